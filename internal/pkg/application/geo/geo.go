@@ -0,0 +1,179 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+const earthRadiusM float64 = 6371000
+
+// metresPerDegree is the length of one degree of latitude
+const metresPerDegree float64 = earthRadiusM * math.Pi / 180
+
+// DistanceInMetres returns the great circle distance between two points
+func DistanceInMetres(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	// clamp to guard against rounding errors for antipodal points
+	a = math.Min(math.Max(a, 0), 1)
+
+	return earthRadiusM * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// Index is a grid of items by location for proximity and bounding box lookups that only
+// need to look at the items in nearby cells. An index is not safe for concurrent
+// modification, so it should be built when the items are refreshed and then replace the
+// previous index. Lookups do not wrap around the antimeridian.
+type Index[T any] struct {
+	cellDegrees float64
+	cells       map[cell][]entry[T]
+	count       int
+}
+
+type cell struct {
+	row int
+	col int
+}
+
+type entry[T any] struct {
+	lat  float64
+	lon  float64
+	seq  int
+	item T
+}
+
+// Match is an item found by a proximity lookup along with its distance in metres from
+// the point of the lookup
+type Match[T any] struct {
+	Item     T
+	Distance float64
+}
+
+// NewIndex returns an empty index with cells that are cellSize metres high. Lookups are
+// fastest when the cell size is close to the typical lookup radius.
+func NewIndex[T any](cellSize float64) *Index[T] {
+	if cellSize <= 0 || math.IsNaN(cellSize) {
+		cellSize = 1000
+	}
+
+	return &Index[T]{
+		cellDegrees: cellSize / metresPerDegree,
+		cells:       map[cell][]entry[T]{},
+	}
+}
+
+// Add inserts an item at the given location
+func (idx *Index[T]) Add(lat, lon float64, item T) {
+	c := idx.cellOf(lat, lon)
+	idx.cells[c] = append(idx.cells[c], entry[T]{lat: lat, lon: lon, seq: idx.count, item: item})
+	idx.count++
+}
+
+// Len returns the number of items in the index
+func (idx *Index[T]) Len() int {
+	return idx.count
+}
+
+// Within returns the items within radius metres from the point, nearest first. Items at
+// the same distance are returned in the order they were added.
+func (idx *Index[T]) Within(lat, lon, radius float64) []Match[T] {
+	type found struct {
+		match Match[T]
+		seq   int
+	}
+
+	candidates := []found{}
+
+	latSpan := radius / metresPerDegree
+	lonSpan := 180.0
+
+	// the longitudes spanned by the radius grow towards the poles, so they are based
+	// on the latitude furthest from the equator
+	if maxLat := math.Abs(lat) + latSpan; maxLat < 90 {
+		lonSpan = math.Min(latSpan/math.Cos(maxLat*math.Pi/180), 180)
+	}
+
+	idx.visit(lat-latSpan, lon-lonSpan, lat+latSpan, lon+lonSpan, func(e entry[T]) {
+		if d := DistanceInMetres(lat, lon, e.lat, e.lon); d <= radius {
+			candidates = append(candidates, found{Match[T]{Item: e.item, Distance: d}, e.seq})
+		}
+	})
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].match.Distance != candidates[j].match.Distance {
+			return candidates[i].match.Distance < candidates[j].match.Distance
+		}
+		return candidates[i].seq < candidates[j].seq
+	})
+
+	matches := make([]Match[T], 0, len(candidates))
+	for _, c := range candidates {
+		matches = append(matches, c.match)
+	}
+
+	return matches
+}
+
+// InBoundingBox returns the items within the bounding box, including its edges, in the
+// order they were added
+func (idx *Index[T]) InBoundingBox(minLat, minLon, maxLat, maxLon float64) []T {
+	found := []entry[T]{}
+
+	idx.visit(minLat, minLon, maxLat, maxLon, func(e entry[T]) {
+		if e.lat >= minLat && e.lat <= maxLat && e.lon >= minLon && e.lon <= maxLon {
+			found = append(found, e)
+		}
+	})
+
+	sort.Slice(found, func(i, j int) bool { return found[i].seq < found[j].seq })
+
+	items := make([]T, 0, len(found))
+	for _, e := range found {
+		items = append(items, e.item)
+	}
+
+	return items
+}
+
+// visit calls fn for every entry in the cells that overlap the bounding box, or for
+// every entry in the index if the box spans more cells than there are occupied cells
+func (idx *Index[T]) visit(minLat, minLon, maxLat, maxLon float64, fn func(entry[T])) {
+	if minLat > maxLat || minLon > maxLon {
+		return
+	}
+
+	lower, upper := idx.cellOf(minLat, minLon), idx.cellOf(maxLat, maxLon)
+
+	rows := float64(upper.row-lower.row) + 1
+	cols := float64(upper.col-lower.col) + 1
+
+	if rows*cols > float64(len(idx.cells)) {
+		for _, entries := range idx.cells {
+			for _, e := range entries {
+				fn(e)
+			}
+		}
+		return
+	}
+
+	for row := lower.row; row <= upper.row; row++ {
+		for col := lower.col; col <= upper.col; col++ {
+			for _, e := range idx.cells[cell{row, col}] {
+				fn(e)
+			}
+		}
+	}
+}
+
+func (idx *Index[T]) cellOf(lat, lon float64) cell {
+	return cell{
+		row: int(math.Floor(lat / idx.cellDegrees)),
+		col: int(math.Floor(lon / idx.cellDegrees)),
+	}
+}
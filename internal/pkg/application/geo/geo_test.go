@@ -0,0 +1,87 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDistanceInMetres(t *testing.T) {
+	is := is.New(t)
+
+	// Sundsvall to Stockholm is roughly 343 km as the crow flies
+	d := DistanceInMetres(62.3908, 17.3069, 59.3293, 18.0686)
+	is.True(math.Abs(d-343000) < 1000)
+
+	is.Equal(DistanceInMetres(62.39, 17.3, 62.39, 17.3), 0.0)
+}
+
+func TestThatWithinFindsTheSameItemsAsAFullScan(t *testing.T) {
+	is := is.New(t)
+
+	type point struct {
+		lat float64
+		lon float64
+	}
+
+	random := rand.New(rand.NewSource(4711))
+	points := []point{}
+
+	idx := NewIndex[int](500)
+
+	for i := 0; i < 2000; i++ {
+		p := point{lat: 62 + random.Float64(), lon: 16.5 + random.Float64()*2}
+		points = append(points, p)
+		idx.Add(p.lat, p.lon, i)
+	}
+
+	is.Equal(idx.Len(), len(points))
+
+	for _, radius := range []float64{50, 500, 2500, 20000, 500000} {
+		lat, lon := 62.39, 17.3
+
+		expected := 0
+		for _, p := range points {
+			if DistanceInMetres(lat, lon, p.lat, p.lon) <= radius {
+				expected++
+			}
+		}
+
+		matches := idx.Within(lat, lon, radius)
+		is.Equal(len(matches), expected) // the index should find every item within the radius
+
+		for i := 1; i < len(matches); i++ {
+			is.True(matches[i-1].Distance <= matches[i].Distance) // matches should be ordered by distance
+		}
+	}
+}
+
+func TestThatItemsAtTheSameDistanceKeepTheirOrder(t *testing.T) {
+	is := is.New(t)
+
+	idx := NewIndex[string](1000)
+	idx.Add(62.39, 17.3, "b")
+	idx.Add(62.39, 17.3, "a")
+	idx.Add(62.40, 17.3, "c")
+
+	matches := idx.Within(62.39, 17.3, 5000)
+	is.Equal(len(matches), 3)
+	is.Equal(matches[0].Item, "b")
+	is.Equal(matches[1].Item, "a")
+	is.Equal(matches[2].Item, "c")
+}
+
+func TestInBoundingBox(t *testing.T) {
+	is := is.New(t)
+
+	idx := NewIndex[string](1000)
+	idx.Add(62.39, 17.30, "inside")
+	idx.Add(62.40, 17.40, "on the edge")
+	idx.Add(62.50, 17.30, "north of the box")
+	idx.Add(62.39, 16.00, "west of the box")
+
+	is.Equal(idx.InBoundingBox(62.30, 17.20, 62.40, 17.40), []string{"inside", "on the edge"})
+	is.Equal(len(idx.InBoundingBox(62.40, 17.40, 62.30, 17.20)), 0) // an inverted box contains nothing
+}
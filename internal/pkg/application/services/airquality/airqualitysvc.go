@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/url"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/temporal"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
-	"github.com/diwise/context-broker/pkg/ngsild"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
 	"github.com/diwise/context-broker/pkg/ngsild/geojson"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
@@ -38,37 +41,98 @@ type AirQualityService interface {
 
 	GetAll(ctx context.Context) []domain.AirQuality
 	GetByID(ctx context.Context, id string) (*domain.AirQualityDetails, error)
-	GetByIDWithTimespan(ctx context.Context, id string, from, to time.Time) (*domain.AirQualityDetails, error)
+	GetByIDWithTimespan(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.AirQualityDetails, error)
+	GetExceedances(ctx context.Context, id string, from, to time.Time) (*domain.AirQualityExceedances, error)
+	GetAllExceedances(ctx context.Context, from, to time.Time) ([]domain.AirQualityExceedances, error)
+
+	StationStatus() []StationStatus
 }
 
 var ErrNoSuchAirQuality error = errors.New("no such air quality")
 
-func NewAirQualityService(ctx context.Context, cbClient client.ContextBrokerClient, ctxBrokerTenant string) AirQualityService {
+var ErrInvalidQuery error = errors.New("invalid query")
+
+// MaxTimespan is the longest time span that the details of a station can be requested for
+const MaxTimespan time.Duration = 31 * 24 * time.Hour
+
+// MaxExceedanceTimespan is the longest time span that exceedances can be computed for. It
+// covers a calendar year, so that the number of exceedances can be compared with the
+// number that is allowed per year.
+const MaxExceedanceTimespan time.Duration = 366 * 24 * time.Hour
+
+// exceedanceBucket is the size of the time slots that the time spans of the exceedances of
+// all stations are rounded outwards to, so that requests for similar time spans share the
+// cached result
+const exceedanceBucket time.Duration = time.Hour
+
+// exceedancesTTL is how long the exceedances of all stations are cached
+const exceedancesTTL time.Duration = 15 * time.Minute
+
+// maxCachedExceedances limits the number of time spans whose exceedances are cached at
+// the same time
+const maxCachedExceedances int = 20
+
+// maxConcurrentRequests limits the number of stations whose details are retrieved at
+// the same time
+const maxConcurrentRequests int = 4
+
+const (
+	StationStatusOK     string = "ok"
+	StationStatusFailed string = "failed"
+)
+
+// StationStatus is the outcome of the latest attempt to refresh the details of a station.
+// LastUpdated is the time of the latest successful refresh.
+type StationStatus struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+func NewAirQualityService(ctx context.Context, cbClient client.ContextBrokerClient, ctxBrokerTenant string, catalogue Catalogue, limits []LimitValue) AirQualityService {
 	return &aqsvc{
-		cbClient: cbClient,
-		tenant:   ctxBrokerTenant,
+		cbClient:  cbClient,
+		tenant:    ctxBrokerTenant,
+		catalogue: catalogue,
+		limits:    limits,
 
 		airQualities:   []domain.AirQuality{},
 		airQualityByID: map[string]domain.AirQualityDetails{},
 
-		queue:       make(chan func()),
-		keepRunning: &atomic.Bool{},
+		queue:         make(chan func()),
+		stationStatus: map[string]StationStatus{},
+		exceedances:   map[string]cachedExceedances{},
+		keepRunning:   &atomic.Bool{},
 	}
 }
 
 type aqsvc struct {
-	cbClient client.ContextBrokerClient
-	tenant   string
+	cbClient  client.ContextBrokerClient
+	tenant    string
+	catalogue Catalogue
+	limits    []LimitValue
 
 	airQualities   []domain.AirQuality
 	airQualityByID map[string]domain.AirQualityDetails
 
 	queue chan func()
 
+	statusMutex   sync.Mutex
+	stationStatus map[string]StationStatus
+
+	exceedancesMutex sync.Mutex
+	exceedances      map[string]cachedExceedances
+
 	keepRunning *atomic.Bool
 	wg          sync.WaitGroup
 }
 
+type cachedExceedances struct {
+	exceedances []domain.AirQualityExceedances
+	computedAt  time.Time
+}
+
 /*func (svc *aqsvc) Broker() string {
 	return svc.cbClient
 }*/
@@ -108,29 +172,222 @@ func (svc *aqsvc) GetByID(ctx context.Context, id string) (*domain.AirQualityDet
 	}
 }
 
-func (svc *aqsvc) GetByIDWithTimespan(ctx context.Context, id string, from, to time.Time) (*domain.AirQualityDetails, error) {
+// GetByIDWithTimespan retrieves the measurements of a station between from and to,
+// along with statistics per pollutant. With a resolution of timeseries.Hour or
+// timeseries.Day the values are averaged per hour or day.
+func (svc *aqsvc) GetByIDWithTimespan(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.AirQualityDetails, error) {
+	if resolution != "" && resolution != timeseries.Hour && resolution != timeseries.Day {
+		return nil, fmt.Errorf("%w: values can only be aggregated by hour or day", ErrInvalidQuery)
+	}
+
+	if err := validateTimespan(from, to, MaxTimespan); err != nil {
+		return nil, err
+	}
+
+	aq, err := svc.retrievePollutants(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range aq.Pollutants {
+		aq.Pollutants[i].Statistics = statisticsOf(aq.Pollutants[i].Values)
+
+		if resolution != "" {
+			aq.Pollutants[i].Values = aggregateValues(aq.Pollutants[i].Values, resolution)
+		}
+	}
+
+	return aq, nil
+}
+
+// retrievePollutants returns the latest observation of a station along with the values of
+// its pollutants between from and to, as retrieved from the broker
+func (svc *aqsvc) retrievePollutants(ctx context.Context, id string, from, to time.Time) (*domain.AirQualityDetails, error) {
 	logger := logging.GetFromContext(ctx)
 
+	station, err := svc.station(id)
+	if err != nil {
+		return nil, err
+	}
+
 	headers := map[string][]string{
 		"Accept": {"application/ld+json"},
 		"Link":   {entities.LinkHeader},
 	}
 
-	aq := &domain.AirQualityDetails{}
-	aq.ID = id
-	aq.Location = svc.airQualityByID[id].Location
+	aq := &domain.AirQualityDetails{
+		ID:           id,
+		Location:     station.Location,
+		DateObserved: station.DateObserved,
+	}
 
-	t, err := svc.cbClient.RetrieveTemporalEvolutionOfEntity(ctx, id, headers, client.Between(from, to))
-	if err != nil || t.Found == nil {
+	t, err := temporal.Retrieve(ctx, svc.cbClient, id, headers, from, to, measuredProperties(station, svc.catalogue))
+	if err != nil {
 		logger.Error(fmt.Sprintf("failed to retrieve temporal evolution of air quality with id %s and within timespan %s-%s", id, from.Format(time.RFC3339), to.Format(time.RFC3339)), "err", err.Error())
 		return nil, err
 	}
 
-	aq.Pollutants = getPollutantsFromFoundProperties(t)
+	aq.Pollutants = getPollutantsFromFoundProperties(t, measuredProperties(station, svc.catalogue), svc.catalogue)
 
 	return aq, nil
 }
 
+// validateTimespan checks that the time span does not end before it starts and is no
+// longer than maxTimespan
+func validateTimespan(from, to time.Time, maxTimespan time.Duration) error {
+	if to.Before(from) {
+		return fmt.Errorf("%w: the time span must not end before it starts", ErrInvalidQuery)
+	}
+
+	if to.Sub(from) > maxTimespan {
+		return fmt.Errorf("%w: the time span must not be longer than %d days", ErrInvalidQuery, int(maxTimespan.Hours()/24))
+	}
+
+	return nil
+}
+
+// station returns the latest observation of the station with the given id
+func (svc *aqsvc) station(id string) (domain.AirQuality, error) {
+	result := make(chan domain.AirQuality)
+	err := make(chan error)
+
+	svc.queue <- func() {
+		for _, aq := range svc.airQualities {
+			if aq.ID == id {
+				result <- aq
+				return
+			}
+		}
+		err <- ErrNoSuchAirQuality
+	}
+
+	select {
+	case r := <-result:
+		return r, nil
+	case e := <-err:
+		return domain.AirQuality{}, e
+	}
+}
+
+// GetExceedances computes the exceedances of a station between from and to, which may be
+// up to MaxExceedanceTimespan apart
+func (svc *aqsvc) GetExceedances(ctx context.Context, id string, from, to time.Time) (*domain.AirQualityExceedances, error) {
+	if err := validateTimespan(from, to, MaxExceedanceTimespan); err != nil {
+		return nil, err
+	}
+
+	aq, err := svc.retrievePollutants(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AirQualityExceedances{
+		ID:          id,
+		From:        from,
+		To:          to,
+		LimitValues: computeExceedances(aq.Pollutants, svc.limits),
+	}, nil
+}
+
+// GetAllExceedances computes the exceedances of every station between from and to, which
+// are rounded outwards to whole hours. The stations are retrieved with at most
+// maxConcurrentRequests concurrent requests and the result is cached per time span. Only
+// an invalid time span fails the whole request, while stations whose values can not be
+// retrieved are included with an error and without limit values.
+func (svc *aqsvc) GetAllExceedances(ctx context.Context, from, to time.Time) ([]domain.AirQualityExceedances, error) {
+	if err := validateTimespan(from, to, MaxExceedanceTimespan); err != nil {
+		return nil, err
+	}
+
+	from = from.Truncate(exceedanceBucket)
+	if rounded := to.Truncate(exceedanceBucket); rounded.Before(to) {
+		to = rounded.Add(exceedanceBucket)
+	}
+
+	key := from.Format(time.RFC3339) + "|" + to.Format(time.RFC3339)
+	now := time.Now()
+
+	svc.exceedancesMutex.Lock()
+	cached, ok := svc.exceedances[key]
+	svc.exceedancesMutex.Unlock()
+
+	if ok && now.Sub(cached.computedAt) < exceedancesTTL {
+		return cached.exceedances, nil
+	}
+
+	logger := logging.GetFromContext(ctx)
+
+	stations := svc.GetAll(ctx)
+	exceedances := make([]domain.AirQualityExceedances, len(stations))
+	semaphore := make(chan struct{}, maxConcurrentRequests)
+	wg := sync.WaitGroup{}
+
+	for i, aq := range stations {
+		wg.Add(1)
+
+		go func(i int, id string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			e, err := svc.GetExceedances(ctx, id, from, to)
+			if err != nil {
+				// a station that fails is reported as such, instead of failing the others
+				logger.Error("failed to compute exceedances", "id", id, "err", err.Error())
+
+				exceedances[i] = domain.AirQualityExceedances{
+					ID:          id,
+					From:        from,
+					To:          to,
+					LimitValues: []domain.LimitValueResult{},
+					Error:       "failed to retrieve the values of the station",
+				}
+				return
+			}
+
+			exceedances[i] = *e
+		}(i, aq.ID)
+	}
+
+	wg.Wait()
+
+	svc.exceedancesMutex.Lock()
+	defer svc.exceedancesMutex.Unlock()
+
+	svc.evictExceedances(now)
+	svc.exceedances[key] = cachedExceedances{exceedances: exceedances, computedAt: now}
+
+	return exceedances, nil
+}
+
+// evictExceedances removes the expired exceedances from the cache, along with the oldest
+// ones if there is no room for another time span. It must be called with the mutex held.
+func (svc *aqsvc) evictExceedances(now time.Time) {
+	for k, c := range svc.exceedances {
+		if now.Sub(c.computedAt) >= exceedancesTTL {
+			delete(svc.exceedances, k)
+		}
+	}
+
+	if len(svc.exceedances) < maxCachedExceedances {
+		return
+	}
+
+	keys := make([]string, 0, len(svc.exceedances))
+	for k := range svc.exceedances {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return svc.exceedances[keys[i]].computedAt.Before(svc.exceedances[keys[j]].computedAt)
+	})
+
+	for _, k := range keys[:len(keys)-maxCachedExceedances+1] {
+		delete(svc.exceedances, k)
+	}
+}
+
 func (svc *aqsvc) Refresh(ctx context.Context) (int, error) {
 	refreshDone := make(chan int)
 	refreshFailed := make(chan error)
@@ -243,7 +500,7 @@ func (svc *aqsvc) refresh(ctx context.Context) (count int, err error) {
 			break
 		}
 
-		airqualities = append(airqualities, toAirQuality(airquality))
+		airqualities = append(airqualities, toAirQuality(airquality, svc.catalogue))
 	}
 
 	svc.airQualities = airqualities
@@ -281,13 +538,38 @@ const (
 	NOPropertyName                        string = "NO"
 	NO2PropertyName                       string = "NO2"
 	NOxPropertyName                       string = "NOx"
+	O3PropertyName                        string = "O3"
+	SO2PropertyName                       string = "SO2"
+	C6H6PropertyName                      string = "C6H6"
 	VoltagePropertyName                   string = "voltage"
 	WindDirectionPropertyName             string = "windDirection"
 	WindSpeedPropertyName                 string = "windSpeed"
 	DateObservedPropertyName              string = "dateObserved"
 )
 
-func toAirQuality(n types.Entity) domain.AirQuality {
+// airQualityFields maps the properties that have a field of their own in
+// domain.AirQuality to that field
+var airQualityFields = map[string]func(*domain.AirQuality) **float64{
+	AtmosphericPressurePropertyName:       func(aq *domain.AirQuality) **float64 { return &aq.AtmosphericPressure },
+	TemperaturePropertyName:               func(aq *domain.AirQuality) **float64 { return &aq.Temperature },
+	RelativeHumidityPropertyName:          func(aq *domain.AirQuality) **float64 { return &aq.RelativeHumidity },
+	ParticleCountPropertyName:             func(aq *domain.AirQuality) **float64 { return &aq.ParticleCount },
+	PM1PropertyName:                       func(aq *domain.AirQuality) **float64 { return &aq.PM1 },
+	PM4PropertyName:                       func(aq *domain.AirQuality) **float64 { return &aq.PM4 },
+	PM10PropertyName:                      func(aq *domain.AirQuality) **float64 { return &aq.PM10 },
+	PM25PropertyName:                      func(aq *domain.AirQuality) **float64 { return &aq.PM25 },
+	TotalSuspendedParticulatePropertyName: func(aq *domain.AirQuality) **float64 { return &aq.TotalSuspendedParticulate },
+	CO2PropertyName:                       func(aq *domain.AirQuality) **float64 { return &aq.CO2 },
+	NOPropertyName:                        func(aq *domain.AirQuality) **float64 { return &aq.NO },
+	NO2PropertyName:                       func(aq *domain.AirQuality) **float64 { return &aq.NO2 },
+	NOxPropertyName:                       func(aq *domain.AirQuality) **float64 { return &aq.NOx },
+	O3PropertyName:                        func(aq *domain.AirQuality) **float64 { return &aq.O3 },
+	VoltagePropertyName:                   func(aq *domain.AirQuality) **float64 { return &aq.Voltage },
+	WindDirectionPropertyName:             func(aq *domain.AirQuality) **float64 { return &aq.WindDirection },
+	WindSpeedPropertyName:                 func(aq *domain.AirQuality) **float64 { return &aq.WindSpeed },
+}
+
+func toAirQuality(n types.Entity, catalogue Catalogue) domain.AirQuality {
 	airquality := domain.AirQuality{}
 	airquality.ID = n.ID()
 
@@ -302,148 +584,249 @@ func toAirQuality(n types.Entity) domain.AirQuality {
 			point := p.GetAsPoint()
 			airquality.Location.Coordinates = point.Coordinates[:]
 			airquality.Location.Type = p.GeoPropertyType()
-		case AtmosphericPressurePropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.AtmosphericPressure = &p.Val
-		case TemperaturePropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.Temperature = &p.Val
-		case RelativeHumidityPropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.RelativeHumidity = &p.Val
-		case ParticleCountPropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.ParticleCount = &p.Val
-		case PM1PropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.PM1 = &p.Val
-		case PM4PropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.PM4 = &p.Val
-		case PM10PropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.PM10 = &p.Val
-		case PM25PropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.PM25 = &p.Val
-		case TotalSuspendedParticulatePropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.TotalSuspendedParticulate = &p.Val
-		case CO2PropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.CO2 = &p.Val
-		case NOPropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.NO = &p.Val
-		case NO2PropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.NO2 = &p.Val
-		case NOxPropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.NOx = &p.Val
-		case VoltagePropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.Voltage = &p.Val
-		case WindDirectionPropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.WindDirection = &p.Val
-		case WindSpeedPropertyName:
-			p := contents.(*properties.NumberProperty)
-			airquality.WindSpeed = &p.Val
+		default:
+			p, ok := contents.(*properties.NumberProperty)
+			if !ok {
+				return
+			}
+
+			value, ok := catalogue.entry(attributeName).normalise(p.Val)
+			if !ok {
+				return
+			}
+
+			if field, ok := airQualityFields[attributeName]; ok {
+				*field(&airquality) = &value
+				return
+			}
+
+			if airquality.Other == nil {
+				airquality.Other = map[string]float64{}
+			}
+			airquality.Other[attributeName] = value
 		}
 	})
 
 	return airquality
 }
 
+// getDetails retrieves the last 24 hours of measurements of every station, using at
+// most maxConcurrentRequests concurrent requests. A station that fails keeps its last
+// good details, and the errors of all failing stations are joined and returned.
 func (svc *aqsvc) getDetails(ctx context.Context, c client.ContextBrokerClient, headers map[string][]string) error {
 	logger := logging.GetFromContext(ctx)
 
-	for _, aqo := range svc.airQualities {
-		details := domain.AirQualityDetails{}
+	type result struct {
+		details domain.AirQualityDetails
+		err     error
+	}
 
-		details.ID = aqo.ID
-		details.DateObserved = aqo.DateObserved
-		details.Location = aqo.Location
+	results := make([]result, len(svc.airQualities))
+	semaphore := make(chan struct{}, maxConcurrentRequests)
+	wg := sync.WaitGroup{}
 
-		t, err := c.RetrieveTemporalEvolutionOfEntity(ctx, aqo.ID, headers, client.Between(time.Now().Add(-24*time.Hour), time.Now()))
-		if err != nil || t.Found == nil {
-			logger.Error(fmt.Sprintf("failed to retrieve temporal evolution of air quality with id: %s", aqo.ID), "err", err.Error())
-			return err
-		}
+	for i, aqo := range svc.airQualities {
+		wg.Add(1)
+
+		go func(i int, aqo domain.AirQuality) {
+			defer wg.Done()
 
-		details.Pollutants = getPollutantsFromFoundProperties(t)
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
 
-		svc.airQualityByID[aqo.ID] = details
+			details, err := svc.retrieveDetails(ctx, c, headers, aqo)
+			results[i] = result{details: details, err: err}
+		}(i, aqo)
 	}
 
-	return nil
-}
+	wg.Wait()
 
-func getPollutantsFromFoundProperties(t *ngsild.RetrieveTemporalEvolutionOfEntityResult) (pollutants []domain.Pollutant) {
-	if len(t.Found.Property(AtmosphericPressurePropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("AtmosphericPressure", t.Found.Property(AtmosphericPressurePropertyName)))
-	}
-	if len(t.Found.Property(TemperaturePropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("Temperature", t.Found.Property(TemperaturePropertyName)))
-	}
-	if len(t.Found.Property(RelativeHumidityPropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("RelativeHumidity", t.Found.Property(RelativeHumidityPropertyName)))
-	}
-	if len(t.Found.Property(ParticleCountPropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("ParticleCount", t.Found.Property(ParticleCountPropertyName)))
+	now := time.Now().UTC()
+	statuses := map[string]StationStatus{}
+	errs := []error{}
+
+	svc.statusMutex.Lock()
+	defer svc.statusMutex.Unlock()
+
+	for i, r := range results {
+		id := svc.airQualities[i].ID
+		status := svc.stationStatus[id]
+		status.ID = id
+
+		if r.err != nil {
+			logger.Error("failed to retrieve air quality details", "id", id, "err", r.err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", id, r.err))
+
+			status.Status = StationStatusFailed
+			status.Error = r.err.Error()
+
+			if previous, ok := svc.airQualityByID[id]; ok {
+				svc.airQualities[i].Index = previous.Index
+			}
+		} else {
+			status.Status = StationStatusOK
+			status.Error = ""
+			status.LastUpdated = &now
+
+			svc.airQualities[i].Index = r.details.Index
+			svc.airQualityByID[id] = r.details
+		}
+
+		statuses[id] = status
 	}
-	if len(t.Found.Property(PM1PropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("PM1", t.Found.Property(PM1PropertyName)))
+
+	svc.stationStatus = statuses
+
+	return errors.Join(errs...)
+}
+
+func (svc *aqsvc) retrieveDetails(ctx context.Context, c client.ContextBrokerClient, headers map[string][]string, aqo domain.AirQuality) (domain.AirQualityDetails, error) {
+	details := domain.AirQualityDetails{
+		ID:           aqo.ID,
+		DateObserved: aqo.DateObserved,
+		Location:     aqo.Location,
 	}
-	if len(t.Found.Property(PM4PropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("PM4", t.Found.Property(PM4PropertyName)))
+
+	t, err := temporal.Retrieve(ctx, c, aqo.ID, headers, time.Now().Add(-24*time.Hour), time.Now(), measuredProperties(aqo, svc.catalogue))
+	if err != nil {
+		return details, fmt.Errorf("failed to retrieve temporal evolution: %w", err)
 	}
-	if len(t.Found.Property(PM10PropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("PM10", t.Found.Property(PM10PropertyName)))
+
+	details.Pollutants = getPollutantsFromFoundProperties(t, measuredProperties(aqo, svc.catalogue), svc.catalogue)
+	details.Index = computeEAQI(details.Pollutants, time.Now())
+
+	return details, nil
+}
+
+// StationStatus returns the outcome of the latest refresh of the details of each
+// station, sorted by id
+func (svc *aqsvc) StationStatus() []StationStatus {
+	svc.statusMutex.Lock()
+	defer svc.statusMutex.Unlock()
+
+	statuses := make([]StationStatus, 0, len(svc.stationStatus))
+	for _, s := range svc.stationStatus {
+		statuses = append(statuses, s)
 	}
-	if len(t.Found.Property(PM25PropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("PM25", t.Found.Property(PM25PropertyName)))
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+
+	return statuses
+}
+
+// measuredProperties returns the names of the properties in the catalogue followed by
+// the names of any other numeric properties of the air quality station, sorted by name
+func measuredProperties(aq domain.AirQuality, catalogue Catalogue) []string {
+	names := make([]string, 0, len(catalogue)+len(aq.Other))
+	for _, e := range catalogue {
+		names = append(names, e.Property)
 	}
-	if len(t.Found.Property(TotalSuspendedParticulatePropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("TotalSuspendedParticulate", t.Found.Property(TotalSuspendedParticulatePropertyName)))
+
+	unknown := []string{}
+	for name := range aq.Other {
+		if _, ok := catalogue.indexOf(name); !ok {
+			unknown = append(unknown, name)
+		}
 	}
-	if len(t.Found.Property(CO2PropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("CO2", t.Found.Property(CO2PropertyName)))
+	sort.Strings(unknown)
+
+	return append(names, unknown...)
+}
+
+func getPollutantsFromFoundProperties(t types.EntityTemporal, names []string, catalogue Catalogue) (pollutants []domain.Pollutant) {
+	for _, name := range names {
+		values := t.Property(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		pollutant := addPollutant(catalogue.entry(name), values)
+		if len(pollutant.Values) > 0 {
+			pollutants = append(pollutants, pollutant)
+		}
 	}
-	if len(t.Found.Property(NOPropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("NO", t.Found.Property(NOPropertyName)))
+
+	return
+}
+
+func addPollutant(entry CatalogueEntry, temporal []types.TemporalProperty) domain.Pollutant {
+	aqi := domain.Pollutant{
+		Property: entry.Property,
+		Name:     entry.Name,
+		Unit:     entry.Unit,
 	}
-	if len(t.Found.Property(NO2PropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("NO2", t.Found.Property(NO2PropertyName)))
+
+	for _, v := range temporal {
+		f, ok := v.Value().(float64)
+		if !ok {
+			continue
+		}
+
+		value, ok := entry.normalise(f)
+		if !ok {
+			continue
+		}
+
+		aqi.Values = append(aqi.Values, domain.Value{
+			Value:      value,
+			ObservedAt: v.ObservedAt(),
+		})
 	}
-	if len(t.Found.Property(NOxPropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("NOx", t.Found.Property(NOxPropertyName)))
+
+	return aqi
+}
+
+func statisticsOf(values []domain.Value) *domain.PollutantStatistics {
+	samples := toSamples(values)
+	if len(samples) == 0 {
+		return nil
 	}
-	if len(t.Found.Property(WindDirectionPropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("WindDirection", t.Found.Property(WindDirectionPropertyName)))
+
+	b := timeseries.Summarise(samples)
+
+	return &domain.PollutantStatistics{
+		Average: round(b.Average),
+		Min:     b.Min,
+		Max:     b.Max,
+		Median:  round(b.Median),
+		Count:   b.Count,
 	}
-	if len(t.Found.Property(WindSpeedPropertyName)) > 0 {
-		pollutants = append(pollutants, addPollutant("WindSpeed", t.Found.Property(WindSpeedPropertyName)))
+}
+
+// aggregateValues replaces the values with their average per hour or day, with days in
+// local time
+func aggregateValues(values []domain.Value, resolution timeseries.Resolution) []domain.Value {
+	buckets := timeseries.Aggregate(toSamples(values), resolution, timeseries.DefaultLocation)
+	aggregated := make([]domain.Value, 0, len(buckets))
+
+	for _, b := range buckets {
+		minimum, maximum := b.Min, b.Max
+		aggregated = append(aggregated, domain.Value{
+			Value:      round(b.Average),
+			ObservedAt: b.Start.Format(time.RFC3339),
+			Min:        &minimum,
+			Max:        &maximum,
+			Count:      b.Count,
+		})
 	}
 
-	return
+	return aggregated
 }
 
-func addPollutant(name string, temporal []types.TemporalProperty) domain.Pollutant {
-	aqi := domain.Pollutant{
-		Name: name,
-	}
+func toSamples(values []domain.Value) []timeseries.Sample {
+	samples := make([]timeseries.Sample, 0, len(values))
 
-	if len(temporal) > 0 {
-		for _, v := range temporal {
-			aqi.Values = append(aqi.Values, domain.Value{
-				Value:      v.Value().(float64),
-				ObservedAt: v.ObservedAt(),
-			})
+	for _, v := range values {
+		at, err := time.Parse(time.RFC3339, v.ObservedAt)
+		if err != nil {
+			continue
 		}
-		return aqi
+		samples = append(samples, timeseries.Sample{At: at, Value: v.Value})
 	}
 
-	return aqi
+	return samples
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
 }
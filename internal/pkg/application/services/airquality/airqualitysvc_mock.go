@@ -5,6 +5,7 @@ package airquality
 
 import (
 	"context"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"sync"
 	"time"
@@ -16,46 +17,61 @@ var _ AirQualityService = &AirQualityServiceMock{}
 
 // AirQualityServiceMock is a mock implementation of AirQualityService.
 //
-// 	func TestSomethingThatUsesAirQualityService(t *testing.T) {
+//	func TestSomethingThatUsesAirQualityService(t *testing.T) {
 //
-// 		// make and configure a mocked AirQualityService
-// 		mockedAirQualityService := &AirQualityServiceMock{
-// 			GetAllFunc: func(ctx context.Context) []domain.AirQuality {
-// 				panic("mock out the GetAll method")
-// 			},
-// 			GetByIDFunc: func(ctx context.Context, id string) (*domain.AirQualityDetails, error) {
-// 				panic("mock out the GetByID method")
-// 			},
-// 			GetByIDWithTimespanFunc: func(ctx context.Context, id string, from time.Time, to time.Time) (*domain.AirQualityDetails, error) {
-// 				panic("mock out the GetByIDWithTimespan method")
-// 			},
-// 			RefreshFunc: func(ctx context.Context) (int, error) {
-// 				panic("mock out the Refresh method")
-// 			},
-// 			ShutdownFunc: func(ctx context.Context)  {
-// 				panic("mock out the Shutdown method")
-// 			},
-// 			StartFunc: func(ctx context.Context)  {
-// 				panic("mock out the Start method")
-// 			},
-// 			TenantFunc: func() string {
-// 				panic("mock out the Tenant method")
-// 			},
-// 		}
+//		// make and configure a mocked AirQualityService
+//		mockedAirQualityService := &AirQualityServiceMock{
+//			GetAllFunc: func(ctx context.Context) []domain.AirQuality {
+//				panic("mock out the GetAll method")
+//			},
+//			GetAllExceedancesFunc: func(ctx context.Context, from time.Time, to time.Time) ([]domain.AirQualityExceedances, error) {
+//				panic("mock out the GetAllExceedances method")
+//			},
+//			GetByIDFunc: func(ctx context.Context, id string) (*domain.AirQualityDetails, error) {
+//				panic("mock out the GetByID method")
+//			},
+//			GetByIDWithTimespanFunc: func(ctx context.Context, id string, from time.Time, to time.Time, resolution timeseries.Resolution) (*domain.AirQualityDetails, error) {
+//				panic("mock out the GetByIDWithTimespan method")
+//			},
+//			GetExceedancesFunc: func(ctx context.Context, id string, from time.Time, to time.Time) (*domain.AirQualityExceedances, error) {
+//				panic("mock out the GetExceedances method")
+//			},
+//			RefreshFunc: func(ctx context.Context) (int, error) {
+//				panic("mock out the Refresh method")
+//			},
+//			ShutdownFunc: func(ctx context.Context)  {
+//				panic("mock out the Shutdown method")
+//			},
+//			StartFunc: func(ctx context.Context)  {
+//				panic("mock out the Start method")
+//			},
+//			StationStatusFunc: func() []StationStatus {
+//				panic("mock out the StationStatus method")
+//			},
+//			TenantFunc: func() string {
+//				panic("mock out the Tenant method")
+//			},
+//		}
 //
-// 		// use mockedAirQualityService in code that requires AirQualityService
-// 		// and then make assertions.
+//		// use mockedAirQualityService in code that requires AirQualityService
+//		// and then make assertions.
 //
-// 	}
+//	}
 type AirQualityServiceMock struct {
 	// GetAllFunc mocks the GetAll method.
 	GetAllFunc func(ctx context.Context) []domain.AirQuality
 
+	// GetAllExceedancesFunc mocks the GetAllExceedances method.
+	GetAllExceedancesFunc func(ctx context.Context, from time.Time, to time.Time) ([]domain.AirQualityExceedances, error)
+
 	// GetByIDFunc mocks the GetByID method.
 	GetByIDFunc func(ctx context.Context, id string) (*domain.AirQualityDetails, error)
 
 	// GetByIDWithTimespanFunc mocks the GetByIDWithTimespan method.
-	GetByIDWithTimespanFunc func(ctx context.Context, id string, from time.Time, to time.Time) (*domain.AirQualityDetails, error)
+	GetByIDWithTimespanFunc func(ctx context.Context, id string, from time.Time, to time.Time, resolution timeseries.Resolution) (*domain.AirQualityDetails, error)
+
+	// GetExceedancesFunc mocks the GetExceedances method.
+	GetExceedancesFunc func(ctx context.Context, id string, from time.Time, to time.Time) (*domain.AirQualityExceedances, error)
 
 	// RefreshFunc mocks the Refresh method.
 	RefreshFunc func(ctx context.Context) (int, error)
@@ -66,6 +82,9 @@ type AirQualityServiceMock struct {
 	// StartFunc mocks the Start method.
 	StartFunc func(ctx context.Context)
 
+	// StationStatusFunc mocks the StationStatus method.
+	StationStatusFunc func() []StationStatus
+
 	// TenantFunc mocks the Tenant method.
 	TenantFunc func() string
 
@@ -76,6 +95,15 @@ type AirQualityServiceMock struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
 		}
+		// GetAllExceedances holds details about calls to the GetAllExceedances method.
+		GetAllExceedances []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// From is the from argument value.
+			From time.Time
+			// To is the to argument value.
+			To time.Time
+		}
 		// GetByID holds details about calls to the GetByID method.
 		GetByID []struct {
 			// Ctx is the ctx argument value.
@@ -93,6 +121,19 @@ type AirQualityServiceMock struct {
 			From time.Time
 			// To is the to argument value.
 			To time.Time
+			// Resolution is the resolution argument value.
+			Resolution timeseries.Resolution
+		}
+		// GetExceedances holds details about calls to the GetExceedances method.
+		GetExceedances []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ID is the id argument value.
+			ID string
+			// From is the from argument value.
+			From time.Time
+			// To is the to argument value.
+			To time.Time
 		}
 		// Refresh holds details about calls to the Refresh method.
 		Refresh []struct {
@@ -109,16 +150,22 @@ type AirQualityServiceMock struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
 		}
+		// StationStatus holds details about calls to the StationStatus method.
+		StationStatus []struct {
+		}
 		// Tenant holds details about calls to the Tenant method.
 		Tenant []struct {
 		}
 	}
 	lockGetAll              sync.RWMutex
+	lockGetAllExceedances   sync.RWMutex
 	lockGetByID             sync.RWMutex
 	lockGetByIDWithTimespan sync.RWMutex
+	lockGetExceedances      sync.RWMutex
 	lockRefresh             sync.RWMutex
 	lockShutdown            sync.RWMutex
 	lockStart               sync.RWMutex
+	lockStationStatus       sync.RWMutex
 	lockTenant              sync.RWMutex
 }
 
@@ -140,7 +187,8 @@ func (mock *AirQualityServiceMock) GetAll(ctx context.Context) []domain.AirQuali
 
 // GetAllCalls gets all the calls that were made to GetAll.
 // Check the length with:
-//     len(mockedAirQualityService.GetAllCalls())
+//
+//	len(mockedAirQualityService.GetAllCalls())
 func (mock *AirQualityServiceMock) GetAllCalls() []struct {
 	Ctx context.Context
 } {
@@ -153,6 +201,46 @@ func (mock *AirQualityServiceMock) GetAllCalls() []struct {
 	return calls
 }
 
+// GetAllExceedances calls GetAllExceedancesFunc.
+func (mock *AirQualityServiceMock) GetAllExceedances(ctx context.Context, from time.Time, to time.Time) ([]domain.AirQualityExceedances, error) {
+	if mock.GetAllExceedancesFunc == nil {
+		panic("AirQualityServiceMock.GetAllExceedancesFunc: method is nil but AirQualityService.GetAllExceedances was just called")
+	}
+	callInfo := struct {
+		Ctx  context.Context
+		From time.Time
+		To   time.Time
+	}{
+		Ctx:  ctx,
+		From: from,
+		To:   to,
+	}
+	mock.lockGetAllExceedances.Lock()
+	mock.calls.GetAllExceedances = append(mock.calls.GetAllExceedances, callInfo)
+	mock.lockGetAllExceedances.Unlock()
+	return mock.GetAllExceedancesFunc(ctx, from, to)
+}
+
+// GetAllExceedancesCalls gets all the calls that were made to GetAllExceedances.
+// Check the length with:
+//
+//	len(mockedAirQualityService.GetAllExceedancesCalls())
+func (mock *AirQualityServiceMock) GetAllExceedancesCalls() []struct {
+	Ctx  context.Context
+	From time.Time
+	To   time.Time
+} {
+	var calls []struct {
+		Ctx  context.Context
+		From time.Time
+		To   time.Time
+	}
+	mock.lockGetAllExceedances.RLock()
+	calls = mock.calls.GetAllExceedances
+	mock.lockGetAllExceedances.RUnlock()
+	return calls
+}
+
 // GetByID calls GetByIDFunc.
 func (mock *AirQualityServiceMock) GetByID(ctx context.Context, id string) (*domain.AirQualityDetails, error) {
 	if mock.GetByIDFunc == nil {
@@ -173,7 +261,8 @@ func (mock *AirQualityServiceMock) GetByID(ctx context.Context, id string) (*dom
 
 // GetByIDCalls gets all the calls that were made to GetByID.
 // Check the length with:
-//     len(mockedAirQualityService.GetByIDCalls())
+//
+//	len(mockedAirQualityService.GetByIDCalls())
 func (mock *AirQualityServiceMock) GetByIDCalls() []struct {
 	Ctx context.Context
 	ID  string
@@ -189,10 +278,58 @@ func (mock *AirQualityServiceMock) GetByIDCalls() []struct {
 }
 
 // GetByIDWithTimespan calls GetByIDWithTimespanFunc.
-func (mock *AirQualityServiceMock) GetByIDWithTimespan(ctx context.Context, id string, from time.Time, to time.Time) (*domain.AirQualityDetails, error) {
+func (mock *AirQualityServiceMock) GetByIDWithTimespan(ctx context.Context, id string, from time.Time, to time.Time, resolution timeseries.Resolution) (*domain.AirQualityDetails, error) {
 	if mock.GetByIDWithTimespanFunc == nil {
 		panic("AirQualityServiceMock.GetByIDWithTimespanFunc: method is nil but AirQualityService.GetByIDWithTimespan was just called")
 	}
+	callInfo := struct {
+		Ctx        context.Context
+		ID         string
+		From       time.Time
+		To         time.Time
+		Resolution timeseries.Resolution
+	}{
+		Ctx:        ctx,
+		ID:         id,
+		From:       from,
+		To:         to,
+		Resolution: resolution,
+	}
+	mock.lockGetByIDWithTimespan.Lock()
+	mock.calls.GetByIDWithTimespan = append(mock.calls.GetByIDWithTimespan, callInfo)
+	mock.lockGetByIDWithTimespan.Unlock()
+	return mock.GetByIDWithTimespanFunc(ctx, id, from, to, resolution)
+}
+
+// GetByIDWithTimespanCalls gets all the calls that were made to GetByIDWithTimespan.
+// Check the length with:
+//
+//	len(mockedAirQualityService.GetByIDWithTimespanCalls())
+func (mock *AirQualityServiceMock) GetByIDWithTimespanCalls() []struct {
+	Ctx        context.Context
+	ID         string
+	From       time.Time
+	To         time.Time
+	Resolution timeseries.Resolution
+} {
+	var calls []struct {
+		Ctx        context.Context
+		ID         string
+		From       time.Time
+		To         time.Time
+		Resolution timeseries.Resolution
+	}
+	mock.lockGetByIDWithTimespan.RLock()
+	calls = mock.calls.GetByIDWithTimespan
+	mock.lockGetByIDWithTimespan.RUnlock()
+	return calls
+}
+
+// GetExceedances calls GetExceedancesFunc.
+func (mock *AirQualityServiceMock) GetExceedances(ctx context.Context, id string, from time.Time, to time.Time) (*domain.AirQualityExceedances, error) {
+	if mock.GetExceedancesFunc == nil {
+		panic("AirQualityServiceMock.GetExceedancesFunc: method is nil but AirQualityService.GetExceedances was just called")
+	}
 	callInfo := struct {
 		Ctx  context.Context
 		ID   string
@@ -204,16 +341,17 @@ func (mock *AirQualityServiceMock) GetByIDWithTimespan(ctx context.Context, id s
 		From: from,
 		To:   to,
 	}
-	mock.lockGetByIDWithTimespan.Lock()
-	mock.calls.GetByIDWithTimespan = append(mock.calls.GetByIDWithTimespan, callInfo)
-	mock.lockGetByIDWithTimespan.Unlock()
-	return mock.GetByIDWithTimespanFunc(ctx, id, from, to)
+	mock.lockGetExceedances.Lock()
+	mock.calls.GetExceedances = append(mock.calls.GetExceedances, callInfo)
+	mock.lockGetExceedances.Unlock()
+	return mock.GetExceedancesFunc(ctx, id, from, to)
 }
 
-// GetByIDWithTimespanCalls gets all the calls that were made to GetByIDWithTimespan.
+// GetExceedancesCalls gets all the calls that were made to GetExceedances.
 // Check the length with:
-//     len(mockedAirQualityService.GetByIDWithTimespanCalls())
-func (mock *AirQualityServiceMock) GetByIDWithTimespanCalls() []struct {
+//
+//	len(mockedAirQualityService.GetExceedancesCalls())
+func (mock *AirQualityServiceMock) GetExceedancesCalls() []struct {
 	Ctx  context.Context
 	ID   string
 	From time.Time
@@ -225,9 +363,9 @@ func (mock *AirQualityServiceMock) GetByIDWithTimespanCalls() []struct {
 		From time.Time
 		To   time.Time
 	}
-	mock.lockGetByIDWithTimespan.RLock()
-	calls = mock.calls.GetByIDWithTimespan
-	mock.lockGetByIDWithTimespan.RUnlock()
+	mock.lockGetExceedances.RLock()
+	calls = mock.calls.GetExceedances
+	mock.lockGetExceedances.RUnlock()
 	return calls
 }
 
@@ -249,7 +387,8 @@ func (mock *AirQualityServiceMock) Refresh(ctx context.Context) (int, error) {
 
 // RefreshCalls gets all the calls that were made to Refresh.
 // Check the length with:
-//     len(mockedAirQualityService.RefreshCalls())
+//
+//	len(mockedAirQualityService.RefreshCalls())
 func (mock *AirQualityServiceMock) RefreshCalls() []struct {
 	Ctx context.Context
 } {
@@ -280,7 +419,8 @@ func (mock *AirQualityServiceMock) Shutdown(ctx context.Context) {
 
 // ShutdownCalls gets all the calls that were made to Shutdown.
 // Check the length with:
-//     len(mockedAirQualityService.ShutdownCalls())
+//
+//	len(mockedAirQualityService.ShutdownCalls())
 func (mock *AirQualityServiceMock) ShutdownCalls() []struct {
 	Ctx context.Context
 } {
@@ -311,7 +451,8 @@ func (mock *AirQualityServiceMock) Start(ctx context.Context) {
 
 // StartCalls gets all the calls that were made to Start.
 // Check the length with:
-//     len(mockedAirQualityService.StartCalls())
+//
+//	len(mockedAirQualityService.StartCalls())
 func (mock *AirQualityServiceMock) StartCalls() []struct {
 	Ctx context.Context
 } {
@@ -324,6 +465,33 @@ func (mock *AirQualityServiceMock) StartCalls() []struct {
 	return calls
 }
 
+// StationStatus calls StationStatusFunc.
+func (mock *AirQualityServiceMock) StationStatus() []StationStatus {
+	if mock.StationStatusFunc == nil {
+		panic("AirQualityServiceMock.StationStatusFunc: method is nil but AirQualityService.StationStatus was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockStationStatus.Lock()
+	mock.calls.StationStatus = append(mock.calls.StationStatus, callInfo)
+	mock.lockStationStatus.Unlock()
+	return mock.StationStatusFunc()
+}
+
+// StationStatusCalls gets all the calls that were made to StationStatus.
+// Check the length with:
+//
+//	len(mockedAirQualityService.StationStatusCalls())
+func (mock *AirQualityServiceMock) StationStatusCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockStationStatus.RLock()
+	calls = mock.calls.StationStatus
+	mock.lockStationStatus.RUnlock()
+	return calls
+}
+
 // Tenant calls TenantFunc.
 func (mock *AirQualityServiceMock) Tenant() string {
 	if mock.TenantFunc == nil {
@@ -339,7 +507,8 @@ func (mock *AirQualityServiceMock) Tenant() string {
 
 // TenantCalls gets all the calls that were made to Tenant.
 // Check the length with:
-//     len(mockedAirQualityService.TenantCalls())
+//
+//	len(mockedAirQualityService.TenantCalls())
 func (mock *AirQualityServiceMock) TenantCalls() []struct {
 } {
 	var calls []struct {
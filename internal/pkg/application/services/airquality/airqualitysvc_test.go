@@ -3,7 +3,15 @@ package airquality
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 
 	"github.com/diwise/context-broker/pkg/ngsild"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
@@ -17,7 +25,7 @@ func TestGetByID(t *testing.T) {
 
 	ctx := context.Background()
 
-	svc := NewAirQualityService(ctx, cbMock, "ignored")
+	svc := NewAirQualityService(ctx, cbMock, "ignored", DefaultCatalogue, DefaultLimitValues)
 	svc.Start(ctx)
 	defer svc.Shutdown(ctx)
 
@@ -30,14 +38,152 @@ func TestGetByID(t *testing.T) {
 	aqBytes, err := json.Marshal(aq)
 	is.NoErr(err)
 
-	is.Equal(string(aqBytes), `{"id":"urn:ngsi-ld:AirQualityObserved:test3","location":{"type":"Point","coordinates":[-3.712247,40.423853]},"dateObserved":{"@type":"DateTime","@value":"2025-02-12T19:23:09Z"},"pollutants":[{"name":"Temperature","values":[{"value":12.2,"observedAt":"2025-02-12T06:23:09Z"},{"value":12.2,"observedAt":"2025-02-12T16:23:09Z"},{"value":12.2,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"RelativeHumidity","values":[{"value":0.54,"observedAt":"2025-02-12T06:23:09Z"},{"value":0.54,"observedAt":"2025-02-12T16:23:09Z"},{"value":0.54,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"CO2","values":[{"value":500,"observedAt":"2025-02-12T06:23:09Z"},{"value":500,"observedAt":"2025-02-12T16:23:09Z"},{"value":500,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"NO","values":[{"value":45,"observedAt":"2025-02-12T06:23:09Z"},{"value":45,"observedAt":"2025-02-12T16:23:09Z"},{"value":45,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"NO2","values":[{"value":69,"observedAt":"2025-02-12T06:23:09Z"},{"value":69,"observedAt":"2025-02-12T16:23:09Z"},{"value":69,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"NOx","values":[{"value":139,"observedAt":"2025-02-12T06:23:09Z"},{"value":139,"observedAt":"2025-02-12T16:23:09Z"},{"value":139,"observedAt":"2025-02-19T16:23:09Z"}]}]}`)
+	is.Equal(string(aqBytes), `{"id":"urn:ngsi-ld:AirQualityObserved:test3","location":{"type":"Point","coordinates":[-3.712247,40.423853]},"dateObserved":{"@type":"DateTime","@value":"2025-02-12T19:23:09Z"},"pollutants":[{"name":"Temperature","unit":"°C","values":[{"value":12.2,"observedAt":"2025-02-12T06:23:09Z"},{"value":12.2,"observedAt":"2025-02-12T16:23:09Z"},{"value":12.2,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"RelativeHumidity","values":[{"value":0.54,"observedAt":"2025-02-12T06:23:09Z"},{"value":0.54,"observedAt":"2025-02-12T16:23:09Z"},{"value":0.54,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"CO2","unit":"ppm","values":[{"value":500,"observedAt":"2025-02-12T06:23:09Z"},{"value":500,"observedAt":"2025-02-12T16:23:09Z"},{"value":500,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"NO","unit":"µg/m³","values":[{"value":45,"observedAt":"2025-02-12T06:23:09Z"},{"value":45,"observedAt":"2025-02-12T16:23:09Z"},{"value":45,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"NO2","unit":"µg/m³","values":[{"value":69,"observedAt":"2025-02-12T06:23:09Z"},{"value":69,"observedAt":"2025-02-12T16:23:09Z"},{"value":69,"observedAt":"2025-02-12T19:23:09Z"}]},{"name":"NOx","unit":"µg/m³","values":[{"value":139,"observedAt":"2025-02-12T06:23:09Z"},{"value":139,"observedAt":"2025-02-12T16:23:09Z"},{"value":139,"observedAt":"2025-02-19T16:23:09Z"}]},{"name":"SO2","unit":"µg/m³","values":[{"value":11,"observedAt":"2025-02-12T06:23:09Z"},{"value":11,"observedAt":"2025-02-12T16:23:09Z"},{"value":11,"observedAt":"2025-02-19T16:23:09Z"}]}]}`)
+}
+
+func TestGetByIDWithTimespan(t *testing.T) {
+	is, cbMock := testSetup(t)
+	ctx := context.Background()
+
+	svc := NewAirQualityService(ctx, cbMock, "ignored", DefaultCatalogue, DefaultLimitValues)
+	svc.Start(ctx)
+	defer svc.Shutdown(ctx)
+
+	_, err := svc.Refresh(ctx)
+	is.NoErr(err)
+
+	from := time.Date(2025, 2, 12, 0, 0, 0, 0, time.UTC)
+	aq, err := svc.GetByIDWithTimespan(ctx, "urn:ngsi-ld:AirQualityObserved:test3", from, from.AddDate(0, 0, 8), timeseries.Day)
+	is.NoErr(err)
+
+	is.Equal(aq.Location.Coordinates, []float64{-3.712247, 40.423853})
+
+	nox := aq.Pollutants[5]
+	is.Equal(nox.Name, "NOx")
+	is.Equal(*nox.Statistics, domain.PollutantStatistics{Average: 139, Min: 139, Max: 139, Median: 139, Count: 3})
+	is.Equal(len(nox.Values), 2) // values should be averaged per day
+	is.Equal(nox.Values[0].Count, 2)
+
+	_, err = svc.GetByIDWithTimespan(ctx, "urn:ngsi-ld:AirQualityObserved:unknown", from, from.AddDate(0, 0, 1), "")
+	is.True(errors.Is(err, ErrNoSuchAirQuality))
+
+	_, err = svc.GetByIDWithTimespan(ctx, "urn:ngsi-ld:AirQualityObserved:test3", from, from.AddDate(0, 0, 1), timeseries.Week)
+	is.True(errors.Is(err, ErrInvalidQuery))
+
+	_, err = svc.GetByIDWithTimespan(ctx, "urn:ngsi-ld:AirQualityObserved:test3", from, from.Add(-time.Hour), "")
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span must not end before it starts
+
+	_, err = svc.GetByIDWithTimespan(ctx, "urn:ngsi-ld:AirQualityObserved:test3", from, from.Add(MaxTimespan+time.Hour), "")
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span must not be longer than MaxTimespan
+}
+
+func TestThatAllExceedancesReportFailingStations(t *testing.T) {
+	is, cbMock := testSetup(t)
+	ctx := context.Background()
+
+	retrieve := cbMock.RetrieveTemporalEvolutionOfEntityFunc
+	cbMock.RetrieveTemporalEvolutionOfEntityFunc = func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+		if entityID == "failing" {
+			return nil, errors.New("broker unavailable")
+		}
+		return retrieve(ctx, entityID, headers, parameters...)
+	}
+
+	svc := NewAirQualityService(ctx, cbMock, "ignored", DefaultCatalogue, DefaultLimitValues).(*aqsvc)
+	svc.Start(ctx)
+	defer svc.Shutdown(ctx)
+
+	_, err := svc.Refresh(ctx)
+	is.NoErr(err)
+
+	svc.queue <- func() {
+		svc.airQualities = append(svc.airQualities, domain.AirQuality{ID: "failing"})
+	}
+
+	from := time.Date(2025, 2, 12, 0, 0, 0, 0, time.UTC)
+	exceedances, err := svc.GetAllExceedances(ctx, from, from.AddDate(0, 0, 8))
+	is.NoErr(err) // a failing station should not fail the others
+
+	is.Equal(len(exceedances), 2)
+	is.Equal(exceedances[0].Error, "")
+	is.Equal(exceedances[1].ID, "failing")
+	is.True(exceedances[1].Error != "")
+	is.Equal(len(exceedances[1].LimitValues), 0)
+
+	_, err = svc.GetAllExceedances(ctx, from, from.Add(MaxExceedanceTimespan+time.Hour))
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span should be limited
+}
+
+func TestThatAllExceedancesAreCachedPerTimeSpan(t *testing.T) {
+	is, cbMock := testSetup(t)
+	ctx := context.Background()
+
+	svc := NewAirQualityService(ctx, cbMock, "ignored", DefaultCatalogue, DefaultLimitValues).(*aqsvc)
+	svc.Start(ctx)
+	defer svc.Shutdown(ctx)
+
+	_, err := svc.Refresh(ctx)
+	is.NoErr(err)
+
+	calls := len(cbMock.RetrieveTemporalEvolutionOfEntityCalls())
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	exceedances, err := svc.GetAllExceedances(ctx, from, to)
+	is.NoErr(err) // a calendar year should be allowed so that the count can be compared with the allowed number
+	is.Equal(len(cbMock.RetrieveTemporalEvolutionOfEntityCalls()), calls+1)
+
+	again, err := svc.GetAllExceedances(ctx, from.Add(10*time.Minute), to.Add(-10*time.Minute))
+	is.NoErr(err)
+	is.Equal(len(cbMock.RetrieveTemporalEvolutionOfEntityCalls()), calls+1) // a time span within the same hours should be served from the cache
+	is.Equal(again[0].From, exceedances[0].From)
+}
+
+func TestThatPartialTemporalResultsArePaged(t *testing.T) {
+	is, cbMock := testSetup(t)
+	ctx := context.Background()
+
+	retrieve := cbMock.RetrieveTemporalEvolutionOfEntityFunc
+	calls := 0
+
+	cbMock.RetrieveTemporalEvolutionOfEntityFunc = func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+		calls++
+		result, err := retrieve(ctx, entityID, headers, parameters...)
+
+		// the first response only covers the first half of the time span
+		if calls == 1 {
+			start := time.Date(2025, 2, 12, 0, 0, 0, 0, time.UTC)
+			end := start.AddDate(0, 0, 4)
+			result.PartialResult = true
+			result.ContentRange = &ngsild.ContentRange{StartTime: &start, EndTime: &end}
+		}
+
+		return result, err
+	}
+
+	svc := NewAirQualityService(ctx, cbMock, "ignored", DefaultCatalogue, DefaultLimitValues)
+	svc.Start(ctx)
+	defer svc.Shutdown(ctx)
+
+	_, err := svc.Refresh(ctx)
+	is.NoErr(err)
+
+	calls = 0
+
+	from := time.Date(2025, 2, 12, 0, 0, 0, 0, time.UTC)
+	aq, err := svc.GetByIDWithTimespan(ctx, "urn:ngsi-ld:AirQualityObserved:test3", from, from.AddDate(0, 0, 8), "")
+	is.NoErr(err)
+
+	is.Equal(calls, 2)                        // the rest of the time span should be requested after a partial result
+	is.Equal(len(aq.Pollutants[5].Values), 3) // values repeated in both pages should only be included once
 }
 
 func TestGetAll(t *testing.T) {
 	is, cbMock := testSetup(t)
 	ctx := context.Background()
 
-	svc := NewAirQualityService(ctx, cbMock, "ignored")
+	svc := NewAirQualityService(ctx, cbMock, "ignored", DefaultCatalogue, DefaultLimitValues)
 	svc.Start(ctx)
 	defer svc.Shutdown(ctx)
 
@@ -49,7 +195,157 @@ func TestGetAll(t *testing.T) {
 
 	aqosBytes, _ := json.Marshal(aqos)
 
-	is.Equal(string(aqosBytes), `[{"id":"urn:ngsi-ld:AirQualityObserved:test3","location":{"type":"Point","coordinates":[-3.712247,40.423853]},"dateObserved":{"@type":"DateTime","@value":"2025-02-12T19:23:09Z"},"temperature":12.2,"relativeHumidity":0.54,"CO2":500,"NO":45,"NO2":69,"NOx":139}]`)
+	is.Equal(string(aqosBytes), `[{"id":"urn:ngsi-ld:AirQualityObserved:test3","location":{"type":"Point","coordinates":[-3.712247,40.423853]},"dateObserved":{"@type":"DateTime","@value":"2025-02-12T19:23:09Z"},"temperature":12.2,"relativeHumidity":0.54,"CO2":500,"NO":45,"NO2":69,"NOx":139,"SO2":11}]`)
+}
+
+func TestThatFailingStationsKeepTheirLastGoodDetails(t *testing.T) {
+	is, cbMock := testSetup(t)
+	ctx := context.Background()
+
+	var inFlight, maxInFlight atomic.Int32
+	retrieve := cbMock.RetrieveTemporalEvolutionOfEntityFunc
+	cbMock.RetrieveTemporalEvolutionOfEntityFunc = func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		switch entityID {
+		case "failing":
+			return nil, errors.New("broker unavailable")
+		case "empty":
+			return &ngsild.RetrieveTemporalEvolutionOfEntityResult{}, nil
+		}
+
+		return retrieve(ctx, entityID, headers, parameters...)
+	}
+
+	svc := NewAirQualityService(ctx, cbMock, "ignored", DefaultCatalogue, DefaultLimitValues).(*aqsvc)
+
+	svc.airQualities = []domain.AirQuality{{ID: "empty"}, {ID: "failing"}}
+	for i := 0; i < 8; i++ {
+		svc.airQualities = append(svc.airQualities, domain.AirQuality{ID: fmt.Sprintf("station%d", i)})
+	}
+
+	previous := &domain.AirQualityIndex{Level: 2, Label: "fair"}
+	svc.airQualityByID["failing"] = domain.AirQualityDetails{ID: "failing", Index: previous}
+
+	err := svc.getDetails(ctx, cbMock, nil)
+	is.True(err != nil) // errors from failing stations should be reported
+
+	is.True(maxInFlight.Load() <= int32(maxConcurrentRequests)) // the number of concurrent requests should be bounded
+	is.Equal(len(svc.airQualityByID), 9)                        // all stations except the empty one should have details
+	is.Equal(len(svc.airQualityByID["station7"].Pollutants), 7)
+	is.Equal(svc.airQualityByID["failing"].Index, previous) // the last good details should be kept
+	is.Equal(svc.airQualities[1].Index, previous)
+
+	statuses := svc.StationStatus()
+	is.Equal(len(statuses), 10)
+	is.Equal(statuses[0].ID, "empty")
+	is.Equal(statuses[0].Status, StationStatusFailed)
+	is.Equal(statuses[1].Error, "failed to retrieve temporal evolution: broker unavailable")
+	is.Equal(statuses[2].Status, StationStatusOK)
+	is.True(statuses[2].LastUpdated != nil)
+}
+
+func TestThatUnknownPropertiesArePassedThrough(t *testing.T) {
+	is := is.New(t)
+
+	var entity entities.EntityImpl
+	is.NoErr(json.Unmarshal([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],"id":"urn:ngsi-ld:AirQualityObserved:1","type":"AirQualityObserved",`+
+		`"PM10":{"type":"Property","value":-5},"PM25":{"type":"Property","value":7.5},`+
+		`"LAeq":{"type":"Property","value":54.25},"source":{"type":"Property","value":"sensor"}}`), &entity))
+
+	catalogue, err := LoadCatalogue(strings.NewReader(`[{"property":"LAeq","name":"Noise","unit":"dB","decimals":1}]`))
+	is.NoErr(err)
+
+	aq := toAirQuality(entity, catalogue)
+	is.Equal(aq.PM10, nil) // values outside of the valid range should be left out
+	is.Equal(*aq.PM25, 7.5)
+
+	aqBytes, err := json.Marshal(aq)
+	is.NoErr(err)
+	is.True(strings.HasSuffix(string(aqBytes), `"PM25":7.5,"LAeq":54.3}`))
+
+	names := measuredProperties(domain.AirQuality{Other: map[string]float64{"LAeq": 1, "PM01": 2}}, catalogue)
+	is.Equal(names[len(names)-2:], []string{"LAeq", "PM01"}) // catalogue entries should come before unknown properties
+}
+
+func TestEAQIIsDecidedByTheWorstPollutant(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2025, 2, 12, 12, 0, 0, 0, time.UTC)
+	values := func(v ...float64) []domain.Value {
+		result := []domain.Value{}
+		for i, value := range v {
+			result = append(result, domain.Value{Value: value, ObservedAt: now.Add(-time.Duration(i*30) * time.Minute).Format(time.RFC3339)})
+		}
+		return result
+	}
+
+	index := computeEAQI([]domain.Pollutant{
+		{Property: "PM25", Name: "PM2.5", Values: values(8, 12)},     // 24 hour mean of 10 is good
+		{Property: "NO2", Name: "NO₂", Values: values(95, 100, 300)}, // hourly mean of 97.5 is moderate, the older value is outside the window
+		{Property: "temperature", Name: "Temperature", Values: values(40)},
+	}, now)
+
+	is.Equal(*index, domain.AirQualityIndex{Level: 3, Label: "moderate", Colour: "#F0E641", DominantPollutant: "NO2"}) // pollutants should be matched on their property, not their name
+
+	index = computeEAQI([]domain.Pollutant{{Property: "PM10", Name: "PM10", Values: values(160)}}, now)
+	is.Equal(index.Label, "extremely poor")
+
+	is.Equal(computeEAQI([]domain.Pollutant{{Property: "O3", Name: "O3", Values: values(80)}}, now.Add(2*time.Hour)), nil) // stale values should not give an index
+}
+
+func TestExceedancesAreCombinedIntoIntervals(t *testing.T) {
+	is := is.New(t)
+
+	hourly := []domain.Value{}
+	for h, v := range []float64{80, 95, 100, 85, 120} {
+		at := time.Date(2025, 2, 12, 8+h, 15, 0, 0, time.UTC)
+		hourly = append(hourly,
+			domain.Value{Value: v - 10, ObservedAt: at.Format(time.RFC3339)},
+			domain.Value{Value: v + 10, ObservedAt: at.Add(30 * time.Minute).Format(time.RFC3339)},
+		)
+	}
+
+	results := computeExceedances([]domain.Pollutant{{Property: "NO2", Name: "NO₂", Values: hourly}}, DefaultLimitValues)
+	is.Equal(len(results), 4)
+
+	no2 := results[2]
+	is.Equal(no2.Pollutant, "NO2")
+	is.Equal(no2.Period, "hour")
+	is.Equal(no2.Periods, 5)
+	is.Equal(no2.Count, 3)
+	is.Equal(len(no2.Intervals), 2) // consecutive hours above the limit should be combined
+	is.Equal(no2.Intervals[0].From.UTC(), time.Date(2025, 2, 12, 9, 0, 0, 0, time.UTC))
+	is.Equal(no2.Intervals[0].To.UTC(), time.Date(2025, 2, 12, 11, 0, 0, 0, time.UTC))
+	is.Equal(no2.Intervals[0].Periods, 2)
+	is.Equal(no2.Intervals[0].Max, 100.0)
+
+	is.Equal(results[3].Count, 1) // the daily mean of 96 should exceed the daily limit of 60
+	is.Equal(results[0].Periods, 0)
+}
+
+func TestParseLimitValues(t *testing.T) {
+	is := is.New(t)
+
+	limits, err := ParseLimitValues("PM10:day:40:10, O3:hour:120")
+	is.NoErr(err)
+	is.Equal(len(limits), 2)
+	is.Equal(limits[0].Limit, 40.0)
+	is.Equal(*limits[0].Allowed, 10)
+	is.Equal(limits[1].Allowed, nil)
+
+	_, err = ParseLimitValues("PM10:week:40")
+	is.True(err != nil)
 }
 
 func testSetup(t *testing.T) (*is.I, *cbtest.ContextBrokerClientMock) {
@@ -0,0 +1,119 @@
+package airquality
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// CatalogueEntry describes how a measured property of an AirQualityObserved entity is
+// presented. Values outside of [Min, Max] are treated as faulty readings and left out.
+type CatalogueEntry struct {
+	Property string   `json:"property"`
+	Name     string   `json:"name"`
+	Unit     string   `json:"unit,omitempty"`
+	Decimals *int     `json:"decimals,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// Catalogue is the ordered list of known properties. Numeric properties that are not
+// in the catalogue are still passed through, using the property name as their name.
+type Catalogue []CatalogueEntry
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+func decimals(n int) *int {
+	return &n
+}
+
+var DefaultCatalogue Catalogue = Catalogue{
+	{Property: AtmosphericPressurePropertyName, Name: "AtmosphericPressure", Unit: "hPa", Min: bound(800), Max: bound(1100)},
+	{Property: TemperaturePropertyName, Name: "Temperature", Unit: "°C", Min: bound(-60), Max: bound(60)},
+	{Property: RelativeHumidityPropertyName, Name: "RelativeHumidity", Min: bound(0), Max: bound(100)},
+	{Property: ParticleCountPropertyName, Name: "ParticleCount", Min: bound(0)},
+	{Property: PM1PropertyName, Name: "PM1", Unit: "µg/m³", Min: bound(0), Max: bound(1000)},
+	{Property: PM4PropertyName, Name: "PM4", Unit: "µg/m³", Min: bound(0), Max: bound(1000)},
+	{Property: PM10PropertyName, Name: "PM10", Unit: "µg/m³", Min: bound(0), Max: bound(1000)},
+	{Property: PM25PropertyName, Name: "PM25", Unit: "µg/m³", Min: bound(0), Max: bound(1000)},
+	{Property: TotalSuspendedParticulatePropertyName, Name: "TotalSuspendedParticulate", Unit: "µg/m³", Min: bound(0)},
+	{Property: CO2PropertyName, Name: "CO2", Unit: "ppm", Min: bound(0), Max: bound(10000), Decimals: decimals(0)},
+	{Property: NOPropertyName, Name: "NO", Unit: "µg/m³", Min: bound(0)},
+	{Property: NO2PropertyName, Name: "NO2", Unit: "µg/m³", Min: bound(0), Max: bound(2000)},
+	{Property: NOxPropertyName, Name: "NOx", Unit: "µg/m³", Min: bound(0)},
+	{Property: O3PropertyName, Name: "O3", Unit: "µg/m³", Min: bound(0), Max: bound(1000)},
+	{Property: SO2PropertyName, Name: "SO2", Unit: "µg/m³", Min: bound(0), Max: bound(2000)},
+	{Property: C6H6PropertyName, Name: "Benzene", Unit: "µg/m³", Min: bound(0)},
+	{Property: VoltagePropertyName, Name: "Voltage", Unit: "V"},
+	{Property: WindDirectionPropertyName, Name: "WindDirection", Unit: "°", Min: bound(0), Max: bound(360)},
+	{Property: WindSpeedPropertyName, Name: "WindSpeed", Unit: "m/s", Min: bound(0), Max: bound(100)},
+}
+
+// LoadCatalogue reads a JSON array of catalogue entries. Entries for properties that
+// are already in the default catalogue replace the defaults, and others are added.
+func LoadCatalogue(input io.Reader) (Catalogue, error) {
+	entries := []CatalogueEntry{}
+
+	if err := json.NewDecoder(input).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode air quality catalogue: %w", err)
+	}
+
+	catalogue := append(Catalogue{}, DefaultCatalogue...)
+
+	for _, e := range entries {
+		if e.Property == "" {
+			return nil, fmt.Errorf("air quality catalogue entries must have a property")
+		}
+
+		if e.Name == "" {
+			e.Name = e.Property
+		}
+
+		if e.Min != nil && e.Max != nil && *e.Min > *e.Max {
+			return nil, fmt.Errorf("the valid range of %s is empty", e.Property)
+		}
+
+		if i, ok := catalogue.indexOf(e.Property); ok {
+			catalogue[i] = e
+		} else {
+			catalogue = append(catalogue, e)
+		}
+	}
+
+	return catalogue, nil
+}
+
+func (c Catalogue) indexOf(property string) (int, bool) {
+	for i, e := range c {
+		if e.Property == property {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// entry returns the catalogue entry of a property, or an entry without any unit, range
+// or rounding if the property is unknown
+func (c Catalogue) entry(property string) CatalogueEntry {
+	if i, ok := c.indexOf(property); ok {
+		return c[i]
+	}
+	return CatalogueEntry{Property: property, Name: property}
+}
+
+// normalise rounds the value and reports whether it is within the valid range
+func (e CatalogueEntry) normalise(v float64) (float64, bool) {
+	if math.IsNaN(v) || (e.Min != nil && v < *e.Min) || (e.Max != nil && v > *e.Max) {
+		return v, false
+	}
+
+	if e.Decimals != nil {
+		pow := math.Pow(10, float64(*e.Decimals))
+		v = math.Round(v*pow) / pow
+	}
+
+	return v, true
+}
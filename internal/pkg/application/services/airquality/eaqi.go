@@ -0,0 +1,101 @@
+package airquality
+
+import (
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+)
+
+// eaqiBand is a level of the European Air Quality Index, as defined by the European
+// Environment Agency
+type eaqiBand struct {
+	label  string
+	colour string
+}
+
+var eaqiBands = []eaqiBand{
+	{"good", "#50F0E6"},
+	{"fair", "#50CCAA"},
+	{"moderate", "#F0E641"},
+	{"poor", "#FF5050"},
+	{"very poor", "#960032"},
+	{"extremely poor", "#7D2181"},
+}
+
+// eaqiPollutant describes how the index level of a pollutant is computed from the
+// average of its values (in µg/m³) over a time window that ends at the time of
+// computation. Each upper limit is the highest concentration of the corresponding
+// band, and anything above the last limit is extremely poor.
+type eaqiPollutant struct {
+	name   string
+	window time.Duration
+	limits [5]float64
+}
+
+var eaqiPollutants = []eaqiPollutant{
+	{name: PM25PropertyName, window: 24 * time.Hour, limits: [5]float64{10, 20, 25, 50, 75}},
+	{name: PM10PropertyName, window: 24 * time.Hour, limits: [5]float64{20, 40, 50, 100, 150}},
+	{name: NO2PropertyName, window: time.Hour, limits: [5]float64{40, 90, 120, 230, 340}},
+	{name: O3PropertyName, window: time.Hour, limits: [5]float64{50, 100, 130, 240, 380}},
+}
+
+// computeEAQI returns the European Air Quality Index based on rolling averages of the
+// pollutants at the given time, i.e. 24 hour means of particulate matter and hourly
+// means of NO2 and O3. The worst level of any pollutant decides the index, and nil is
+// returned if none of the pollutants have been measured within their time window.
+func computeEAQI(pollutants []domain.Pollutant, now time.Time) *domain.AirQualityIndex {
+	var index *domain.AirQualityIndex
+
+	for _, ep := range eaqiPollutants {
+		for _, p := range pollutants {
+			if p.Property != ep.name {
+				continue
+			}
+
+			avg, ok := rollingAverage(p.Values, now.Add(-ep.window), now)
+			if !ok {
+				continue
+			}
+
+			level := len(ep.limits) + 1
+			for i, limit := range ep.limits {
+				if avg <= limit {
+					level = i + 1
+					break
+				}
+			}
+
+			if index == nil || level > index.Level {
+				band := eaqiBands[level-1]
+				index = &domain.AirQualityIndex{
+					Level:             level,
+					Label:             band.label,
+					Colour:            band.colour,
+					DominantPollutant: ep.name,
+				}
+			}
+		}
+	}
+
+	return index
+}
+
+func rollingAverage(values []domain.Value, from, to time.Time) (float64, bool) {
+	sum, count := 0.0, 0
+
+	for _, v := range values {
+		observedAt, err := time.Parse(time.RFC3339, v.ObservedAt)
+		if err != nil || !observedAt.After(from) || observedAt.After(to) {
+			continue
+		}
+
+		sum += v.Value
+		count++
+	}
+
+	if count == 0 {
+		return 0, false
+	}
+
+	return sum / float64(count), true
+}
@@ -0,0 +1,127 @@
+package airquality
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+)
+
+// LimitValue is the highest allowed mean concentration (µg/m³) of a pollutant over an
+// hour or a day, along with the number of times per calendar year that it may be
+// exceeded. The pollutant is the name of the measured property, e.g. PM25.
+type LimitValue struct {
+	Pollutant string
+	Period    timeseries.Resolution
+	Limit     float64
+	Allowed   *int
+}
+
+// DefaultLimitValues follow the Swedish environmental quality standards for outdoor air
+// (SFS 2010:477), except for the daily limit of PM2.5 that comes from the national
+// environmental objective for clean air
+var DefaultLimitValues []LimitValue = []LimitValue{
+	{Pollutant: "PM10", Period: timeseries.Day, Limit: 50, Allowed: allowed(35)},
+	{Pollutant: "PM25", Period: timeseries.Day, Limit: 25, Allowed: allowed(3)},
+	{Pollutant: "NO2", Period: timeseries.Hour, Limit: 90, Allowed: allowed(175)},
+	{Pollutant: "NO2", Period: timeseries.Day, Limit: 60, Allowed: allowed(7)},
+}
+
+func allowed(n int) *int {
+	return &n
+}
+
+// ParseLimitValues parses a comma separated list of limit values, each written as
+// pollutant:period:limit with an optional :allowed suffix, e.g. PM10:day:50:35
+func ParseLimitValues(s string) ([]LimitValue, error) {
+	limits := []LimitValue{}
+
+	for _, lv := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(lv), ":")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] == "" {
+			return nil, fmt.Errorf("limit value %q must be written as pollutant:period:limit[:allowed]", lv)
+		}
+
+		period, err := timeseries.ParseResolution(parts[1])
+		if err != nil || (period != timeseries.Hour && period != timeseries.Day) {
+			return nil, fmt.Errorf("limit value %q must apply to an hour or a day", lv)
+		}
+
+		limit, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("limit value %q has an invalid limit: %w", lv, err)
+		}
+
+		limitValue := LimitValue{Pollutant: parts[0], Period: period, Limit: limit}
+
+		if len(parts) == 4 {
+			n, err := strconv.Atoi(parts[3])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("limit value %q has an invalid number of allowed exceedances", lv)
+			}
+			limitValue.Allowed = &n
+		}
+
+		limits = append(limits, limitValue)
+	}
+
+	return limits, nil
+}
+
+// computeExceedances compares the hourly or daily means of each pollutant with the limit
+// values. Days follow local time, and consecutive periods above a limit are combined
+// into one interval.
+func computeExceedances(pollutants []domain.Pollutant, limits []LimitValue) []domain.LimitValueResult {
+	results := make([]domain.LimitValueResult, 0, len(limits))
+
+	for _, lv := range limits {
+		result := domain.LimitValueResult{
+			Pollutant: lv.Pollutant,
+			Period:    string(lv.Period),
+			Limit:     lv.Limit,
+			Allowed:   lv.Allowed,
+			Intervals: []domain.ExceedanceInterval{},
+		}
+
+		samples := []timeseries.Sample{}
+		for _, p := range pollutants {
+			if p.Property == lv.Pollutant {
+				samples = append(samples, toSamples(p.Values)...)
+			}
+		}
+
+		buckets := timeseries.Aggregate(samples, lv.Period, timeseries.DefaultLocation)
+		result.Periods = len(buckets)
+
+		for _, b := range buckets {
+			if b.Average <= lv.Limit {
+				continue
+			}
+
+			result.Count++
+			mean := round(b.Average)
+
+			last := len(result.Intervals) - 1
+			if last >= 0 && result.Intervals[last].To.Equal(b.Start) {
+				result.Intervals[last].To = b.End
+				result.Intervals[last].Periods++
+				result.Intervals[last].Max = math.Max(result.Intervals[last].Max, mean)
+				continue
+			}
+
+			result.Intervals = append(result.Intervals, domain.ExceedanceInterval{
+				From:    b.Start,
+				To:      b.End,
+				Periods: 1,
+				Max:     mean,
+			})
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
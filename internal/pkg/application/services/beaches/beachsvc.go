@@ -14,6 +14,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/waterquality"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
@@ -25,12 +26,16 @@ import (
 
 var tracer = otel.Tracer("api-opendata/svcs/beaches")
 
+// nearbyCellSize is the size in metres of the cells of the spatial index of beaches
+const nearbyCellSize float64 = 1000
+
 type BeachService interface {
 	Broker() string
 	Tenant() string
 
 	GetAll(ctx context.Context) []Beach
 	GetByID(ctx context.Context, id string) (*Beach, error)
+	GetAllNearPoint(ctx context.Context, lat, lon float64, maxDistance int) []Beach
 
 	Start(context.Context)
 	Refresh(context.Context) (int, error)
@@ -44,6 +49,7 @@ func NewBeachService(ctx context.Context, contextBrokerURL, tenant string, maxWQ
 		wqsvc:               wqsvc,
 		beaches:             []Beach{},
 		beachByID:           map[string]Beach{},
+		nearby:              geo.NewIndex[int](nearbyCellSize),
 		beachMaxWQODistance: maxWQODistance,
 		contextBrokerURL:    contextBrokerURL,
 		tenant:              tenant,
@@ -62,6 +68,7 @@ type beachSvc struct {
 
 	beaches             []Beach
 	beachByID           map[string]Beach
+	nearby              *geo.Index[int]
 	beachMaxWQODistance int
 
 	queue chan func()
@@ -114,6 +121,25 @@ func (svc *beachSvc) GetByID(ctx context.Context, beachID string) (*Beach, error
 	}
 }
 
+// GetAllNearPoint returns the beaches whose center is within maxDistance metres from the
+// point, nearest first
+func (svc *beachSvc) GetAllNearPoint(ctx context.Context, lat, lon float64, maxDistance int) []Beach {
+	result := make(chan []Beach)
+
+	svc.queue <- func() {
+		nearby := svc.nearby.Within(lat, lon, float64(maxDistance))
+		beaches := make([]Beach, 0, len(nearby))
+
+		for _, n := range nearby {
+			beaches = append(beaches, svc.beaches[n.Item])
+		}
+
+		result <- beaches
+	}
+
+	return <-result
+}
+
 func (svc *beachSvc) Start(ctx context.Context) {
 	go svc.run(ctx)
 }
@@ -210,6 +236,7 @@ func (svc *beachSvc) refresh(ctx context.Context) (count int, err error) {
 	logger.Info("refreshing beach info")
 
 	beaches := []Beach{}
+	nearby := geo.NewIndex[int](nearbyCellSize)
 
 	_, err = contextbroker.QueryEntities(ctx, svc.contextBrokerURL, svc.tenant, "Beach", nil, func(b beachDTO) {
 
@@ -255,6 +282,7 @@ func (svc *beachSvc) refresh(ctx context.Context) (count int, err error) {
 
 		svc.beachByID[b.ID] = beach
 
+		nearby.Add(latitude, longitude, len(beaches))
 		beaches = append(beaches, beach)
 	})
 	if err != nil {
@@ -263,6 +291,7 @@ func (svc *beachSvc) refresh(ctx context.Context) (count int, err error) {
 	}
 
 	svc.beaches = beaches
+	svc.nearby = nearby
 
 	return len(svc.beaches), nil
 }
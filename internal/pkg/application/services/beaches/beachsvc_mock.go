@@ -24,6 +24,9 @@ var _ BeachService = &BeachServiceMock{}
 //			GetAllFunc: func(ctx context.Context) []Beach {
 //				panic("mock out the GetAll method")
 //			},
+//			GetAllNearPointFunc: func(ctx context.Context, lat float64, lon float64, maxDistance int) []Beach {
+//				panic("mock out the GetAllNearPoint method")
+//			},
 //			GetByIDFunc: func(ctx context.Context, id string) (*Beach, error) {
 //				panic("mock out the GetByID method")
 //			},
@@ -52,6 +55,9 @@ type BeachServiceMock struct {
 	// GetAllFunc mocks the GetAll method.
 	GetAllFunc func(ctx context.Context) []Beach
 
+	// GetAllNearPointFunc mocks the GetAllNearPoint method.
+	GetAllNearPointFunc func(ctx context.Context, lat float64, lon float64, maxDistance int) []Beach
+
 	// GetByIDFunc mocks the GetByID method.
 	GetByIDFunc func(ctx context.Context, id string) (*Beach, error)
 
@@ -77,6 +83,17 @@ type BeachServiceMock struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
 		}
+		// GetAllNearPoint holds details about calls to the GetAllNearPoint method.
+		GetAllNearPoint []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Lat is the lat argument value.
+			Lat float64
+			// Lon is the lon argument value.
+			Lon float64
+			// MaxDistance is the maxDistance argument value.
+			MaxDistance int
+		}
 		// GetByID holds details about calls to the GetByID method.
 		GetByID []struct {
 			// Ctx is the ctx argument value.
@@ -103,13 +120,14 @@ type BeachServiceMock struct {
 		Tenant []struct {
 		}
 	}
-	lockBroker   sync.RWMutex
-	lockGetAll   sync.RWMutex
-	lockGetByID  sync.RWMutex
-	lockRefresh  sync.RWMutex
-	lockShutdown sync.RWMutex
-	lockStart    sync.RWMutex
-	lockTenant   sync.RWMutex
+	lockBroker          sync.RWMutex
+	lockGetAll          sync.RWMutex
+	lockGetAllNearPoint sync.RWMutex
+	lockGetByID         sync.RWMutex
+	lockRefresh         sync.RWMutex
+	lockShutdown        sync.RWMutex
+	lockStart           sync.RWMutex
+	lockTenant          sync.RWMutex
 }
 
 // Broker calls BrokerFunc.
@@ -171,6 +189,50 @@ func (mock *BeachServiceMock) GetAllCalls() []struct {
 	return calls
 }
 
+// GetAllNearPoint calls GetAllNearPointFunc.
+func (mock *BeachServiceMock) GetAllNearPoint(ctx context.Context, lat float64, lon float64, maxDistance int) []Beach {
+	if mock.GetAllNearPointFunc == nil {
+		panic("BeachServiceMock.GetAllNearPointFunc: method is nil but BeachService.GetAllNearPoint was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		Lat         float64
+		Lon         float64
+		MaxDistance int
+	}{
+		Ctx:         ctx,
+		Lat:         lat,
+		Lon:         lon,
+		MaxDistance: maxDistance,
+	}
+	mock.lockGetAllNearPoint.Lock()
+	mock.calls.GetAllNearPoint = append(mock.calls.GetAllNearPoint, callInfo)
+	mock.lockGetAllNearPoint.Unlock()
+	return mock.GetAllNearPointFunc(ctx, lat, lon, maxDistance)
+}
+
+// GetAllNearPointCalls gets all the calls that were made to GetAllNearPoint.
+// Check the length with:
+//
+//	len(mockedBeachService.GetAllNearPointCalls())
+func (mock *BeachServiceMock) GetAllNearPointCalls() []struct {
+	Ctx         context.Context
+	Lat         float64
+	Lon         float64
+	MaxDistance int
+} {
+	var calls []struct {
+		Ctx         context.Context
+		Lat         float64
+		Lon         float64
+		MaxDistance int
+	}
+	mock.lockGetAllNearPoint.RLock()
+	calls = mock.calls.GetAllNearPoint
+	mock.lockGetAllNearPoint.RUnlock()
+	return calls
+}
+
 // GetByID calls GetByIDFunc.
 func (mock *BeachServiceMock) GetByID(ctx context.Context, id string) (*Beach, error) {
 	if mock.GetByIDFunc == nil {
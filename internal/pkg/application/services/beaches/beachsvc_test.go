@@ -95,6 +95,22 @@ func TestBeachServiceGetsByIDContainsWaterQuality(t *testing.T) {
 	is.True(strings.Contains(string(bJson), expectation))
 }
 
+func TestBeachServiceGetAllNearPoint(t *testing.T) {
+	is, mockBeachSvc := testSetup(t, 200, beachesJson)
+	wq := mockWaterService(is)
+	ctx := context.Background()
+
+	bs := NewBeachService(ctx, mockBeachSvc.URL(), "default", 1000, wq)
+	bs.Start(ctx)
+	defer bs.Shutdown(ctx)
+
+	_, err := bs.Refresh(ctx)
+	is.NoErr(err)
+
+	is.Equal(len(bs.GetAllNearPoint(ctx, 62.4352, 17.4726, 1000)), 1)
+	is.Equal(len(bs.GetAllNearPoint(ctx, 62.3900, 17.3060, 1000)), 0) // beaches further away should not be found
+}
+
 var Expects = testutils.Expects
 var Returns = testutils.Returns
 var anyInput = expects.AnyInput
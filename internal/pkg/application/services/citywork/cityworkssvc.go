@@ -2,13 +2,13 @@ package citywork
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"log/slog"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
@@ -19,12 +19,16 @@ import (
 
 var tracer = otel.Tracer("api-opendata/svcs/cityworks")
 
+// indexCellSize is the size in metres of the cells of the spatial index of cityworks
+const indexCellSize float64 = 1000
+
 type CityworksService interface {
 	Broker() string
 	Tenant() string
 
-	GetAll() []byte
-	GetByID(id string) ([]byte, error)
+	GetAll(from, to time.Time) []domain.CityworksDetails
+	GetByID(id string) (*domain.CityworksDetails, error)
+	GetAllInBoundingBox(from, to time.Time, minLat, minLon, maxLat, maxLon float64) []domain.CityworksDetails
 
 	Start(ctx context.Context)
 	Shutdown(ctx context.Context)
@@ -32,8 +36,9 @@ type CityworksService interface {
 
 func NewCityworksService(ctx context.Context, contextBrokerUrl, tenant string) CityworksService {
 	svc := &cityworksSvc{
-		cityworks:        []byte("[]"),
-		cityworksDetails: map[string][]byte{},
+		cityworks:        []domain.CityworksDetails{},
+		cityworksDetails: map[string]int{},
+		locations:        geo.NewIndex[int](indexCellSize),
 		contextBrokerURL: contextBrokerUrl,
 		tenant:           tenant,
 
@@ -48,8 +53,9 @@ type cityworksSvc struct {
 	tenant           string
 
 	cityworksMutex   sync.Mutex
-	cityworks        []byte
-	cityworksDetails map[string][]byte
+	cityworks        []domain.CityworksDetails
+	cityworksDetails map[string]int
+	locations        *geo.Index[int]
 
 	keepRunning bool
 }
@@ -62,23 +68,56 @@ func (svc *cityworksSvc) Tenant() string {
 	return svc.tenant
 }
 
-func (svc *cityworksSvc) GetAll() []byte {
+// GetAll returns all cityworks that are ongoing at some point within the time span
+// from - to. A zero from or to time leaves that end of the time span open.
+func (svc *cityworksSvc) GetAll(from, to time.Time) []domain.CityworksDetails {
 	svc.cityworksMutex.Lock()
 	defer svc.cityworksMutex.Unlock()
 
-	return svc.cityworks
+	if from.IsZero() && to.IsZero() {
+		return svc.cityworks
+	}
+
+	result := make([]domain.CityworksDetails, 0, len(svc.cityworks))
+
+	for idx := range svc.cityworks {
+		if svc.cityworks[idx].Overlaps(from, to) {
+			result = append(result, svc.cityworks[idx])
+		}
+	}
+
+	return result
 }
 
-func (svc *cityworksSvc) GetByID(id string) ([]byte, error) {
+// GetAllInBoundingBox returns the cityworks that are ongoing at some point within the time span from - to
+// that are located within the bounding box. A zero from or to time leaves that end of the
+// time span open.
+func (svc *cityworksSvc) GetAllInBoundingBox(from, to time.Time, minLat, minLon, maxLat, maxLon float64) []domain.CityworksDetails {
 	svc.cityworksMutex.Lock()
 	defer svc.cityworksMutex.Unlock()
 
-	body, ok := svc.cityworksDetails[id]
+	indices := svc.locations.InBoundingBox(minLat, minLon, maxLat, maxLon)
+	result := make([]domain.CityworksDetails, 0, len(indices))
+
+	for _, idx := range indices {
+		if svc.cityworks[idx].Overlaps(from, to) {
+			result = append(result, svc.cityworks[idx])
+		}
+	}
+
+	return result
+}
+
+func (svc *cityworksSvc) GetByID(id string) (*domain.CityworksDetails, error) {
+	svc.cityworksMutex.Lock()
+	defer svc.cityworksMutex.Unlock()
+
+	index, ok := svc.cityworksDetails[id]
 	if !ok {
-		return []byte{}, fmt.Errorf("no such cityworks")
+		return nil, fmt.Errorf("no such cityworks")
 	}
 
-	return body, nil
+	return &svc.cityworks[index], nil
 }
 
 func (svc *cityworksSvc) Start(ctx context.Context) {
@@ -127,66 +166,49 @@ func (svc *cityworksSvc) refresh(ctx context.Context) (count int, err error) {
 
 	_, ctx, _ = o11y.AddTraceIDToLoggerAndStoreInContext(span, logger, ctx)
 
-	cityworks := []domain.Cityworks{}
+	cityworks := []domain.CityworksDetails{}
 
 	count, err = contextbroker.QueryEntities(ctx, svc.contextBrokerURL, svc.tenant, "CityWork", nil, func(c cityworksDTO) {
-		location := *domain.NewPoint(c.Location.Coordinates[1], c.Location.Coordinates[0])
-
 		details := domain.CityworksDetails{
 			ID:           c.ID,
-			Location:     location,
+			Location:     *domain.NewPoint(c.Location.Coordinates[1], c.Location.Coordinates[0]),
 			Description:  c.Description,
 			DateModified: c.DateModified.Value,
 			StartDate:    c.StartDate.Value,
 			EndDate:      c.EndDate.Value,
 		}
 
-		jsonBytes, err_ := json.MarshalIndent(details, "  ", "  ")
-		if err_ != nil {
-			err = fmt.Errorf("failed to marshal cityworks to json: %w", err_)
-			return
-		}
-
-		svc.storeCityworksDetails(c.ID, jsonBytes)
-
-		cw := domain.Cityworks{
-			ID:        c.ID,
-			Location:  location,
-			StartDate: c.StartDate.Value,
-			EndDate:   c.EndDate.Value,
-		}
-
-		cityworks = append(cityworks, cw)
-
+		cityworks = append(cityworks, details)
 	})
 	if err != nil {
 		err = fmt.Errorf("failed to retrieve cityworks from context broker: %w", err)
 		return
 	}
 
-	jsonBytes, err_ := json.MarshalIndent(cityworks, "  ", "  ")
-	if err_ != nil {
-		err = fmt.Errorf("failed to marshal cityworks to json: %w", err_)
-		return
-	}
-
-	svc.storeCityworksList(jsonBytes)
+	svc.storeCityworksList(cityworks)
 
 	return
 }
 
-func (svc *cityworksSvc) storeCityworksDetails(id string, body []byte) {
+func (svc *cityworksSvc) storeCityworksList(list []domain.CityworksDetails) {
 	svc.cityworksMutex.Lock()
 	defer svc.cityworksMutex.Unlock()
 
-	svc.cityworksDetails[id] = body
-}
+	svc.cityworks = list
+	svc.cityworksDetails = map[string]int{}
 
-func (svc *cityworksSvc) storeCityworksList(body []byte) {
-	svc.cityworksMutex.Lock()
-	defer svc.cityworksMutex.Unlock()
+	for index := range list {
+		svc.cityworksDetails[list[index].ID] = index
+	}
+
+	locations := geo.NewIndex[int](indexCellSize)
+	for index := range list {
+		if coordinates := list[index].Location.Coordinates; len(coordinates) >= 2 {
+			locations.Add(coordinates[1], coordinates[0], index)
+		}
+	}
 
-	svc.cityworks = body
+	svc.locations = locations
 }
 
 type cityworksDTO struct {
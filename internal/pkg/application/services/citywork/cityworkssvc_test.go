@@ -4,6 +4,9 @@ import (
 	"context"
 	"net/http"
 	"testing"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 
 	testutils "github.com/diwise/service-chassis/pkg/test/http"
 	"github.com/diwise/service-chassis/pkg/test/http/expects"
@@ -61,6 +64,45 @@ func TestThatItWorks(t *testing.T) {
 	_, err := svc.refresh(context.Background())
 	is.NoErr(err)
 	is.Equal(len(svc.cityworksDetails), 2) // should be equal to 2
+
+	cw, err := svc.GetByID("urn:ngsi-ld:CityWork:citywork0")
+	is.NoErr(err)
+	is.Equal(cw.Location.Coordinates[0], 17.0)
+}
+
+func TestThatGetAllFiltersOnTimespan(t *testing.T) {
+	is := is.New(t)
+
+	svc, ok := NewCityworksService(context.Background(), "ignored", "default").(*cityworksSvc)
+	is.True(ok)
+
+	svc.storeCityworksList([]domain.CityworksDetails{
+		{ID: "cw0", StartDate: "2022-05-01T07:00:00Z", EndDate: "2022-05-14T16:00:00Z"},
+		{ID: "cw1", StartDate: "2022-06-01T07:00:00Z", EndDate: "2022-06-02T16:00:00Z"},
+		{ID: "cw2", StartDate: "2022-04-01T07:00:00Z"},
+	})
+
+	cityworks := svc.GetAll(time.Date(2022, 5, 20, 0, 0, 0, 0, time.UTC), time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC))
+	is.Equal(len(cityworks), 1)
+	is.Equal(cityworks[0].ID, "cw2") // cityworks without an end date should be considered ongoing
+}
+
+func TestThatGetAllInBoundingBoxFiltersOnLocationAndTimespan(t *testing.T) {
+	is := is.New(t)
+
+	svc, ok := NewCityworksService(context.Background(), "ignored", "default").(*cityworksSvc)
+	is.True(ok)
+
+	svc.storeCityworksList([]domain.CityworksDetails{
+		{ID: "cw0", StartDate: "2022-05-01T07:00:00Z", EndDate: "2022-05-14T16:00:00Z", Location: *domain.NewPoint(62.1, 17.1)},
+		{ID: "cw1", StartDate: "2022-06-01T07:00:00Z", Location: *domain.NewPoint(62.1, 17.1)},
+		{ID: "cw2", StartDate: "2022-06-01T07:00:00Z", Location: *domain.NewPoint(62.3, 17.1)},
+		{ID: "cw3", StartDate: "2022-06-01T07:00:00Z"},
+	})
+
+	cityworks := svc.GetAllInBoundingBox(time.Date(2022, 5, 20, 0, 0, 0, 0, time.UTC), time.Time{}, 62.05, 17.05, 62.2, 17.2)
+	is.Equal(len(cityworks), 1)
+	is.Equal(cityworks[0].ID, "cw1")
 }
 
 var Expects = testutils.Expects
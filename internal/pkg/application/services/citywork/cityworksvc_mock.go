@@ -5,7 +5,9 @@ package citywork
 
 import (
 	"context"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"sync"
+	"time"
 )
 
 // Ensure, that CityworksServiceMock does implement CityworksService.
@@ -21,10 +23,13 @@ var _ CityworksService = &CityworksServiceMock{}
 //			BrokerFunc: func() string {
 //				panic("mock out the Broker method")
 //			},
-//			GetAllFunc: func() []byte {
+//			GetAllFunc: func(from time.Time, to time.Time) []domain.CityworksDetails {
 //				panic("mock out the GetAll method")
 //			},
-//			GetByIDFunc: func(id string) ([]byte, error) {
+//			GetAllInBoundingBoxFunc: func(from time.Time, to time.Time, minLat float64, minLon float64, maxLat float64, maxLon float64) []domain.CityworksDetails {
+//				panic("mock out the GetAllInBoundingBox method")
+//			},
+//			GetByIDFunc: func(id string) (*domain.CityworksDetails, error) {
 //				panic("mock out the GetByID method")
 //			},
 //			ShutdownFunc: func(ctx context.Context)  {
@@ -47,10 +52,13 @@ type CityworksServiceMock struct {
 	BrokerFunc func() string
 
 	// GetAllFunc mocks the GetAll method.
-	GetAllFunc func() []byte
+	GetAllFunc func(from time.Time, to time.Time) []domain.CityworksDetails
+
+	// GetAllInBoundingBoxFunc mocks the GetAllInBoundingBox method.
+	GetAllInBoundingBoxFunc func(from time.Time, to time.Time, minLat float64, minLon float64, maxLat float64, maxLon float64) []domain.CityworksDetails
 
 	// GetByIDFunc mocks the GetByID method.
-	GetByIDFunc func(id string) ([]byte, error)
+	GetByIDFunc func(id string) (*domain.CityworksDetails, error)
 
 	// ShutdownFunc mocks the Shutdown method.
 	ShutdownFunc func(ctx context.Context)
@@ -68,6 +76,25 @@ type CityworksServiceMock struct {
 		}
 		// GetAll holds details about calls to the GetAll method.
 		GetAll []struct {
+			// From is the from argument value.
+			From time.Time
+			// To is the to argument value.
+			To time.Time
+		}
+		// GetAllInBoundingBox holds details about calls to the GetAllInBoundingBox method.
+		GetAllInBoundingBox []struct {
+			// From is the from argument value.
+			From time.Time
+			// To is the to argument value.
+			To time.Time
+			// MinLat is the minLat argument value.
+			MinLat float64
+			// MinLon is the minLon argument value.
+			MinLon float64
+			// MaxLat is the maxLat argument value.
+			MaxLat float64
+			// MaxLon is the maxLon argument value.
+			MaxLon float64
 		}
 		// GetByID holds details about calls to the GetByID method.
 		GetByID []struct {
@@ -88,12 +115,13 @@ type CityworksServiceMock struct {
 		Tenant []struct {
 		}
 	}
-	lockBroker   sync.RWMutex
-	lockGetAll   sync.RWMutex
-	lockGetByID  sync.RWMutex
-	lockShutdown sync.RWMutex
-	lockStart    sync.RWMutex
-	lockTenant   sync.RWMutex
+	lockBroker              sync.RWMutex
+	lockGetAll              sync.RWMutex
+	lockGetAllInBoundingBox sync.RWMutex
+	lockGetByID             sync.RWMutex
+	lockShutdown            sync.RWMutex
+	lockStart               sync.RWMutex
+	lockTenant              sync.RWMutex
 }
 
 // Broker calls BrokerFunc.
@@ -124,16 +152,21 @@ func (mock *CityworksServiceMock) BrokerCalls() []struct {
 }
 
 // GetAll calls GetAllFunc.
-func (mock *CityworksServiceMock) GetAll() []byte {
+func (mock *CityworksServiceMock) GetAll(from time.Time, to time.Time) []domain.CityworksDetails {
 	if mock.GetAllFunc == nil {
 		panic("CityworksServiceMock.GetAllFunc: method is nil but CityworksService.GetAll was just called")
 	}
 	callInfo := struct {
-	}{}
+		From time.Time
+		To   time.Time
+	}{
+		From: from,
+		To:   to,
+	}
 	mock.lockGetAll.Lock()
 	mock.calls.GetAll = append(mock.calls.GetAll, callInfo)
 	mock.lockGetAll.Unlock()
-	return mock.GetAllFunc()
+	return mock.GetAllFunc(from, to)
 }
 
 // GetAllCalls gets all the calls that were made to GetAll.
@@ -141,8 +174,12 @@ func (mock *CityworksServiceMock) GetAll() []byte {
 //
 //	len(mockedCityworksService.GetAllCalls())
 func (mock *CityworksServiceMock) GetAllCalls() []struct {
+	From time.Time
+	To   time.Time
 } {
 	var calls []struct {
+		From time.Time
+		To   time.Time
 	}
 	mock.lockGetAll.RLock()
 	calls = mock.calls.GetAll
@@ -150,8 +187,60 @@ func (mock *CityworksServiceMock) GetAllCalls() []struct {
 	return calls
 }
 
+// GetAllInBoundingBox calls GetAllInBoundingBoxFunc.
+func (mock *CityworksServiceMock) GetAllInBoundingBox(from time.Time, to time.Time, minLat float64, minLon float64, maxLat float64, maxLon float64) []domain.CityworksDetails {
+	if mock.GetAllInBoundingBoxFunc == nil {
+		panic("CityworksServiceMock.GetAllInBoundingBoxFunc: method is nil but CityworksService.GetAllInBoundingBox was just called")
+	}
+	callInfo := struct {
+		From   time.Time
+		To     time.Time
+		MinLat float64
+		MinLon float64
+		MaxLat float64
+		MaxLon float64
+	}{
+		From:   from,
+		To:     to,
+		MinLat: minLat,
+		MinLon: minLon,
+		MaxLat: maxLat,
+		MaxLon: maxLon,
+	}
+	mock.lockGetAllInBoundingBox.Lock()
+	mock.calls.GetAllInBoundingBox = append(mock.calls.GetAllInBoundingBox, callInfo)
+	mock.lockGetAllInBoundingBox.Unlock()
+	return mock.GetAllInBoundingBoxFunc(from, to, minLat, minLon, maxLat, maxLon)
+}
+
+// GetAllInBoundingBoxCalls gets all the calls that were made to GetAllInBoundingBox.
+// Check the length with:
+//
+//	len(mockedCityworksService.GetAllInBoundingBoxCalls())
+func (mock *CityworksServiceMock) GetAllInBoundingBoxCalls() []struct {
+	From   time.Time
+	To     time.Time
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+} {
+	var calls []struct {
+		From   time.Time
+		To     time.Time
+		MinLat float64
+		MinLon float64
+		MaxLat float64
+		MaxLon float64
+	}
+	mock.lockGetAllInBoundingBox.RLock()
+	calls = mock.calls.GetAllInBoundingBox
+	mock.lockGetAllInBoundingBox.RUnlock()
+	return calls
+}
+
 // GetByID calls GetByIDFunc.
-func (mock *CityworksServiceMock) GetByID(id string) ([]byte, error) {
+func (mock *CityworksServiceMock) GetByID(id string) (*domain.CityworksDetails, error) {
 	if mock.GetByIDFunc == nil {
 		panic("CityworksServiceMock.GetByIDFunc: method is nil but CityworksService.GetByID was just called")
 	}
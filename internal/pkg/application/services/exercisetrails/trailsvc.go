@@ -10,6 +10,7 @@ import (
 
 	"log/slog"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/organisations"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
@@ -21,12 +22,20 @@ import (
 
 var tracer = otel.Tracer("api-opendata/svcs/exercisetrails")
 
+// nearbyCellSize is the size in metres of the cells of the spatial index of trails
+const nearbyCellSize float64 = 1000
+
+// maxStatusChanges limits how many of the most recent status changes we keep
+const maxStatusChanges int = 50
+
 type ExerciseTrailService interface {
 	Broker() string
 	Tenant() string
 
 	GetAll(requiredCategories []string) []domain.ExerciseTrail
 	GetByID(id string) (*domain.ExerciseTrail, error)
+	GetAllNearPoint(lat, lon float64, maxDistance int, requiredCategories []string) []domain.ExerciseTrail
+	GetStatusChanges() []domain.StatusChange
 
 	Start(ctx context.Context)
 	Shutdown(ctx context.Context)
@@ -36,6 +45,8 @@ func NewExerciseTrailService(ctx context.Context, contextBrokerURL, tenant strin
 	svc := &exerciseTrailSvc{
 		trails:           []domain.ExerciseTrail{},
 		trailDetails:     map[string]int{},
+		nearby:           geo.NewIndex[int](nearbyCellSize),
+		statusChanges:    []domain.StatusChange{},
 		orgRegistry:      orgreg,
 		contextBrokerURL: contextBrokerURL,
 		tenant:           tenant,
@@ -54,6 +65,9 @@ type exerciseTrailSvc struct {
 	trailMutex   sync.Mutex
 	trails       []domain.ExerciseTrail
 	trailDetails map[string]int
+	nearby       *geo.Index[int]
+
+	statusChanges []domain.StatusChange
 
 	keepRunning bool
 }
@@ -76,20 +90,8 @@ func (svc *exerciseTrailSvc) GetAll(requiredCategories []string) []domain.Exerci
 
 	result := make([]domain.ExerciseTrail, 0, len(svc.trails))
 
-	anyCategoryMatches := func(categories []string) bool {
-		for _, category := range categories {
-			for _, requiredCategory := range requiredCategories {
-				if category == requiredCategory {
-					return true
-				}
-			}
-		}
-
-		return false
-	}
-
 	for idx := range svc.trails {
-		if anyCategoryMatches(svc.trails[idx].Categories) {
+		if anyCategoryMatches(svc.trails[idx].Categories, requiredCategories) {
 			result = append(result, svc.trails[idx])
 		}
 	}
@@ -97,6 +99,19 @@ func (svc *exerciseTrailSvc) GetAll(requiredCategories []string) []domain.Exerci
 	return result
 }
 
+// anyCategoryMatches reports whether any of the categories is one of the required ones
+func anyCategoryMatches(categories, requiredCategories []string) bool {
+	for _, category := range categories {
+		for _, requiredCategory := range requiredCategories {
+			if category == requiredCategory {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func (svc *exerciseTrailSvc) GetByID(id string) (*domain.ExerciseTrail, error) {
 	svc.trailMutex.Lock()
 	defer svc.trailMutex.Unlock()
@@ -109,6 +124,31 @@ func (svc *exerciseTrailSvc) GetByID(id string) (*domain.ExerciseTrail, error) {
 	return &svc.trails[index], nil
 }
 
+// GetAllNearPoint returns the trails that start within maxDistance metres from the point,
+// nearest first. If any categories are required, only those in one of them are returned.
+func (svc *exerciseTrailSvc) GetAllNearPoint(lat, lon float64, maxDistance int, requiredCategories []string) []domain.ExerciseTrail {
+	svc.trailMutex.Lock()
+	defer svc.trailMutex.Unlock()
+
+	nearby := svc.nearby.Within(lat, lon, float64(maxDistance))
+	result := make([]domain.ExerciseTrail, 0, len(nearby))
+
+	for _, n := range nearby {
+		if len(requiredCategories) == 0 || anyCategoryMatches(svc.trails[n.Item].Categories, requiredCategories) {
+			result = append(result, svc.trails[n.Item])
+		}
+	}
+
+	return result
+}
+
+func (svc *exerciseTrailSvc) GetStatusChanges() []domain.StatusChange {
+	svc.trailMutex.Lock()
+	defer svc.trailMutex.Unlock()
+
+	return svc.statusChanges
+}
+
 func (svc *exerciseTrailSvc) Start(ctx context.Context) {
 	logger := logging.GetFromContext(ctx)
 	logger.Info("starting exercise trail service")
@@ -203,21 +243,52 @@ func (svc *exerciseTrailSvc) refresh(ctx context.Context) (count int, err error)
 		return
 	}
 
-	svc.storeExerciseTrailList(trails)
+	svc.storeExerciseTrailList(trails, time.Now().UTC())
 
 	return
 }
 
-func (svc *exerciseTrailSvc) storeExerciseTrailList(list []domain.ExerciseTrail) {
+func (svc *exerciseTrailSvc) storeExerciseTrailList(list []domain.ExerciseTrail, now time.Time) {
 	svc.trailMutex.Lock()
 	defer svc.trailMutex.Unlock()
 
+	// status changes can only be detected once we have a previous list to compare with
+	if len(svc.trails) > 0 {
+		for _, trail := range list {
+			index, ok := svc.trailDetails[trail.ID]
+			if !ok || svc.trails[index].Status == trail.Status {
+				continue
+			}
+
+			svc.statusChanges = append([]domain.StatusChange{{
+				ID:             trail.ID,
+				Name:           trail.Name,
+				Status:         trail.Status,
+				PreviousStatus: svc.trails[index].Status,
+				DateChanged:    now.Format(time.RFC3339),
+			}}, svc.statusChanges...)
+		}
+
+		if len(svc.statusChanges) > maxStatusChanges {
+			svc.statusChanges = svc.statusChanges[:maxStatusChanges]
+		}
+	}
+
 	svc.trails = list
 	svc.trailDetails = map[string]int{}
 
 	for index := range list {
 		svc.trailDetails[list[index].ID] = index
 	}
+
+	nearby := geo.NewIndex[int](nearbyCellSize)
+	for index := range list {
+		if lat, lon, ok := list[index].Location.Start(); ok {
+			nearby.Add(lat, lon, index)
+		}
+	}
+
+	svc.nearby = nearby
 }
 
 type trailDTO struct {
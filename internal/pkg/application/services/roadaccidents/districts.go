@@ -0,0 +1,117 @@
+package roadaccidents
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Districts is a set of named areas that road accidents can be grouped by
+type Districts struct {
+	districts []district
+}
+
+type district struct {
+	name     string
+	polygons [][][][]float64
+}
+
+// NewDistrictsFromGeoJSON reads districts from a GeoJSON FeatureCollection with
+// Polygon or MultiPolygon features. The name of each district is taken from the
+// feature property given by nameProperty.
+func NewDistrictsFromGeoJSON(input io.Reader, nameProperty string) (*Districts, error) {
+	fc := struct {
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}{}
+
+	err := json.NewDecoder(input).Decode(&fc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode districts: %w", err)
+	}
+
+	result := &Districts{}
+
+	for idx, f := range fc.Features {
+		name, ok := f.Properties[nameProperty].(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("district %d has no %s property", idx, nameProperty)
+		}
+
+		d := district{name: name}
+
+		switch f.Geometry.Type {
+		case "Polygon":
+			polygon := [][][]float64{}
+			err = json.Unmarshal(f.Geometry.Coordinates, &polygon)
+			d.polygons = [][][][]float64{polygon}
+		case "MultiPolygon":
+			err = json.Unmarshal(f.Geometry.Coordinates, &d.polygons)
+		default:
+			err = fmt.Errorf("unsupported geometry type %q", f.Geometry.Type)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read geometry of district %s: %w", name, err)
+		}
+
+		result.districts = append(result.districts, d)
+	}
+
+	return result, nil
+}
+
+// Locate returns the name of the first district that contains the point, or an
+// empty string if the point is not within any district
+func (d *Districts) Locate(lon, lat float64) string {
+	for _, dist := range d.districts {
+		for _, polygon := range dist.polygons {
+			if polygonContains(polygon, lon, lat) {
+				return dist.name
+			}
+		}
+	}
+
+	return ""
+}
+
+// polygonContains checks if a point is inside the exterior ring of a polygon
+// and outside all of its holes
+func polygonContains(polygon [][][]float64, lon, lat float64) bool {
+	if len(polygon) == 0 || !ringContains(polygon[0], lon, lat) {
+		return false
+	}
+
+	for _, hole := range polygon[1:] {
+		if ringContains(hole, lon, lat) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ringContains uses ray casting to determine if a point lies within a linear ring
+func ringContains(ring [][]float64, lon, lat float64) bool {
+	inside := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		if len(ring[i]) < 2 || len(ring[j]) < 2 {
+			continue
+		}
+
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
@@ -0,0 +1,210 @@
+package roadaccidents
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+)
+
+// HotspotOptions controls the density based clustering of road accidents. Radius
+// is the neighbourhood distance in metres, and MinCount the number of accidents
+// (including itself) that must be within that distance for an accident to be
+// considered a core point of a cluster.
+type HotspotOptions struct {
+	Radius   float64
+	MinCount int
+}
+
+// Hotspot is a cluster of road accidents. Hull is the closed convex hull of the
+// accident locations, or nil if the locations do not span an area.
+type Hotspot struct {
+	Centroid    []float64
+	Hull        [][]float64
+	Count       int
+	AccidentIDs []string
+}
+
+// FindHotspots clusters the road accidents using DBSCAN and returns the clusters
+// sorted by descending accident count. Accidents that do not belong to a cluster
+// are not returned.
+func FindHotspots(accidents []domain.RoadAccidentDetails, opts HotspotOptions) ([]Hotspot, error) {
+	if opts.Radius <= 0 || math.IsNaN(opts.Radius) {
+		return nil, fmt.Errorf("radius must be a positive number")
+	}
+
+	if opts.MinCount < 1 {
+		return nil, fmt.Errorf("minimum count must be at least 1")
+	}
+
+	located := make([]domain.RoadAccidentDetails, 0, len(accidents))
+	for _, ra := range accidents {
+		if len(ra.Location.Coordinates) >= 2 {
+			located = append(located, ra)
+		}
+	}
+
+	// visit the accidents in a stable order so that clusters get the same
+	// members regardless of the order in which the accidents were cached
+	sort.Slice(located, func(i, j int) bool { return located[i].ID < located[j].ID })
+
+	const (
+		unvisited int = 0
+		noise     int = -1
+	)
+
+	labels := make([]int, len(located))
+	clusterCount := 0
+
+	nearby := geo.NewIndex[int](opts.Radius)
+	for idx, ra := range located {
+		nearby.Add(ra.Location.Coordinates[1], ra.Location.Coordinates[0], idx)
+	}
+
+	// neighbours are returned in the order of the accidents rather than by distance, so
+	// that clusters grow in the same order as with a full scan
+	neighbours := func(idx int) []int {
+		p := located[idx].Location.Coordinates
+		matches := nearby.Within(p[1], p[0], opts.Radius)
+
+		result := make([]int, 0, len(matches))
+		for _, m := range matches {
+			result = append(result, m.Item)
+		}
+
+		sort.Ints(result)
+		return result
+	}
+
+	// an accident is queued at most once, as it belongs to the cluster that queued it first
+	queued := make([]bool, len(located))
+
+	for idx := range located {
+		if labels[idx] != unvisited {
+			continue
+		}
+
+		n := neighbours(idx)
+		if len(n) < opts.MinCount {
+			labels[idx] = noise
+			continue
+		}
+
+		clusterCount++
+		labels[idx] = clusterCount
+
+		seeds := make([]int, 0, len(n))
+		enqueue := func(n []int) {
+			for _, j := range n {
+				if !queued[j] && (labels[j] == unvisited || labels[j] == noise) {
+					queued[j] = true
+					seeds = append(seeds, j)
+				}
+			}
+		}
+
+		enqueue(n)
+
+		for i := 0; i < len(seeds); i++ {
+			j := seeds[i]
+
+			if labels[j] == noise {
+				labels[j] = clusterCount
+			}
+
+			if labels[j] != unvisited {
+				continue
+			}
+
+			labels[j] = clusterCount
+
+			if n := neighbours(j); len(n) >= opts.MinCount {
+				enqueue(n)
+			}
+		}
+	}
+
+	hotspots := make([]Hotspot, clusterCount)
+	points := make([][][]float64, clusterCount)
+
+	for idx, label := range labels {
+		if label <= 0 {
+			continue
+		}
+
+		c := label - 1
+		hotspots[c].Count++
+		hotspots[c].AccidentIDs = append(hotspots[c].AccidentIDs, located[idx].ID)
+		points[c] = append(points[c], located[idx].Location.Coordinates[:2])
+	}
+
+	for c := range hotspots {
+		hotspots[c].Centroid = centroidOf(points[c])
+		hotspots[c].Hull = convexHull(points[c])
+	}
+
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		return hotspots[i].Count > hotspots[j].Count
+	})
+
+	return hotspots, nil
+}
+
+func centroidOf(points [][]float64) []float64 {
+	lon, lat := 0.0, 0.0
+
+	for _, p := range points {
+		lon += p[0]
+		lat += p[1]
+	}
+
+	n := float64(len(points))
+	return []float64{round(lon/n, 6), round(lat/n, 6)}
+}
+
+// convexHull computes the convex hull of the points using Andrew's monotone chain
+// and returns it as a closed, counter clockwise ring
+func convexHull(points [][]float64) [][]float64 {
+	sorted := make([][]float64, len(points))
+	copy(sorted, points)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+
+	// points that are within floating point noise of a line are treated as collinear
+	const epsilon float64 = 1e-12
+
+	cross := func(o, a, b []float64) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+
+	hull := make([][]float64, 0, 2*len(sorted))
+
+	for _, p := range sorted {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= epsilon {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+
+	for i, lower := len(sorted)-2, len(hull)+1; i >= 0; i-- {
+		p := sorted[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= epsilon {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+
+	// a hull with less than three distinct corners does not span an area
+	if len(hull) < 4 {
+		return nil
+	}
+
+	return hull
+}
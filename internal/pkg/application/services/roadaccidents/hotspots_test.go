@@ -0,0 +1,75 @@
+package roadaccidents
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	"github.com/matryer/is"
+)
+
+func TestFindHotspots(t *testing.T) {
+	is := is.New(t)
+
+	accidents := append(testAccidents(),
+		domain.RoadAccidentDetails{ID: "ra5", Location: *domain.NewPoint(62.551, 17.551)},
+		domain.RoadAccidentDetails{ID: "ra6", Location: *domain.NewPoint(62.0, 16.0)},
+	)
+
+	hotspots, err := FindHotspots(accidents, HotspotOptions{Radius: 2000, MinCount: 3})
+	is.NoErr(err)
+
+	is.Equal(len(hotspots), 2)
+	is.Equal(hotspots[0].Count, 3)
+	is.Equal(hotspots[0].AccidentIDs, []string{"ra0", "ra1", "ra2"})
+	is.Equal(hotspots[0].Centroid, []float64{17.36, 62.36})
+	is.Equal(len(hotspots[0].Hull), 0) // collinear accidents do not span an area
+	is.Equal(hotspots[1].AccidentIDs, []string{"ra3", "ra4", "ra5"})
+}
+
+func TestThatHotspotsHaveAConvexHull(t *testing.T) {
+	is := is.New(t)
+
+	accidents := []domain.RoadAccidentDetails{
+		{ID: "ra0", Location: *domain.NewPoint(62.0, 17.0)},
+		{ID: "ra1", Location: *domain.NewPoint(62.0, 17.001)},
+		{ID: "ra2", Location: *domain.NewPoint(62.001, 17.001)},
+		{ID: "ra3", Location: *domain.NewPoint(62.0003, 17.0007)},
+	}
+
+	hotspots, err := FindHotspots(accidents, HotspotOptions{Radius: 200, MinCount: 2})
+	is.NoErr(err)
+
+	is.Equal(len(hotspots), 1)
+	is.Equal(hotspots[0].Count, 4)
+	is.Equal(hotspots[0].Hull, [][]float64{{17.0, 62.0}, {17.001, 62.0}, {17.001, 62.001}, {17.0, 62.0}}) // inner point should not be part of the hull
+}
+
+func TestThatDenseHotspotsAreFoundOnce(t *testing.T) {
+	is := is.New(t)
+
+	accidents := make([]domain.RoadAccidentDetails, 0, 1000)
+	for i := range 1000 {
+		accidents = append(accidents, domain.RoadAccidentDetails{
+			ID:       fmt.Sprintf("ra%d", i),
+			Location: *domain.NewPoint(62.0+float64(i%40)*0.00001, 17.0+float64(i/40)*0.00001),
+		})
+	}
+
+	hotspots, err := FindHotspots(accidents, HotspotOptions{Radius: 500, MinCount: 3})
+	is.NoErr(err)
+
+	is.Equal(len(hotspots), 1)
+	is.Equal(hotspots[0].Count, 1000) // every accident should be counted exactly once
+	is.Equal(len(hotspots[0].AccidentIDs), 1000)
+}
+
+func TestFindHotspotsFailsOnInvalidOptions(t *testing.T) {
+	is := is.New(t)
+
+	_, err := FindHotspots(testAccidents(), HotspotOptions{Radius: 0, MinCount: 3})
+	is.True(err != nil)
+
+	_, err = FindHotspots(testAccidents(), HotspotOptions{Radius: 100, MinCount: 0})
+	is.True(err != nil)
+}
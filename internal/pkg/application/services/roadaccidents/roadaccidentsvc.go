@@ -2,13 +2,13 @@ package roadaccidents
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"log/slog"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
@@ -19,12 +19,16 @@ import (
 
 var tracer = otel.Tracer("api-opendata/svcs/roadaccidents")
 
+// indexCellSize is the size in metres of the cells of the spatial index of road accidents
+const indexCellSize float64 = 1000
+
 type RoadAccidentService interface {
 	Broker() string
 	Tenant() string
 
-	GetAll() []byte
-	GetByID(id string) ([]byte, error)
+	GetAll(from, to time.Time) []domain.RoadAccidentDetails
+	GetByID(id string) (*domain.RoadAccidentDetails, error)
+	GetAllInBoundingBox(from, to time.Time, minLat, minLon, maxLat, maxLon float64) []domain.RoadAccidentDetails
 
 	Start(ctx context.Context)
 	Shutdown(ctx context.Context)
@@ -35,8 +39,9 @@ func NewRoadAccidentService(ctx context.Context, contextBrokerURL, tenant string
 		contextBrokerURL: contextBrokerURL,
 		tenant:           tenant,
 
-		roadAccidents:       []byte("[]"),
-		roadAccidentDetails: map[string][]byte{},
+		roadAccidents:       []domain.RoadAccidentDetails{},
+		roadAccidentDetails: map[string]int{},
+		locations:           geo.NewIndex[int](indexCellSize),
 
 		keepRunning: true,
 	}
@@ -49,8 +54,9 @@ type roadAccidentSvc struct {
 	tenant           string
 
 	roadAccidentMutex   sync.Mutex
-	roadAccidents       []byte
-	roadAccidentDetails map[string][]byte
+	roadAccidents       []domain.RoadAccidentDetails
+	roadAccidentDetails map[string]int
+	locations           *geo.Index[int]
 
 	keepRunning bool
 }
@@ -63,23 +69,56 @@ func (svc *roadAccidentSvc) Tenant() string {
 	return svc.tenant
 }
 
-func (svc *roadAccidentSvc) GetAll() []byte {
+// GetAll returns all road accidents that occurred within the time span from - to.
+// A zero from or to time leaves that end of the time span open.
+func (svc *roadAccidentSvc) GetAll(from, to time.Time) []domain.RoadAccidentDetails {
 	svc.roadAccidentMutex.Lock()
 	defer svc.roadAccidentMutex.Unlock()
 
-	return svc.roadAccidents
+	if from.IsZero() && to.IsZero() {
+		return svc.roadAccidents
+	}
+
+	result := make([]domain.RoadAccidentDetails, 0, len(svc.roadAccidents))
+
+	for idx := range svc.roadAccidents {
+		if svc.roadAccidents[idx].OccurredWithin(from, to) {
+			result = append(result, svc.roadAccidents[idx])
+		}
+	}
+
+	return result
 }
 
-func (svc *roadAccidentSvc) GetByID(id string) ([]byte, error) {
+// GetAllInBoundingBox returns the road accidents that occurred within the time span from - to
+// that are located within the bounding box. A zero from or to time leaves that end of the
+// time span open.
+func (svc *roadAccidentSvc) GetAllInBoundingBox(from, to time.Time, minLat, minLon, maxLat, maxLon float64) []domain.RoadAccidentDetails {
 	svc.roadAccidentMutex.Lock()
 	defer svc.roadAccidentMutex.Unlock()
 
-	body, ok := svc.roadAccidentDetails[id]
+	indices := svc.locations.InBoundingBox(minLat, minLon, maxLat, maxLon)
+	result := make([]domain.RoadAccidentDetails, 0, len(indices))
+
+	for _, idx := range indices {
+		if svc.roadAccidents[idx].OccurredWithin(from, to) {
+			result = append(result, svc.roadAccidents[idx])
+		}
+	}
+
+	return result
+}
+
+func (svc *roadAccidentSvc) GetByID(id string) (*domain.RoadAccidentDetails, error) {
+	svc.roadAccidentMutex.Lock()
+	defer svc.roadAccidentMutex.Unlock()
+
+	index, ok := svc.roadAccidentDetails[id]
 	if !ok {
-		return []byte{}, fmt.Errorf("no such road accident")
+		return nil, fmt.Errorf("no such road accident")
 	}
 
-	return body, nil
+	return &svc.roadAccidents[index], nil
 }
 
 func (svc *roadAccidentSvc) Start(ctx context.Context) {
@@ -130,10 +169,9 @@ func (svc *roadAccidentSvc) refresh(ctx context.Context) (count int, err error)
 
 	_, ctx, _ = o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
 
-	roadAccidents := []domain.RoadAccident{}
+	roadAccidents := []domain.RoadAccidentDetails{}
 
 	count, err = contextbroker.QueryEntities(ctx, svc.contextBrokerURL, svc.tenant, "RoadAccident", nil, func(r roadAccidentDTO) {
-
 		details := domain.RoadAccidentDetails{
 			ID:           r.ID,
 			Description:  r.Description,
@@ -144,52 +182,37 @@ func (svc *roadAccidentSvc) refresh(ctx context.Context) (count int, err error)
 			Status:       r.Status,
 		}
 
-		jsonBytes, err_ := json.MarshalIndent(details, "  ", "  ")
-		if err_ != nil {
-			err = fmt.Errorf("failed to marshal road accident to json: %w", err_)
-			return
-		}
-
-		svc.storeRoadAccidentDetails(r.ID, jsonBytes)
-
-		roadAccident := domain.RoadAccident{
-			ID:           r.ID,
-			Location:     details.Location,
-			AccidentDate: r.AccidentDate.Value,
-		}
-
-		roadAccidents = append(roadAccidents, roadAccident)
+		roadAccidents = append(roadAccidents, details)
 	})
 	if err != nil {
 		err = fmt.Errorf("failed to retrieve road accidents from context broker: %w", err)
 		return
 	}
 
-	jsonBytes, err_ := json.MarshalIndent(roadAccidents, "  ", "  ")
-	if err_ != nil {
-		err = fmt.Errorf("failed to marshal road accidents to json: %w", err_)
-		return
-	}
-
-	svc.storeRoadAccidentList(jsonBytes)
+	svc.storeRoadAccidentList(roadAccidents)
 
 	return
 }
 
-func (svc *roadAccidentSvc) storeRoadAccidentDetails(id string, body []byte) {
+func (svc *roadAccidentSvc) storeRoadAccidentList(list []domain.RoadAccidentDetails) {
 	svc.roadAccidentMutex.Lock()
 	defer svc.roadAccidentMutex.Unlock()
 
-	svc.roadAccidentDetails[id] = body
-
-}
+	svc.roadAccidents = list
+	svc.roadAccidentDetails = map[string]int{}
 
-func (svc *roadAccidentSvc) storeRoadAccidentList(body []byte) {
-	svc.roadAccidentMutex.Lock()
-	defer svc.roadAccidentMutex.Unlock()
+	for index := range list {
+		svc.roadAccidentDetails[list[index].ID] = index
+	}
 
-	svc.roadAccidents = body
+	locations := geo.NewIndex[int](indexCellSize)
+	for index := range list {
+		if coordinates := list[index].Location.Coordinates; len(coordinates) >= 2 {
+			locations.Add(coordinates[1], coordinates[0], index)
+		}
+	}
 
+	svc.locations = locations
 }
 
 type roadAccidentDTO struct {
@@ -5,7 +5,9 @@ package roadaccidents
 
 import (
 	"context"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"sync"
+	"time"
 )
 
 // Ensure, that RoadAccidentServiceMock does implement RoadAccidentService.
@@ -21,10 +23,13 @@ var _ RoadAccidentService = &RoadAccidentServiceMock{}
 //			BrokerFunc: func() string {
 //				panic("mock out the Broker method")
 //			},
-//			GetAllFunc: func() []byte {
+//			GetAllFunc: func(from time.Time, to time.Time) []domain.RoadAccidentDetails {
 //				panic("mock out the GetAll method")
 //			},
-//			GetByIDFunc: func(id string) ([]byte, error) {
+//			GetAllInBoundingBoxFunc: func(from time.Time, to time.Time, minLat float64, minLon float64, maxLat float64, maxLon float64) []domain.RoadAccidentDetails {
+//				panic("mock out the GetAllInBoundingBox method")
+//			},
+//			GetByIDFunc: func(id string) (*domain.RoadAccidentDetails, error) {
 //				panic("mock out the GetByID method")
 //			},
 //			ShutdownFunc: func(ctx context.Context)  {
@@ -47,10 +52,13 @@ type RoadAccidentServiceMock struct {
 	BrokerFunc func() string
 
 	// GetAllFunc mocks the GetAll method.
-	GetAllFunc func() []byte
+	GetAllFunc func(from time.Time, to time.Time) []domain.RoadAccidentDetails
+
+	// GetAllInBoundingBoxFunc mocks the GetAllInBoundingBox method.
+	GetAllInBoundingBoxFunc func(from time.Time, to time.Time, minLat float64, minLon float64, maxLat float64, maxLon float64) []domain.RoadAccidentDetails
 
 	// GetByIDFunc mocks the GetByID method.
-	GetByIDFunc func(id string) ([]byte, error)
+	GetByIDFunc func(id string) (*domain.RoadAccidentDetails, error)
 
 	// ShutdownFunc mocks the Shutdown method.
 	ShutdownFunc func(ctx context.Context)
@@ -68,6 +76,25 @@ type RoadAccidentServiceMock struct {
 		}
 		// GetAll holds details about calls to the GetAll method.
 		GetAll []struct {
+			// From is the from argument value.
+			From time.Time
+			// To is the to argument value.
+			To time.Time
+		}
+		// GetAllInBoundingBox holds details about calls to the GetAllInBoundingBox method.
+		GetAllInBoundingBox []struct {
+			// From is the from argument value.
+			From time.Time
+			// To is the to argument value.
+			To time.Time
+			// MinLat is the minLat argument value.
+			MinLat float64
+			// MinLon is the minLon argument value.
+			MinLon float64
+			// MaxLat is the maxLat argument value.
+			MaxLat float64
+			// MaxLon is the maxLon argument value.
+			MaxLon float64
 		}
 		// GetByID holds details about calls to the GetByID method.
 		GetByID []struct {
@@ -88,12 +115,13 @@ type RoadAccidentServiceMock struct {
 		Tenant []struct {
 		}
 	}
-	lockBroker   sync.RWMutex
-	lockGetAll   sync.RWMutex
-	lockGetByID  sync.RWMutex
-	lockShutdown sync.RWMutex
-	lockStart    sync.RWMutex
-	lockTenant   sync.RWMutex
+	lockBroker              sync.RWMutex
+	lockGetAll              sync.RWMutex
+	lockGetAllInBoundingBox sync.RWMutex
+	lockGetByID             sync.RWMutex
+	lockShutdown            sync.RWMutex
+	lockStart               sync.RWMutex
+	lockTenant              sync.RWMutex
 }
 
 // Broker calls BrokerFunc.
@@ -124,16 +152,21 @@ func (mock *RoadAccidentServiceMock) BrokerCalls() []struct {
 }
 
 // GetAll calls GetAllFunc.
-func (mock *RoadAccidentServiceMock) GetAll() []byte {
+func (mock *RoadAccidentServiceMock) GetAll(from time.Time, to time.Time) []domain.RoadAccidentDetails {
 	if mock.GetAllFunc == nil {
 		panic("RoadAccidentServiceMock.GetAllFunc: method is nil but RoadAccidentService.GetAll was just called")
 	}
 	callInfo := struct {
-	}{}
+		From time.Time
+		To   time.Time
+	}{
+		From: from,
+		To:   to,
+	}
 	mock.lockGetAll.Lock()
 	mock.calls.GetAll = append(mock.calls.GetAll, callInfo)
 	mock.lockGetAll.Unlock()
-	return mock.GetAllFunc()
+	return mock.GetAllFunc(from, to)
 }
 
 // GetAllCalls gets all the calls that were made to GetAll.
@@ -141,8 +174,12 @@ func (mock *RoadAccidentServiceMock) GetAll() []byte {
 //
 //	len(mockedRoadAccidentService.GetAllCalls())
 func (mock *RoadAccidentServiceMock) GetAllCalls() []struct {
+	From time.Time
+	To   time.Time
 } {
 	var calls []struct {
+		From time.Time
+		To   time.Time
 	}
 	mock.lockGetAll.RLock()
 	calls = mock.calls.GetAll
@@ -150,8 +187,60 @@ func (mock *RoadAccidentServiceMock) GetAllCalls() []struct {
 	return calls
 }
 
+// GetAllInBoundingBox calls GetAllInBoundingBoxFunc.
+func (mock *RoadAccidentServiceMock) GetAllInBoundingBox(from time.Time, to time.Time, minLat float64, minLon float64, maxLat float64, maxLon float64) []domain.RoadAccidentDetails {
+	if mock.GetAllInBoundingBoxFunc == nil {
+		panic("RoadAccidentServiceMock.GetAllInBoundingBoxFunc: method is nil but RoadAccidentService.GetAllInBoundingBox was just called")
+	}
+	callInfo := struct {
+		From   time.Time
+		To     time.Time
+		MinLat float64
+		MinLon float64
+		MaxLat float64
+		MaxLon float64
+	}{
+		From:   from,
+		To:     to,
+		MinLat: minLat,
+		MinLon: minLon,
+		MaxLat: maxLat,
+		MaxLon: maxLon,
+	}
+	mock.lockGetAllInBoundingBox.Lock()
+	mock.calls.GetAllInBoundingBox = append(mock.calls.GetAllInBoundingBox, callInfo)
+	mock.lockGetAllInBoundingBox.Unlock()
+	return mock.GetAllInBoundingBoxFunc(from, to, minLat, minLon, maxLat, maxLon)
+}
+
+// GetAllInBoundingBoxCalls gets all the calls that were made to GetAllInBoundingBox.
+// Check the length with:
+//
+//	len(mockedRoadAccidentService.GetAllInBoundingBoxCalls())
+func (mock *RoadAccidentServiceMock) GetAllInBoundingBoxCalls() []struct {
+	From   time.Time
+	To     time.Time
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+} {
+	var calls []struct {
+		From   time.Time
+		To     time.Time
+		MinLat float64
+		MinLon float64
+		MaxLat float64
+		MaxLon float64
+	}
+	mock.lockGetAllInBoundingBox.RLock()
+	calls = mock.calls.GetAllInBoundingBox
+	mock.lockGetAllInBoundingBox.RUnlock()
+	return calls
+}
+
 // GetByID calls GetByIDFunc.
-func (mock *RoadAccidentServiceMock) GetByID(id string) ([]byte, error) {
+func (mock *RoadAccidentServiceMock) GetByID(id string) (*domain.RoadAccidentDetails, error) {
 	if mock.GetByIDFunc == nil {
 		panic("RoadAccidentServiceMock.GetByIDFunc: method is nil but RoadAccidentService.GetByID was just called")
 	}
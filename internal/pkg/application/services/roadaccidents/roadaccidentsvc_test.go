@@ -4,6 +4,9 @@ import (
 	"context"
 	"net/http"
 	"testing"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 
 	testutils "github.com/diwise/service-chassis/pkg/test/http"
 	"github.com/diwise/service-chassis/pkg/test/http/expects"
@@ -62,6 +65,39 @@ func TestThatItWorks(t *testing.T) {
 	is.Equal(len(svc.roadAccidentDetails), 2) // should be equal to 2
 }
 
+func TestThatGetAllFiltersOnTimespan(t *testing.T) {
+	is := is.New(t)
+
+	svc, ok := NewRoadAccidentService(context.Background(), "ignored", "default").(*roadAccidentSvc)
+	is.True(ok)
+
+	svc.storeRoadAccidentList([]domain.RoadAccidentDetails{
+		{ID: "ra0", AccidentDate: "2022-05-01T07:00:00Z"},
+		{ID: "ra1", AccidentDate: "2022-06-01T07:00:00Z"},
+	})
+
+	roadAccidents := svc.GetAll(time.Date(2022, 5, 20, 0, 0, 0, 0, time.UTC), time.Time{})
+	is.Equal(len(roadAccidents), 1)
+	is.Equal(roadAccidents[0].ID, "ra1")
+}
+
+func TestThatGetAllInBoundingBoxFiltersOnLocationAndTimespan(t *testing.T) {
+	is := is.New(t)
+
+	svc, ok := NewRoadAccidentService(context.Background(), "ignored", "default").(*roadAccidentSvc)
+	is.True(ok)
+
+	svc.storeRoadAccidentList([]domain.RoadAccidentDetails{
+		{ID: "ra0", AccidentDate: "2022-05-01T07:00:00Z", Location: *domain.NewPoint(62.01, 17.01)},
+		{ID: "ra1", AccidentDate: "2022-06-01T07:00:00Z", Location: *domain.NewPoint(62.01, 17.01)},
+		{ID: "ra2", AccidentDate: "2022-06-01T07:00:00Z", Location: *domain.NewPoint(62.10, 17.01)},
+	})
+
+	roadAccidents := svc.GetAllInBoundingBox(time.Date(2022, 5, 20, 0, 0, 0, 0, time.UTC), time.Time{}, 62.0, 17.0, 62.05, 17.05)
+	is.Equal(len(roadAccidents), 1)
+	is.Equal(roadAccidents[0].ID, "ra1")
+}
+
 var Expects = testutils.Expects
 var Returns = testutils.Returns
 var anyInput = expects.AnyInput
@@ -0,0 +1,169 @@
+package roadaccidents
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+)
+
+const (
+	PeriodDay   string = "day"
+	PeriodWeek  string = "week"
+	PeriodMonth string = "month"
+	PeriodYear  string = "year"
+)
+
+// StatisticsOptions controls how road accidents are grouped when computing statistics.
+// Accidents are always grouped by period, and optionally by status and by either
+// grid cell or district.
+type StatisticsOptions struct {
+	Period    string
+	ByStatus  bool
+	GridSize  float64
+	Districts *Districts
+}
+
+type StatisticsBucket struct {
+	Period   string    `json:"period"`
+	Status   *string   `json:"status,omitempty"`
+	Cell     []float64 `json:"cell,omitempty"`
+	District *string   `json:"district,omitempty"`
+	Count    int       `json:"count"`
+}
+
+// ComputeStatistics counts the road accidents per period and the optional groupings
+// in opts. Periods follow local time, and accidents without a valid accident date are
+// not counted. Accidents without a location are counted in a bucket without a cell or
+// district. The returned buckets are sorted by period, followed by the other grouping
+// keys.
+func ComputeStatistics(accidents []domain.RoadAccidentDetails, opts StatisticsOptions) ([]StatisticsBucket, error) {
+	if opts.GridSize > 0 && opts.Districts != nil {
+		return nil, fmt.Errorf("accidents can not be grouped by both grid and district")
+	}
+
+	if opts.GridSize < 0 || math.IsNaN(opts.GridSize) {
+		return nil, fmt.Errorf("grid size must be a positive number")
+	}
+
+	type bucketKey struct {
+		period   string
+		status   string
+		hasCell  bool
+		cellX    int64
+		cellY    int64
+		district string
+	}
+
+	counts := map[bucketKey]int{}
+
+	for _, ra := range accidents {
+		accidentDate, err := time.Parse(time.RFC3339, ra.AccidentDate)
+		if err != nil {
+			continue
+		}
+
+		period, err := periodOf(accidentDate.In(timeseries.DefaultLocation), opts.Period)
+		if err != nil {
+			return nil, err
+		}
+
+		key := bucketKey{period: period}
+
+		if opts.ByStatus {
+			key.status = ra.Status
+		}
+
+		if len(ra.Location.Coordinates) >= 2 {
+			lon, lat := ra.Location.Coordinates[0], ra.Location.Coordinates[1]
+
+			if opts.GridSize > 0 {
+				key.hasCell = true
+				key.cellX = int64(math.Floor(lon / opts.GridSize))
+				key.cellY = int64(math.Floor(lat / opts.GridSize))
+			} else if opts.Districts != nil {
+				key.district = opts.Districts.Locate(lon, lat)
+			}
+		}
+
+		counts[key]++
+	}
+
+	buckets := make([]StatisticsBucket, 0, len(counts))
+	keys := make([]bucketKey, 0, len(counts))
+
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.period != b.period {
+			return a.period < b.period
+		}
+		if a.status != b.status {
+			return a.status < b.status
+		}
+		if a.district != b.district {
+			return a.district < b.district
+		}
+		if a.hasCell != b.hasCell {
+			return !a.hasCell
+		}
+		if a.cellY != b.cellY {
+			return a.cellY < b.cellY
+		}
+		return a.cellX < b.cellX
+	})
+
+	for _, key := range keys {
+		bucket := StatisticsBucket{Period: key.period, Count: counts[key]}
+
+		if opts.ByStatus {
+			status := key.status
+			bucket.Status = &status
+		}
+
+		if key.hasCell {
+			bucket.Cell = []float64{
+				round(float64(key.cellX)*opts.GridSize, 6),
+				round(float64(key.cellY)*opts.GridSize, 6),
+				round(float64(key.cellX+1)*opts.GridSize, 6),
+				round(float64(key.cellY+1)*opts.GridSize, 6),
+			}
+		} else if opts.Districts != nil && key.district != "" {
+			district := key.district
+			bucket.District = &district
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
+
+// periodOf formats t as a key that sorts chronologically within the same period
+// length, using ISO 8601 week numbering for weeks
+func periodOf(t time.Time, period string) (string, error) {
+	switch period {
+	case PeriodDay:
+		return t.Format("2006-01-02"), nil
+	case PeriodWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week), nil
+	case PeriodMonth:
+		return t.Format("2006-01"), nil
+	case PeriodYear:
+		return t.Format("2006"), nil
+	}
+
+	return "", fmt.Errorf("unknown period %q, must be one of day, week, month or year", period)
+}
+
+func round(v float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(v*pow) / pow
+}
@@ -0,0 +1,141 @@
+package roadaccidents
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	"github.com/matryer/is"
+)
+
+func TestComputeStatisticsPerMonthAndStatus(t *testing.T) {
+	is := is.New(t)
+
+	buckets, err := ComputeStatistics(testAccidents(), StatisticsOptions{Period: PeriodMonth, ByStatus: true})
+	is.NoErr(err)
+
+	is.Equal(len(buckets), 3)
+	is.Equal(buckets[0].Period, "2022-05")
+	is.Equal(*buckets[0].Status, "onGoing")
+	is.Equal(buckets[0].Count, 1)
+	is.Equal(*buckets[1].Status, "solved")
+	is.Equal(buckets[1].Count, 2)
+	is.Equal(buckets[2].Period, "2022-06")
+}
+
+func TestComputeStatisticsPerISOWeek(t *testing.T) {
+	is := is.New(t)
+
+	buckets, err := ComputeStatistics(testAccidents(), StatisticsOptions{Period: PeriodWeek})
+	is.NoErr(err)
+
+	is.Equal(len(buckets), 3)
+	is.Equal(buckets[0].Period, "2022-W17") // 2022-05-01 is a sunday and belongs to week 17
+	is.Equal(buckets[1].Period, "2022-W18")
+	is.Equal(buckets[1].Count, 2)
+}
+
+func TestComputeStatisticsPerGridCell(t *testing.T) {
+	is := is.New(t)
+
+	buckets, err := ComputeStatistics(testAccidents(), StatisticsOptions{Period: PeriodYear, GridSize: 0.1})
+	is.NoErr(err)
+
+	is.Equal(len(buckets), 2)
+	is.Equal(buckets[0].Cell, []float64{17.3, 62.3, 17.4, 62.4})
+	is.Equal(buckets[0].Count, 3)
+}
+
+func TestThatAccidentsWithoutLocationHaveNoCell(t *testing.T) {
+	is := is.New(t)
+
+	accidents := append(testAccidents(), domain.RoadAccidentDetails{ID: "ra5", AccidentDate: "2022-05-01T07:00:00Z"})
+
+	buckets, err := ComputeStatistics(accidents, StatisticsOptions{Period: PeriodYear, GridSize: 0.1})
+	is.NoErr(err)
+
+	is.Equal(len(buckets), 3)
+	is.Equal(buckets[0].Cell, nil) // accidents without a location should not be placed in a cell
+	is.Equal(buckets[0].Count, 1)
+	is.Equal(buckets[1].Cell, []float64{17.3, 62.3, 17.4, 62.4})
+}
+
+func TestThatPeriodsFollowLocalTime(t *testing.T) {
+	is := is.New(t)
+
+	accidents := []domain.RoadAccidentDetails{
+		{ID: "ra0", AccidentDate: "2022-05-31T22:30:00Z"}, // 00:30 on the first of june in Stockholm
+		{ID: "ra1", AccidentDate: "2022-06-01T07:00:00Z"},
+	}
+
+	buckets, err := ComputeStatistics(accidents, StatisticsOptions{Period: PeriodMonth})
+	is.NoErr(err)
+
+	is.Equal(len(buckets), 1)
+	is.Equal(buckets[0].Period, "2022-06")
+	is.Equal(buckets[0].Count, 2)
+
+	buckets, err = ComputeStatistics(accidents, StatisticsOptions{Period: PeriodDay})
+	is.NoErr(err)
+	is.Equal(buckets[0].Period, "2022-06-01")
+	is.Equal(buckets[0].Count, 2)
+}
+
+func TestComputeStatisticsPerDistrict(t *testing.T) {
+	is := is.New(t)
+
+	districts, err := NewDistrictsFromGeoJSON(strings.NewReader(districtsGeoJSON), "name")
+	is.NoErr(err)
+
+	buckets, err := ComputeStatistics(testAccidents(), StatisticsOptions{Period: PeriodYear, Districts: districts})
+	is.NoErr(err)
+
+	is.Equal(len(buckets), 2)
+	is.Equal(buckets[0].District, nil) // accidents outside all districts should not get a district
+	is.Equal(buckets[0].Count, 1)
+	is.Equal(*buckets[1].District, "Centrum")
+	is.Equal(buckets[1].Count, 3)
+}
+
+func TestComputeStatisticsFailsOnUnknownPeriod(t *testing.T) {
+	is := is.New(t)
+
+	_, err := ComputeStatistics(testAccidents(), StatisticsOptions{Period: "decade"})
+	is.True(err != nil)
+}
+
+func TestThatDistrictHolesAreExcluded(t *testing.T) {
+	is := is.New(t)
+
+	districts, err := NewDistrictsFromGeoJSON(strings.NewReader(districtsGeoJSON), "name")
+	is.NoErr(err)
+
+	is.Equal(districts.Locate(17.35, 62.35), "Centrum")
+	is.Equal(districts.Locate(17.395, 62.395), "") // within the hole of the polygon
+	is.Equal(districts.Locate(16.0, 62.0), "")
+}
+
+func testAccidents() []domain.RoadAccidentDetails {
+	return []domain.RoadAccidentDetails{
+		{ID: "ra0", Location: *domain.NewPoint(62.35, 17.35), AccidentDate: "2022-05-01T07:00:00Z", Status: "solved"},
+		{ID: "ra1", Location: *domain.NewPoint(62.36, 17.36), AccidentDate: "2022-05-03T07:00:00Z", Status: "solved"},
+		{ID: "ra2", Location: *domain.NewPoint(62.37, 17.37), AccidentDate: "2022-05-04T07:00:00Z", Status: "onGoing"},
+		{ID: "ra3", Location: *domain.NewPoint(62.55, 17.55), AccidentDate: "2022-06-01T07:00:00Z", Status: "solved"},
+		{ID: "ra4", Location: *domain.NewPoint(62.55, 17.55), AccidentDate: "not a date", Status: "solved"},
+	}
+}
+
+const districtsGeoJSON string = `{
+	"type": "FeatureCollection",
+	"features": [{
+		"type": "Feature",
+		"properties": {"name": "Centrum"},
+		"geometry": {
+			"type": "Polygon",
+			"coordinates": [
+				[[17.3, 62.3], [17.4, 62.3], [17.4, 62.4], [17.3, 62.4], [17.3, 62.3]],
+				[[17.39, 62.39], [17.399, 62.39], [17.399, 62.399], [17.39, 62.399], [17.39, 62.39]]
+			]
+		}
+	}]
+}`
@@ -9,6 +9,7 @@ import (
 
 	"log/slog"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/organisations"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
@@ -20,12 +21,20 @@ import (
 
 var tracer = otel.Tracer("api-opendata/svcs/sportsfields")
 
+// nearbyCellSize is the size in metres of the cells of the spatial index of sports fields
+const nearbyCellSize float64 = 1000
+
+// maxStatusChanges limits how many of the most recent status changes we keep
+const maxStatusChanges int = 50
+
 type SportsFieldService interface {
 	Broker() string
 	Tenant() string
 
 	GetAll(requiredCategories []string) []domain.SportsField
 	GetByID(id string) (*domain.SportsField, error)
+	GetAllNearPoint(lat, lon float64, maxDistance int, requiredCategories []string) []domain.SportsField
+	GetStatusChanges() []domain.StatusChange
 
 	Start(ctx context.Context)
 	Shutdown(ctx context.Context)
@@ -35,6 +44,8 @@ func NewSportsFieldService(ctx context.Context, contextBrokerURL, tenant string,
 	svc := &sportsfieldSvc{
 		sportsfields:        []domain.SportsField{},
 		sportsfieldsDetails: map[string]int{},
+		nearby:              geo.NewIndex[int](nearbyCellSize),
+		statusChanges:       []domain.StatusChange{},
 		orgRegistry:         orgreg,
 		contextBrokerURL:    contextBrokerURL,
 		tenant:              tenant,
@@ -48,6 +59,8 @@ type sportsfieldSvc struct {
 	sportsfieldsMutex   sync.Mutex
 	sportsfields        []domain.SportsField
 	sportsfieldsDetails map[string]int
+	nearby              *geo.Index[int]
+	statusChanges       []domain.StatusChange
 	orgRegistry         organisations.Registry
 	contextBrokerURL    string
 	tenant              string
@@ -72,20 +85,8 @@ func (svc *sportsfieldSvc) GetAll(requiredCategories []string) []domain.SportsFi
 
 	result := make([]domain.SportsField, 0, len(svc.sportsfields))
 
-	anyCategoryMatches := func(categories []string) bool {
-		for _, category := range categories {
-			for _, requiredCategory := range requiredCategories {
-				if category == requiredCategory {
-					return true
-				}
-			}
-		}
-
-		return false
-	}
-
 	for idx := range svc.sportsfields {
-		if anyCategoryMatches(svc.sportsfields[idx].Categories) {
+		if anyCategoryMatches(svc.sportsfields[idx].Categories, requiredCategories) {
 			result = append(result, svc.sportsfields[idx])
 		}
 	}
@@ -93,6 +94,19 @@ func (svc *sportsfieldSvc) GetAll(requiredCategories []string) []domain.SportsFi
 	return result
 }
 
+// anyCategoryMatches reports whether any of the categories is one of the required ones
+func anyCategoryMatches(categories, requiredCategories []string) bool {
+	for _, category := range categories {
+		for _, requiredCategory := range requiredCategories {
+			if category == requiredCategory {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func (svc *sportsfieldSvc) GetByID(id string) (*domain.SportsField, error) {
 	svc.sportsfieldsMutex.Lock()
 	defer svc.sportsfieldsMutex.Unlock()
@@ -105,6 +119,31 @@ func (svc *sportsfieldSvc) GetByID(id string) (*domain.SportsField, error) {
 	return &svc.sportsfields[index], nil
 }
 
+// GetAllNearPoint returns the sports fields with a center within maxDistance metres from the point,
+// nearest first. If any categories are required, only those in one of them are returned.
+func (svc *sportsfieldSvc) GetAllNearPoint(lat, lon float64, maxDistance int, requiredCategories []string) []domain.SportsField {
+	svc.sportsfieldsMutex.Lock()
+	defer svc.sportsfieldsMutex.Unlock()
+
+	nearby := svc.nearby.Within(lat, lon, float64(maxDistance))
+	result := make([]domain.SportsField, 0, len(nearby))
+
+	for _, n := range nearby {
+		if len(requiredCategories) == 0 || anyCategoryMatches(svc.sportsfields[n.Item].Categories, requiredCategories) {
+			result = append(result, svc.sportsfields[n.Item])
+		}
+	}
+
+	return result
+}
+
+func (svc *sportsfieldSvc) GetStatusChanges() []domain.StatusChange {
+	svc.sportsfieldsMutex.Lock()
+	defer svc.sportsfieldsMutex.Unlock()
+
+	return svc.statusChanges
+}
+
 func (svc *sportsfieldSvc) Start(ctx context.Context) {
 	logger := logging.GetFromContext(ctx)
 	logger.Info("starting sports fields service")
@@ -200,21 +239,52 @@ func (svc *sportsfieldSvc) refresh(ctx context.Context) (count int, err error) {
 		return
 	}
 
-	svc.storeSportsFieldList(sportsfields)
+	svc.storeSportsFieldList(sportsfields, time.Now().UTC())
 
 	return
 }
 
-func (svc *sportsfieldSvc) storeSportsFieldList(list []domain.SportsField) {
+func (svc *sportsfieldSvc) storeSportsFieldList(list []domain.SportsField, now time.Time) {
 	svc.sportsfieldsMutex.Lock()
 	defer svc.sportsfieldsMutex.Unlock()
 
+	// status changes can only be detected once we have a previous list to compare with
+	if len(svc.sportsfields) > 0 {
+		for _, field := range list {
+			index, ok := svc.sportsfieldsDetails[field.ID]
+			if !ok || svc.sportsfields[index].Status == field.Status {
+				continue
+			}
+
+			svc.statusChanges = append([]domain.StatusChange{{
+				ID:             field.ID,
+				Name:           field.Name,
+				Status:         field.Status,
+				PreviousStatus: svc.sportsfields[index].Status,
+				DateChanged:    now.Format(time.RFC3339),
+			}}, svc.statusChanges...)
+		}
+
+		if len(svc.statusChanges) > maxStatusChanges {
+			svc.statusChanges = svc.statusChanges[:maxStatusChanges]
+		}
+	}
+
 	svc.sportsfields = list
 	svc.sportsfieldsDetails = map[string]int{}
 
 	for index := range list {
 		svc.sportsfieldsDetails[list[index].ID] = index
 	}
+
+	nearby := geo.NewIndex[int](nearbyCellSize)
+	for index := range list {
+		if lat, lon, ok := list[index].Location.Center(); ok {
+			nearby.Add(lat, lon, index)
+		}
+	}
+
+	svc.nearby = nearby
 }
 
 type sportsFieldDTO struct {
@@ -25,9 +25,15 @@ var _ SportsFieldService = &SportsFieldServiceMock{}
 //			GetAllFunc: func(requiredCategories []string) []domain.SportsField {
 //				panic("mock out the GetAll method")
 //			},
+//			GetAllNearPointFunc: func(lat float64, lon float64, maxDistance int, requiredCategories []string) []domain.SportsField {
+//				panic("mock out the GetAllNearPoint method")
+//			},
 //			GetByIDFunc: func(id string) (*domain.SportsField, error) {
 //				panic("mock out the GetByID method")
 //			},
+//			GetStatusChangesFunc: func() []domain.StatusChange {
+//				panic("mock out the GetStatusChanges method")
+//			},
 //			ShutdownFunc: func(ctx context.Context)  {
 //				panic("mock out the Shutdown method")
 //			},
@@ -50,9 +56,15 @@ type SportsFieldServiceMock struct {
 	// GetAllFunc mocks the GetAll method.
 	GetAllFunc func(requiredCategories []string) []domain.SportsField
 
+	// GetAllNearPointFunc mocks the GetAllNearPoint method.
+	GetAllNearPointFunc func(lat float64, lon float64, maxDistance int, requiredCategories []string) []domain.SportsField
+
 	// GetByIDFunc mocks the GetByID method.
 	GetByIDFunc func(id string) (*domain.SportsField, error)
 
+	// GetStatusChangesFunc mocks the GetStatusChanges method.
+	GetStatusChangesFunc func() []domain.StatusChange
+
 	// ShutdownFunc mocks the Shutdown method.
 	ShutdownFunc func(ctx context.Context)
 
@@ -72,11 +84,25 @@ type SportsFieldServiceMock struct {
 			// RequiredCategories is the requiredCategories argument value.
 			RequiredCategories []string
 		}
+		// GetAllNearPoint holds details about calls to the GetAllNearPoint method.
+		GetAllNearPoint []struct {
+			// Lat is the lat argument value.
+			Lat float64
+			// Lon is the lon argument value.
+			Lon float64
+			// MaxDistance is the maxDistance argument value.
+			MaxDistance int
+			// RequiredCategories is the requiredCategories argument value.
+			RequiredCategories []string
+		}
 		// GetByID holds details about calls to the GetByID method.
 		GetByID []struct {
 			// ID is the id argument value.
 			ID string
 		}
+		// GetStatusChanges holds details about calls to the GetStatusChanges method.
+		GetStatusChanges []struct {
+		}
 		// Shutdown holds details about calls to the Shutdown method.
 		Shutdown []struct {
 			// Ctx is the ctx argument value.
@@ -91,12 +117,14 @@ type SportsFieldServiceMock struct {
 		Tenant []struct {
 		}
 	}
-	lockBroker   sync.RWMutex
-	lockGetAll   sync.RWMutex
-	lockGetByID  sync.RWMutex
-	lockShutdown sync.RWMutex
-	lockStart    sync.RWMutex
-	lockTenant   sync.RWMutex
+	lockBroker           sync.RWMutex
+	lockGetAll           sync.RWMutex
+	lockGetAllNearPoint  sync.RWMutex
+	lockGetByID          sync.RWMutex
+	lockGetStatusChanges sync.RWMutex
+	lockShutdown         sync.RWMutex
+	lockStart            sync.RWMutex
+	lockTenant           sync.RWMutex
 }
 
 // Broker calls BrokerFunc.
@@ -158,6 +186,50 @@ func (mock *SportsFieldServiceMock) GetAllCalls() []struct {
 	return calls
 }
 
+// GetAllNearPoint calls GetAllNearPointFunc.
+func (mock *SportsFieldServiceMock) GetAllNearPoint(lat float64, lon float64, maxDistance int, requiredCategories []string) []domain.SportsField {
+	if mock.GetAllNearPointFunc == nil {
+		panic("SportsFieldServiceMock.GetAllNearPointFunc: method is nil but SportsFieldService.GetAllNearPoint was just called")
+	}
+	callInfo := struct {
+		Lat                float64
+		Lon                float64
+		MaxDistance        int
+		RequiredCategories []string
+	}{
+		Lat:                lat,
+		Lon:                lon,
+		MaxDistance:        maxDistance,
+		RequiredCategories: requiredCategories,
+	}
+	mock.lockGetAllNearPoint.Lock()
+	mock.calls.GetAllNearPoint = append(mock.calls.GetAllNearPoint, callInfo)
+	mock.lockGetAllNearPoint.Unlock()
+	return mock.GetAllNearPointFunc(lat, lon, maxDistance, requiredCategories)
+}
+
+// GetAllNearPointCalls gets all the calls that were made to GetAllNearPoint.
+// Check the length with:
+//
+//	len(mockedSportsFieldService.GetAllNearPointCalls())
+func (mock *SportsFieldServiceMock) GetAllNearPointCalls() []struct {
+	Lat                float64
+	Lon                float64
+	MaxDistance        int
+	RequiredCategories []string
+} {
+	var calls []struct {
+		Lat                float64
+		Lon                float64
+		MaxDistance        int
+		RequiredCategories []string
+	}
+	mock.lockGetAllNearPoint.RLock()
+	calls = mock.calls.GetAllNearPoint
+	mock.lockGetAllNearPoint.RUnlock()
+	return calls
+}
+
 // GetByID calls GetByIDFunc.
 func (mock *SportsFieldServiceMock) GetByID(id string) (*domain.SportsField, error) {
 	if mock.GetByIDFunc == nil {
@@ -190,6 +262,33 @@ func (mock *SportsFieldServiceMock) GetByIDCalls() []struct {
 	return calls
 }
 
+// GetStatusChanges calls GetStatusChangesFunc.
+func (mock *SportsFieldServiceMock) GetStatusChanges() []domain.StatusChange {
+	if mock.GetStatusChangesFunc == nil {
+		panic("SportsFieldServiceMock.GetStatusChangesFunc: method is nil but SportsFieldService.GetStatusChanges was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockGetStatusChanges.Lock()
+	mock.calls.GetStatusChanges = append(mock.calls.GetStatusChanges, callInfo)
+	mock.lockGetStatusChanges.Unlock()
+	return mock.GetStatusChangesFunc()
+}
+
+// GetStatusChangesCalls gets all the calls that were made to GetStatusChanges.
+// Check the length with:
+//
+//	len(mockedSportsFieldService.GetStatusChangesCalls())
+func (mock *SportsFieldServiceMock) GetStatusChangesCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockGetStatusChanges.RLock()
+	calls = mock.calls.GetStatusChanges
+	mock.lockGetStatusChanges.RUnlock()
+	return calls
+}
+
 // Shutdown calls ShutdownFunc.
 func (mock *SportsFieldServiceMock) Shutdown(ctx context.Context) {
 	if mock.ShutdownFunc == nil {
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"testing"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 
 	testutils "github.com/diwise/service-chassis/pkg/test/http"
 	"github.com/diwise/service-chassis/pkg/test/http/expects"
@@ -71,3 +74,47 @@ func testSetup(t *testing.T, statusCode int, responseBody string) (*is.I, contex
 const testData string = `[{"@context":["https://raw.githubusercontent.com/diwise/context-broker/main/assets/jsonldcontexts/default-context.jsonl"],"category":["skating","floodlit","ice-rink"],"dateCreated":{"@type":"DateTime","@value":"2022-01-25T15:37:55Z"},"dateModified":{"@type":"DateTime","@value":"2022-01-25T22:08:19Z"},"description":"Stenstans konstfrusna isbana på Stora Torget är alltid öppen för alla att åka på fram tom sportlovsveckan. Snöröjs och spolas fem gånger i veckan beroende på väder. Belysning är alltid på och musik spelas under dagtid. Fritidsbanken lånar gratis ut skridskor och hjälmar måndag-torsdag 9-21, fredag 9-18, lördag-söndag 10-18.","id":"urn:ngsi-ld:SportsField:se:sundsvall:facilities:3142","location":{"type":"MultiPolygon","coordinates":[[[[17.306436,62.390592],[17.306383,62.390501],[17.30692,62.390437],[17.306973,62.390532],[17.306436,62.390592]]]]},"name":"Stora Torget isbana","publicAccess":"after-school","source":"https://api.sundsvall.se/facilities/2.1/get/3142","type":"SportsField"}]`
 
 const expectedOutput string = `{"id":"urn:ngsi-ld:SportsField:se:sundsvall:facilities:3142","name":"Stora Torget isbana","description":"Stenstans konstfrusna isbana på Stora Torget är alltid öppen för alla att åka på fram tom sportlovsveckan. Snöröjs och spolas fem gånger i veckan beroende på väder. Belysning är alltid på och musik spelas under dagtid. Fritidsbanken lånar gratis ut skridskor och hjälmar måndag-torsdag 9-21, fredag 9-18, lördag-söndag 10-18.","categories":["skating","floodlit","ice-rink"],"publicAccess":"after-school","location":{"type":"MultiPolygon","coordinates":[[[[17.306436,62.390592],[17.306383,62.390501],[17.30692,62.390437],[17.306973,62.390532],[17.306436,62.390592]]]]},"dateCreated":"2022-01-25T15:37:55Z","dateModified":"2022-01-25T22:08:19Z","source":"https://api.sundsvall.se/facilities/2.1/get/3142"}`
+
+func TestThatStatusChangesAreRecordedNewestFirst(t *testing.T) {
+	is := is.New(t)
+
+	svci := NewSportsFieldService(context.Background(), "ignored", "ignored", nil)
+	svc, ok := svci.(*sportsfieldSvc)
+	is.True(ok)
+
+	first := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+
+	svc.storeSportsFieldList([]domain.SportsField{{ID: "sf0", Status: "closed"}}, first)
+	svc.storeSportsFieldList([]domain.SportsField{{ID: "sf0", Status: "open"}}, first.Add(time.Hour))
+	svc.storeSportsFieldList([]domain.SportsField{{ID: "sf0", Status: "closed"}}, first.Add(2*time.Hour))
+
+	changes := svc.GetStatusChanges()
+	is.Equal(len(changes), 2)
+	is.Equal(changes[0].Status, "closed") // the most recent change should be first
+	is.Equal(changes[1].Status, "open")
+}
+
+func TestThatSportsFieldsAreFoundNearTheirCenter(t *testing.T) {
+	is := is.New(t)
+
+	svci := NewSportsFieldService(context.Background(), "ignored", "ignored", nil)
+	svc, ok := svci.(*sportsfieldSvc)
+	is.True(ok)
+
+	square := func(lon, lat float64) domain.MultiPolygon {
+		return domain.MultiPolygon{Type: "MultiPolygon", Coordinates: [][][][]float64{{{
+			{lon - 0.001, lat - 0.001}, {lon + 0.001, lat - 0.001}, {lon + 0.001, lat + 0.001}, {lon - 0.001, lat + 0.001}, {lon - 0.001, lat - 0.001},
+		}}}}
+	}
+
+	svc.storeSportsFieldList([]domain.SportsField{
+		{ID: "far", Location: square(17.40, 62.40)},
+		{ID: "near", Location: square(17.31, 62.39)},
+		{ID: "nearest", Location: square(17.306, 62.39)},
+	}, time.Now())
+
+	fields := svc.GetAllNearPoint(62.39, 17.306, 1000, []string{})
+	is.Equal(len(fields), 2)
+	is.Equal(fields[0].ID, "nearest")
+	is.Equal(fields[1].ID, "near")
+}
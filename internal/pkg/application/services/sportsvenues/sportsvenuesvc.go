@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/organisations"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
@@ -19,12 +20,16 @@ import (
 
 var tracer = otel.Tracer("api-opendata/svcs/sportsvenues")
 
+// nearbyCellSize is the size in metres of the cells of the spatial index of sports venues
+const nearbyCellSize float64 = 1000
+
 type SportsVenueService interface {
 	Broker() string
 	Tenant() string
 
 	GetAll(requiredCategories []string) []domain.SportsVenue
 	GetByID(id string) (*domain.SportsVenue, error)
+	GetAllNearPoint(lat, lon float64, maxDistance int, requiredCategories []string) []domain.SportsVenue
 
 	Start(ctx context.Context)
 	Shutdown(ctx context.Context)
@@ -34,6 +39,7 @@ func NewSportsVenueService(ctx context.Context, contextBrokerURL, tenant string,
 	svc := &sportsvenueSvc{
 		sportsvenues:        []domain.SportsVenue{},
 		sportsvenuesDetails: map[string]int{},
+		nearby:              geo.NewIndex[int](nearbyCellSize),
 		contextBrokerURL:    contextBrokerURL,
 		orgRegistry:         orgreg,
 		tenant:              tenant,
@@ -47,6 +53,7 @@ type sportsvenueSvc struct {
 	sportsvenuesMutex   sync.Mutex
 	sportsvenues        []domain.SportsVenue
 	sportsvenuesDetails map[string]int
+	nearby              *geo.Index[int]
 	orgRegistry         organisations.Registry
 	contextBrokerURL    string
 	tenant              string
@@ -71,20 +78,8 @@ func (svc *sportsvenueSvc) GetAll(requiredCategories []string) []domain.SportsVe
 
 	result := make([]domain.SportsVenue, 0, len(svc.sportsvenues))
 
-	anyCategoryMatches := func(categories []string) bool {
-		for _, category := range categories {
-			for _, requiredCategory := range requiredCategories {
-				if category == requiredCategory {
-					return true
-				}
-			}
-		}
-
-		return false
-	}
-
 	for idx := range svc.sportsvenues {
-		if anyCategoryMatches(svc.sportsvenues[idx].Categories) {
+		if anyCategoryMatches(svc.sportsvenues[idx].Categories, requiredCategories) {
 			result = append(result, svc.sportsvenues[idx])
 		}
 	}
@@ -92,6 +87,19 @@ func (svc *sportsvenueSvc) GetAll(requiredCategories []string) []domain.SportsVe
 	return result
 }
 
+// anyCategoryMatches reports whether any of the categories is one of the required ones
+func anyCategoryMatches(categories, requiredCategories []string) bool {
+	for _, category := range categories {
+		for _, requiredCategory := range requiredCategories {
+			if category == requiredCategory {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func (svc *sportsvenueSvc) GetByID(id string) (*domain.SportsVenue, error) {
 	svc.sportsvenuesMutex.Lock()
 	defer svc.sportsvenuesMutex.Unlock()
@@ -104,6 +112,24 @@ func (svc *sportsvenueSvc) GetByID(id string) (*domain.SportsVenue, error) {
 	return &svc.sportsvenues[index], nil
 }
 
+// GetAllNearPoint returns the sports venues with a center within maxDistance metres from the point,
+// nearest first. If any categories are required, only those in one of them are returned.
+func (svc *sportsvenueSvc) GetAllNearPoint(lat, lon float64, maxDistance int, requiredCategories []string) []domain.SportsVenue {
+	svc.sportsvenuesMutex.Lock()
+	defer svc.sportsvenuesMutex.Unlock()
+
+	nearby := svc.nearby.Within(lat, lon, float64(maxDistance))
+	result := make([]domain.SportsVenue, 0, len(nearby))
+
+	for _, n := range nearby {
+		if len(requiredCategories) == 0 || anyCategoryMatches(svc.sportsvenues[n.Item].Categories, requiredCategories) {
+			result = append(result, svc.sportsvenues[n.Item])
+		}
+	}
+
+	return result
+}
+
 func (svc *sportsvenueSvc) Start(ctx context.Context) {
 	logger := logging.GetFromContext(ctx)
 	logger.Info("starting sports venues service")
@@ -210,6 +236,15 @@ func (svc *sportsvenueSvc) storeSportsVenueList(list []domain.SportsVenue) {
 	for index := range list {
 		svc.sportsvenuesDetails[list[index].ID] = index
 	}
+
+	nearby := geo.NewIndex[int](nearbyCellSize)
+	for index := range list {
+		if lat, lon, ok := list[index].Location.Center(); ok {
+			nearby.Add(lat, lon, index)
+		}
+	}
+
+	svc.nearby = nearby
 }
 
 type sportsVenueDTO struct {
@@ -25,6 +25,9 @@ var _ SportsVenueService = &SportsVenueServiceMock{}
 //			GetAllFunc: func(requiredCategories []string) []domain.SportsVenue {
 //				panic("mock out the GetAll method")
 //			},
+//			GetAllNearPointFunc: func(lat float64, lon float64, maxDistance int, requiredCategories []string) []domain.SportsVenue {
+//				panic("mock out the GetAllNearPoint method")
+//			},
 //			GetByIDFunc: func(id string) (*domain.SportsVenue, error) {
 //				panic("mock out the GetByID method")
 //			},
@@ -50,6 +53,9 @@ type SportsVenueServiceMock struct {
 	// GetAllFunc mocks the GetAll method.
 	GetAllFunc func(requiredCategories []string) []domain.SportsVenue
 
+	// GetAllNearPointFunc mocks the GetAllNearPoint method.
+	GetAllNearPointFunc func(lat float64, lon float64, maxDistance int, requiredCategories []string) []domain.SportsVenue
+
 	// GetByIDFunc mocks the GetByID method.
 	GetByIDFunc func(id string) (*domain.SportsVenue, error)
 
@@ -72,6 +78,17 @@ type SportsVenueServiceMock struct {
 			// RequiredCategories is the requiredCategories argument value.
 			RequiredCategories []string
 		}
+		// GetAllNearPoint holds details about calls to the GetAllNearPoint method.
+		GetAllNearPoint []struct {
+			// Lat is the lat argument value.
+			Lat float64
+			// Lon is the lon argument value.
+			Lon float64
+			// MaxDistance is the maxDistance argument value.
+			MaxDistance int
+			// RequiredCategories is the requiredCategories argument value.
+			RequiredCategories []string
+		}
 		// GetByID holds details about calls to the GetByID method.
 		GetByID []struct {
 			// ID is the id argument value.
@@ -91,12 +108,13 @@ type SportsVenueServiceMock struct {
 		Tenant []struct {
 		}
 	}
-	lockBroker   sync.RWMutex
-	lockGetAll   sync.RWMutex
-	lockGetByID  sync.RWMutex
-	lockShutdown sync.RWMutex
-	lockStart    sync.RWMutex
-	lockTenant   sync.RWMutex
+	lockBroker          sync.RWMutex
+	lockGetAll          sync.RWMutex
+	lockGetAllNearPoint sync.RWMutex
+	lockGetByID         sync.RWMutex
+	lockShutdown        sync.RWMutex
+	lockStart           sync.RWMutex
+	lockTenant          sync.RWMutex
 }
 
 // Broker calls BrokerFunc.
@@ -158,6 +176,50 @@ func (mock *SportsVenueServiceMock) GetAllCalls() []struct {
 	return calls
 }
 
+// GetAllNearPoint calls GetAllNearPointFunc.
+func (mock *SportsVenueServiceMock) GetAllNearPoint(lat float64, lon float64, maxDistance int, requiredCategories []string) []domain.SportsVenue {
+	if mock.GetAllNearPointFunc == nil {
+		panic("SportsVenueServiceMock.GetAllNearPointFunc: method is nil but SportsVenueService.GetAllNearPoint was just called")
+	}
+	callInfo := struct {
+		Lat                float64
+		Lon                float64
+		MaxDistance        int
+		RequiredCategories []string
+	}{
+		Lat:                lat,
+		Lon:                lon,
+		MaxDistance:        maxDistance,
+		RequiredCategories: requiredCategories,
+	}
+	mock.lockGetAllNearPoint.Lock()
+	mock.calls.GetAllNearPoint = append(mock.calls.GetAllNearPoint, callInfo)
+	mock.lockGetAllNearPoint.Unlock()
+	return mock.GetAllNearPointFunc(lat, lon, maxDistance, requiredCategories)
+}
+
+// GetAllNearPointCalls gets all the calls that were made to GetAllNearPoint.
+// Check the length with:
+//
+//	len(mockedSportsVenueService.GetAllNearPointCalls())
+func (mock *SportsVenueServiceMock) GetAllNearPointCalls() []struct {
+	Lat                float64
+	Lon                float64
+	MaxDistance        int
+	RequiredCategories []string
+} {
+	var calls []struct {
+		Lat                float64
+		Lon                float64
+		MaxDistance        int
+		RequiredCategories []string
+	}
+	mock.lockGetAllNearPoint.RLock()
+	calls = mock.calls.GetAllNearPoint
+	mock.lockGetAllNearPoint.RUnlock()
+	return calls
+}
+
 // GetByID calls GetByIDFunc.
 func (mock *SportsVenueServiceMock) GetByID(id string) (*domain.SportsVenue, error) {
 	if mock.GetByIDFunc == nil {
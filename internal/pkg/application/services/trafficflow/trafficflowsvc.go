@@ -0,0 +1,615 @@
+package trafficflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"log/slog"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/temporal"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("api-opendata/svcs/trafficflow")
+
+// maxConcurrentRequests limits the number of temporal requests that are sent to the
+// broker at the same time when the history of the lanes is requested
+const maxConcurrentRequests int = 4
+
+// ErrInvalidQuery is returned when the time span of a query is invalid
+var ErrInvalidQuery error = errors.New("invalid query")
+
+// MaxTimespan is the longest time span that can be retrieved from the broker when the
+// start of a query is older than the history that is kept in memory
+const MaxTimespan time.Duration = 31 * 24 * time.Hour
+
+// olderTTL is how long the observations from before the history in memory are cached.
+// Time spans are rounded outwards to whole multiples of it, so that queries for similar
+// time spans share the observations until they expire.
+const olderTTL time.Duration = 5 * time.Minute
+
+// maxCachedSpans limits the number of older time spans that are cached at the same time
+const maxCachedSpans int = 50
+
+//go:generate moq -rm -out trafficflowsvc_mock.go . TrafficFlowService
+
+type TrafficFlowService interface {
+	Broker() string
+	Tenant() string
+
+	Query(ctx context.Context, from, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error)
+	GetRoadSegments() []domain.RoadSegment
+
+	Start(ctx context.Context)
+	Shutdown(ctx context.Context)
+}
+
+// NewTrafficFlowService creates a service that keeps the traffic flow observations
+// from the last window in memory. The history of the window is loaded from the temporal
+// API when the service starts and is then kept up to date by polling the broker for the
+// latest observation per lane.
+func NewTrafficFlowService(ctx context.Context, contextBrokerURL, tenant string, window time.Duration) TrafficFlowService {
+	svc := &trafficFlowSvc{
+		contextBrokerURL: contextBrokerURL,
+		tenant:           tenant,
+		window:           window,
+		cbClient:         contextbroker.NewContextBrokerClient(contextBrokerURL, contextbroker.Tenant(tenant)),
+
+		observations: []domain.TrafficFlowObserved{},
+		observed:     map[string]struct{}{},
+		lanes:        map[string]lane{},
+		older:        map[string]cachedSpan{},
+
+		keepRunning: true,
+	}
+
+	return svc
+}
+
+type trafficFlowSvc struct {
+	contextBrokerURL string
+	tenant           string
+	window           time.Duration
+	cbClient         contextbroker.ContextBrokerClient
+
+	trafficFlowMutex sync.Mutex
+	observations     []domain.TrafficFlowObserved
+	observed         map[string]struct{}
+	lanes            map[string]lane
+	older            map[string]cachedSpan
+
+	// historyFrom is the start of the history that is kept in memory, or zero until the
+	// history of the window has been loaded
+	historyFrom time.Time
+
+	keepRunning bool
+}
+
+type cachedSpan struct {
+	observations []domain.TrafficFlowObserved
+	fetchedAt    time.Time
+}
+
+func (svc *trafficFlowSvc) Broker() string {
+	return svc.contextBrokerURL
+}
+
+func (svc *trafficFlowSvc) Tenant() string {
+	return svc.tenant
+}
+
+// Query returns the observations within the time span from - to, ordered by date
+// observed, road segment and lane. A zero from or to time leaves that end of the time
+// span open, and an empty list of segments includes all road segments. Observations
+// from before the history that is kept in memory are retrieved from the broker, and the
+// part of the time span before the history must not be longer than MaxTimespan. A longer
+// time span, or one that ends before it starts, makes the query fail with ErrInvalidQuery.
+func (svc *trafficFlowSvc) Query(ctx context.Context, from, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, fmt.Errorf("%w: the end of the time span must not be before its start", ErrInvalidQuery)
+	}
+
+	svc.trafficFlowMutex.Lock()
+	result := filterObservations(svc.observations, from, to, segments)
+	historyFrom := svc.historyFrom
+	svc.trafficFlowMutex.Unlock()
+
+	if from.IsZero() || (!historyFrom.IsZero() && !from.Before(historyFrom)) {
+		return result, nil
+	}
+
+	end := historyFrom
+	if end.IsZero() || (!to.IsZero() && to.Before(end)) {
+		end = to
+	}
+	if end.IsZero() {
+		end = time.Now().UTC()
+	}
+
+	if end.Sub(from) > MaxTimespan {
+		return nil, fmt.Errorf("%w: the time span must not be longer than %s", ErrInvalidQuery, MaxTimespan)
+	}
+
+	older, err := svc.getOlderObservations(ctx, from, end, segments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve traffic flows from context broker: %w", err)
+	}
+
+	observed := map[string]struct{}{}
+	for _, o := range result {
+		observed[observationKey(o)] = struct{}{}
+	}
+
+	for _, o := range filterObservations(older, from, to, segments) {
+		if _, ok := observed[observationKey(o)]; !ok {
+			observed[observationKey(o)] = struct{}{}
+			result = append(result, o)
+		}
+	}
+
+	sortObservations(result)
+
+	return result, nil
+}
+
+// getOlderObservations returns the observations on the road segments between from and
+// to that are retrieved from the broker. The observations of the time span rounded
+// outwards to whole multiples of olderTTL are cached, so that repeated queries for an
+// older time span do not request it from the broker again.
+func (svc *trafficFlowSvc) getOlderObservations(ctx context.Context, from, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+	spanFrom := from.Truncate(olderTTL)
+	spanTo := to.Truncate(olderTTL)
+	if spanTo.Before(to) {
+		spanTo = spanTo.Add(olderTTL)
+	}
+
+	sortedSegments := slices.Clone(segments)
+	sort.Strings(sortedSegments)
+
+	key := fmt.Sprintf("%s|%s|%s", spanFrom.Format(time.RFC3339), spanTo.Format(time.RFC3339), strings.Join(sortedSegments, ","))
+	now := time.Now()
+
+	svc.trafficFlowMutex.Lock()
+	cached, ok := svc.older[key]
+	svc.trafficFlowMutex.Unlock()
+
+	if ok && now.Sub(cached.fetchedAt) < olderTTL {
+		return filterObservations(cached.observations, from, to, segments), nil
+	}
+
+	observations, err := svc.retrieveObservations(ctx, spanFrom, spanTo, segments)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.trafficFlowMutex.Lock()
+	defer svc.trafficFlowMutex.Unlock()
+
+	svc.evictOlderSpans(now)
+	svc.older[key] = cachedSpan{observations: observations, fetchedAt: now}
+
+	return filterObservations(observations, from, to, segments), nil
+}
+
+// evictOlderSpans removes the expired time spans from the cache, along with the oldest
+// ones if there is no room for another time span. It must be called with the mutex held.
+func (svc *trafficFlowSvc) evictOlderSpans(now time.Time) {
+	for k, c := range svc.older {
+		if now.Sub(c.fetchedAt) >= olderTTL {
+			delete(svc.older, k)
+		}
+	}
+
+	if len(svc.older) < maxCachedSpans {
+		return
+	}
+
+	keys := make([]string, 0, len(svc.older))
+	for k := range svc.older {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return svc.older[keys[i]].fetchedAt.Before(svc.older[keys[j]].fetchedAt)
+	})
+
+	for _, k := range keys[:len(keys)-maxCachedSpans+1] {
+		delete(svc.older, k)
+	}
+}
+
+func filterObservations(observations []domain.TrafficFlowObserved, from, to time.Time, segments []string) []domain.TrafficFlowObserved {
+	result := []domain.TrafficFlowObserved{}
+
+	for _, o := range observations {
+		if len(segments) > 0 && !slices.Contains(segments, o.RoadSegment) {
+			continue
+		}
+
+		if !from.IsZero() || !to.IsZero() {
+			dateObserved, err := time.Parse(time.RFC3339, o.DateObserved)
+			if err != nil || (!from.IsZero() && dateObserved.Before(from)) || (!to.IsZero() && dateObserved.After(to)) {
+				continue
+			}
+		}
+
+		result = append(result, o)
+	}
+
+	return result
+}
+
+// GetRoadSegments returns the road segments referenced by the cached observations, sorted
+// by id, using the location of the most recent observation on each segment
+func (svc *trafficFlowSvc) GetRoadSegments() []domain.RoadSegment {
+	svc.trafficFlowMutex.Lock()
+	defer svc.trafficFlowMutex.Unlock()
+
+	segments := []domain.RoadSegment{}
+	index := map[string]int{}
+
+	for _, o := range svc.observations {
+		if o.RoadSegment == "" {
+			continue
+		}
+
+		idx, ok := index[o.RoadSegment]
+		if !ok {
+			idx = len(segments)
+			index[o.RoadSegment] = idx
+			segments = append(segments, domain.RoadSegment{ID: o.RoadSegment, Lanes: []int{}})
+		}
+
+		if o.Location != nil {
+			segments[idx].Location = *o.Location
+		}
+
+		if !slices.Contains(segments[idx].Lanes, o.LaneID) {
+			segments[idx].Lanes = append(segments[idx].Lanes, o.LaneID)
+		}
+	}
+
+	for _, s := range segments {
+		sort.Ints(s.Lanes)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].ID < segments[j].ID })
+
+	return segments
+}
+
+func (svc *trafficFlowSvc) Start(ctx context.Context) {
+	logger := logging.GetFromContext(ctx)
+	logger.Info("starting traffic flow service")
+	// TODO: Prevent multiple starts on the same service
+	go svc.run(ctx)
+}
+
+func (svc *trafficFlowSvc) Shutdown(ctx context.Context) {
+	logger := logging.GetFromContext(ctx)
+	logger.Info("shutting down traffic flow service")
+	svc.keepRunning = false
+}
+
+func (svc *trafficFlowSvc) run(ctx context.Context) {
+	nextRefreshTime := time.Now()
+	logger := logging.GetFromContext(ctx)
+
+	for svc.keepRunning {
+		if time.Now().After(nextRefreshTime) {
+			logger.Info("refreshing traffic flow info")
+			count, err := svc.refresh(ctx)
+
+			if err == nil && !svc.historyLoaded() {
+				logger.Info("loading traffic flow history", slog.String("window", svc.window.String()))
+				err = svc.loadHistory(ctx, time.Now().UTC())
+			}
+
+			if err != nil {
+				logger.Error("failed to refresh traffic flows", slog.String("err", err.Error()))
+				// Retry every 10 seconds on error
+				nextRefreshTime = time.Now().Add(10 * time.Second)
+			} else {
+				logger.Info("refreshed traffic flows", slog.Int("count", count))
+				// Observations are updated frequently, so refresh every minute on success
+				nextRefreshTime = time.Now().Add(1 * time.Minute)
+			}
+		}
+
+		// TODO: Use blocking channels instead of sleeps
+		time.Sleep(1 * time.Second)
+	}
+
+	logger.Info("traffic flow service exiting")
+}
+
+func (svc *trafficFlowSvc) refresh(ctx context.Context) (count int, err error) {
+	log := logging.GetFromContext(ctx)
+
+	ctx, span := tracer.Start(ctx, "refresh-trafficflows")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, _ = o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
+
+	observations := []domain.TrafficFlowObserved{}
+	lanes := map[string]lane{}
+
+	count, err = contextbroker.QueryEntities(ctx, svc.contextBrokerURL, svc.tenant, "TrafficFlowObserved", nil, func(t trafficFlowObservedDTO) {
+		if t.LaneID == nil {
+			return
+		}
+
+		l := lane{id: t.ID, roadSegment: t.RefRoadSegment, laneID: *t.LaneID}
+		if t.Location != nil {
+			l.location = domain.NewPoint(t.Location.Coordinates[1], t.Location.Coordinates[0])
+		}
+		lanes[t.ID] = l
+
+		observation := l.observation(t.DateObserved.Value())
+		observation.Intensity = int(t.Intensity)
+		observation.AverageVehicleSpeed = t.AverageVehicleSpeed
+
+		observations = append(observations, observation)
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve traffic flows from context broker: %w", err)
+		return
+	}
+
+	svc.trafficFlowMutex.Lock()
+	svc.lanes = lanes
+	svc.trafficFlowMutex.Unlock()
+
+	svc.storeTrafficFlows(observations, time.Now().UTC())
+
+	return
+}
+
+func (svc *trafficFlowSvc) historyLoaded() bool {
+	svc.trafficFlowMutex.Lock()
+	defer svc.trafficFlowMutex.Unlock()
+
+	return !svc.historyFrom.IsZero()
+}
+
+// loadHistory retrieves the observations of every known lane within the window from the
+// temporal API, so that the whole window is available without waiting for it to be
+// built up by polling
+func (svc *trafficFlowSvc) loadHistory(ctx context.Context, now time.Time) (err error) {
+	ctx, span := tracer.Start(ctx, "load-trafficflow-history")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	from := now.Add(-svc.window)
+
+	observations, err := svc.retrieveObservations(ctx, from, now, nil)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve traffic flow history from context broker: %w", err)
+	}
+
+	svc.storeTrafficFlows(observations, now)
+
+	svc.trafficFlowMutex.Lock()
+	svc.historyFrom = from
+	svc.trafficFlowMutex.Unlock()
+
+	return nil
+}
+
+// retrieveObservations retrieves the temporal evolution of the intensity and average
+// vehicle speed of the known lanes on the given road segments, or on all road segments
+// if none are given, with at most maxConcurrentRequests requests at a time
+func (svc *trafficFlowSvc) retrieveObservations(ctx context.Context, from, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+	svc.trafficFlowMutex.Lock()
+	lanes := []lane{}
+	for _, l := range svc.lanes {
+		if len(segments) == 0 || slices.Contains(segments, l.roadSegment) {
+			lanes = append(lanes, l)
+		}
+	}
+	svc.trafficFlowMutex.Unlock()
+
+	headers := map[string][]string{
+		"Accept": {"application/ld+json"},
+		"Link":   {entities.LinkHeader},
+	}
+
+	observations := make([][]domain.TrafficFlowObserved, len(lanes))
+	errs := make([]error, len(lanes))
+	semaphore := make(chan struct{}, maxConcurrentRequests)
+	wg := sync.WaitGroup{}
+
+	for i := range lanes {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			evolution, err := temporal.Retrieve(ctx, svc.cbClient, lanes[i].id, headers, from, to, []string{"intensity", "averageVehicleSpeed"})
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to retrieve temporal evolution of %s: %w", lanes[i].id, err)
+				return
+			}
+
+			observations[i] = lanes[i].observations(evolution)
+		}(i)
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	result := []domain.TrafficFlowObserved{}
+	for _, o := range observations {
+		result = append(result, o...)
+	}
+
+	return result, nil
+}
+
+// storeTrafficFlows adds the observations that are not already known to the cache and
+// evicts all observations that are older than the window
+func (svc *trafficFlowSvc) storeTrafficFlows(list []domain.TrafficFlowObserved, now time.Time) {
+	svc.trafficFlowMutex.Lock()
+	defer svc.trafficFlowMutex.Unlock()
+
+	for _, o := range list {
+		key := observationKey(o)
+		if _, ok := svc.observed[key]; !ok {
+			svc.observed[key] = struct{}{}
+			svc.observations = append(svc.observations, o)
+		}
+	}
+
+	windowStart := now.Add(-svc.window)
+	kept := make([]domain.TrafficFlowObserved, 0, len(svc.observations))
+
+	for _, o := range svc.observations {
+		dateObserved, err := time.Parse(time.RFC3339, o.DateObserved)
+		if err != nil || dateObserved.Before(windowStart) {
+			delete(svc.observed, observationKey(o))
+			continue
+		}
+
+		kept = append(kept, o)
+	}
+
+	sortObservations(kept)
+
+	svc.observations = kept
+
+	if !svc.historyFrom.IsZero() && svc.historyFrom.Before(windowStart) {
+		svc.historyFrom = windowStart
+	}
+}
+
+func observationKey(o domain.TrafficFlowObserved) string {
+	return fmt.Sprintf("%s|%s|%d", o.DateObserved, o.RoadSegment, o.LaneID)
+}
+
+func sortObservations(observations []domain.TrafficFlowObserved) {
+	sort.SliceStable(observations, func(i, j int) bool {
+		a, b := observations[i], observations[j]
+		if a.DateObserved != b.DateObserved {
+			return a.DateObserved < b.DateObserved
+		}
+		if a.RoadSegment != b.RoadSegment {
+			return a.RoadSegment < b.RoadSegment
+		}
+		return a.LaneID < b.LaneID
+	})
+}
+
+// lane is a TrafficFlowObserved entity, holding the observations of one lane on a road
+// segment, as it was found in the latest refresh
+type lane struct {
+	id          string
+	roadSegment string
+	laneID      int
+	location    *domain.Point
+}
+
+// observation returns an observation on the lane at the given time. The date observed
+// is normalised to RFC3339 in UTC, so that observations read from entities and from the
+// temporal API are recognised as the same observation.
+func (l lane) observation(dateObserved string) domain.TrafficFlowObserved {
+	if t, err := time.Parse(time.RFC3339, dateObserved); err == nil {
+		dateObserved = t.UTC().Format(time.RFC3339)
+	}
+
+	return domain.TrafficFlowObserved{
+		DateObserved: dateObserved,
+		RoadSegment:  l.roadSegment,
+		LaneID:       l.laneID,
+		Location:     l.location,
+	}
+}
+
+// observations combines the intensity and average vehicle speed values in the temporal
+// evolution of the lane into one observation per observation time
+func (l lane) observations(evolution types.EntityTemporal) []domain.TrafficFlowObserved {
+	result := []domain.TrafficFlowObserved{}
+	index := map[string]int{}
+
+	at := func(observedAt string) *domain.TrafficFlowObserved {
+		o := l.observation(observedAt)
+		i, ok := index[o.DateObserved]
+		if !ok {
+			i = len(result)
+			index[o.DateObserved] = i
+			result = append(result, o)
+		}
+		return &result[i]
+	}
+
+	for _, p := range evolution.Property("intensity") {
+		if v, ok := p.Value().(float64); ok && p.ObservedAt() != "" {
+			at(p.ObservedAt()).Intensity = int(v)
+		}
+	}
+
+	for _, p := range evolution.Property("averageVehicleSpeed") {
+		if v, ok := p.Value().(float64); ok && p.ObservedAt() != "" {
+			at(p.ObservedAt()).AverageVehicleSpeed = v
+		}
+	}
+
+	return result
+}
+
+type trafficFlowObservedDTO struct {
+	ID                  string       `json:"id"`
+	DateObserved        dateObserved `json:"dateObserved"`
+	LaneID              *int         `json:"laneID"`
+	Intensity           float64      `json:"intensity"`
+	AverageVehicleSpeed float64      `json:"averageVehicleSpeed"`
+	RefRoadSegment      string       `json:"refRoadSegment"`
+	Location            *struct {
+		Type        string     `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"`
+	} `json:"location,omitempty"`
+}
+
+// dateObserved accepts the observation date both as a plain string and as a DateTime
+// value, since the broker returns keyValues in either form depending on how the
+// observation was created
+type dateObserved struct {
+	value string
+}
+
+func (d *dateObserved) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &d.value); err == nil {
+		return nil
+	}
+
+	dt := domain.DateTime{}
+	if err := json.Unmarshal(data, &dt); err != nil {
+		return err
+	}
+
+	d.value = dt.Value
+	return nil
+}
+
+func (d dateObserved) Value() string {
+	return d.value
+}
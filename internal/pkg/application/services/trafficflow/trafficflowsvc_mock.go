@@ -0,0 +1,294 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package trafficflow
+
+import (
+	"context"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	"sync"
+	"time"
+)
+
+// Ensure, that TrafficFlowServiceMock does implement TrafficFlowService.
+// If this is not the case, regenerate this file with moq.
+var _ TrafficFlowService = &TrafficFlowServiceMock{}
+
+// TrafficFlowServiceMock is a mock implementation of TrafficFlowService.
+//
+//	func TestSomethingThatUsesTrafficFlowService(t *testing.T) {
+//
+//		// make and configure a mocked TrafficFlowService
+//		mockedTrafficFlowService := &TrafficFlowServiceMock{
+//			BrokerFunc: func() string {
+//				panic("mock out the Broker method")
+//			},
+//			GetRoadSegmentsFunc: func() []domain.RoadSegment {
+//				panic("mock out the GetRoadSegments method")
+//			},
+//			QueryFunc: func(ctx context.Context, from time.Time, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+//				panic("mock out the Query method")
+//			},
+//			ShutdownFunc: func(ctx context.Context)  {
+//				panic("mock out the Shutdown method")
+//			},
+//			StartFunc: func(ctx context.Context)  {
+//				panic("mock out the Start method")
+//			},
+//			TenantFunc: func() string {
+//				panic("mock out the Tenant method")
+//			},
+//		}
+//
+//		// use mockedTrafficFlowService in code that requires TrafficFlowService
+//		// and then make assertions.
+//
+//	}
+type TrafficFlowServiceMock struct {
+	// BrokerFunc mocks the Broker method.
+	BrokerFunc func() string
+
+	// GetRoadSegmentsFunc mocks the GetRoadSegments method.
+	GetRoadSegmentsFunc func() []domain.RoadSegment
+
+	// QueryFunc mocks the Query method.
+	QueryFunc func(ctx context.Context, from time.Time, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error)
+
+	// ShutdownFunc mocks the Shutdown method.
+	ShutdownFunc func(ctx context.Context)
+
+	// StartFunc mocks the Start method.
+	StartFunc func(ctx context.Context)
+
+	// TenantFunc mocks the Tenant method.
+	TenantFunc func() string
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Broker holds details about calls to the Broker method.
+		Broker []struct {
+		}
+		// GetRoadSegments holds details about calls to the GetRoadSegments method.
+		GetRoadSegments []struct {
+		}
+		// Query holds details about calls to the Query method.
+		Query []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// From is the from argument value.
+			From time.Time
+			// To is the to argument value.
+			To time.Time
+			// Segments is the segments argument value.
+			Segments []string
+		}
+		// Shutdown holds details about calls to the Shutdown method.
+		Shutdown []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+		}
+		// Start holds details about calls to the Start method.
+		Start []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+		}
+		// Tenant holds details about calls to the Tenant method.
+		Tenant []struct {
+		}
+	}
+	lockBroker          sync.RWMutex
+	lockGetRoadSegments sync.RWMutex
+	lockQuery           sync.RWMutex
+	lockShutdown        sync.RWMutex
+	lockStart           sync.RWMutex
+	lockTenant          sync.RWMutex
+}
+
+// Broker calls BrokerFunc.
+func (mock *TrafficFlowServiceMock) Broker() string {
+	if mock.BrokerFunc == nil {
+		panic("TrafficFlowServiceMock.BrokerFunc: method is nil but TrafficFlowService.Broker was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockBroker.Lock()
+	mock.calls.Broker = append(mock.calls.Broker, callInfo)
+	mock.lockBroker.Unlock()
+	return mock.BrokerFunc()
+}
+
+// BrokerCalls gets all the calls that were made to Broker.
+// Check the length with:
+//
+//	len(mockedTrafficFlowService.BrokerCalls())
+func (mock *TrafficFlowServiceMock) BrokerCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockBroker.RLock()
+	calls = mock.calls.Broker
+	mock.lockBroker.RUnlock()
+	return calls
+}
+
+// GetRoadSegments calls GetRoadSegmentsFunc.
+func (mock *TrafficFlowServiceMock) GetRoadSegments() []domain.RoadSegment {
+	if mock.GetRoadSegmentsFunc == nil {
+		panic("TrafficFlowServiceMock.GetRoadSegmentsFunc: method is nil but TrafficFlowService.GetRoadSegments was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockGetRoadSegments.Lock()
+	mock.calls.GetRoadSegments = append(mock.calls.GetRoadSegments, callInfo)
+	mock.lockGetRoadSegments.Unlock()
+	return mock.GetRoadSegmentsFunc()
+}
+
+// GetRoadSegmentsCalls gets all the calls that were made to GetRoadSegments.
+// Check the length with:
+//
+//	len(mockedTrafficFlowService.GetRoadSegmentsCalls())
+func (mock *TrafficFlowServiceMock) GetRoadSegmentsCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockGetRoadSegments.RLock()
+	calls = mock.calls.GetRoadSegments
+	mock.lockGetRoadSegments.RUnlock()
+	return calls
+}
+
+// Query calls QueryFunc.
+func (mock *TrafficFlowServiceMock) Query(ctx context.Context, from time.Time, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+	if mock.QueryFunc == nil {
+		panic("TrafficFlowServiceMock.QueryFunc: method is nil but TrafficFlowService.Query was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		From     time.Time
+		To       time.Time
+		Segments []string
+	}{
+		Ctx:      ctx,
+		From:     from,
+		To:       to,
+		Segments: segments,
+	}
+	mock.lockQuery.Lock()
+	mock.calls.Query = append(mock.calls.Query, callInfo)
+	mock.lockQuery.Unlock()
+	return mock.QueryFunc(ctx, from, to, segments)
+}
+
+// QueryCalls gets all the calls that were made to Query.
+// Check the length with:
+//
+//	len(mockedTrafficFlowService.QueryCalls())
+func (mock *TrafficFlowServiceMock) QueryCalls() []struct {
+	Ctx      context.Context
+	From     time.Time
+	To       time.Time
+	Segments []string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		From     time.Time
+		To       time.Time
+		Segments []string
+	}
+	mock.lockQuery.RLock()
+	calls = mock.calls.Query
+	mock.lockQuery.RUnlock()
+	return calls
+}
+
+// Shutdown calls ShutdownFunc.
+func (mock *TrafficFlowServiceMock) Shutdown(ctx context.Context) {
+	if mock.ShutdownFunc == nil {
+		panic("TrafficFlowServiceMock.ShutdownFunc: method is nil but TrafficFlowService.Shutdown was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+	}{
+		Ctx: ctx,
+	}
+	mock.lockShutdown.Lock()
+	mock.calls.Shutdown = append(mock.calls.Shutdown, callInfo)
+	mock.lockShutdown.Unlock()
+	mock.ShutdownFunc(ctx)
+}
+
+// ShutdownCalls gets all the calls that were made to Shutdown.
+// Check the length with:
+//
+//	len(mockedTrafficFlowService.ShutdownCalls())
+func (mock *TrafficFlowServiceMock) ShutdownCalls() []struct {
+	Ctx context.Context
+} {
+	var calls []struct {
+		Ctx context.Context
+	}
+	mock.lockShutdown.RLock()
+	calls = mock.calls.Shutdown
+	mock.lockShutdown.RUnlock()
+	return calls
+}
+
+// Start calls StartFunc.
+func (mock *TrafficFlowServiceMock) Start(ctx context.Context) {
+	if mock.StartFunc == nil {
+		panic("TrafficFlowServiceMock.StartFunc: method is nil but TrafficFlowService.Start was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+	}{
+		Ctx: ctx,
+	}
+	mock.lockStart.Lock()
+	mock.calls.Start = append(mock.calls.Start, callInfo)
+	mock.lockStart.Unlock()
+	mock.StartFunc(ctx)
+}
+
+// StartCalls gets all the calls that were made to Start.
+// Check the length with:
+//
+//	len(mockedTrafficFlowService.StartCalls())
+func (mock *TrafficFlowServiceMock) StartCalls() []struct {
+	Ctx context.Context
+} {
+	var calls []struct {
+		Ctx context.Context
+	}
+	mock.lockStart.RLock()
+	calls = mock.calls.Start
+	mock.lockStart.RUnlock()
+	return calls
+}
+
+// Tenant calls TenantFunc.
+func (mock *TrafficFlowServiceMock) Tenant() string {
+	if mock.TenantFunc == nil {
+		panic("TrafficFlowServiceMock.TenantFunc: method is nil but TrafficFlowService.Tenant was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockTenant.Lock()
+	mock.calls.Tenant = append(mock.calls.Tenant, callInfo)
+	mock.lockTenant.Unlock()
+	return mock.TenantFunc()
+}
+
+// TenantCalls gets all the calls that were made to Tenant.
+// Check the length with:
+//
+//	len(mockedTrafficFlowService.TenantCalls())
+func (mock *TrafficFlowServiceMock) TenantCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockTenant.RLock()
+	calls = mock.calls.Tenant
+	mock.lockTenant.RUnlock()
+	return calls
+}
@@ -0,0 +1,278 @@
+package trafficflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	cbtest "github.com/diwise/context-broker/pkg/test"
+	testutils "github.com/diwise/service-chassis/pkg/test/http"
+	"github.com/diwise/service-chassis/pkg/test/http/expects"
+	"github.com/diwise/service-chassis/pkg/test/http/response"
+	"github.com/matryer/is"
+)
+
+func TestThatRefreshFailsOnStatusCode400(t *testing.T) {
+	is := is.New(t)
+	server := testutils.NewMockServiceThat(
+		testutils.Expects(is, expects.AnyInput()),
+		testutils.Returns(response.Code(http.StatusBadRequest)),
+	)
+
+	svc := NewTrafficFlowService(context.Background(), server.URL(), "default", 24*time.Hour).(*trafficFlowSvc)
+
+	_, err := svc.refresh(context.Background())
+	is.True(err != nil)
+	is.Equal("failed to retrieve traffic flows from context broker: request failed", err.Error())
+}
+
+func TestThatRefreshUsesTenantAndStoresObservations(t *testing.T) {
+	is := is.New(t)
+	server := testutils.NewMockServiceThat(
+		testutils.Expects(is,
+			expects.RequestHeaderContains("NGSILD-Tenant", "sundsvall"),
+			expects.QueryParamEquals("type", "TrafficFlowObserved"),
+			expects.QueryParamEquals("offset", "0"),
+		),
+		testutils.Returns(
+			response.Code(http.StatusOK),
+			response.ContentType("application/ld+json"),
+			response.Body([]byte(testData(time.Now().UTC()))),
+		),
+	)
+
+	svc := NewTrafficFlowService(context.Background(), server.URL(), "sundsvall", 24*time.Hour).(*trafficFlowSvc)
+
+	count, err := svc.refresh(context.Background())
+	is.NoErr(err)
+	is.Equal(count, 3)
+	is.Equal(len(svc.observations), 2) // the observation without a lane should be skipped
+	is.Equal(svc.observations[0].RoadSegment, "urn:ngsi-ld:RoadSegment:1")
+	is.Equal(svc.observations[1].Intensity, 5)
+
+	_, err = svc.refresh(context.Background())
+	is.NoErr(err)
+	is.Equal(len(svc.observations), 2) // refreshing again should not duplicate observations
+}
+
+func TestThatObservationsOutsideTheWindowAreEvicted(t *testing.T) {
+	is := is.New(t)
+
+	svc := NewTrafficFlowService(context.Background(), "ignored", "default", time.Hour).(*trafficFlowSvc)
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	svc.storeTrafficFlows([]domain.TrafficFlowObserved{
+		{DateObserved: "2022-05-01T10:30:00Z", LaneID: 0},
+		{DateObserved: "2022-05-01T11:30:00Z", LaneID: 0},
+	}, now)
+	is.Equal(len(svc.observations), 1)
+
+	svc.storeTrafficFlows([]domain.TrafficFlowObserved{
+		{DateObserved: "2022-05-01T12:30:00Z", LaneID: 0},
+	}, now.Add(time.Hour))
+	is.Equal(len(svc.observations), 1)
+	is.Equal(svc.observations[0].DateObserved, "2022-05-01T12:30:00Z")
+}
+
+func TestThatQueryFiltersOnTimeAndSegment(t *testing.T) {
+	is := is.New(t)
+
+	svc := NewTrafficFlowService(context.Background(), "ignored", "default", 24*time.Hour).(*trafficFlowSvc)
+	svc.storeTrafficFlows([]domain.TrafficFlowObserved{
+		{DateObserved: "2022-05-01T11:00:00Z", RoadSegment: "rs1", LaneID: 0},
+		{DateObserved: "2022-05-01T10:00:00Z", RoadSegment: "rs1", LaneID: 1},
+		{DateObserved: "2022-05-01T10:00:00Z", RoadSegment: "rs2", LaneID: 0, Location: domain.NewPoint(62.0, 17.0)},
+	}, time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	svc.historyFrom = time.Date(2022, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	query := func(from time.Time, segments []string) []domain.TrafficFlowObserved {
+		result, err := svc.Query(context.Background(), from, time.Time{}, segments)
+		is.NoErr(err)
+		return result
+	}
+
+	is.Equal(query(time.Time{}, nil)[0].LaneID, 1) // observations should be sorted by date
+	is.Equal(len(query(time.Date(2022, 5, 1, 10, 30, 0, 0, time.UTC), nil)), 1)
+	is.Equal(len(query(time.Time{}, []string{"rs1"})), 2)
+
+	segments := svc.GetRoadSegments()
+	is.Equal(len(segments), 2)
+	is.Equal(segments[0].Lanes, []int{0, 1})
+	is.Equal(segments[1].Location.Coordinates, []float64{17.0, 62.0})
+}
+
+func TestThatTheHistoryOfTheWindowIsLoaded(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	svc := NewTrafficFlowService(context.Background(), "ignored", "default", 24*time.Hour).(*trafficFlowSvc)
+	svc.lanes = map[string]lane{
+		"urn:ngsi-ld:TrafficFlowObserved:tfo0": {id: "urn:ngsi-ld:TrafficFlowObserved:tfo0", roadSegment: "rs1", laneID: 0},
+	}
+
+	requested := []string{}
+
+	svc.cbClient = &cbtest.ContextBrokerClientMock{
+		RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+			requested = append(requested, strings.Join(parameters[0](nil), "&"))
+			return temporalData(is, entityID, "2022-05-01T08:00:00.000Z", "2022-05-01T09:00:00.000Z"), nil
+		},
+	}
+
+	is.NoErr(svc.loadHistory(context.Background(), now))
+	is.Equal(requested, []string{"timerel=between&timeAt=2022-04-30T12:00:00Z&endTimeAt=2022-05-01T12:00:00Z"})
+	is.Equal(svc.historyFrom, now.Add(-24*time.Hour))
+	is.Equal(len(svc.observations), 2)
+	is.Equal(svc.observations[0].DateObserved, "2022-05-01T08:00:00Z")
+	is.Equal(svc.observations[0].Intensity, 8)
+	is.Equal(svc.observations[0].AverageVehicleSpeed, 17.3)
+
+	// the same observation from a refresh should not be added again
+	svc.storeTrafficFlows([]domain.TrafficFlowObserved{
+		{DateObserved: "2022-05-01T09:00:00Z", RoadSegment: "rs1", LaneID: 0},
+	}, now)
+	is.Equal(len(svc.observations), 2)
+}
+
+func TestThatQueriesBeforeTheHistoryAreRetrievedFromTheBroker(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	svc := NewTrafficFlowService(context.Background(), "ignored", "default", 24*time.Hour).(*trafficFlowSvc)
+	svc.lanes = map[string]lane{
+		"urn:ngsi-ld:TrafficFlowObserved:tfo0": {id: "urn:ngsi-ld:TrafficFlowObserved:tfo0", roadSegment: "rs1", laneID: 0},
+		"urn:ngsi-ld:TrafficFlowObserved:tfo1": {id: "urn:ngsi-ld:TrafficFlowObserved:tfo1", roadSegment: "rs2", laneID: 0},
+	}
+	svc.historyFrom = now.Add(-24 * time.Hour)
+	svc.storeTrafficFlows([]domain.TrafficFlowObserved{
+		{DateObserved: "2022-05-01T10:00:00Z", RoadSegment: "rs1", LaneID: 0},
+	}, now)
+
+	requested := []string{}
+
+	svc.cbClient = &cbtest.ContextBrokerClientMock{
+		RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+			requested = append(requested, entityID+"?"+strings.Join(parameters[0](nil), "&"))
+			return temporalData(is, entityID, "2022-04-20T08:00:00Z", "2022-04-30T12:00:00Z"), nil
+		},
+	}
+
+	result, err := svc.Query(context.Background(), time.Date(2022, 4, 20, 0, 0, 0, 0, time.UTC), time.Time{}, []string{"rs1"})
+	is.NoErr(err)
+
+	// only the older part of the time span, on the requested segment, should be retrieved
+	is.Equal(requested, []string{"urn:ngsi-ld:TrafficFlowObserved:tfo0?timerel=between&timeAt=2022-04-20T00:00:00Z&endTimeAt=2022-04-30T12:00:00Z"})
+	is.Equal(len(result), 3)
+	is.Equal(result[0].DateObserved, "2022-04-20T08:00:00Z")
+	is.Equal(result[2].DateObserved, "2022-05-01T10:00:00Z")
+
+	_, err = svc.Query(context.Background(), time.Date(2022, 4, 30, 18, 0, 0, 0, time.UTC), time.Time{}, nil)
+	is.NoErr(err)
+	is.Equal(len(requested), 1) // time spans within the history should not reach the broker
+}
+
+func temporalData(is *is.I, id string, observedAt ...string) *ngsild.RetrieveTemporalEvolutionOfEntityResult {
+	intensity := []any{}
+	speed := []any{}
+
+	for _, at := range observedAt {
+		intensity = append(intensity, map[string]any{"type": "Property", "value": 8, "observedAt": at})
+		speed = append(speed, map[string]any{"type": "Property", "value": 17.3, "observedAt": at})
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"@context":            []string{"https://raw.githubusercontent.com/diwise/context-broker/main/assets/jsonldcontexts/default-context.jsonld"},
+		"id":                  id,
+		"type":                "TrafficFlowObserved",
+		"intensity":           intensity,
+		"averageVehicleSpeed": speed,
+	})
+
+	var entity entities.EntityTemporalImpl
+	is.NoErr(json.Unmarshal(body, &entity))
+
+	return ngsild.NewRetrieveTemporalEvolutionOfEntityResult(&entity)
+}
+
+func testData(now time.Time) string {
+	dateObserved := now.Add(-time.Minute).Format(time.RFC3339)
+
+	return `[
+	{
+		"id": "urn:ngsi-ld:TrafficFlowObserved:tfo0",
+		"type": "TrafficFlowObserved",
+		"dateObserved": "` + dateObserved + `",
+		"laneID": 0,
+		"intensity": 8,
+		"averageVehicleSpeed": 17.3,
+		"refRoadSegment": "urn:ngsi-ld:RoadSegment:1",
+		"location": {"type": "Point", "coordinates": [17.0, 62.2]}
+	},
+	{
+		"id": "urn:ngsi-ld:TrafficFlowObserved:tfo1",
+		"type": "TrafficFlowObserved",
+		"dateObserved": {"@type": "DateTime", "@value": "` + dateObserved + `"},
+		"laneID": 4,
+		"intensity": 5,
+		"averageVehicleSpeed": 50.0,
+		"refRoadSegment": "urn:ngsi-ld:RoadSegment:2"
+	},
+	{
+		"id": "urn:ngsi-ld:TrafficFlowObserved:tfo2",
+		"type": "TrafficFlowObserved",
+		"dateObserved": "` + dateObserved + `"
+	}
+]`
+}
+
+func TestThatOlderTimeSpansAreValidatedAndCached(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	svc := NewTrafficFlowService(context.Background(), "ignored", "default", 24*time.Hour).(*trafficFlowSvc)
+	svc.lanes = map[string]lane{
+		"urn:ngsi-ld:TrafficFlowObserved:tfo0": {id: "urn:ngsi-ld:TrafficFlowObserved:tfo0", roadSegment: "rs1", laneID: 0},
+	}
+	svc.historyFrom = now.Add(-24 * time.Hour)
+
+	calls := 0
+
+	svc.cbClient = &cbtest.ContextBrokerClientMock{
+		RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+			calls++
+			return temporalData(is, entityID, "2022-04-20T08:00:00Z", "2022-04-25T12:00:00Z"), nil
+		},
+	}
+
+	_, err := svc.Query(context.Background(), time.Date(2022, 4, 25, 0, 0, 0, 0, time.UTC), time.Date(2022, 4, 20, 0, 0, 0, 0, time.UTC), nil)
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span must not end before it starts
+
+	_, err = svc.Query(context.Background(), time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}, nil)
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span retrieved from the broker must not be too long
+	is.Equal(calls, 0)
+
+	from := time.Date(2022, 4, 20, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 4, 26, 0, 0, 0, 0, time.UTC)
+
+	result, err := svc.Query(context.Background(), from, to, nil)
+	is.NoErr(err)
+	is.Equal(len(result), 2)
+
+	result, err = svc.Query(context.Background(), from.Add(time.Minute), to, nil)
+	is.NoErr(err)
+	is.Equal(len(result), 2)
+	is.Equal(calls, 1) // a similar time span should be served from the cache
+}
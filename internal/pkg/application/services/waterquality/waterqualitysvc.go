@@ -2,14 +2,9 @@ package waterquality
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"slices"
 	"sort"
 	"strings"
@@ -19,13 +14,15 @@ import (
 
 	"log/slog"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
+	"github.com/diwise/api-opendata/internal/pkg/application/temporal"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 )
 
@@ -41,15 +38,17 @@ type WaterQualityService interface {
 
 	GetAll(ctx context.Context) []domain.WaterQuality
 	GetAllNearPointWithinTimespan(ctx context.Context, pt Point, distance int, from, to time.Time) ([]domain.WaterQuality, error)
-	GetByID(ctx context.Context, id string, from, to time.Time) (*domain.WaterQualityTemporal, error)
+	GetByID(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error)
 }
 
 func NewWaterQualityService(ctx context.Context, url, tenant string) WaterQualityService {
 	return &wqsvc{
 		contextBrokerURL: url,
 		tenant:           tenant,
+		cbClient:         contextbroker.NewContextBrokerClient(url, contextbroker.Tenant(tenant)),
 
 		waterQualityByID: map[string]WaterQuality{},
+		nearby:           geo.NewIndex[string](nearbyCellSize),
 
 		queue:       make(chan func()),
 		keepRunning: &atomic.Bool{},
@@ -58,11 +57,27 @@ func NewWaterQualityService(ctx context.Context, url, tenant string) WaterQualit
 
 var ErrWQNotFound error = errors.New("not found")
 
+var ErrInvalidQuery error = errors.New("invalid query")
+
+// MaxTimespan is the longest time span that the temperatures of a water quality can be
+// requested for
+const MaxTimespan time.Duration = 366 * 24 * time.Hour
+
+// cachedHistory is how far back the temperatures of each water quality are kept in memory.
+// Older temperatures are retrieved from the context broker when requested.
+const cachedHistory time.Duration = 7 * 24 * time.Hour
+
+// nearbyCellSize is the size in metres of the cells of the spatial index, chosen to be
+// close to the distance within which beaches look for water qualities
+const nearbyCellSize float64 = 1000
+
 type wqsvc struct {
 	contextBrokerURL string
 	tenant           string
+	cbClient         contextbroker.ContextBrokerClient
 
 	waterQualityByID map[string]WaterQuality
+	nearby           *geo.Index[string]
 
 	queue chan func()
 
@@ -83,25 +98,24 @@ func (svc *wqsvc) Start(ctx context.Context) {
 }
 
 func (svc *wqsvc) Refresh(ctx context.Context) (int, error) {
+	cached := make(chan map[string]WaterQuality)
+	svc.queue <- func() {
+		cached <- svc.cachedWaterQualities()
+	}
 
-	refreshDone := make(chan int)
-	refreshFailed := make(chan error)
+	// the context broker is queried outside of the queue so that the water qualities can
+	// still be served while the refresh is in progress
+	waterQualities, err := svc.refresh(ctx, <-cached)
+	if err != nil {
+		return 0, err
+	}
 
+	refreshDone := make(chan int)
 	svc.queue <- func() {
-		count, err := svc.refresh(ctx)
-		if err != nil {
-			refreshFailed <- err
-		} else {
-			refreshDone <- count
-		}
+		refreshDone <- svc.store(waterQualities)
 	}
 
-	select {
-	case c := <-refreshDone:
-		return c, nil
-	case e := <-refreshFailed:
-		return 0, e
-	}
+	return <-refreshDone, nil
 }
 
 func (svc *wqsvc) Shutdown(ctx context.Context) {
@@ -132,6 +146,8 @@ func (svc *wqsvc) GetAll(ctx context.Context) []domain.WaterQuality {
 			l = append(l, i.Latest)
 		}
 
+		sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+
 		result <- l
 	}
 
@@ -161,11 +177,12 @@ func (svc *wqsvc) GetAllNearPointWithinTimespan(ctx context.Context, pt Point, m
 	}
 
 	svc.queue <- func() {
-		waterQualitiesWithinDistance := make([]domain.WaterQuality, 0, len(svc.waterQualityByID))
+		nearby := svc.nearby.Within(pt.Latitude, pt.Longitude, float64(maxDistance))
+		waterQualitiesWithinDistance := make([]domain.WaterQuality, 0, len(nearby))
 
-		for _, storedWQ := range svc.waterQualityByID {
-			wqPoint := NewPoint(storedWQ.Location.Coordinates[1], storedWQ.Location.Coordinates[0])
-			distanceBetweenPoints := distance(wqPoint, pt)
+		for _, match := range nearby {
+			storedWQ := svc.waterQualityByID[match.Item]
+			distanceBetweenPoints := int(math.Round(match.Distance))
 
 			storedDate, err := time.ParseInLocation(time.RFC3339, storedWQ.Latest.DateObserved, time.UTC)
 			if err != nil {
@@ -210,61 +227,189 @@ func (svc *wqsvc) GetAllNearPointWithinTimespan(ctx context.Context, pt Point, m
 		result <- waterQualitiesWithinDistance
 	}
 
-	return <-result, nil
+	select {
+	case err := <-failure:
+		return nil, err
+	case r := <-result:
+		return r, nil
+	}
 }
 
-func (svc *wqsvc) GetByID(ctx context.Context, id string, from, to time.Time) (*domain.WaterQualityTemporal, error) {
+// GetByID returns the temperatures observed within [from, to], newest first. A zero
+// from or to defaults to a time span of 24 hours, ending now unless to is given. Time
+// spans that start before the cached history are retrieved from the context broker, and
+// with a resolution of timeseries.Hour or timeseries.Day the temperatures are averaged
+// per hour or local day.
+func (svc *wqsvc) GetByID(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error) {
+	if resolution != "" && resolution != timeseries.Hour && resolution != timeseries.Day {
+		return nil, fmt.Errorf("%w: temperatures can only be aggregated by hour or day", ErrInvalidQuery)
+	}
+
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: the time span must not end before it starts", ErrInvalidQuery)
+	}
+
+	if to.Sub(from) > MaxTimespan {
+		return nil, fmt.Errorf("%w: the time span must not be longer than %d days", ErrInvalidQuery, int(MaxTimespan.Hours()/24))
+	}
 
-	result := make(chan *domain.WaterQualityTemporal)
+	result := make(chan WaterQuality)
 	failure := make(chan error)
 
 	svc.queue <- func() {
-		_, ok := svc.waterQualityByID[id]
+		wqo, ok := svc.waterQualityByID[id]
 		if !ok {
 			failure <- ErrWQNotFound
 			return
 		}
 
-		if from.IsZero() && to.IsZero() {
-			to = time.Now().UTC()
-			from = to.Add(-24 * time.Hour)
-		}
+		result <- wqo
+	}
+
+	var wqo WaterQuality
+
+	select {
+	case err := <-failure:
+		return nil, err
+	case wqo = <-result:
+	}
+
+	wqoTemp := domain.WaterQualityTemporal{
+		ID:          wqo.ID,
+		Location:    wqo.Location,
+		Temperature: []domain.Value{},
+	}
+
+	if wqo.Latest.Source != nil {
+		wqoTemp.Source = *wqo.Latest.Source
+	}
 
-		wqo := svc.waterQualityByID[id]
+	var temps []domain.Value
 
-		wqoTemp := domain.WaterQualityTemporal{
-			ID: wqo.ID,
+	if wqo.History != nil && !wqo.HistoryFrom.IsZero() && !from.Before(wqo.HistoryFrom) {
+		temps = *wqo.History
+	} else {
+		var err error
+
+		temps, err = svc.requestTemperatures(ctx, id, from, to)
+		if err != nil {
+			return nil, err
 		}
 
-		if wqo.Latest.Source != nil {
-			wqoTemp.Source = *wqo.Latest.Source
+		temps = withLatest(temps, wqo.Latest)
+	}
+
+	temps = withinTimespan(temps, from, to)
+
+	if resolution != "" {
+		temps = aggregateTemperatures(temps, resolution)
+		slices.Reverse(temps)
+	} else {
+		sortNewestFirst(temps)
+	}
+
+	if len(temps) > 0 {
+		wqoTemp.Temperature = temps
+	}
+
+	return &wqoTemp, nil
+}
+
+// withinTimespan returns the distinct temperatures observed within [from, to]
+func withinTimespan(temps []domain.Value, from, to time.Time) []domain.Value {
+	found := make([]domain.Value, 0, len(temps))
+	seen := map[string]bool{}
+
+	for _, t := range temps {
+		observedAt, err := time.Parse(time.RFC3339, t.ObservedAt)
+		if err != nil || observedAt.Before(from) || observedAt.After(to) || seen[t.ObservedAt] {
+			continue
 		}
 
-		if wqo.Location != nil {
-			wqoTemp.Location = wqo.Location
+		seen[t.ObservedAt] = true
+		found = append(found, t)
+	}
+
+	return found
+}
+
+// aggregateTemperatures replaces the temperatures with their mean, min and max per hour
+// or day, with days in local time
+func aggregateTemperatures(temps []domain.Value, resolution timeseries.Resolution) []domain.Value {
+	samples := make([]timeseries.Sample, 0, len(temps))
+	for _, t := range temps {
+		if at, err := time.Parse(time.RFC3339, t.ObservedAt); err == nil {
+			samples = append(samples, timeseries.Sample{At: at, Value: t.Value})
 		}
+	}
 
-		if wqo.History != nil {
-			temps := *wqo.History
+	buckets := timeseries.Aggregate(samples, resolution, timeseries.DefaultLocation)
+	aggregated := make([]domain.Value, 0, len(buckets))
+
+	for _, b := range buckets {
+		minimum, maximum := b.Min, b.Max
+		aggregated = append(aggregated, domain.Value{
+			Value:      round(b.Average),
+			ObservedAt: b.Start.Format(time.RFC3339),
+			Min:        &minimum,
+			Max:        &maximum,
+			Count:      b.Count,
+		})
+	}
 
-			if len(temps) != 0 {
-				sort.Slice(temps, func(i, j int) bool {
-					return strings.Compare(temps[i].ObservedAt, temps[j].ObservedAt) > 0
-				})
+	return aggregated
+}
 
-				wqoTemp.Temperature = temps
-			}
+// withLatest adds the latest observation to the temperatures unless one of them was
+// observed at the same time or later
+func withLatest(temps []domain.Value, latest domain.WaterQuality) []domain.Value {
+	for _, t := range temps {
+		if !after(latest.DateObserved, t.ObservedAt) {
+			return temps
 		}
+	}
 
-		result <- &wqoTemp
+	return append(temps, domain.Value{
+		Value:      latest.Temperature,
+		ObservedAt: latest.DateObserved,
+	})
+}
+
+// after reports whether d1 is later than d2, or if d2 is empty
+func after(d1, d2 string) bool {
+	dt1, err := time.Parse(time.RFC3339, d1)
+	if err != nil {
+		return false
 	}
 
-	select {
-	case err := <-failure:
-		return nil, err
-	case r := <-result:
-		return r, nil
+	if d2 == "" {
+		return true
 	}
+
+	dt2, err := time.Parse(time.RFC3339, d2)
+	if err != nil {
+		return false
+	}
+
+	return dt1.After(dt2)
+}
+
+func sortNewestFirst(temps []domain.Value) {
+	sort.Slice(temps, func(i, j int) bool {
+		return strings.Compare(temps[i].ObservedAt, temps[j].ObservedAt) > 0
+	})
+}
+
+func round(f float64) float64 {
+	return math.Round(f*10) / 10
 }
 
 type Point struct {
@@ -279,36 +424,6 @@ func NewPoint(lat, lon float64) Point {
 	}
 }
 
-func degreesToRadians(d float64) float64 {
-	return d * math.Pi / 180
-}
-
-func distance(point1, point2 Point) int {
-	const earthRadiusM = 6371000.0
-
-	lat1 := degreesToRadians(point1.Latitude)
-	lon1 := degreesToRadians(point1.Longitude)
-	lat2 := degreesToRadians(point2.Latitude)
-	lon2 := degreesToRadians(point2.Longitude)
-
-	dLat := lat2 - lat1
-	dLon := lon2 - lon1
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1)*math.Cos(lat2)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-
-	// Clamp pga flyttalsavrundning
-	if a < 0 {
-		a = 0
-	} else if a > 1 {
-		a = 1
-	}
-
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return int(math.Round(earthRadiusM * c))
-}
-
 func (svc *wqsvc) run(ctx context.Context) {
 	svc.wg.Add(1)
 	defer svc.wg.Done()
@@ -319,13 +434,32 @@ func (svc *wqsvc) run(ctx context.Context) {
 	const RefreshIntervalOnFail time.Duration = 5 * time.Second
 	const RefreshIntervalOnSuccess time.Duration = 30 * time.Second
 
+	type refreshResult struct {
+		waterQualities map[string]WaterQuality
+		err            error
+	}
+
+	// buffered so that a refresh that completes after shutdown does not block forever
+	refreshed := make(chan refreshResult, 1)
+
+	startRefresh := func() {
+		cached := svc.cachedWaterQualities()
+		go func() {
+			waterQualities, err := svc.refresh(ctx, cached)
+			refreshed <- refreshResult{waterQualities, err}
+		}()
+	}
+
+	// nothing is cached before the first refresh, so requests wait for it to complete
+	// instead of being served from an empty cache
 	var refreshTimer *time.Timer
-	count, err := svc.refresh(ctx)
+	waterQualities, err := svc.refresh(ctx, svc.cachedWaterQualities())
 
 	if err != nil {
 		logger.Error("failed to refresh water qualities", slog.String("err", err.Error()))
 		refreshTimer = time.NewTimer(RefreshIntervalOnFail)
 	} else {
+		count := svc.store(waterQualities)
 		logger.Info("refreshed water quality", slog.Int("count", count))
 		refreshTimer = time.NewTimer(RefreshIntervalOnSuccess)
 	}
@@ -334,22 +468,49 @@ func (svc *wqsvc) run(ctx context.Context) {
 		select {
 		case fn := <-svc.queue:
 			fn()
-		case <-refreshTimer.C:
-			count, err := svc.refresh(ctx)
-			if err != nil {
-				logger.Error("failed to refresh water quality info", slog.String("err", err.Error()))
+		case r := <-refreshed:
+			if r.err != nil {
+				logger.Error("failed to refresh water quality info", slog.String("err", r.err.Error()))
 				refreshTimer = time.NewTimer(RefreshIntervalOnFail)
 			} else {
+				count := svc.store(r.waterQualities)
 				logger.Info("refreshed water quality entities", slog.Int("count", count))
 				refreshTimer = time.NewTimer(RefreshIntervalOnSuccess)
 			}
+		case <-refreshTimer.C:
+			startRefresh()
 		}
 	}
 
+	refreshTimer.Stop()
+
 	logger.Info("water quality service exiting")
 }
 
-func (svc *wqsvc) refresh(ctx context.Context) (count int, err error) {
+// cachedWaterQualities returns a copy of the cached water qualities, that a refresh can
+// read from outside of the queue
+func (svc *wqsvc) cachedWaterQualities() map[string]WaterQuality {
+	cached := make(map[string]WaterQuality, len(svc.waterQualityByID))
+	for id, wq := range svc.waterQualityByID {
+		cached[id] = wq
+	}
+	return cached
+}
+
+// store replaces the cached water qualities with the refreshed ones and returns how many
+// there are
+func (svc *wqsvc) store(waterQualities map[string]WaterQuality) int {
+	svc.waterQualityByID = waterQualities
+	svc.nearby = indexByLocation(waterQualities)
+
+	return len(svc.waterQualityByID)
+}
+
+// refresh retrieves the water qualities from the context broker. Only the temperatures that
+// are newer than the cached history of a water quality are requested from the temporal API
+// and appended to it, while temperatures older than cachedHistory are dropped. The cached
+// water qualities are not modified.
+func (svc *wqsvc) refresh(ctx context.Context, cached map[string]WaterQuality) (waterQualities map[string]WaterQuality, err error) {
 
 	ctx, span := tracer.Start(ctx, "refresh-water-quality")
 	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
@@ -359,27 +520,7 @@ func (svc *wqsvc) refresh(ctx context.Context) (count int, err error) {
 
 	logger.Info("refreshing water quality info")
 
-	after := func(d1, d2 string) bool {
-		dt1, err := time.Parse(time.RFC3339, d1)
-		if err != nil {
-			return false
-		}
-
-		if d2 == "" {
-			return true
-		}
-
-		dt2, err := time.Parse(time.RFC3339, d2)
-		if err != nil {
-			return false
-		}
-
-		return dt1.After(dt2)
-	}
-
-	round := func(f float64) float64 {
-		return math.Round(f*10) / 10
-	}
+	waterQualities = map[string]WaterQuality{}
 
 	_, err = contextbroker.QueryEntities(ctx, svc.Broker(), svc.Tenant(), "WaterQualityObserved", nil, func(w WaterQualityDTO) {
 		wq := WaterQuality{
@@ -405,130 +546,106 @@ func (svc *wqsvc) refresh(ctx context.Context) (count int, err error) {
 			wq.Latest = latest
 		}
 
-		dto := WaterQualityTemporalDTO{}
-
-		b, err := svc.requestTemporalDataForSingleEntity(ctx, svc.Broker(), w.ID, svc.Tenant(), time.Time{}, time.Time{})
-		if err != nil {
-			logger.Error("no temporal data found for water quality", "id", wq.ID, "err", err.Error())
-			return
-		}
-
-		json.Unmarshal(b, &dto)
+		to := time.Now().UTC()
+		historyFrom := to.Add(-cachedHistory)
 
 		temps := []domain.Value{}
+		from := historyFrom
 
-		if len(dto.Temperature) != 0 {
-			for i, t := range dto.Temperature {
-				dto.Temperature[i].Value = round(t.Value)
+		previous, ok := cached[w.ID]
+		if ok && previous.History != nil && !previous.HistoryFrom.IsZero() {
+			temps = withinTimespan(*previous.History, historyFrom, to)
+			if newest := newestObservation(temps); !newest.IsZero() {
+				from = newest
 			}
+		}
 
-			temps = append(temps, dto.Temperature...)
+		newTemps, err := svc.requestTemperatures(ctx, w.ID, from, to)
+		if err != nil {
+			logger.Error("no temporal data found for water quality", "id", wq.ID, "err", err.Error())
+			if ok && !previous.HistoryFrom.IsZero() {
+				// keep what was cached, the missing temperatures are requested on the next refresh
+				wq.HistoryFrom = historyFrom
+			}
 		} else {
-			logger.Info("no temporal data found for water quality", "id", wq.ID)
+			temps = withinTimespan(append(temps, newTemps...), historyFrom, to)
+			wq.HistoryFrom = historyFrom
 		}
 
 		if len(temps) == 0 {
-			temps = append(temps, domain.Value{
-				Value:      latest.Temperature,
-				ObservedAt: latest.DateObserved,
-			})
+			logger.Info("no temporal data found for water quality", "id", wq.ID)
 		}
 
-		slices.SortFunc(temps, func(a, b domain.Value) int {
-			if a.ObservedAt < b.ObservedAt {
-				return 1
-			} else if a.ObservedAt > b.ObservedAt {
-				return -1
-			}
-			return 0
-		})
-
-		if temps[0].ObservedAt != latest.DateObserved && after(latest.DateObserved, temps[0].ObservedAt) {
-			temps = append([]domain.Value{{
-				Value:      latest.Temperature,
-				ObservedAt: latest.DateObserved,
-			}}, temps...)
-		}
+		temps = withLatest(temps, latest)
+		sortNewestFirst(temps)
 
 		wq.History = &temps
 
-		svc.waterQualityByID[w.ID] = wq
-
+		waterQualities[w.ID] = wq
 	})
 
 	if err != nil {
 		err = fmt.Errorf("failed to retrieve water qualities from context broker: %w", err)
-		return
+		return nil, err
 	}
 
-	return len(svc.waterQualityByID), nil
+	return waterQualities, nil
 }
 
-func (q *wqsvc) requestTemporalDataForSingleEntity(ctx context.Context, ctxBrokerURL, id, tenant string, from, to time.Time) ([]byte, error) {
-	var err error
-
-	log := logging.GetFromContext(ctx)
-
-	httpClient := http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+// newestObservation returns the time of the latest of the temperatures, or the zero time
+// if none of them could be parsed
+func newestObservation(temps []domain.Value) time.Time {
+	newest := time.Time{}
+	for _, t := range temps {
+		if observedAt, err := time.Parse(time.RFC3339, t.ObservedAt); err == nil && observedAt.After(newest) {
+			newest = observedAt
+		}
 	}
+	return newest
+}
 
-	params := url.Values{}
-
-	if from.IsZero() && to.IsZero() {
-		from = time.Now().UTC().Add(-24 * 7 * time.Hour)
-		to = time.Now().UTC()
+// indexByLocation returns a spatial index of the IDs of the water qualities that have a
+// location, added in the order of their IDs
+func indexByLocation(waterQualities map[string]WaterQuality) *geo.Index[string] {
+	ids := make([]string, 0, len(waterQualities))
+	for id, wq := range waterQualities {
+		if wq.Location != nil && len(wq.Location.Coordinates) >= 2 {
+			ids = append(ids, id)
+		}
 	}
 
-	params.Add("timerel", "between")
-	params.Add("timeAt", from.Format(time.RFC3339))
-	params.Add("endTimeAt", to.Format(time.RFC3339))
-	params.Add("lastN", "50")
-
-	requestURL := fmt.Sprintf(
-		"%s/ngsi-ld/v1/temporal/entities/%s?%s",
-		ctxBrokerURL, id, params.Encode(),
-	)
+	sort.Strings(ids)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create http request: %s", err.Error())
+	idx := geo.NewIndex[string](nearbyCellSize)
+	for _, id := range ids {
+		coordinates := waterQualities[id].Location.Coordinates
+		idx.Add(coordinates[1], coordinates[0], id)
 	}
 
-	req.Header.Add("Accept", "application/ld+json")
-	req.Header.Add("Link", entities.LinkHeader)
+	return idx
+}
 
-	if tenant != entities.DefaultNGSITenant {
-		req.Header.Add("NGSILD-Tenant", tenant)
+// requestTemperatures retrieves the temperatures observed within a time span from the
+// temporal API of the context broker
+func (svc *wqsvc) requestTemperatures(ctx context.Context, id string, from, to time.Time) ([]domain.Value, error) {
+	headers := map[string][]string{
+		"Accept": {"application/ld+json"},
+		"Link":   {entities.LinkHeader},
 	}
 
-	response, err := httpClient.Do(req)
+	evolution, err := temporal.Retrieve(ctx, svc.cbClient, id, headers, from, to, []string{"temperature"})
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %s", err.Error())
+		return nil, fmt.Errorf("failed to retrieve temporal data: %w", err)
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
-		rb, _ := httputil.DumpResponse(response, true)
-		logging.GetFromContext(ctx).Debug("bad response", "response", string(rb))
-		return nil, fmt.Errorf("request failed, status code %d not ok (or partial)", response.StatusCode)
-	}
-
-	b, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %s", err.Error())
+	temps := []domain.Value{}
+	for _, t := range evolution.Property("temperature") {
+		if v, ok := t.Value().(float64); ok && t.ObservedAt() != "" {
+			temps = append(temps, domain.Value{Value: round(v), ObservedAt: t.ObservedAt()})
+		}
 	}
 
-	log.Debug("response from temporal endpoint", "id", id, "tenant", tenant, "body", string(b), "url", requestURL)
-
-	return b, nil
-}
-
-type WaterQualityTemporalDTO struct {
-	ID           string          `json:"id"`
-	Temperature  []domain.Value  `json:"temperature"`
-	Source       *string         `json:"source,omitempty"`
-	DateObserved domain.DateTime `json:"dateObserved,omitempty"`
+	return withinTimespan(temps, from, to), nil
 }
 
 type WaterQualityDTO struct {
@@ -544,4 +661,6 @@ type WaterQuality struct {
 	Location *domain.Point       `json:"location"`
 	Latest   domain.WaterQuality `json:"latest"`
 	History  *[]domain.Value     `json:"history"`
+	// HistoryFrom is the start of the time span that History covers
+	HistoryFrom time.Time `json:"-"`
 }
@@ -5,6 +5,7 @@ package waterquality
 
 import (
 	"context"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"sync"
 	"time"
@@ -29,7 +30,7 @@ var _ WaterQualityService = &WaterQualityServiceMock{}
 //			GetAllNearPointWithinTimespanFunc: func(ctx context.Context, pt Point, distance int, from time.Time, to time.Time) ([]domain.WaterQuality, error) {
 //				panic("mock out the GetAllNearPointWithinTimespan method")
 //			},
-//			GetByIDFunc: func(ctx context.Context, id string, from time.Time, to time.Time) (*domain.WaterQualityTemporal, error) {
+//			GetByIDFunc: func(ctx context.Context, id string, from time.Time, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error) {
 //				panic("mock out the GetByID method")
 //			},
 //			RefreshFunc: func(ctx context.Context) (int, error) {
@@ -61,7 +62,7 @@ type WaterQualityServiceMock struct {
 	GetAllNearPointWithinTimespanFunc func(ctx context.Context, pt Point, distance int, from time.Time, to time.Time) ([]domain.WaterQuality, error)
 
 	// GetByIDFunc mocks the GetByID method.
-	GetByIDFunc func(ctx context.Context, id string, from time.Time, to time.Time) (*domain.WaterQualityTemporal, error)
+	GetByIDFunc func(ctx context.Context, id string, from time.Time, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error)
 
 	// RefreshFunc mocks the Refresh method.
 	RefreshFunc func(ctx context.Context) (int, error)
@@ -108,6 +109,8 @@ type WaterQualityServiceMock struct {
 			From time.Time
 			// To is the to argument value.
 			To time.Time
+			// Resolution is the resolution argument value.
+			Resolution timeseries.Resolution
 		}
 		// Refresh holds details about calls to the Refresh method.
 		Refresh []struct {
@@ -246,25 +249,27 @@ func (mock *WaterQualityServiceMock) GetAllNearPointWithinTimespanCalls() []stru
 }
 
 // GetByID calls GetByIDFunc.
-func (mock *WaterQualityServiceMock) GetByID(ctx context.Context, id string, from time.Time, to time.Time) (*domain.WaterQualityTemporal, error) {
+func (mock *WaterQualityServiceMock) GetByID(ctx context.Context, id string, from time.Time, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error) {
 	if mock.GetByIDFunc == nil {
 		panic("WaterQualityServiceMock.GetByIDFunc: method is nil but WaterQualityService.GetByID was just called")
 	}
 	callInfo := struct {
-		Ctx  context.Context
-		ID   string
-		From time.Time
-		To   time.Time
+		Ctx        context.Context
+		ID         string
+		From       time.Time
+		To         time.Time
+		Resolution timeseries.Resolution
 	}{
-		Ctx:  ctx,
-		ID:   id,
-		From: from,
-		To:   to,
+		Ctx:        ctx,
+		ID:         id,
+		From:       from,
+		To:         to,
+		Resolution: resolution,
 	}
 	mock.lockGetByID.Lock()
 	mock.calls.GetByID = append(mock.calls.GetByID, callInfo)
 	mock.lockGetByID.Unlock()
-	return mock.GetByIDFunc(ctx, id, from, to)
+	return mock.GetByIDFunc(ctx, id, from, to, resolution)
 }
 
 // GetByIDCalls gets all the calls that were made to GetByID.
@@ -272,16 +277,18 @@ func (mock *WaterQualityServiceMock) GetByID(ctx context.Context, id string, fro
 //
 //	len(mockedWaterQualityService.GetByIDCalls())
 func (mock *WaterQualityServiceMock) GetByIDCalls() []struct {
-	Ctx  context.Context
-	ID   string
-	From time.Time
-	To   time.Time
+	Ctx        context.Context
+	ID         string
+	From       time.Time
+	To         time.Time
+	Resolution timeseries.Resolution
 } {
 	var calls []struct {
-		Ctx  context.Context
-		ID   string
-		From time.Time
-		To   time.Time
+		Ctx        context.Context
+		ID         string
+		From       time.Time
+		To         time.Time
+		Resolution timeseries.Resolution
 	}
 	mock.lockGetByID.RLock()
 	calls = mock.calls.GetByID
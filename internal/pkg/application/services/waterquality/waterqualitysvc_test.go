@@ -3,12 +3,14 @@ package waterquality
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/matryer/is"
 )
 
@@ -94,7 +96,10 @@ func TestGetByID(t *testing.T) {
 	_, err := wq.Refresh(ctx)
 	is.NoErr(err)
 
-	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", time.Time{}, time.Time{})
+	from, _ := time.Parse(time.RFC3339, "2021-05-18T00:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2021-05-23T00:00:00Z")
+
+	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to, "")
 	is.NoErr(err)
 
 	wqoJson, _ := json.Marshal(wqo)
@@ -114,7 +119,10 @@ func TestGetByIDSortsTemporalData(t *testing.T) {
 	_, err := wq.Refresh(ctx)
 	is.NoErr(err)
 
-	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", time.Time{}, time.Time{})
+	from, _ := time.Parse(time.RFC3339, "2021-05-18T00:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2021-05-23T00:00:00Z")
+
+	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to, "")
 	is.NoErr(err)
 
 	wqoJson, _ := json.Marshal(wqo)
@@ -137,7 +145,7 @@ func TestGetByIDWithTimespan(t *testing.T) {
 	from, _ := time.Parse(time.RFC3339, "2021-05-18T19:23:09Z")
 	to, _ := time.Parse(time.RFC3339, "2021-05-18T19:23:09Z")
 
-	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to)
+	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to, "")
 	is.NoErr(err)
 
 	wqoJson, _ := json.Marshal(wqo)
@@ -160,7 +168,7 @@ func TestGetTemporalWithEmptyTempResult(t *testing.T) {
 	from, _ := time.Parse(time.RFC3339, "2021-05-18T19:23:09Z")
 	to, _ := time.Parse(time.RFC3339, "2021-05-18T19:23:09Z")
 
-	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to)
+	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to, "")
 	is.NoErr(err)
 
 	wqoJson, err := json.Marshal(wqo)
@@ -170,6 +178,153 @@ func TestGetTemporalWithEmptyTempResult(t *testing.T) {
 	is.Equal(string(wqoJson), expectation)
 }
 
+func TestGetByIDReturnsOnlyTheRequestedTimespan(t *testing.T) {
+	is, ms := testSetup(t, http.StatusOK, multipleTemporalJSON)
+	ctx := context.Background()
+	defer ms.Close()
+
+	wq := NewWaterQualityService(ctx, ms.URL, "default")
+	wq.Start(ctx)
+	defer wq.Shutdown(ctx)
+
+	_, err := wq.Refresh(ctx)
+	is.NoErr(err)
+
+	from, _ := time.Parse(time.RFC3339, "2021-05-20T00:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2021-05-21T23:59:59Z")
+
+	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to, "")
+	is.NoErr(err)
+
+	wqoJson, _ := json.Marshal(wqo.Temperature)
+	is.Equal(string(wqoJson), `[{"value":10.8,"observedAt":"2021-05-21T14:23:09Z"},{"value":10.8,"observedAt":"2021-05-20T13:23:09Z"}]`)
+}
+
+func TestGetByIDRequestsPartialResultsPageByPage(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	pages := map[string]struct {
+		contentRange string
+		temperatures string
+	}{
+		"2021-05-01T00:00:00Z": {"date-time 2021-05-01T00:00:00-2021-05-02T12:00:00/2", `[{"type":"Property","value":10.04,"observedAt":"2021-05-01T10:00:00Z"},{"type":"Property","value":11.0,"observedAt":"2021-05-01T10:30:00Z"},{"type":"Property","value":12.0,"observedAt":"2021-05-02T12:00:00Z"}]`},
+		"2021-05-02T12:00:00Z": {"", `[{"type":"Property","value":12.0,"observedAt":"2021-05-02T12:00:00Z"},{"type":"Property","value":14.0,"observedAt":"2021-05-03T09:00:00Z"}]`},
+	}
+
+	timeAts := []string{}
+
+	ms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/ngsi-ld/v1/temporal/entities/") {
+			w.Write([]byte(waterQualityJSON))
+			return
+		}
+
+		timeAt := r.URL.Query().Get("timeAt")
+		page, ok := pages[timeAt]
+		if !ok {
+			w.Write([]byte(emptyTemporalJSON))
+			return
+		}
+
+		timeAts = append(timeAts, timeAt)
+
+		if page.contentRange != "" {
+			w.Header().Add("Content-Range", page.contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],"id":"urn:ngsi-ld:WaterQualityObserved:testID","type":"WaterQualityObserved","temperature":` + page.temperatures + `}`))
+	}))
+	defer ms.Close()
+
+	wq := NewWaterQualityService(ctx, ms.URL, "default")
+	wq.Start(ctx)
+	defer wq.Shutdown(ctx)
+
+	_, err := wq.Refresh(ctx)
+	is.NoErr(err)
+
+	from, _ := time.Parse(time.RFC3339, "2021-05-01T00:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2021-05-04T00:00:00Z")
+
+	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to, "")
+	is.NoErr(err)
+	is.Equal(timeAts, []string{"2021-05-01T00:00:00Z", "2021-05-02T12:00:00Z"}) // the second page should start where the first one ended
+	is.Equal(len(wqo.Temperature), 4)                                           // temperatures at the end of a page should not be repeated
+
+	wqo, err = wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", from, to, timeseries.Day)
+	is.NoErr(err)
+
+	wqoJson, _ := json.Marshal(wqo.Temperature)
+	is.Equal(string(wqoJson), `[{"value":14,"observedAt":"2021-05-03T00:00:00+02:00","min":14,"max":14,"count":1},{"value":12,"observedAt":"2021-05-02T00:00:00+02:00","min":12,"max":12,"count":1},{"value":10.5,"observedAt":"2021-05-01T00:00:00+02:00","min":10,"max":11,"count":2}]`)
+}
+
+func TestThatRefreshOnlyRequestsNewTemperatures(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	newest := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	timeAts := []string{}
+
+	ms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/ngsi-ld/v1/temporal/entities/") {
+			w.Write([]byte(waterQualityJSON))
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "testID") {
+			timeAts = append(timeAts, r.URL.Query().Get("timeAt"))
+		}
+
+		temperatures := `[{"type":"Property","value":10.0,"observedAt":"` + newest.Add(-2*time.Hour).Format(time.RFC3339) + `"},{"type":"Property","value":11.0,"observedAt":"` + newest.Format(time.RFC3339) + `"}]`
+		w.Write([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],"id":"urn:ngsi-ld:WaterQualityObserved:testID","type":"WaterQualityObserved","temperature":` + temperatures + `}`))
+	}))
+	defer ms.Close()
+
+	wq := NewWaterQualityService(ctx, ms.URL, "default")
+	wq.Start(ctx)
+	defer wq.Shutdown(ctx)
+
+	_, err := wq.Refresh(ctx)
+	is.NoErr(err)
+
+	is.Equal(len(timeAts), 2)
+	is.True(timeAts[0] != newest.Format(time.RFC3339)) // the first refresh should request the whole cached history
+	is.Equal(timeAts[1], newest.Format(time.RFC3339))  // later refreshes should only request what is newer than the cached history
+
+	wqo, err := wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:testID", newest.Add(-24*time.Hour), newest, "")
+	is.NoErr(err)
+	is.Equal(len(wqo.Temperature), 2) // temperatures that are requested again should not be repeated
+}
+
+func TestGetByIDValidatesTheQuery(t *testing.T) {
+	is, ms := testSetup(t, http.StatusOK, singleTemporalJSON)
+	ctx := context.Background()
+	defer ms.Close()
+
+	wq := NewWaterQualityService(ctx, ms.URL, "default")
+	wq.Start(ctx)
+	defer wq.Shutdown(ctx)
+
+	_, err := wq.Refresh(ctx)
+	is.NoErr(err)
+
+	id := "urn:ngsi-ld:WaterQualityObserved:testID"
+	now := time.Now().UTC()
+
+	_, err = wq.GetByID(ctx, id, now, now.Add(-time.Hour), "")
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span must not end before it starts
+
+	_, err = wq.GetByID(ctx, id, now.Add(-MaxTimespan-time.Hour), now, "")
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span must not be too long
+
+	_, err = wq.GetByID(ctx, id, time.Time{}, time.Time{}, timeseries.Week)
+	is.True(errors.Is(err, ErrInvalidQuery)) // only hourly and daily aggregation is supported
+
+	_, err = wq.GetByID(ctx, "urn:ngsi-ld:WaterQualityObserved:unknown", time.Time{}, time.Time{}, "")
+	is.True(errors.Is(err, ErrWQNotFound))
+}
+
 func testSetup(t *testing.T, statusCode int, temporalJSON string) (*is.I, *httptest.Server) {
 	is := is.New(t)
 
@@ -191,13 +346,6 @@ const emptyTemporalJSON string = `{
 	  "https://schema.lab.fiware.org/ld/context",
 	  "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
 	],
-	"dateObserved": {
-	  "type": "Property",
-	  "value": {
-		"@type": "DateTime",
-		"@value": "2021-05-18T19:23:09Z"
-	  }
-	},
 	"id": "urn:ngsi-ld:WaterQualityObserved:testID",
 	"temperature": [],
 	"type": "WaterQualityObserved"
@@ -208,13 +356,6 @@ const singleTemporalJSON string = `{
 	  "https://schema.lab.fiware.org/ld/context",
 	  "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
 	],
-	"dateObserved": {
-	  "type": "Property",
-	  "value": {
-		"@type": "DateTime",
-		"@value": "2021-05-18T19:23:09Z"
-	  }
-	},
 	"id": "urn:ngsi-ld:WaterQualityObserved:testID",
 	"temperature": [{
 	  "type": "Property",
@@ -229,13 +370,6 @@ const multipleTemporalJSON string = `{
 	  "https://schema.lab.fiware.org/ld/context",
 	  "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
 	],
-	"dateObserved": {
-	  "type": "Property",
-	  "value": {
-		"@type": "DateTime",
-		"@value": "2021-05-18T19:23:09Z"
-	  }
-	},
 	"id": "urn:ngsi-ld:WaterQualityObserved:testID",
 	"temperature": [{
 		"type": "Property",
@@ -0,0 +1,316 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
+)
+
+// GetForecasts returns the forecasts for all locations within maxDistance metres from
+// the point, ordered by distance. Periods that have already ended are left out, and
+// with a resolution of timeseries.Day the periods are combined into one per day.
+func (svc *ws) GetForecasts(lat, lon float64, maxDistance int64, resolution timeseries.Resolution) []domain.WeatherForecast {
+	svc.weatherMutex.Lock()
+	defer svc.weatherMutex.Unlock()
+
+	now := time.Now()
+	nearby := svc.nearbyForecasts.Within(lat, lon, float64(maxDistance))
+	forecasts := make([]domain.WeatherForecast, 0, len(nearby))
+
+	for _, n := range nearby {
+		f := svc.forecasts[n.Item]
+
+		periods := make([]domain.WeatherForecastPeriod, 0, len(f.Forecasts))
+		for _, p := range f.Forecasts {
+			if p.ValidTo.After(now) {
+				periods = append(periods, p)
+			}
+		}
+
+		if len(periods) == 0 {
+			continue
+		}
+
+		if resolution == timeseries.Day {
+			periods = forecastsPerDay(periods)
+		}
+
+		forecasts = append(forecasts, domain.WeatherForecast{Location: f.Location, DateIssued: f.DateIssued, Forecasts: periods})
+	}
+
+	return forecasts
+}
+
+func (svc *ws) refreshForecasts(ctx context.Context) (count int, err error) {
+	dtos := []weatherForecastDTO{}
+
+	count, err = contextbroker.QueryEntities(ctx, svc.contextBrokerURL, svc.contextBrokerTenant, "WeatherForecast", nil, func(f weatherForecastDTO) {
+		dtos = append(dtos, f)
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve weather forecasts from context broker: %w", err)
+		return
+	}
+
+	svc.storeForecasts(groupForecastsByLocation(dtos))
+
+	return
+}
+
+func (svc *ws) storeForecasts(forecasts []domain.WeatherForecast) {
+	svc.weatherMutex.Lock()
+	defer svc.weatherMutex.Unlock()
+
+	svc.forecasts = forecasts
+	svc.nearbyForecasts = geo.NewIndex[int](nearbyCellSize)
+
+	for index, f := range forecasts {
+		if len(f.Location.Coordinates) >= 2 {
+			svc.nearbyForecasts.Add(f.Location.Coordinates[1], f.Location.Coordinates[0], index)
+		}
+	}
+}
+
+// groupForecastsByLocation combines the forecast entities for each location into a
+// series ordered by time. When there are several forecasts for the same period, the
+// most recently issued one is kept.
+func groupForecastsByLocation(dtos []weatherForecastDTO) []domain.WeatherForecast {
+	type issuedPeriod struct {
+		period domain.WeatherForecastPeriod
+		issued time.Time
+	}
+
+	locations := map[string]*domain.WeatherForecast{}
+	periods := map[string]map[int64]issuedPeriod{}
+
+	for _, f := range dtos {
+		if f.Location == nil || len(f.Location.Coordinates) < 2 {
+			continue
+		}
+
+		validFrom, err := time.Parse(time.RFC3339, f.ValidFrom.Value)
+		if err != nil {
+			continue
+		}
+
+		validTo, err := time.Parse(time.RFC3339, f.ValidTo.Value)
+		if err != nil {
+			continue
+		}
+
+		issued, _ := time.Parse(time.RFC3339, f.DateIssued.Value)
+
+		key := fmt.Sprintf("%.5f,%.5f", f.Location.Coordinates[0], f.Location.Coordinates[1])
+
+		location, ok := locations[key]
+		if !ok {
+			location = &domain.WeatherForecast{
+				Location: *domain.NewPoint(f.Location.Coordinates[1], f.Location.Coordinates[0]),
+			}
+			locations[key] = location
+			periods[key] = map[int64]issuedPeriod{}
+		}
+
+		if issued.After(location.DateIssued) {
+			location.DateIssued = issued
+		}
+
+		if existing, ok := periods[key][validFrom.Unix()]; ok && existing.issued.After(issued) {
+			continue
+		}
+
+		periods[key][validFrom.Unix()] = issuedPeriod{
+			issued: issued,
+			period: domain.WeatherForecastPeriod{
+				ValidFrom:        validFrom.UTC(),
+				ValidTo:          validTo.UTC(),
+				Temperature:      f.Temperature,
+				MinTemperature:   f.DayMinimum.temperature(),
+				MaxTemperature:   f.DayMaximum.temperature(),
+				RelativeHumidity: f.RelativeHumidity,
+				WindSpeed:        f.WindSpeed,
+				WindDirection:    f.WindDirection,
+				Precipitation:    f.Precipitation,
+				WeatherType:      f.WeatherType,
+			},
+		}
+	}
+
+	forecasts := make([]domain.WeatherForecast, 0, len(locations))
+
+	for key, location := range locations {
+		for _, p := range periods[key] {
+			location.Forecasts = append(location.Forecasts, p.period)
+		}
+
+		sort.Slice(location.Forecasts, func(i, j int) bool {
+			return location.Forecasts[i].ValidFrom.Before(location.Forecasts[j].ValidFrom)
+		})
+
+		forecasts = append(forecasts, *location)
+	}
+
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := forecasts[i].Location.Coordinates, forecasts[j].Location.Coordinates
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		return a[1] < b[1]
+	})
+
+	return forecasts
+}
+
+// forecastsPerDay combines the periods that start on the same day, in local time, into
+// one period per day. Temperatures, humidity and wind speed are averaged, wind
+// directions are averaged around the circle and precipitation is summed. The most
+// common weather type is used for the day.
+func forecastsPerDay(periods []domain.WeatherForecastPeriod) []domain.WeatherForecastPeriod {
+	days := []domain.WeatherForecastPeriod{}
+
+	for start := 0; start < len(periods); {
+		day := timeseries.BucketStart(periods[start].ValidFrom, timeseries.Day, timeseries.DefaultLocation)
+
+		end := start
+		for end < len(periods) && timeseries.BucketStart(periods[end].ValidFrom, timeseries.Day, timeseries.DefaultLocation).Equal(day) {
+			end++
+		}
+
+		days = append(days, combineForecasts(periods[start:end], day, day.AddDate(0, 0, 1)))
+		start = end
+	}
+
+	return days
+}
+
+func combineForecasts(periods []domain.WeatherForecastPeriod, from, to time.Time) domain.WeatherForecastPeriod {
+	var temperatures, humidities, windSpeeds, windDirections, precipitation []float64
+	var minTemperature, maxTemperature *float64
+	weatherTypes := map[string]int{}
+	weatherType := ""
+
+	lower := func(current *float64, v float64) *float64 {
+		if current == nil || v < *current {
+			return &v
+		}
+		return current
+	}
+
+	higher := func(current *float64, v float64) *float64 {
+		if current == nil || v > *current {
+			return &v
+		}
+		return current
+	}
+
+	for _, p := range periods {
+		if p.Temperature != nil {
+			temperatures = append(temperatures, *p.Temperature)
+			minTemperature = lower(minTemperature, *p.Temperature)
+			maxTemperature = higher(maxTemperature, *p.Temperature)
+		}
+		if p.MinTemperature != nil {
+			minTemperature = lower(minTemperature, *p.MinTemperature)
+		}
+		if p.MaxTemperature != nil {
+			maxTemperature = higher(maxTemperature, *p.MaxTemperature)
+		}
+		if p.RelativeHumidity != nil {
+			humidities = append(humidities, *p.RelativeHumidity)
+		}
+		if p.WindSpeed != nil {
+			windSpeeds = append(windSpeeds, *p.WindSpeed)
+		}
+		if p.WindDirection != nil {
+			windDirections = append(windDirections, *p.WindDirection)
+		}
+		if p.Precipitation != nil {
+			precipitation = append(precipitation, *p.Precipitation)
+		}
+		if p.WeatherType != "" {
+			weatherTypes[p.WeatherType]++
+			if weatherTypes[p.WeatherType] > weatherTypes[weatherType] {
+				weatherType = p.WeatherType
+			}
+		}
+	}
+
+	day := domain.WeatherForecastPeriod{
+		ValidFrom:        from,
+		ValidTo:          to,
+		Temperature:      average(temperatures),
+		MinTemperature:   minTemperature,
+		MaxTemperature:   maxTemperature,
+		RelativeHumidity: average(humidities),
+		WindSpeed:        average(windSpeeds),
+		Precipitation:    sum(precipitation),
+		WeatherType:      weatherType,
+	}
+
+	if len(windDirections) > 0 {
+		direction := timeseries.CircularMean(windDirections)
+		day.WindDirection = &direction
+	}
+
+	return day
+}
+
+func average(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+
+	avg := round(*sum(values) / float64(len(values)))
+	return &avg
+}
+
+func sum(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+
+	total = math.Round(total*100) / 100
+	return &total
+}
+
+type weatherForecastDTO struct {
+	ID               string          `json:"id"`
+	DateIssued       domain.DateTime `json:"dateIssued"`
+	ValidFrom        domain.DateTime `json:"validFrom"`
+	ValidTo          domain.DateTime `json:"validTo"`
+	Temperature      *float64        `json:"temperature"`
+	DayMinimum       *dayExtremeDTO  `json:"dayMinimum"`
+	DayMaximum       *dayExtremeDTO  `json:"dayMaximum"`
+	RelativeHumidity *float64        `json:"relativeHumidity"`
+	WindSpeed        *float64        `json:"windSpeed"`
+	WindDirection    *float64        `json:"windDirection"`
+	Precipitation    *float64        `json:"precipitation"`
+	WeatherType      string          `json:"weatherType"`
+	Location         *struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"location"`
+}
+
+type dayExtremeDTO struct {
+	Temperature *float64 `json:"temperature"`
+}
+
+func (d *dayExtremeDTO) temperature() *float64 {
+	if d == nil {
+		return nil
+	}
+	return d.Temperature
+}
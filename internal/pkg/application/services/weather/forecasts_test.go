@@ -0,0 +1,97 @@
+package weather
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	"github.com/matryer/is"
+)
+
+func TestThatTheLatestIssuedForecastIsKeptPerPeriod(t *testing.T) {
+	is := is.New(t)
+
+	forecasts := groupForecastsByLocation([]weatherForecastDTO{
+		newTestForecast("2023-06-01T06:00:00Z", "2023-06-02T12:00:00Z", 20, 17.3, 62.39),
+		newTestForecast("2023-06-01T12:00:00Z", "2023-06-02T12:00:00Z", 24, 17.3, 62.39),
+		newTestForecast("2023-06-01T12:00:00Z", "2023-06-02T11:00:00Z", 22, 17.3, 62.39),
+		newTestForecast("2023-06-01T12:00:00Z", "2023-06-02T11:00:00Z", 15, 17.0, 62.0),
+	})
+
+	is.Equal(len(forecasts), 2) // forecasts should be grouped by location
+	is.Equal(forecasts[1].Location.Coordinates, []float64{17.3, 62.39})
+	is.Equal(forecasts[1].DateIssued, time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	is.Equal(len(forecasts[1].Forecasts), 2)
+	is.Equal(*forecasts[1].Forecasts[0].Temperature, 22.0) // periods should be sorted by time
+	is.Equal(*forecasts[1].Forecasts[1].Temperature, 24.0) // the most recently issued forecast should be kept
+}
+
+func TestThatForecastsCanBeCombinedPerDay(t *testing.T) {
+	is := is.New(t)
+
+	tomorrow := timeseries.BucketStart(time.Now().AddDate(0, 0, 1), timeseries.Day, timeseries.DefaultLocation)
+	period := func(hour int, temperature, precipitation, windDirection float64, weatherType string) domain.WeatherForecastPeriod {
+		from := tomorrow.Add(time.Duration(hour) * time.Hour)
+		return domain.WeatherForecastPeriod{
+			ValidFrom:     from,
+			ValidTo:       from.Add(time.Hour),
+			Temperature:   &temperature,
+			Precipitation: &precipitation,
+			WindDirection: &windDirection,
+			WeatherType:   weatherType,
+		}
+	}
+
+	svc := NewWeatherService(context.Background(), "ignored", "default").(*ws)
+	svc.storeForecasts([]domain.WeatherForecast{
+		{
+			Location: *domain.NewPoint(62.39, 17.3),
+			Forecasts: []domain.WeatherForecastPeriod{
+				period(6, 14, 0.5, 350, "cloudy"),
+				period(12, 24, 0, 10, "sunny"),
+				period(18, 19, 1.2, 0, "sunny"),
+				period(30, 12, 0, 90, "rain"),
+			},
+		},
+		{
+			Location:  *domain.NewPoint(63.0, 18.0),
+			Forecasts: []domain.WeatherForecastPeriod{period(6, 14, 0, 0, "")},
+		},
+	})
+
+	is.Equal(len(svc.GetForecasts(62.39, 17.3, 10000, timeseries.Hour)), 1) // forecasts far away should be left out
+
+	hourly := svc.GetForecasts(62.39, 17.3, 10000, timeseries.Hour)[0]
+	is.Equal(len(hourly.Forecasts), 4)
+
+	daily := svc.GetForecasts(62.39, 17.3, 10000, timeseries.Day)[0]
+	is.Equal(len(daily.Forecasts), 2)
+
+	is.Equal(daily.Forecasts[0].ValidFrom, tomorrow)
+	is.Equal(*daily.Forecasts[0].Temperature, 19.0)
+	is.Equal(*daily.Forecasts[0].MinTemperature, 14.0)
+	is.Equal(*daily.Forecasts[0].MaxTemperature, 24.0)
+	is.Equal(*daily.Forecasts[0].Precipitation, 1.7)
+	is.Equal(*daily.Forecasts[0].WindDirection, 0.0)
+	is.Equal(daily.Forecasts[0].WeatherType, "sunny")
+}
+
+func newTestForecast(issued, validFrom string, temperature, lon, lat float64) weatherForecastDTO {
+	from, _ := time.Parse(time.RFC3339, validFrom)
+
+	f := weatherForecastDTO{
+		DateIssued:  *domain.NewDateTime(issued),
+		ValidFrom:   *domain.NewDateTime(validFrom),
+		ValidTo:     *domain.NewDateTime(from.Add(time.Hour).Format(time.RFC3339)),
+		Temperature: &temperature,
+	}
+
+	f.Location = &struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	}{Type: "Point", Coordinates: []float64{lon, lat}}
+
+	return f
+}
@@ -2,24 +2,79 @@ package weather
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
-	"net/url"
-	"slices"
+	"sort"
+	"sync"
 	"time"
 
+	"log/slog"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/geo"
+	"github.com/diwise/api-opendata/internal/pkg/application/temporal"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	contextbroker "github.com/diwise/context-broker/pkg/ngsild/client"
-	"github.com/diwise/context-broker/pkg/ngsild/geojson"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
-	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
 	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("api-opendata/svcs/weather")
+
+// ErrNotFound is returned when a weather station is not known to the service
+var ErrNotFound error = errors.New("no such weather station")
+
+// ErrInvalidQuery is returned when the time span or aggregation of a query is invalid
+var ErrInvalidQuery error = errors.New("invalid query")
+
+// MaxTimespan is the longest time span of history that can be requested in one query
+const MaxTimespan time.Duration = 31 * 24 * time.Hour
+
+// historyTTL is how long the temporal evolution of a weather station is cached. Time
+// spans are rounded to whole multiples of it, so that requests for the default time
+// span share a cached history until it expires.
+const historyTTL time.Duration = 5 * time.Minute
+
+// maxCachedHistories limits the number of time spans that are cached at the same time
+const maxCachedHistories int = 500
+
+// maxConcurrentRequests limits the number of temporal requests that are sent to the
+// broker at the same time when the history of several stations is requested
+const maxConcurrentRequests int = 4
+
+// nearbyCellSize is the size in metres of the cells of the spatial indexes of stations
+// and forecasts, chosen to be close to the default search distances
+const nearbyCellSize float64 = 5000
+
+// weatherAttributes are the numeric WeatherObserved attributes, apart from temperature,
+// that are passed on when present
+var weatherAttributes = []string{
+	"relativeHumidity",
+	"atmosphericPressure",
+	"windSpeed",
+	"windDirection",
+	"precipitation",
+	"snowHeight",
+	"illuminance",
+}
+
 //go:generate moq -rm -out weathersvc_mock.go . WeatherService
 type WeatherService interface {
+	Broker() string
+	Tenant() string
+
 	Query() WeatherServiceQuery
+	GetStations() []domain.WeatherStation
+	GetForecasts(lat, lon float64, maxDistance int64, resolution timeseries.Resolution) []domain.WeatherForecast
+
+	Start(ctx context.Context)
+	Shutdown(ctx context.Context)
 }
 
 //go:generate moq -rm -out weathersvcquery_mock.go . WeatherServiceQuery
@@ -32,32 +87,90 @@ type WeatherServiceQuery interface {
 	GetByID(ctx context.Context) (domain.Weather, error)
 }
 
+// NewWeatherService creates a service that keeps the latest observation from each
+// weather station and the latest forecasts in memory, along with a short lived cache
+// of temperature histories
 func NewWeatherService(ctx context.Context, contextBrokerURL string, contextBrokerTenant string) WeatherService {
 	return &ws{
 		contextBrokerURL:    contextBrokerURL,
 		contextBrokerTenant: contextBrokerTenant,
+
+		stations:        []WeatherDTO{},
+		stationIndex:    map[string]int{},
+		nearbyStations:  geo.NewIndex[int](nearbyCellSize),
+		history:         map[string]cachedHistory{},
+		forecasts:       []domain.WeatherForecast{},
+		nearbyForecasts: geo.NewIndex[int](nearbyCellSize),
+
+		keepRunning: true,
 	}
 }
 
 type ws struct {
 	contextBrokerURL    string
 	contextBrokerTenant string
+
+	weatherMutex    sync.Mutex
+	stations        []WeatherDTO
+	stationIndex    map[string]int
+	nearbyStations  *geo.Index[int]
+	history         map[string]cachedHistory
+	forecasts       []domain.WeatherForecast
+	nearbyForecasts *geo.Index[int]
+
+	keepRunning bool
+}
+
+type cachedHistory struct {
+	series    map[string][]TemperatureDTO
+	fetchedAt time.Time
 }
 
 type wsq struct {
-	ws
+	svc      *ws
 	id       string
 	lat      float64
 	lon      float64
 	distance int64
 	from     time.Time
 	to       time.Time
-	err      error
 	aggr     string
 }
 
+func (svc *ws) Broker() string {
+	return svc.contextBrokerURL
+}
+
+func (svc *ws) Tenant() string {
+	return svc.contextBrokerTenant
+}
+
 func (svc *ws) Query() WeatherServiceQuery {
-	return &wsq{ws: *svc}
+	return wsq{svc: svc}
+}
+
+// GetStations returns all known weather stations, sorted by id
+func (svc *ws) GetStations() []domain.WeatherStation {
+	svc.weatherMutex.Lock()
+	defer svc.weatherMutex.Unlock()
+
+	stations := make([]domain.WeatherStation, 0, len(svc.stations))
+
+	for _, s := range svc.stations {
+		station := domain.WeatherStation{
+			ID:          s.ID,
+			Location:    *domain.NewPoint(s.Location.Lat, s.Location.Lon),
+			Temperature: s.Temperature,
+		}
+
+		if s.DateObserved != nil {
+			station.DateObserved, _ = time.Parse(time.RFC3339, *s.DateObserved)
+		}
+
+		stations = append(stations, station)
+	}
+
+	return stations
 }
 
 func (q wsq) BetweenTimes(from, to time.Time) WeatherServiceQuery {
@@ -78,12 +191,9 @@ func (q wsq) ID(id string) WeatherServiceQuery {
 	return q
 }
 
+// Aggr sets the resolution that the history should be aggregated by. An unknown
+// resolution makes the query fail with ErrInvalidQuery.
 func (q wsq) Aggr(aggr string) WeatherServiceQuery {
-	if aggr != "hour" && aggr != "day" && aggr != "month" && aggr != "year" {
-		q.aggr = ""
-		return q
-	}
-
 	q.aggr = aggr
 	return q
 }
@@ -97,6 +207,10 @@ type WeatherDTO struct {
 		Lon float64
 	}
 	Temperatures []TemperatureDTO
+	// Attributes holds the latest value of each of the weatherAttributes that
+	// are present, and Series their temporal evolution
+	Attributes map[string]*float64
+	Series     map[string][]TemperatureDTO
 }
 
 type TemperatureDTO struct {
@@ -104,6 +218,8 @@ type TemperatureDTO struct {
 	Temperature  *float64
 	Max          *float64
 	Min          *float64
+	Median       *float64
+	Count        int
 	From         *time.Time
 	To           *time.Time
 }
@@ -112,153 +228,472 @@ func NewDTO(id string) WeatherDTO {
 	return WeatherDTO{
 		ID:           id,
 		Temperatures: make([]TemperatureDTO, 0),
+		Attributes:   map[string]*float64{},
+		Series:       map[string][]TemperatureDTO{},
 	}
 }
 
+// Get returns the latest observation from each weather station within the given
+// distance from the point, ordered by distance. If a time span is given, the history
+// of each station is included as well, fetched with at most maxConcurrentRequests
+// requests to the broker at a time. Stations whose history can not be retrieved are
+// left out, and an error is only returned if no history could be retrieved at all.
 func (q wsq) Get(ctx context.Context) ([]domain.Weather, error) {
-	headers := map[string][]string{
-		"Accept": {"application/ld+json"},
-		"Link":   {entities.LinkHeader},
+	if err := q.validate(); err != nil {
+		return nil, err
 	}
 
-	cbClient := contextbroker.NewContextBrokerClient(q.contextBrokerURL, contextbroker.Tenant(q.contextBrokerTenant))
+	q.svc.weatherMutex.Lock()
 
-	params := url.Values{}
-	params.Add("type", fiware.WeatherObservedTypeName)
-	params.Add("geoproperty", "location")
-	params.Add("georel", fmt.Sprintf("near;maxDistance==%d", q.distance))
-	params.Add("geometry", "Point")
-	params.Add("coordinates", fmt.Sprintf("[%f,%f]", q.lon, q.lat))
+	nearby := q.svc.nearbyStations.Within(q.lat, q.lon, float64(q.distance))
 
-	reqUrl := fmt.Sprintf("/ngsi-ld/v1/entities?%s", params.Encode())
+	weather := make([]WeatherDTO, 0, len(nearby))
+	for _, n := range nearby {
+		weather = append(weather, q.svc.stations[n.Item])
+	}
 
-	wos, err := cbClient.QueryEntities(ctx, nil, nil, reqUrl, headers)
-	if err != nil {
-		return nil, fmt.Errorf("invalid temperature service query: %s", q.err.Error())
+	q.svc.weatherMutex.Unlock()
+
+	if q.from.IsZero() && q.to.IsZero() {
+		return toWeatherSlice(weather), nil
+	}
+
+	errs := make([]error, len(weather))
+	semaphore := make(chan struct{}, maxConcurrentRequests)
+	wg := sync.WaitGroup{}
+
+	for i := range weather {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			weather[i], errs[i] = q.withHistory(ctx, weather[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	logger := logging.GetFromContext(ctx)
+	retrieved := make([]WeatherDTO, 0, len(weather))
+
+	for i := range weather {
+		if errs[i] != nil {
+			logger.Warn("leaving out weather station without history", slog.String("id", weather[i].ID), slog.String("err", errs[i].Error()))
+			continue
+		}
+
+		retrieved = append(retrieved, weather[i])
 	}
 
-	weather := make([]WeatherDTO, 0)
+	if len(retrieved) == 0 && len(weather) > 0 {
+		return nil, errors.Join(errs...)
+	}
 
-	for {
-		entity := <-wos.Found
-		if entity == nil {
-			break
+	return toWeatherSlice(retrieved), nil
+}
+
+// validate checks that the time span is in order and no longer than MaxTimespan, and
+// that the aggregation, if any, is a known resolution
+func (q wsq) validate() error {
+	if !q.from.IsZero() && !q.to.IsZero() {
+		if q.to.Before(q.from) {
+			return fmt.Errorf("%w: the end of the time span must not be before its start", ErrInvalidQuery)
 		}
 
-		weather = append(weather, weatherObservedToWeatherDto(entity))
+		if q.to.Sub(q.from) > MaxTimespan {
+			return fmt.Errorf("%w: the time span must not be longer than %s", ErrInvalidQuery, MaxTimespan)
+		}
 	}
 
-	return toWeatherSlice(weather), nil
+	if q.aggr != "" {
+		if _, err := timeseries.ParseResolution(q.aggr); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidQuery, err.Error())
+		}
+	}
+
+	return nil
 }
 
+// GetByID returns the latest observation from a weather station, along with the
+// values of each attribute between from and to. The history is cached for a few
+// minutes, with the time span rounded to whole multiples of the cache ttl so that
+// repeated requests for the default time span are served from the cache.
 func (q wsq) GetByID(ctx context.Context) (domain.Weather, error) {
 	if q.id == "" {
 		return domain.Weather{}, fmt.Errorf("no id specified")
 	}
 
-	headers := map[string][]string{
-		"Accept": {"application/ld+json"},
-		"Link":   {entities.LinkHeader},
+	if err := q.validate(); err != nil {
+		return domain.Weather{}, err
 	}
 
-	cbClient := contextbroker.NewContextBrokerClient(q.contextBrokerURL, contextbroker.Tenant(q.contextBrokerTenant))
+	q.svc.weatherMutex.Lock()
+	index, ok := q.svc.stationIndex[q.id]
+	var dto WeatherDTO
+	if ok {
+		dto = q.svc.stations[index]
+	}
+	q.svc.weatherMutex.Unlock()
+
+	if !ok {
+		return domain.Weather{}, ErrNotFound
+	}
 
-	entity, err := cbClient.RetrieveEntity(ctx, q.id, headers)
+	dto, err := q.withHistory(ctx, dto)
 	if err != nil {
 		return domain.Weather{}, err
 	}
 
-	temporal, err := cbClient.RetrieveTemporalEvolutionOfEntity(ctx, entity.ID(), headers, contextbroker.Between(q.from, q.to))
+	return toWeather(dto), nil
+}
+
+// withHistory adds the values of each attribute between from and to, aggregated by
+// the resolution of the query if one is set
+func (q wsq) withHistory(ctx context.Context, dto WeatherDTO) (WeatherDTO, error) {
+	series, err := q.svc.getHistory(ctx, dto.ID, q.from, q.to)
 	if err != nil {
-		return domain.Weather{}, fmt.Errorf("invalid temperature service query: %s", err.Error())
+		return dto, err
 	}
 
-	dto := weatherObservedToWeatherDto(entity)
-	dto.Temperatures = temporalPropertiesToTemperatureDto(temporal.Found.Property("temperature"))
+	dto.Temperatures = series["temperature"]
+	dto.Series = map[string][]TemperatureDTO{}
 
-	if q.aggr != "" && q.aggr == "hour" || q.aggr == "day" || q.aggr == "month" || q.aggr == "year" {
-		dto.Temperatures = groupByTime(dto.Temperatures, q.aggr)
+	for _, attr := range weatherAttributes {
+		if len(series[attr]) > 0 {
+			dto.Series[attr] = series[attr]
+		}
 	}
 
-	return toWeather(dto), nil
+	if res, err := timeseries.ParseResolution(q.aggr); err == nil {
+		dto.Temperatures = groupByTime(dto.Temperatures, res, false)
+
+		for attr, values := range dto.Series {
+			dto.Series[attr] = groupByTime(values, res, attr == "windDirection")
+		}
+	}
+
+	return dto, nil
 }
 
-func groupByTime(tempDto []TemperatureDTO, res string) []TemperatureDTO {
-	grouped := make(map[string][]TemperatureDTO)
-
-	for _, t := range tempDto {
-		dateObserved := t.DateObserved.Format(time.RFC3339)
-		switch res {
-		case "hour":
-			grouped[dateObserved[0:13]] = append(grouped[dateObserved[0:13]], t)
-		case "day":
-			grouped[dateObserved[0:10]] = append(grouped[dateObserved[0:10]], t)
-		case "month":
-			grouped[dateObserved[0:7]] = append(grouped[dateObserved[0:7]], t)
-		case "year":
-			grouped[dateObserved[0:4]] = append(grouped[dateObserved[0:4]], t)
+// getHistory returns the values of each attribute of a weather station between from
+// and to. The history of the time span rounded outwards to whole multiples of historyTTL
+// is requested from the broker, following partial responses, and cached.
+func (svc *ws) getHistory(ctx context.Context, id string, from, to time.Time) (map[string][]TemperatureDTO, error) {
+	spanFrom := from.Truncate(historyTTL)
+	spanTo := to.Truncate(historyTTL)
+	if spanTo.Before(to) {
+		spanTo = spanTo.Add(historyTTL)
+	}
+
+	key := fmt.Sprintf("%s|%s|%s", id, spanFrom.Format(time.RFC3339), spanTo.Format(time.RFC3339))
+	now := time.Now()
+
+	svc.weatherMutex.Lock()
+	cached, ok := svc.history[key]
+	svc.weatherMutex.Unlock()
+
+	if ok && now.Sub(cached.fetchedAt) < historyTTL {
+		return seriesBetween(cached.series, from, to), nil
+	}
+
+	headers := map[string][]string{
+		"Accept": {"application/ld+json"},
+		"Link":   {entities.LinkHeader},
+	}
+
+	cbClient := contextbroker.NewContextBrokerClient(svc.contextBrokerURL, contextbroker.Tenant(svc.contextBrokerTenant))
+
+	evolution, err := temporal.Retrieve(ctx, cbClient, id, headers, spanFrom, spanTo, append([]string{"temperature"}, weatherAttributes...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid temperature service query: %s", err.Error())
+	}
+
+	series := map[string][]TemperatureDTO{
+		"temperature": temporalPropertiesToTemperatureDto(evolution.Property("temperature")),
+	}
+
+	for _, attr := range weatherAttributes {
+		series[attr] = temporalPropertiesToTemperatureDto(evolution.Property(attr))
+	}
+
+	svc.weatherMutex.Lock()
+	defer svc.weatherMutex.Unlock()
+
+	svc.evictHistories(now)
+	svc.history[key] = cachedHistory{series: series, fetchedAt: now}
+
+	return seriesBetween(series, from, to), nil
+}
+
+// evictHistories removes the expired histories from the cache, along with the oldest
+// ones if there is no room for another history. It must be called with the mutex held.
+func (svc *ws) evictHistories(now time.Time) {
+	for k, h := range svc.history {
+		if now.Sub(h.fetchedAt) >= historyTTL {
+			delete(svc.history, k)
 		}
 	}
 
-	aggregated := make([]TemperatureDTO, 0)
+	if len(svc.history) < maxCachedHistories {
+		return
+	}
+
+	keys := make([]string, 0, len(svc.history))
+	for k := range svc.history {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return svc.history[keys[i]].fetchedAt.Before(svc.history[keys[j]].fetchedAt)
+	})
+
+	for _, k := range keys[:len(keys)-maxCachedHistories+1] {
+		delete(svc.history, k)
+	}
+}
+
+// seriesBetween returns the values of each series that were observed between from and
+// to. A zero from or to time leaves that end of the time span open.
+func seriesBetween(series map[string][]TemperatureDTO, from, to time.Time) map[string][]TemperatureDTO {
+	result := make(map[string][]TemperatureDTO, len(series))
 
-	for _, t := range grouped {
-		slices.SortFunc[[]TemperatureDTO](t, func(a, b TemperatureDTO) int {
-			if a.DateObserved.Before(*b.DateObserved) {
-				return -1
+	for attr, values := range series {
+		result[attr] = make([]TemperatureDTO, 0, len(values))
+
+		for _, v := range values {
+			if (!from.IsZero() && v.DateObserved.Before(from)) || (!to.IsZero() && v.DateObserved.After(to)) {
+				continue
 			}
-			if a.DateObserved.After(*b.DateObserved) {
-				return 1
+			result[attr] = append(result[attr], v)
+		}
+	}
+
+	return result
+}
+
+func (svc *ws) Start(ctx context.Context) {
+	logger := logging.GetFromContext(ctx)
+	logger.Info("starting weather service")
+	go svc.run(ctx)
+}
+
+func (svc *ws) Shutdown(ctx context.Context) {
+	logger := logging.GetFromContext(ctx)
+	logger.Info("shutting down weather service")
+	svc.keepRunning = false
+}
+
+func (svc *ws) run(ctx context.Context) {
+	nextRefreshTime := time.Now()
+	logger := logging.GetFromContext(ctx)
+
+	for svc.keepRunning {
+		if time.Now().After(nextRefreshTime) {
+			logger.Info("refreshing weather info")
+			count, err := svc.refresh(ctx)
+
+			if err != nil {
+				logger.Error("failed to refresh weather", slog.String("err", err.Error()))
+				// Retry every 10 seconds on error
+				nextRefreshTime = time.Now().Add(10 * time.Second)
+			} else {
+				logger.Info("refreshed weather", slog.Int("count", count))
+				// Refresh every 5 minutes on success
+				nextRefreshTime = time.Now().Add(5 * time.Minute)
 			}
-			return 0
-		})
-		aggregated = append(aggregated, aggregate(t))
+		}
+
+		time.Sleep(1 * time.Second)
 	}
 
-	return aggregated
+	logger.Info("weather service exiting")
 }
 
-func aggregate(temperatures []TemperatureDTO) TemperatureDTO {
-	var min, max *float64
-	var avg, total float64
+func (svc *ws) refresh(ctx context.Context) (count int, err error) {
+	logger := logging.GetFromContext(ctx)
 
-	rnd := func(val float64) float64 {
-		ratio := math.Pow(10, float64(2))
-		return math.Round(val*ratio) / ratio
+	ctx, span := tracer.Start(ctx, "refresh-weather")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, _ = o11y.AddTraceIDToLoggerAndStoreInContext(span, logger, ctx)
+
+	stations := []WeatherDTO{}
+
+	count, err = contextbroker.QueryEntities(ctx, svc.contextBrokerURL, svc.contextBrokerTenant, fiware.WeatherObservedTypeName, nil, func(w weatherObservedDTO) {
+		if w.Location == nil || len(w.Location.Coordinates) < 2 || w.DateObserved.Value == "" {
+			return
+		}
+
+		dto := NewDTO(w.ID)
+		dto.DateObserved = &w.DateObserved.Value
+		dto.Temperature = w.Temperature
+		dto.Attributes = w.attributes()
+		dto.Location = &struct {
+			Lat float64
+			Lon float64
+		}{
+			Lat: w.Location.Coordinates[1],
+			Lon: w.Location.Coordinates[0],
+		}
+
+		stations = append(stations, dto)
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve weather observations from context broker: %w", err)
+		return
+	}
+
+	svc.storeWeatherStations(stations)
+
+	// the stations are still served when the forecasts can not be retrieved, in which case
+	// the previous forecasts are kept until the next refresh
+	forecasts, forecastErr := svc.refreshForecasts(ctx)
+	if forecastErr != nil {
+		logger.Error("failed to refresh weather forecasts", slog.String("err", forecastErr.Error()))
+		return
 	}
 
-	for _, t := range temperatures {
-		if min == nil && t.Temperature != nil {
-			min = t.Temperature
-		} else if t.Temperature != nil && *t.Temperature < *min {
-			min = t.Temperature
+	count += forecasts
+
+	return
+}
+
+func (svc *ws) storeWeatherStations(list []WeatherDTO) {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	svc.weatherMutex.Lock()
+	defer svc.weatherMutex.Unlock()
+
+	svc.stations = list
+	svc.stationIndex = map[string]int{}
+	svc.nearbyStations = geo.NewIndex[int](nearbyCellSize)
+
+	for index := range list {
+		svc.stationIndex[list[index].ID] = index
+
+		if location := list[index].Location; location != nil {
+			svc.nearbyStations.Add(location.Lat, location.Lon, index)
 		}
+	}
+}
+
+type weatherObservedDTO struct {
+	ID                  string          `json:"id"`
+	DateObserved        domain.DateTime `json:"dateObserved"`
+	Temperature         *float64        `json:"temperature"`
+	RelativeHumidity    *float64        `json:"relativeHumidity"`
+	AtmosphericPressure *float64        `json:"atmosphericPressure"`
+	WindSpeed           *float64        `json:"windSpeed"`
+	WindDirection       *float64        `json:"windDirection"`
+	Precipitation       *float64        `json:"precipitation"`
+	SnowHeight          *float64        `json:"snowHeight"`
+	Illuminance         *float64        `json:"illuminance"`
+	Location            *struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"location"`
+}
+
+// attributes returns the weatherAttributes that are present in the observation
+func (w weatherObservedDTO) attributes() map[string]*float64 {
+	values := map[string]*float64{
+		"relativeHumidity":    w.RelativeHumidity,
+		"atmosphericPressure": w.AtmosphericPressure,
+		"windSpeed":           w.WindSpeed,
+		"windDirection":       w.WindDirection,
+		"precipitation":       w.Precipitation,
+		"snowHeight":          w.SnowHeight,
+		"illuminance":         w.Illuminance,
+	}
 
-		if max == nil && t.Temperature != nil {
-			max = t.Temperature
-		} else if t.Temperature != nil && *t.Temperature > *max {
-			max = t.Temperature
+	for attr, v := range values {
+		if v == nil {
+			delete(values, attr)
 		}
+	}
+
+	return values
+}
+
+// groupByTime aggregates the values into buckets of the given resolution, sorted by
+// time. Circular values, such as wind directions, are averaged using their circular
+// mean and have no min, max or median.
+func groupByTime(values []TemperatureDTO, res timeseries.Resolution, circular bool) []TemperatureDTO {
+	samples := make([]timeseries.Sample, 0, len(values))
 
-		if t.Temperature != nil {
-			total = total + *t.Temperature
+	for _, v := range values {
+		if v.DateObserved != nil && v.Temperature != nil {
+			samples = append(samples, timeseries.Sample{At: *v.DateObserved, Value: *v.Temperature})
 		}
 	}
 
-	avg = rnd(total / float64(len(temperatures)))
-	return TemperatureDTO{
-		DateObserved: temperatures[0].DateObserved,
-		Temperature:  &avg,
-		Max:          max,
-		Min:          min,
-		From:         temperatures[0].DateObserved,
-		To:           temperatures[len(temperatures)-1].DateObserved,
+	aggregated := make([]TemperatureDTO, 0)
+
+	for _, b := range timeseries.Aggregate(samples, res, timeseries.DefaultLocation) {
+		dto := TemperatureDTO{
+			DateObserved: &b.Start,
+			From:         &b.First,
+			To:           &b.Last,
+			Count:        b.Count,
+		}
+
+		if circular {
+			avg := b.CircularMean()
+			dto.Temperature = &avg
+		} else {
+			avg, min, max, median := round(b.Average), b.Min, b.Max, round(b.Median)
+			dto.Temperature = &avg
+			dto.Min = &min
+			dto.Max = &max
+			dto.Median = &median
+		}
+
+		aggregated = append(aggregated, dto)
 	}
+
+	return aggregated
+}
+
+func round(val float64) float64 {
+	return math.Round(val*100) / 100
 }
 
 func calc(w *domain.Weather) domain.Weather {
-	if w.Temperature.Values == nil || len(*w.Temperature.Values) == 0 {
-		return *w
+	calcMeasurement(&w.Temperature)
+
+	for _, m := range []*domain.Measurement{w.RelativeHumidity, w.AtmosphericPressure, w.WindSpeed, w.Precipitation, w.SnowHeight, w.Illuminance} {
+		if m != nil {
+			calcMeasurement(m)
+		}
+	}
+
+	if w.WindDirection != nil && w.WindDirection.Values != nil && len(*w.WindDirection.Values) > 0 {
+		directions := *w.WindDirection.Values
+		values := make([]float64, 0, len(directions))
+		for _, d := range directions {
+			if d.Value != nil {
+				values = append(values, *d.Value)
+			}
+		}
+
+		avg := timeseries.CircularMean(values)
+		w.WindDirection.Average = &avg
+
+		w.WindDirection.From = directions[0].When
+		w.WindDirection.To = directions[len(directions)-1].When
+	}
+
+	return *w
+}
+
+func calcMeasurement(m *domain.Measurement) {
+	if m.Values == nil || len(*m.Values) == 0 {
+		return
 	}
 
 	var min, max *float64
@@ -269,7 +704,7 @@ func calc(w *domain.Weather) domain.Weather {
 		return math.Round(val*ratio) / ratio
 	}
 
-	for _, t := range *w.Temperature.Values {
+	for _, t := range *m.Values {
 		if min == nil && t.Value != nil {
 			min = t.Value
 		} else if t.Value != nil && *t.Value < *min {
@@ -287,16 +722,14 @@ func calc(w *domain.Weather) domain.Weather {
 		}
 	}
 
-	temps := *w.Temperature.Values
+	temps := *m.Values
 
 	avg = rnd(total / float64(len(temps)))
-	w.Temperature.Average = &avg
-	w.Temperature.Max = max
-	w.Temperature.Min = min
-	w.Temperature.From = temps[0].When
-	w.Temperature.To = temps[len(temps)-1].When
-
-	return *w
+	m.Average = &avg
+	m.Max = max
+	m.Min = min
+	m.From = temps[0].When
+	m.To = temps[len(temps)-1].When
 }
 
 func temporalPropertiesToTemperatureDto(props []types.TemporalProperty) []TemperatureDTO {
@@ -322,33 +755,6 @@ func temporalPropertiesToTemperatureDto(props []types.TemporalProperty) []Temper
 	return temperatures
 }
 
-func weatherObservedToWeatherDto(e types.Entity) WeatherDTO {
-	w := NewDTO(e.ID())
-
-	e.ForEachAttribute(func(_, attributeName string, contents any) {
-		switch attributeName {
-		case "dateObserved":
-			p := contents.(*properties.DateTimeProperty)
-			w.DateObserved = &p.Val.Value
-		case "temperature":
-			p := contents.(*properties.NumberProperty)
-			w.Temperature = &p.Val
-		case "location":
-			p := contents.(*geojson.GeoJSONProperty)
-			point := p.GetAsPoint()
-			w.Location = &struct {
-				Lat float64
-				Lon float64
-			}{
-				Lat: point.Latitude(),
-				Lon: point.Longitude(),
-			}
-		}
-	})
-
-	return w
-}
-
 func toWeather(d WeatherDTO) domain.Weather {
 	dateObserved, _ := time.Parse(time.RFC3339, *d.DateObserved)
 
@@ -363,23 +769,69 @@ func toWeather(d WeatherDTO) domain.Weather {
 	}
 
 	if len(d.Temperatures) > 0 {
-		temperatures := make([]domain.Temperature, 0)
+		w.Temperature.Value = nil
+		w.Temperature.When = nil
+		w.Temperature.Values = toMeasurements(d.Temperatures)
+	}
+
+	for _, attr := range weatherAttributes {
+		var m *domain.Measurement
 
-		for _, t := range d.Temperatures {
-			temperatures = append(temperatures, domain.Temperature{
-				Value: t.Temperature,
-				When:  t.DateObserved,
-			})
+		if series, ok := d.Series[attr]; ok && len(series) > 0 {
+			m = &domain.Measurement{Values: toMeasurements(series)}
+		} else if v, ok := d.Attributes[attr]; ok && v != nil {
+			m = &domain.Measurement{Value: v, When: &dateObserved}
 		}
 
-		w.Temperature.Value = nil
-		w.Temperature.When = nil
-		w.Temperature.Values = &temperatures
+		if m != nil {
+			*measurementOf(&w, attr) = m
+		}
 	}
 
 	return calc(&w)
 }
 
+func toMeasurements(values []TemperatureDTO) *[]domain.Measurement {
+	measurements := make([]domain.Measurement, 0, len(values))
+
+	for _, v := range values {
+		measurements = append(measurements, domain.Measurement{
+			Value:  v.Temperature,
+			When:   v.DateObserved,
+			Max:    v.Max,
+			Min:    v.Min,
+			Median: v.Median,
+			Count:  v.Count,
+			From:   v.From,
+			To:     v.To,
+		})
+	}
+
+	return &measurements
+}
+
+// measurementOf returns the field in w that holds the measurement of an attribute
+func measurementOf(w *domain.Weather, attr string) **domain.Measurement {
+	switch attr {
+	case "relativeHumidity":
+		return &w.RelativeHumidity
+	case "atmosphericPressure":
+		return &w.AtmosphericPressure
+	case "windSpeed":
+		return &w.WindSpeed
+	case "windDirection":
+		return &w.WindDirection
+	case "precipitation":
+		return &w.Precipitation
+	case "snowHeight":
+		return &w.SnowHeight
+	case "illuminance":
+		return &w.Illuminance
+	}
+
+	panic("unknown weather attribute " + attr)
+}
+
 func toWeatherSlice(dto []WeatherDTO) []domain.Weather {
 	weather := make([]domain.Weather, 0)
 
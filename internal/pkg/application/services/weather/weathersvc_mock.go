@@ -4,6 +4,9 @@
 package weather
 
 import (
+	"context"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"sync"
 )
 
@@ -17,9 +20,27 @@ var _ WeatherService = &WeatherServiceMock{}
 //
 //		// make and configure a mocked WeatherService
 //		mockedWeatherService := &WeatherServiceMock{
+//			BrokerFunc: func() string {
+//				panic("mock out the Broker method")
+//			},
+//			GetForecastsFunc: func(lat float64, lon float64, maxDistance int64, resolution timeseries.Resolution) []domain.WeatherForecast {
+//				panic("mock out the GetForecasts method")
+//			},
+//			GetStationsFunc: func() []domain.WeatherStation {
+//				panic("mock out the GetStations method")
+//			},
 //			QueryFunc: func() WeatherServiceQuery {
 //				panic("mock out the Query method")
 //			},
+//			ShutdownFunc: func(ctx context.Context)  {
+//				panic("mock out the Shutdown method")
+//			},
+//			StartFunc: func(ctx context.Context)  {
+//				panic("mock out the Start method")
+//			},
+//			TenantFunc: func() string {
+//				panic("mock out the Tenant method")
+//			},
 //		}
 //
 //		// use mockedWeatherService in code that requires WeatherService
@@ -27,16 +48,168 @@ var _ WeatherService = &WeatherServiceMock{}
 //
 //	}
 type WeatherServiceMock struct {
+	// BrokerFunc mocks the Broker method.
+	BrokerFunc func() string
+
+	// GetForecastsFunc mocks the GetForecasts method.
+	GetForecastsFunc func(lat float64, lon float64, maxDistance int64, resolution timeseries.Resolution) []domain.WeatherForecast
+
+	// GetStationsFunc mocks the GetStations method.
+	GetStationsFunc func() []domain.WeatherStation
+
 	// QueryFunc mocks the Query method.
 	QueryFunc func() WeatherServiceQuery
 
+	// ShutdownFunc mocks the Shutdown method.
+	ShutdownFunc func(ctx context.Context)
+
+	// StartFunc mocks the Start method.
+	StartFunc func(ctx context.Context)
+
+	// TenantFunc mocks the Tenant method.
+	TenantFunc func() string
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// Broker holds details about calls to the Broker method.
+		Broker []struct {
+		}
+		// GetForecasts holds details about calls to the GetForecasts method.
+		GetForecasts []struct {
+			// Lat is the lat argument value.
+			Lat float64
+			// Lon is the lon argument value.
+			Lon float64
+			// MaxDistance is the maxDistance argument value.
+			MaxDistance int64
+			// Resolution is the resolution argument value.
+			Resolution timeseries.Resolution
+		}
+		// GetStations holds details about calls to the GetStations method.
+		GetStations []struct {
+		}
 		// Query holds details about calls to the Query method.
 		Query []struct {
 		}
+		// Shutdown holds details about calls to the Shutdown method.
+		Shutdown []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+		}
+		// Start holds details about calls to the Start method.
+		Start []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+		}
+		// Tenant holds details about calls to the Tenant method.
+		Tenant []struct {
+		}
+	}
+	lockBroker       sync.RWMutex
+	lockGetForecasts sync.RWMutex
+	lockGetStations  sync.RWMutex
+	lockQuery        sync.RWMutex
+	lockShutdown     sync.RWMutex
+	lockStart        sync.RWMutex
+	lockTenant       sync.RWMutex
+}
+
+// Broker calls BrokerFunc.
+func (mock *WeatherServiceMock) Broker() string {
+	if mock.BrokerFunc == nil {
+		panic("WeatherServiceMock.BrokerFunc: method is nil but WeatherService.Broker was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockBroker.Lock()
+	mock.calls.Broker = append(mock.calls.Broker, callInfo)
+	mock.lockBroker.Unlock()
+	return mock.BrokerFunc()
+}
+
+// BrokerCalls gets all the calls that were made to Broker.
+// Check the length with:
+//
+//	len(mockedWeatherService.BrokerCalls())
+func (mock *WeatherServiceMock) BrokerCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockBroker.RLock()
+	calls = mock.calls.Broker
+	mock.lockBroker.RUnlock()
+	return calls
+}
+
+// GetForecasts calls GetForecastsFunc.
+func (mock *WeatherServiceMock) GetForecasts(lat float64, lon float64, maxDistance int64, resolution timeseries.Resolution) []domain.WeatherForecast {
+	if mock.GetForecastsFunc == nil {
+		panic("WeatherServiceMock.GetForecastsFunc: method is nil but WeatherService.GetForecasts was just called")
+	}
+	callInfo := struct {
+		Lat         float64
+		Lon         float64
+		MaxDistance int64
+		Resolution  timeseries.Resolution
+	}{
+		Lat:         lat,
+		Lon:         lon,
+		MaxDistance: maxDistance,
+		Resolution:  resolution,
+	}
+	mock.lockGetForecasts.Lock()
+	mock.calls.GetForecasts = append(mock.calls.GetForecasts, callInfo)
+	mock.lockGetForecasts.Unlock()
+	return mock.GetForecastsFunc(lat, lon, maxDistance, resolution)
+}
+
+// GetForecastsCalls gets all the calls that were made to GetForecasts.
+// Check the length with:
+//
+//	len(mockedWeatherService.GetForecastsCalls())
+func (mock *WeatherServiceMock) GetForecastsCalls() []struct {
+	Lat         float64
+	Lon         float64
+	MaxDistance int64
+	Resolution  timeseries.Resolution
+} {
+	var calls []struct {
+		Lat         float64
+		Lon         float64
+		MaxDistance int64
+		Resolution  timeseries.Resolution
+	}
+	mock.lockGetForecasts.RLock()
+	calls = mock.calls.GetForecasts
+	mock.lockGetForecasts.RUnlock()
+	return calls
+}
+
+// GetStations calls GetStationsFunc.
+func (mock *WeatherServiceMock) GetStations() []domain.WeatherStation {
+	if mock.GetStationsFunc == nil {
+		panic("WeatherServiceMock.GetStationsFunc: method is nil but WeatherService.GetStations was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockGetStations.Lock()
+	mock.calls.GetStations = append(mock.calls.GetStations, callInfo)
+	mock.lockGetStations.Unlock()
+	return mock.GetStationsFunc()
+}
+
+// GetStationsCalls gets all the calls that were made to GetStations.
+// Check the length with:
+//
+//	len(mockedWeatherService.GetStationsCalls())
+func (mock *WeatherServiceMock) GetStationsCalls() []struct {
+} {
+	var calls []struct {
 	}
-	lockQuery sync.RWMutex
+	mock.lockGetStations.RLock()
+	calls = mock.calls.GetStations
+	mock.lockGetStations.RUnlock()
+	return calls
 }
 
 // Query calls QueryFunc.
@@ -65,3 +238,94 @@ func (mock *WeatherServiceMock) QueryCalls() []struct {
 	mock.lockQuery.RUnlock()
 	return calls
 }
+
+// Shutdown calls ShutdownFunc.
+func (mock *WeatherServiceMock) Shutdown(ctx context.Context) {
+	if mock.ShutdownFunc == nil {
+		panic("WeatherServiceMock.ShutdownFunc: method is nil but WeatherService.Shutdown was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+	}{
+		Ctx: ctx,
+	}
+	mock.lockShutdown.Lock()
+	mock.calls.Shutdown = append(mock.calls.Shutdown, callInfo)
+	mock.lockShutdown.Unlock()
+	mock.ShutdownFunc(ctx)
+}
+
+// ShutdownCalls gets all the calls that were made to Shutdown.
+// Check the length with:
+//
+//	len(mockedWeatherService.ShutdownCalls())
+func (mock *WeatherServiceMock) ShutdownCalls() []struct {
+	Ctx context.Context
+} {
+	var calls []struct {
+		Ctx context.Context
+	}
+	mock.lockShutdown.RLock()
+	calls = mock.calls.Shutdown
+	mock.lockShutdown.RUnlock()
+	return calls
+}
+
+// Start calls StartFunc.
+func (mock *WeatherServiceMock) Start(ctx context.Context) {
+	if mock.StartFunc == nil {
+		panic("WeatherServiceMock.StartFunc: method is nil but WeatherService.Start was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+	}{
+		Ctx: ctx,
+	}
+	mock.lockStart.Lock()
+	mock.calls.Start = append(mock.calls.Start, callInfo)
+	mock.lockStart.Unlock()
+	mock.StartFunc(ctx)
+}
+
+// StartCalls gets all the calls that were made to Start.
+// Check the length with:
+//
+//	len(mockedWeatherService.StartCalls())
+func (mock *WeatherServiceMock) StartCalls() []struct {
+	Ctx context.Context
+} {
+	var calls []struct {
+		Ctx context.Context
+	}
+	mock.lockStart.RLock()
+	calls = mock.calls.Start
+	mock.lockStart.RUnlock()
+	return calls
+}
+
+// Tenant calls TenantFunc.
+func (mock *WeatherServiceMock) Tenant() string {
+	if mock.TenantFunc == nil {
+		panic("WeatherServiceMock.TenantFunc: method is nil but WeatherService.Tenant was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockTenant.Lock()
+	mock.calls.Tenant = append(mock.calls.Tenant, callInfo)
+	mock.lockTenant.Unlock()
+	return mock.TenantFunc()
+}
+
+// TenantCalls gets all the calls that were made to Tenant.
+// Check the length with:
+//
+//	len(mockedWeatherService.TenantCalls())
+func (mock *WeatherServiceMock) TenantCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockTenant.RLock()
+	calls = mock.calls.Tenant
+	mock.lockTenant.RUnlock()
+	return calls
+}
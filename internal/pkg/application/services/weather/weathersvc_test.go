@@ -2,11 +2,16 @@ package weather
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
 	testutils "github.com/diwise/service-chassis/pkg/test/http"
@@ -87,8 +92,15 @@ func TestGroupByDay(t *testing.T) {
 			observedAt_: "2019-01-02T00:00:00Z",
 		},
 	}
-	byDay := groupByTime(temporalPropertiesToTemperatureDto(props), "day")
+	byDay := groupByTime(temporalPropertiesToTemperatureDto(props), timeseries.Day, false)
 	is.Equal(2, len(byDay))
+
+	for i := 0; i < 10; i++ {
+		byHour := groupByTime(temporalPropertiesToTemperatureDto(props), timeseries.Hour, false)
+		is.Equal(3, len(byHour))
+		is.Equal(*byHour[0].Temperature, 7.0) // aggregated values should be sorted by time
+		is.Equal(*byHour[2].Temperature, 5.0)
+	}
 }
 
 func TestGetByID(t *testing.T) {
@@ -97,40 +109,10 @@ func TestGetByID(t *testing.T) {
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
-		case "/ngsi-ld/v1/entities/WeatherObserved:net:serva:iot:a81758fffe051cff":
-			response := `
-			{
-				"@context": [
-					"https://raw.githubusercontent.com/diwise/context-broker/main/assets/jsonldcontexts/default-context.jsonl"
-				],
-				"dateObserved": {
-					"type": "Property",
-					"value": {
-						"@type": "DateTime",
-						"@value": "2023-11-10T15:04:49.990701012Z"
-					}
-				},
-				"id": "urn:ngsi-ld:WeatherObserved:net:serva:iot:a81758fffe051cff",
-				"location": {
-					"type": "GeoProperty",
-					"value": {
-						"type": "Point",
-						"coordinates": [
-							17.02068,
-							62.34731
-						]
-					}
-				},
-				"temperature": {
-					"type": "Property",
-					"value": 22.2,
-					"observedAt": "2023-11-10T15:04:49.000Z"
-				},
-				"type": "WeatherObserved"
-			}
-			`
+		case "/ngsi-ld/v1/entities":
+			w.Header().Add("Content-Type", "application/ld+json")
 			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(response))
+			w.Write([]byte(weatherObservedKeyValues))
 		case "/ngsi-ld/v1/temporal/entities/urn:ngsi-ld:WeatherObserved:net:serva:iot:a81758fffe051cff":
 			response := `
 			{
@@ -179,14 +161,295 @@ func TestGetByID(t *testing.T) {
 	}))
 	defer server.Close()
 
-	ws := NewWeatherService(ctx, server.URL, "default")
+	ws := NewWeatherService(ctx, server.URL, "default").(*ws)
+	_, err := ws.refresh(ctx)
+	is.NoErr(err)
 
-	w, err := ws.Query().ID("WeatherObserved:net:serva:iot:a81758fffe051cff").Aggr("year").GetByID(ctx)
+	w, err := ws.Query().ID("urn:ngsi-ld:WeatherObserved:net:serva:iot:a81758fffe051cff").Aggr("year").GetByID(ctx)
 	is.NoErr(err)
 
 	is.Equal("urn:ngsi-ld:WeatherObserved:net:serva:iot:a81758fffe051cff", w.ID)
 	is.Equal(2, len(*w.Temperature.Values))
+
+	_, err = ws.Query().ID("urn:ngsi-ld:WeatherObserved:unknown").GetByID(ctx)
+	is.True(errors.Is(err, ErrNotFound))
+}
+
+func TestThatAllWeatherAttributesArePassedOn(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ngsi-ld/v1/entities":
+			w.Header().Add("Content-Type", "application/ld+json")
+			w.Write([]byte(`[{"id":"urn:ngsi-ld:WeatherObserved:1","type":"WeatherObserved",` +
+				`"dateObserved":{"@type":"DateTime","@value":"2023-11-10T15:00:00Z"},` +
+				`"location":{"type":"Point","coordinates":[17.3,62.39]},` +
+				`"temperature":2.5,"relativeHumidity":0.8,"windSpeed":3.2,"windDirection":350}]`))
+		default:
+			w.Write([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],` +
+				`"id":"urn:ngsi-ld:WeatherObserved:1","type":"WeatherObserved",` +
+				`"relativeHumidity":[{"type":"Property","value":0.8,"observedAt":"2023-11-10T14:00:00Z"},{"type":"Property","value":0.6,"observedAt":"2023-11-10T15:00:00Z"}],` +
+				`"windDirection":[{"type":"Property","value":350,"observedAt":"2023-11-10T14:00:00Z"},{"type":"Property","value":10,"observedAt":"2023-11-10T15:00:00Z"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	ws := NewWeatherService(ctx, server.URL, "default").(*ws)
+	_, err := ws.refresh(ctx)
+	is.NoErr(err)
+
+	latest, err := ws.Query().NearPoint(1000, 62.39, 17.3).Get(ctx)
+	is.NoErr(err)
+	is.Equal(*latest[0].RelativeHumidity.Value, 0.8)
+	is.Equal(*latest[0].WindSpeed.Value, 3.2)
+	is.Equal(latest[0].AtmosphericPressure, nil) // attributes that are not present should be left out
+
+	w, err := ws.Query().ID("urn:ngsi-ld:WeatherObserved:1").Aggr("day").GetByID(ctx)
+	is.NoErr(err)
+	is.Equal(*w.RelativeHumidity.Average, 0.7)
+	is.Equal(len(*w.WindDirection.Values), 1)
+	is.Equal(*w.WindDirection.Average, 0.0) // wind directions should be averaged around the circle
+	is.Equal(*w.WindSpeed.Value, 3.2)       // attributes without history should fall back to the latest value
+}
+
+func TestThatStationsAreRefreshedWhenForecastsFail(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") == "WeatherForecast" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/ld+json")
+		w.Write([]byte(`[{"id":"urn:ngsi-ld:WeatherObserved:1","type":"WeatherObserved",` +
+			`"dateObserved":{"@type":"DateTime","@value":"2023-11-10T15:00:00Z"},` +
+			`"location":{"type":"Point","coordinates":[17.3,62.39]},"temperature":2.5}]`))
+	}))
+	defer server.Close()
+
+	ws := NewWeatherService(ctx, server.URL, "default").(*ws)
+	count, err := ws.refresh(ctx)
+	is.NoErr(err) // a failing forecast query should not fail the refresh of the stations
+	is.Equal(count, 1)
+
+	latest, err := ws.Query().NearPoint(1000, 62.39, 17.3).Get(ctx)
+	is.NoErr(err)
+	is.Equal(len(latest), 1)
 }
+
+func TestThatTemperatureHistoryIsCached(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	temporalRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		temporalRequests++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],"id":"urn:ngsi-ld:WeatherObserved:1","type":"WeatherObserved","temperature":[{"type":"Property","value":3,"observedAt":"2023-11-10T00:00:00Z"}]}`))
+	}))
+	defer server.Close()
+
+	ws := NewWeatherService(ctx, server.URL, "default").(*ws)
+	ws.storeWeatherStations([]WeatherDTO{newTestStation("urn:ngsi-ld:WeatherObserved:1", 62.39, 17.30)})
+
+	from := time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC)
+	_, err := ws.Query().ID("urn:ngsi-ld:WeatherObserved:1").BetweenTimes(from, from.Add(time.Hour)).GetByID(ctx)
+	is.NoErr(err)
+	_, err = ws.Query().ID("urn:ngsi-ld:WeatherObserved:1").BetweenTimes(from.Add(2*time.Minute), from.Add(time.Hour-2*time.Minute)).GetByID(ctx)
+	is.NoErr(err)
+
+	is.Equal(temporalRequests, 1) // time spans within the same five minutes should be served from the cache
+}
+
+func TestThatTheNumberOfCachedHistoriesIsLimited(t *testing.T) {
+	is := is.New(t)
+
+	ws := NewWeatherService(context.Background(), "ignored", "default").(*ws)
+
+	now := time.Now()
+	for i := 0; i < maxCachedHistories; i++ {
+		ws.history[fmt.Sprintf("history%d", i)] = cachedHistory{fetchedAt: now.Add(time.Duration(i-maxCachedHistories) * time.Millisecond)}
+	}
+
+	ws.evictHistories(now)
+
+	is.Equal(len(ws.history), maxCachedHistories-1) // there should be room for one more history
+	_, ok := ws.history["history0"]
+	is.True(!ok) // the oldest history should be evicted first
+}
+
+func TestThatPartialHistoriesArePaged(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		temperature := `[{"type":"Property","value":3,"observedAt":"2023-11-10T00:10:00Z"}]`
+
+		if r.URL.Query().Get("timeAt") == "2023-11-10T00:00:00Z" {
+			w.Header().Add("Content-Range", "DateTime 2023-11-10T00:00:00Z-2023-11-10T00:30:00Z")
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			temperature = `[{"type":"Property","value":5,"observedAt":"2023-11-10T00:40:00Z"}]`
+		}
+
+		w.Write([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],"id":"urn:ngsi-ld:WeatherObserved:1","type":"WeatherObserved","temperature":` + temperature + `}`))
+	}))
+	defer server.Close()
+
+	ws := NewWeatherService(ctx, server.URL, "default").(*ws)
+	ws.storeWeatherStations([]WeatherDTO{newTestStation("urn:ngsi-ld:WeatherObserved:1", 62.39, 17.30)})
+
+	from := time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC)
+	w, err := ws.Query().ID("urn:ngsi-ld:WeatherObserved:1").BetweenTimes(from, from.Add(time.Hour)).GetByID(ctx)
+	is.NoErr(err)
+	is.Equal(len(*w.Temperature.Values), 2) // the values of both pages should be included
+}
+
+func TestThatGetIncludesHistoryWithBoundedConcurrency(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		id := strings.TrimPrefix(r.URL.Path, "/ngsi-ld/v1/temporal/entities/")
+		w.Write([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],"id":"` + id + `","type":"WeatherObserved",` +
+			`"temperature":[{"type":"Property","value":3,"observedAt":"2023-11-10T00:10:00Z"},{"type":"Property","value":5,"observedAt":"2023-11-10T00:20:00Z"}]}`))
+	}))
+	defer server.Close()
+
+	ws := NewWeatherService(ctx, server.URL, "default").(*ws)
+
+	stations := []WeatherDTO{}
+	for i := 0; i < 10; i++ {
+		stations = append(stations, newTestStation(fmt.Sprintf("urn:ngsi-ld:WeatherObserved:%d", i), 62.39, 17.30))
+	}
+	ws.storeWeatherStations(stations)
+
+	from := time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC)
+	weather, err := ws.Query().NearPoint(1000, 62.39, 17.30).BetweenTimes(from, from.Add(time.Hour)).Aggr("hour").Get(ctx)
+	is.NoErr(err)
+
+	is.Equal(len(weather), 10)
+	for _, w := range weather {
+		is.Equal(len(*w.Temperature.Values), 1)
+		is.Equal(*(*w.Temperature.Values)[0].Value, 4.0)
+	}
+
+	is.True(maxInFlight.Load() <= int32(maxConcurrentRequests)) // the number of concurrent requests should be bounded
+}
+
+func TestThatGetLeavesOutStationsWithoutHistory(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/ngsi-ld/v1/temporal/entities/")
+		if id == "urn:ngsi-ld:WeatherObserved:failing" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte(`{"@context":["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],"id":"` + id + `","type":"WeatherObserved",` +
+			`"temperature":[{"type":"Property","value":3,"observedAt":"2023-11-10T00:10:00Z"}]}`))
+	}))
+	defer server.Close()
+
+	ws := NewWeatherService(ctx, server.URL, "default").(*ws)
+	ws.storeWeatherStations([]WeatherDTO{
+		newTestStation("urn:ngsi-ld:WeatherObserved:failing", 62.39, 17.30),
+		newTestStation("urn:ngsi-ld:WeatherObserved:working", 62.39, 17.30),
+	})
+
+	from := time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC)
+	weather, err := ws.Query().NearPoint(1000, 62.39, 17.30).BetweenTimes(from, from.Add(time.Hour)).Get(ctx)
+	is.NoErr(err) // one failing station should not fail the whole list
+	is.Equal(len(weather), 1)
+	is.Equal(weather[0].ID, "urn:ngsi-ld:WeatherObserved:working")
+
+	ws.storeWeatherStations([]WeatherDTO{newTestStation("urn:ngsi-ld:WeatherObserved:failing", 62.39, 17.30)})
+
+	_, err = ws.Query().NearPoint(1000, 62.39, 17.30).BetweenTimes(from, from.Add(time.Hour)).Get(ctx)
+	is.True(err != nil) // an error should be returned when no history could be retrieved
+}
+
+func TestThatInvalidQueriesAreRejected(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	ws := NewWeatherService(ctx, "ignored", "default").(*ws)
+	ws.storeWeatherStations([]WeatherDTO{newTestStation("urn:ngsi-ld:WeatherObserved:1", 62.39, 17.30)})
+
+	from := time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC)
+
+	_, err := ws.Query().NearPoint(1000, 62.39, 17.30).BetweenTimes(from, from.Add(-time.Hour)).Get(ctx)
+	is.True(errors.Is(err, ErrInvalidQuery)) // the end of the time span must not be before its start
+
+	_, err = ws.Query().NearPoint(1000, 62.39, 17.30).BetweenTimes(from, from.Add(MaxTimespan+time.Hour)).Get(ctx)
+	is.True(errors.Is(err, ErrInvalidQuery)) // the time span must not be too long
+
+	_, err = ws.Query().ID("urn:ngsi-ld:WeatherObserved:1").BetweenTimes(from, from.Add(time.Hour)).Aggr("fortnight").GetByID(ctx)
+	is.True(errors.Is(err, ErrInvalidQuery)) // the aggregation must be known
+}
+
+func TestThatGetReturnsStationsNearPointOrderedByDistance(t *testing.T) {
+	is := is.New(t)
+
+	ws := NewWeatherService(context.Background(), "ignored", "default").(*ws)
+	ws.storeWeatherStations([]WeatherDTO{
+		newTestStation("urn:ngsi-ld:WeatherObserved:far", 62.50, 17.30),
+		newTestStation("urn:ngsi-ld:WeatherObserved:near", 62.391, 17.307),
+		newTestStation("urn:ngsi-ld:WeatherObserved:middle", 62.40, 17.30),
+	})
+
+	weather, err := ws.Query().NearPoint(5000, 62.390802, 17.306982).Get(context.Background())
+	is.NoErr(err)
+	is.Equal(len(weather), 2) // the station that is more than 5 km away should be excluded
+	is.Equal(weather[0].ID, "urn:ngsi-ld:WeatherObserved:near")
+
+	stations := ws.GetStations()
+	is.Equal(len(stations), 3)
+	is.Equal(stations[0].ID, "urn:ngsi-ld:WeatherObserved:far") // stations should be sorted by id
+}
+
+func newTestStation(id string, lat, lon float64) WeatherDTO {
+	dateObserved := "2023-11-10T15:04:49Z"
+	temperature := 2.5
+
+	dto := NewDTO(id)
+	dto.DateObserved = &dateObserved
+	dto.Temperature = &temperature
+	dto.Location = &struct {
+		Lat float64
+		Lon float64
+	}{Lat: lat, Lon: lon}
+
+	return dto
+}
+
+const weatherObservedKeyValues string = `[{
+	"id": "urn:ngsi-ld:WeatherObserved:net:serva:iot:a81758fffe051cff",
+	"type": "WeatherObserved",
+	"dateObserved": {"@type": "DateTime", "@value": "2023-11-10T15:04:49Z"},
+	"location": {"type": "Point", "coordinates": [17.02068, 62.34731]},
+	"temperature": 22.2
+}]`
+
 func TestAggr(t *testing.T) {
 	is := is.New(t)
 
@@ -206,5 +469,5 @@ func TestAggr(t *testing.T) {
 	is.Equal("year", q.aggr)
 
 	q = q.Aggr("invalid").(wsq)
-	is.Equal("", q.aggr)
+	is.True(errors.Is(q.validate(), ErrInvalidQuery))
 }
@@ -0,0 +1,94 @@
+package temporal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+)
+
+// ErrNotFound is returned when the broker responds without a temporal evolution
+var ErrNotFound error = errors.New("no temporal evolution found")
+
+// MaxPages limits the number of partial responses that are requested for a single time span
+const MaxPages int = 100
+
+// Evolution is the temporal evolution of the requested properties of an entity, combined
+// from all the partial responses of the context broker
+type Evolution struct {
+	id         string
+	entityType string
+	properties map[string][]types.TemporalProperty
+}
+
+func (e *Evolution) ID() string {
+	return e.id
+}
+
+func (e *Evolution) Type() string {
+	return e.entityType
+}
+
+// Property returns the values of a property in the order they were received, without
+// the values that were repeated at the boundaries between partial responses
+func (e *Evolution) Property(name string) []types.TemporalProperty {
+	return e.properties[name]
+}
+
+// Retrieve requests the temporal evolution of an entity between from and to. The broker
+// may only return a part of the time span, along with a content range, in which case the
+// rest is requested page by page. Only the given properties are kept from each page.
+func Retrieve(ctx context.Context, c client.ContextBrokerClient, id string, headers map[string][]string, from, to time.Time, properties []string) (*Evolution, error) {
+	evolution := &Evolution{
+		id:         id,
+		properties: map[string][]types.TemporalProperty{},
+	}
+
+	seen := map[string]map[string]bool{}
+	for _, p := range properties {
+		seen[p] = map[string]bool{}
+	}
+
+	pageFrom := from
+
+	for page := 0; page < MaxPages; page++ {
+		result, err := c.RetrieveTemporalEvolutionOfEntity(ctx, id, headers, client.Between(pageFrom, to))
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil || result.Found == nil {
+			return nil, fmt.Errorf("%w for %s", ErrNotFound, id)
+		}
+
+		evolution.entityType = result.Found.Type()
+
+		for _, p := range properties {
+			for _, v := range result.Found.Property(p) {
+				if v.ObservedAt() != "" && seen[p][v.ObservedAt()] {
+					continue
+				}
+
+				seen[p][v.ObservedAt()] = true
+				evolution.properties[p] = append(evolution.properties[p], v)
+			}
+		}
+
+		if !result.PartialResult || result.ContentRange == nil || result.ContentRange.EndTime == nil {
+			return evolution, nil
+		}
+
+		// a partial response that does not move forward ends the paging
+		rangeEnd := *result.ContentRange.EndTime
+		if !rangeEnd.After(pageFrom) || !rangeEnd.Before(to) {
+			return evolution, nil
+		}
+
+		pageFrom = rangeEnd
+	}
+
+	return nil, fmt.Errorf("temporal evolution of %s spans more than %d pages", id, MaxPages)
+}
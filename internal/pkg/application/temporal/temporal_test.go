@@ -0,0 +1,119 @@
+package temporal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	cbtest "github.com/diwise/context-broker/pkg/test"
+	"github.com/matryer/is"
+)
+
+func TestThatPartialResultsArePagedAndCombined(t *testing.T) {
+	is := is.New(t)
+
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	middle := from.Add(12 * time.Hour)
+	to := from.Add(24 * time.Hour)
+
+	requestedFrom := []string{}
+
+	cbMock := &cbtest.ContextBrokerClientMock{
+		RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+			timeAt := queryParam(parameters, "timeAt")
+			requestedFrom = append(requestedFrom, timeAt)
+
+			if timeAt == from.Format(time.RFC3339) {
+				result := temporalResult(is, entityID, from.Add(time.Hour), middle)
+				result.PartialResult = true
+				result.ContentRange = &ngsild.ContentRange{StartTime: &from, EndTime: &middle}
+				return result, nil
+			}
+
+			// the second page repeats the value at the boundary of the first page
+			return temporalResult(is, entityID, middle, to.Add(-time.Hour)), nil
+		},
+	}
+
+	evolution, err := Retrieve(context.Background(), cbMock, "urn:ngsi-ld:Thing:1", nil, from, to, []string{"temperature"})
+	is.NoErr(err)
+
+	is.Equal(requestedFrom, []string{from.Format(time.RFC3339), middle.Format(time.RFC3339)})
+	is.Equal(evolution.ID(), "urn:ngsi-ld:Thing:1")
+	is.Equal(evolution.Type(), "Thing")
+	is.Equal(len(evolution.Property("temperature")), 5) // the repeated value should only be included once
+	is.Equal(len(evolution.Property("humidity")), 0)    // only the requested properties should be kept
+}
+
+func TestThatPagingStopsWhenTheRangeDoesNotAdvance(t *testing.T) {
+	is := is.New(t)
+
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	calls := 0
+
+	cbMock := &cbtest.ContextBrokerClientMock{
+		RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+			calls++
+			result := temporalResult(is, entityID, from, from)
+			result.PartialResult = true
+			result.ContentRange = &ngsild.ContentRange{StartTime: &from, EndTime: &from}
+			return result, nil
+		},
+	}
+
+	evolution, err := Retrieve(context.Background(), cbMock, "urn:ngsi-ld:Thing:1", nil, from, to, []string{"temperature"})
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(len(evolution.Property("temperature")), 1)
+}
+
+func TestThatErrorsAreReturned(t *testing.T) {
+	is := is.New(t)
+
+	cbMock := &cbtest.ContextBrokerClientMock{
+		RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string, parameters ...client.RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+			return nil, fmt.Errorf("request failed")
+		},
+	}
+
+	_, err := Retrieve(context.Background(), cbMock, "urn:ngsi-ld:Thing:1", nil, time.Now().Add(-time.Hour), time.Now(), []string{"temperature"})
+	is.True(err != nil)
+}
+
+func queryParam(parameters []client.RequestDecoratorFunc, name string) string {
+	params := []string{}
+	for _, p := range parameters {
+		params = p(params)
+	}
+
+	values, _ := url.ParseQuery(strings.Join(params, "&"))
+	return values.Get(name)
+}
+
+func temporalResult(is *is.I, id string, first, last time.Time) *ngsild.RetrieveTemporalEvolutionOfEntityResult {
+	value := func(v float64, at time.Time) map[string]any {
+		return map[string]any{"type": "Property", "value": v, "observedAt": at.Format(time.RFC3339)}
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"@context":    []string{"https://raw.githubusercontent.com/diwise/context-broker/main/assets/jsonldcontexts/default-context.jsonld"},
+		"id":          id,
+		"type":        "Thing",
+		"temperature": []any{value(1, first), value(2, first.Add(last.Sub(first)/2)), value(3, last)},
+		"humidity":    []any{value(50, first)},
+	})
+
+	var entity entities.EntityTemporalImpl
+	is.NoErr(json.Unmarshal(body, &entity))
+
+	return ngsild.NewRetrieveTemporalEvolutionOfEntityResult(&entity)
+}
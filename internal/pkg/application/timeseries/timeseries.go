@@ -0,0 +1,236 @@
+// Package timeseries aggregates observations into calendar aligned time buckets, such
+// as hours, days or weeks, and computes summary statistics for each bucket.
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	// embed the time zone database so that day boundaries can be computed even when
+	// the host lacks zoneinfo
+	_ "time/tzdata"
+)
+
+type Resolution string
+
+const (
+	QuarterHour Resolution = "15min"
+	Hour        Resolution = "hour"
+	Day         Resolution = "day"
+	Week        Resolution = "week"
+	Month       Resolution = "month"
+	Year        Resolution = "year"
+)
+
+var resolutions = []Resolution{QuarterHour, Hour, Day, Week, Month, Year}
+
+// ParseResolution returns the resolution with the given name
+func ParseResolution(s string) (Resolution, error) {
+	for _, r := range resolutions {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown resolution %q", s)
+}
+
+// DefaultLocation is the time zone used to decide where days, weeks, months and years
+// begin and end
+var DefaultLocation *time.Location = mustLoadLocation("Europe/Stockholm")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+type Sample struct {
+	At    time.Time
+	Value float64
+}
+
+// Bucket summarises the samples within the time span [Start, End)
+type Bucket struct {
+	Start time.Time
+	End   time.Time
+	// First and Last are the times of the first and last sample in the bucket
+	First time.Time
+	Last  time.Time
+
+	Count   int
+	Sum     float64
+	Average float64
+	Min     float64
+	Max     float64
+	Median  float64
+
+	sorted []float64
+}
+
+// Percentile returns the p:th percentile (0 - 100) of the values in the bucket, using
+// linear interpolation between the closest ranks
+func (b Bucket) Percentile(p float64) float64 {
+	return percentile(b.sorted, p)
+}
+
+// CircularMean returns the circular mean of the values in the bucket
+func (b Bucket) CircularMean() float64 {
+	return CircularMean(b.sorted)
+}
+
+// CircularMean returns the mean of values that are directions in degrees, rounded to
+// two decimals. The arithmetic mean of 350 and 10 degrees would point south, while the
+// circular mean points north.
+func CircularMean(degrees []float64) float64 {
+	var sin, cos float64
+
+	for _, d := range degrees {
+		sin += math.Sin(d * math.Pi / 180)
+		cos += math.Cos(d * math.Pi / 180)
+	}
+
+	mean := math.Round(math.Atan2(sin, cos)*180/math.Pi*100) / 100
+
+	return math.Mod(mean+360, 360)
+}
+
+// Aggregate groups the samples into buckets of the given resolution, with bucket
+// boundaries in the given location (or DefaultLocation if nil). Buckets without any
+// samples are left out, and the result is sorted by start time.
+func Aggregate(samples []Sample, resolution Resolution, loc *time.Location) []Bucket {
+	if loc == nil {
+		loc = DefaultLocation
+	}
+
+	grouped := map[int64][]Sample{}
+
+	for _, s := range samples {
+		start := BucketStart(s.At, resolution, loc)
+		grouped[start.UnixNano()] = append(grouped[start.UnixNano()], s)
+	}
+
+	buckets := make([]Bucket, 0, len(grouped))
+
+	for _, group := range grouped {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].At.Before(group[j].At) })
+
+		start := BucketStart(group[0].At, resolution, loc)
+		buckets = append(buckets, summarise(group, start, bucketEnd(start, resolution)))
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+
+	return buckets
+}
+
+// Summarise returns a single bucket with all of the samples, spanning from the first
+// to the last sample. The samples must not be empty.
+func Summarise(samples []Sample) Bucket {
+	sorted := append([]Sample{}, samples...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].At.Before(sorted[j].At) })
+
+	return summarise(sorted, sorted[0].At, sorted[len(sorted)-1].At)
+}
+
+// BucketStart returns the start of the bucket that t belongs to
+func BucketStart(t time.Time, resolution Resolution, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = DefaultLocation
+	}
+
+	t = t.In(loc)
+
+	switch resolution {
+	case QuarterHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()-t.Minute()%15, 0, 0, loc)
+	case Hour:
+		// truncating the absolute time keeps the two hours that share a wall clock
+		// hour when daylight saving time ends apart
+		return t.Truncate(time.Hour)
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	case Week:
+		// weeks start on monday
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	case Year:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, loc)
+	}
+
+	return t
+}
+
+func bucketEnd(start time.Time, resolution Resolution) time.Time {
+	switch resolution {
+	case QuarterHour:
+		return start.Add(15 * time.Minute)
+	case Hour:
+		return start.Add(time.Hour)
+	case Day:
+		return start.AddDate(0, 0, 1)
+	case Week:
+		return start.AddDate(0, 0, 7)
+	case Month:
+		return start.AddDate(0, 1, 0)
+	case Year:
+		return start.AddDate(1, 0, 0)
+	}
+
+	return start
+}
+
+func summarise(samples []Sample, start, end time.Time) Bucket {
+	b := Bucket{
+		Start:  start,
+		End:    end,
+		First:  samples[0].At,
+		Last:   samples[len(samples)-1].At,
+		Count:  len(samples),
+		sorted: make([]float64, 0, len(samples)),
+	}
+
+	for _, s := range samples {
+		b.Sum += s.Value
+		b.sorted = append(b.sorted, s.Value)
+	}
+
+	sort.Float64s(b.sorted)
+
+	b.Min = b.sorted[0]
+	b.Max = b.sorted[len(b.sorted)-1]
+	b.Average = b.Sum / float64(b.Count)
+	b.Median = percentile(b.sorted, 50)
+
+	return b
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+
+	if p <= 0 {
+		return sorted[0]
+	}
+
+	if p >= 100 {
+		return sorted[len(sorted)-1]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	fraction := rank - float64(lower)
+
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+
+	return sorted[lower] + fraction*(sorted[lower+1]-sorted[lower])
+}
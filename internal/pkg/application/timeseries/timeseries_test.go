@@ -0,0 +1,127 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestThatBucketsAreSortedByStartTime(t *testing.T) {
+	is := is.New(t)
+
+	samples := []Sample{}
+	for h := 23; h >= 0; h-- {
+		samples = append(samples, Sample{At: time.Date(2023, 6, 1, h, 30, 0, 0, time.UTC), Value: float64(h)})
+	}
+
+	for i := 0; i < 10; i++ {
+		buckets := Aggregate(samples, Hour, time.UTC)
+		is.Equal(len(buckets), 24)
+
+		for h, b := range buckets {
+			is.Equal(b.Start, time.Date(2023, 6, 1, h, 0, 0, 0, time.UTC))
+			is.Equal(b.Average, float64(h))
+		}
+	}
+}
+
+func TestThatDaysFollowTheLocalTimeZone(t *testing.T) {
+	is := is.New(t)
+
+	samples := []Sample{
+		{At: time.Date(2023, 6, 1, 21, 30, 0, 0, time.UTC), Value: 1}, // 23:30 in Stockholm
+		{At: time.Date(2023, 6, 1, 22, 30, 0, 0, time.UTC), Value: 2}, // 00:30 the day after in Stockholm
+	}
+
+	buckets := Aggregate(samples, Day, nil)
+	is.Equal(len(buckets), 2)
+	is.Equal(buckets[1].Start, time.Date(2023, 6, 2, 0, 0, 0, 0, DefaultLocation))
+
+	is.Equal(len(Aggregate(samples, Day, time.UTC)), 1)
+}
+
+func TestThatDaysAreShorterWhenDaylightSavingTimeBegins(t *testing.T) {
+	is := is.New(t)
+
+	buckets := Aggregate([]Sample{{At: time.Date(2023, 3, 26, 12, 0, 0, 0, time.UTC), Value: 1}}, Day, nil)
+	is.Equal(buckets[0].End.Sub(buckets[0].Start), 23*time.Hour)
+}
+
+func TestWeekAndQuarterHourBuckets(t *testing.T) {
+	is := is.New(t)
+
+	// sunday the 4th of june belongs to the week starting on monday the 29th of may
+	start := BucketStart(time.Date(2023, 6, 4, 12, 0, 0, 0, time.UTC), Week, time.UTC)
+	is.Equal(start, time.Date(2023, 5, 29, 0, 0, 0, 0, time.UTC))
+
+	start = BucketStart(time.Date(2023, 6, 4, 12, 44, 59, 0, time.UTC), QuarterHour, time.UTC)
+	is.Equal(start, time.Date(2023, 6, 4, 12, 30, 0, 0, time.UTC))
+}
+
+func TestBucketStatistics(t *testing.T) {
+	is := is.New(t)
+
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		{At: at.Add(3 * time.Minute), Value: 4},
+		{At: at, Value: 1},
+		{At: at.Add(1 * time.Minute), Value: 3},
+		{At: at.Add(2 * time.Minute), Value: 2},
+	}
+
+	b := Aggregate(samples, Hour, time.UTC)[0]
+
+	is.Equal(b.Count, 4)
+	is.Equal(b.Sum, 10.0)
+	is.Equal(b.Average, 2.5)
+	is.Equal(b.Min, 1.0)
+	is.Equal(b.Max, 4.0)
+	is.Equal(b.Median, 2.5)
+	is.Equal(b.Percentile(0), 1.0)
+	is.Equal(b.Percentile(100), 4.0)
+	is.Equal(b.Percentile(25), 1.75)
+	is.Equal(b.First, at)
+	is.Equal(b.Last, at.Add(3*time.Minute))
+}
+
+func TestSummarise(t *testing.T) {
+	is := is.New(t)
+
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := Summarise([]Sample{{At: at.Add(48 * time.Hour), Value: 3}, {At: at, Value: 1}, {At: at.Add(time.Hour), Value: 8}})
+
+	is.Equal(b.Start, at)
+	is.Equal(b.End, at.Add(48*time.Hour))
+	is.Equal(b.Count, 3)
+	is.Equal(b.Average, 4.0)
+	is.Equal(b.Median, 3.0)
+}
+
+func TestCircularMean(t *testing.T) {
+	is := is.New(t)
+
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	mean := func(degrees ...float64) float64 {
+		samples := []Sample{}
+		for _, d := range degrees {
+			samples = append(samples, Sample{At: at, Value: d})
+		}
+		return Aggregate(samples, Hour, time.UTC)[0].CircularMean()
+	}
+
+	is.Equal(mean(350, 10), 0.0)
+	is.Equal(mean(80, 100), 90.0)
+	is.Equal(mean(260, 280), 270.0)
+}
+
+func TestParseResolution(t *testing.T) {
+	is := is.New(t)
+
+	r, err := ParseResolution("15min")
+	is.NoErr(err)
+	is.Equal(r, QuarterHour)
+
+	_, err = ParseResolution("fortnight")
+	is.True(err != nil)
+}
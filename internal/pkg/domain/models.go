@@ -1,6 +1,9 @@
 package domain
 
 import (
+	"bytes"
+	"encoding/json"
+	"sort"
 	"time"
 )
 
@@ -55,32 +58,79 @@ type Organization struct {
 }
 
 type AirQuality struct {
-	ID                        string   `json:"id"`
-	Location                  Point    `json:"location"`
-	DateObserved              DateTime `json:"dateObserved"`
-	AtmosphericPressure       *float64 `json:"atmosphericPressure,omitempty"`
-	Temperature               *float64 `json:"temperature,omitempty"`
-	RelativeHumidity          *float64 `json:"relativeHumidity,omitempty"`
-	ParticleCount             *float64 `json:"particleCount,omitempty"`
-	PM1                       *float64 `json:"PM1,omitempty"`
-	PM4                       *float64 `json:"PM4,omitempty"`
-	PM10                      *float64 `json:"PM10,omitempty"`
-	PM25                      *float64 `json:"PM25,omitempty"`
-	TotalSuspendedParticulate *float64 `json:"totalSuspendedParticulate,omitempty"`
-	CO2                       *float64 `json:"CO2,omitempty"`
-	NO                        *float64 `json:"NO,omitempty"`
-	NO2                       *float64 `json:"NO2,omitempty"`
-	NOx                       *float64 `json:"NOx,omitempty"`
-	Voltage                   *float64 `json:"voltage,omitempty"`
-	WindDirection             *float64 `json:"windDirection,omitempty"`
-	WindSpeed                 *float64 `json:"windSpeed,omitempty"`
+	ID                        string           `json:"id"`
+	Location                  Point            `json:"location"`
+	DateObserved              DateTime         `json:"dateObserved"`
+	AtmosphericPressure       *float64         `json:"atmosphericPressure,omitempty"`
+	Temperature               *float64         `json:"temperature,omitempty"`
+	RelativeHumidity          *float64         `json:"relativeHumidity,omitempty"`
+	ParticleCount             *float64         `json:"particleCount,omitempty"`
+	PM1                       *float64         `json:"PM1,omitempty"`
+	PM4                       *float64         `json:"PM4,omitempty"`
+	PM10                      *float64         `json:"PM10,omitempty"`
+	PM25                      *float64         `json:"PM25,omitempty"`
+	TotalSuspendedParticulate *float64         `json:"totalSuspendedParticulate,omitempty"`
+	CO2                       *float64         `json:"CO2,omitempty"`
+	NO                        *float64         `json:"NO,omitempty"`
+	NO2                       *float64         `json:"NO2,omitempty"`
+	NOx                       *float64         `json:"NOx,omitempty"`
+	O3                        *float64         `json:"O3,omitempty"`
+	Voltage                   *float64         `json:"voltage,omitempty"`
+	WindDirection             *float64         `json:"windDirection,omitempty"`
+	WindSpeed                 *float64         `json:"windSpeed,omitempty"`
+	Index                     *AirQualityIndex `json:"index,omitempty"`
+	// Other holds the latest values of measured properties without a field of their own,
+	// keyed by property name. They are marshalled alongside the other measurements.
+	Other map[string]float64 `json:"-"`
+}
+
+func (aq AirQuality) MarshalJSON() ([]byte, error) {
+	type airQuality AirQuality
+
+	b, err := json.Marshal(airQuality(aq))
+	if err != nil || len(aq.Other) == 0 {
+		return b, err
+	}
+
+	names := make([]string, 0, len(aq.Other))
+	for name := range aq.Other {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := bytes.NewBuffer(b[:len(b)-1])
+	for _, name := range names {
+		key, _ := json.Marshal(name)
+		value, err := json.Marshal(aq.Other[name])
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.WriteString(",")
+		buffer.Write(key)
+		buffer.WriteString(":")
+		buffer.Write(value)
+	}
+	buffer.WriteString("}")
+
+	return buffer.Bytes(), nil
 }
 
 type AirQualityDetails struct {
-	ID           string      `json:"id"`
-	Location     Point       `json:"location"`
-	DateObserved DateTime    `json:"dateObserved"`
-	Pollutants   []Pollutant `json:"pollutants,omitempty"`
+	ID           string           `json:"id"`
+	Location     Point            `json:"location"`
+	DateObserved DateTime         `json:"dateObserved"`
+	Index        *AirQualityIndex `json:"index,omitempty"`
+	Pollutants   []Pollutant      `json:"pollutants,omitempty"`
+}
+
+// AirQualityIndex is the European Air Quality Index of a station, from 1 (good) to 6
+// (extremely poor), along with the pollutant that decided the level
+type AirQualityIndex struct {
+	Level             int    `json:"level"`
+	Label             string `json:"label"`
+	Colour            string `json:"colour"`
+	DominantPollutant string `json:"dominantPollutant"`
 }
 
 type Beach struct {
@@ -126,6 +176,27 @@ type MultiPolygon struct {
 	Coordinates [][][][]float64 `json:"coordinates"`
 }
 
+// Center returns the mean of the corners of the outer ring of the first polygon, not
+// counting the corner that closes the ring twice. ok is false if there is no such ring.
+func (mp MultiPolygon) Center() (lat, lon float64, ok bool) {
+	if len(mp.Coordinates) == 0 || len(mp.Coordinates[0]) == 0 || len(mp.Coordinates[0][0]) < 2 {
+		return 0, 0, false
+	}
+
+	ring := mp.Coordinates[0][0]
+	for _, pair := range ring[1:] {
+		if len(pair) < 2 {
+			return 0, 0, false
+		}
+
+		lon += pair[0]
+		lat += pair[1]
+	}
+
+	corners := float64(len(ring) - 1)
+	return lat / corners, lon / corners, true
+}
+
 type SportsField struct {
 	ID                  string        `json:"id"`
 	Name                string        `json:"name"`
@@ -143,6 +214,16 @@ type SportsField struct {
 	Status              string        `json:"status,omitempty"`
 }
 
+// StatusChange records that the status of an entity, such as an exercise trail
+// or a sports field, was found to differ from the previous refresh
+type StatusChange struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previousStatus"`
+	DateChanged    string `json:"dateChanged"`
+}
+
 type SportsVenue struct {
 	ID           string        `json:"id"`
 	Name         string        `json:"name"`
@@ -159,29 +240,66 @@ type SportsVenue struct {
 }
 
 type Weather struct {
-	ID           string      `json:"id"`
-	Temperature  Temperature `json:"temperature"`
-	DateObserved time.Time   `json:"dateObserved"`
-	Source       *string     `json:"source,omitempty"`
-	Location     *Point      `json:"location,omitempty"`
-}
-
-type Temperature struct {
+	ID                  string       `json:"id"`
+	Temperature         Temperature  `json:"temperature"`
+	RelativeHumidity    *Measurement `json:"relativeHumidity,omitempty"`
+	AtmosphericPressure *Measurement `json:"atmosphericPressure,omitempty"`
+	WindSpeed           *Measurement `json:"windSpeed,omitempty"`
+	WindDirection       *Measurement `json:"windDirection,omitempty"`
+	Precipitation       *Measurement `json:"precipitation,omitempty"`
+	SnowHeight          *Measurement `json:"snowHeight,omitempty"`
+	Illuminance         *Measurement `json:"illuminance,omitempty"`
+	DateObserved        time.Time    `json:"dateObserved"`
+	Source              *string      `json:"source,omitempty"`
+	Location            *Point       `json:"location,omitempty"`
+}
+
+// Measurement is either a single observed value, or a series of values along with
+// their average, max and min. Aggregated values also carry the median and number of
+// observations within their time span.
+type Measurement struct {
 	Average *float64       `json:"avg,omitempty"`
 	Max     *float64       `json:"max,omitempty"`
 	Min     *float64       `json:"min,omitempty"`
+	Median  *float64       `json:"median,omitempty"`
+	Count   int            `json:"count,omitempty"`
 	Value   *float64       `json:"value,omitempty"`
 	When    *time.Time     `json:"when,omitempty"`
 	From    *time.Time     `json:"from,omitempty"`
 	To      *time.Time     `json:"to,omitempty"`
-	Values  *[]Temperature `json:"values,omitempty"`
+	Values  *[]Measurement `json:"values,omitempty"`
 }
 
-type Cityworks struct {
-	ID        string `json:"id"`
-	Location  Point  `json:"location"`
-	StartDate string `json:"startDate"`
-	EndDate   string `json:"endDate"`
+type Temperature = Measurement
+
+// WeatherForecast is the latest forecast for a location, as a series of forecast
+// periods ordered by time
+type WeatherForecast struct {
+	Location   Point                   `json:"location"`
+	DateIssued time.Time               `json:"dateIssued"`
+	Forecasts  []WeatherForecastPeriod `json:"forecasts"`
+}
+
+type WeatherForecastPeriod struct {
+	ValidFrom        time.Time `json:"validFrom"`
+	ValidTo          time.Time `json:"validTo"`
+	Temperature      *float64  `json:"temperature,omitempty"`
+	MinTemperature   *float64  `json:"minTemperature,omitempty"`
+	MaxTemperature   *float64  `json:"maxTemperature,omitempty"`
+	RelativeHumidity *float64  `json:"relativeHumidity,omitempty"`
+	WindSpeed        *float64  `json:"windSpeed,omitempty"`
+	WindDirection    *float64  `json:"windDirection,omitempty"`
+	Precipitation    *float64  `json:"precipitation,omitempty"`
+	WeatherType      string    `json:"weatherType,omitempty"`
+}
+
+// WeatherStation is a weather station along with the time and temperature of its
+// latest observation
+type WeatherStation struct {
+	ID           string    `json:"id"`
+	Location     Point     `json:"location"`
+	DateObserved time.Time `json:"dateObserved"`
+	Temperature  *float64  `json:"temperature,omitempty"`
 }
 
 type CityworksDetails struct {
@@ -193,11 +311,71 @@ type CityworksDetails struct {
 	EndDate      string `json:"endDate"`
 }
 
+const (
+	CityworksStatusUpcoming string = "upcoming"
+	CityworksStatusOngoing  string = "ongoing"
+	CityworksStatusFinished string = "finished"
+)
+
+// Status returns whether the citywork is upcoming, ongoing or finished at the given
+// time. A citywork without a valid end date is considered to be ongoing indefinitely
+// once it has started, and one without a valid start date has no status at all.
+func (cw CityworksDetails) Status(at time.Time) string {
+	startDate, err := time.Parse(time.RFC3339, cw.StartDate)
+	if err != nil {
+		return ""
+	}
+
+	if startDate.After(at) {
+		return CityworksStatusUpcoming
+	}
+
+	if endDate, err := time.Parse(time.RFC3339, cw.EndDate); err == nil && endDate.Before(at) {
+		return CityworksStatusFinished
+	}
+
+	return CityworksStatusOngoing
+}
+
+// Overlaps reports whether the citywork is ongoing at some point between from and to.
+// A zero from or to leaves that end of the time span open, and a citywork without
+// a valid end date is considered to be ongoing indefinitely.
+func (cw CityworksDetails) Overlaps(from, to time.Time) bool {
+	startDate, err := time.Parse(time.RFC3339, cw.StartDate)
+	if err != nil {
+		return false
+	}
+
+	if !to.IsZero() && startDate.After(to) {
+		return false
+	}
+
+	endDate, err := time.Parse(time.RFC3339, cw.EndDate)
+	if err == nil && !from.IsZero() && endDate.Before(from) {
+		return false
+	}
+
+	return true
+}
+
 type DateTime struct {
 	Type  string `json:"@type"`
 	Value string `json:"@value"`
 }
 
+// UnmarshalJSON accepts both DateTime values and plain strings, since the broker
+// returns keyValues in either form depending on how the entity was created
+func (dt *DateTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*dt = DateTime{Type: "DateTime", Value: s}
+		return nil
+	}
+
+	type dateTime DateTime
+	return json.Unmarshal(data, (*dateTime)(dt))
+}
+
 func NewDateTime(timestamp string) *DateTime {
 	return &DateTime{"DateTime", timestamp}
 }
@@ -220,10 +398,13 @@ func NewLineString(coordinates [][]float64) *LineString {
 	return &LineString{"LineString", coordinates}
 }
 
-type RoadAccident struct {
-	ID           string `json:"id"`
-	AccidentDate string `json:"accidentDate"`
-	Location     Point  `json:"location"`
+// Start returns the first coordinate of the line. ok is false if the line is empty.
+func (ls LineString) Start() (lat, lon float64, ok bool) {
+	if len(ls.Coordinates) == 0 || len(ls.Coordinates[0]) < 2 {
+		return 0, 0, false
+	}
+
+	return ls.Coordinates[0][1], ls.Coordinates[0][0], true
 }
 
 type RoadAccidentDetails struct {
@@ -236,6 +417,36 @@ type RoadAccidentDetails struct {
 	Status       string `json:"status"`
 }
 
+// OccurredWithin reports whether the accident date lies between from and to.
+// A zero from or to leaves that end of the time span open.
+func (ra RoadAccidentDetails) OccurredWithin(from, to time.Time) bool {
+	accidentDate, err := time.Parse(time.RFC3339, ra.AccidentDate)
+	if err != nil {
+		return false
+	}
+
+	if !from.IsZero() && accidentDate.Before(from) {
+		return false
+	}
+
+	return to.IsZero() || !accidentDate.After(to)
+}
+
+type TrafficFlowObserved struct {
+	DateObserved        string  `json:"dateObserved"`
+	RoadSegment         string  `json:"roadSegment"`
+	LaneID              int     `json:"laneID"`
+	Intensity           int     `json:"intensity"`
+	AverageVehicleSpeed float64 `json:"averageVehicleSpeed"`
+	Location            *Point  `json:"location,omitempty"`
+}
+
+type RoadSegment struct {
+	ID       string `json:"id"`
+	Location Point  `json:"location"`
+	Lanes    []int  `json:"lanes"`
+}
+
 type WaterQuality struct {
 	ID           string  `json:"id"`
 	Temperature  float64 `json:"temperature"`
@@ -251,14 +462,66 @@ type WaterQualityTemporal struct {
 	Location    *Point  `json:"location,omitempty"`
 }
 
+// AirQualityExceedances lists the periods when the mean concentration of a pollutant
+// at a station has exceeded a limit value
+type AirQualityExceedances struct {
+	ID          string             `json:"id"`
+	From        time.Time          `json:"from"`
+	To          time.Time          `json:"to"`
+	LimitValues []LimitValueResult `json:"limitValues"`
+	// Error is set, and LimitValues left empty, when the values of the station could
+	// not be retrieved
+	Error string `json:"error,omitempty"`
+}
+
+type LimitValueResult struct {
+	Pollutant string  `json:"pollutant"`
+	Period    string  `json:"period"`
+	Limit     float64 `json:"limit"`
+	// Allowed is the number of exceedances that are allowed per calendar year
+	Allowed *int `json:"allowed,omitempty"`
+	// Periods is the number of periods that have any values, and Count is the number of
+	// those periods with a mean above the limit
+	Periods   int                  `json:"periods"`
+	Count     int                  `json:"count"`
+	Intervals []ExceedanceInterval `json:"intervals"`
+}
+
+// ExceedanceInterval is a span of consecutive periods with means above a limit value
+type ExceedanceInterval struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Periods int       `json:"periods"`
+	Max     float64   `json:"max"`
+}
+
 type Pollutant struct {
-	Name   string  `json:"name,omitempty"`
-	Values []Value `json:"values"`
+	// Property is the name of the measured property, which stays the same when the name
+	// that is presented is changed in the catalogue
+	Property   string               `json:"-"`
+	Name       string               `json:"name,omitempty"`
+	Unit       string               `json:"unit,omitempty"`
+	Statistics *PollutantStatistics `json:"statistics,omitempty"`
+	Values     []Value              `json:"values"`
 }
 
+// Value is either a single observation, or the average of the observations within an
+// hour or a day starting at ObservedAt, in which case Min, Max and Count are also set
 type Value struct {
-	Value      float64 `json:"value"`
-	ObservedAt string  `json:"observedAt"`
+	Value      float64  `json:"value"`
+	ObservedAt string   `json:"observedAt"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+	Count      int      `json:"count,omitempty"`
+}
+
+// PollutantStatistics summarises all observations of a pollutant within a time span
+type PollutantStatistics struct {
+	Average float64 `json:"average"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Median  float64 `json:"median"`
+	Count   int     `json:"count"`
 }
 
 func (w WaterQuality) Age() time.Duration {
@@ -10,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"log/slog"
 
@@ -22,8 +23,10 @@ import (
 	"github.com/diwise/api-opendata/internal/pkg/application/services/roadaccidents"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/sportsfields"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/sportsvenues"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/trafficflow"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/waterquality"
 	"github.com/diwise/api-opendata/internal/pkg/application/services/weather"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/api-opendata/internal/pkg/presentation/handlers"
 	"github.com/diwise/api-opendata/internal/pkg/presentation/handlers/stratsys"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
@@ -43,6 +46,7 @@ type API interface {
 
 type opendataAPI struct {
 	router chi.Router
+	health *healthRegistry
 }
 
 func NewAPI(ctx context.Context, r chi.Router, dcatResponse *bytes.Buffer, openapiResponse *bytes.Buffer, orgfile io.Reader) API {
@@ -59,13 +63,14 @@ func newOpendataAPI(ctx context.Context, r chi.Router, dcatResponse *bytes.Buffe
 	// Enable gzip compression for our responses
 	compressor := middleware.NewCompressor(
 		flate.DefaultCompression,
-		"text/csv", "application/json", "application/xml", "application/rdf+xml",
+		"text/csv", "text/calendar", "application/json", "application/atom+xml", "application/xml", "application/rdf+xml",
 	)
 	r.Use(compressor.Handler)
 	r.Use(otelchi.Middleware("api-opendata", otelchi.WithChiRoutes(r)))
 
 	o := &opendataAPI{
 		router: r,
+		health: newHealthRegistry(),
 	}
 
 	o.addDiwiseHandlers(ctx, r, orgfile)
@@ -87,7 +92,7 @@ func (a *opendataAPI) Start(ctx context.Context, port string) error {
 
 type svcEntry struct {
 	key      string
-	setup    func(ctx context.Context)
+	setup    func(ctx context.Context) error
 	register func(r chi.Router)
 }
 
@@ -97,10 +102,28 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 	contextBrokerURL := env.GetVariableOrDie(ctx, "DIWISE_CONTEXT_BROKER_URL", "context broker URL")
 	contextBrokerTenant := env.GetVariableOrDefault(ctx, "DIWISE_CONTEXT_BROKER_TENANT", entities.DefaultNGSITenant)
 
+	// the public base url is used to create absolute links in feeds, and is derived
+	// from each incoming request if left empty. The forwarded headers of a request are
+	// only trusted when explicitly enabled, as they are set by the client otherwise.
+	trustForwardedHeaders, err := strconv.ParseBool(env.GetVariableOrDefault(ctx, "API_TRUST_FORWARDED_HEADERS", "false"))
+	if err != nil {
+		logger.Error("invalid value of API_TRUST_FORWARDED_HEADERS, forwarded headers will not be trusted", slog.String("err", err.Error()))
+	}
+
+	feedBase := handlers.FeedBase{
+		URL:                   env.GetVariableOrDefault(ctx, "API_BASE_URL", ""),
+		TrustForwardedHeaders: trustForwardedHeaders,
+	}
+
+	// the datasets that use the organisations registry are still served without
+	// organisation details if the registry can not be parsed
 	organisationsRegistry, err := organisations.NewRegistry(orgfile)
 	if err != nil {
-		logger.Error("failed to create organisations registry", slog.String("err", err.Error()))
-		os.Exit(1)
+		logger.Error("failed to create organisations registry, continuing without organisations", slog.String("err", err.Error()))
+		organisationsRegistry, _ = organisations.NewRegistry(nil)
+		o.health.degraded("organisations", err)
+	} else {
+		o.health.ok("organisations")
 	}
 
 	cbClient := client.NewContextBrokerClient(contextBrokerURL, client.Tenant("default"))
@@ -114,29 +137,113 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 
 	services := make(map[string]any)
 
+	// the weather service is shared with beaches and exercise trails, which embed the
+	// nearest forecast in their details when weather has been set up successfully
+	forecasts := func() weather.WeatherService {
+		if svc, ok := services["weather"].(weather.WeatherService); ok {
+			return svc
+		}
+		return nil
+	}
+
 	entries := []svcEntry{
+		{
+			// weather is set up first, so that beaches and exercise trails know whether
+			// forecasts are available when they are registered
+			key: "weather",
+			setup: func(ctx context.Context) error {
+				// the default centre is used to find nearby weather stations when no
+				// coordinates are given, and is specified as longitude,latitude
+				centre, err := parseCoordinates(env.GetVariableOrDefault(ctx, "WEATHER_DEFAULT_COORDINATES", "17.306982,62.390802"))
+				if err != nil {
+					return fmt.Errorf("invalid default weather coordinates: %w", err)
+				}
+				services["weather.centre"] = centre
+
+				svc := weather.NewWeatherService(ctx, contextBrokerURL, contextBrokerTenant)
+				svc.Start(ctx)
+				services["weather"] = svc
+
+				return nil
+			},
+			register: func(r chi.Router) {
+				svc := services["weather"].(weather.WeatherService)
+				centre := services["weather.centre"].(domain.Point)
+				r.Get(
+					"/api/weather",
+					handlers.NewRetrieveWeatherHandler(ctx, svc, centre),
+				)
+				r.Get(
+					"/api/weather/stations",
+					handlers.NewRetrieveWeatherStationsHandler(ctx, svc),
+				)
+				r.Get(
+					"/api/weather/forecasts",
+					handlers.NewRetrieveWeatherForecastsHandler(ctx, svc, centre),
+				)
+				r.Get(
+					"/api/weather/{id}",
+					handlers.NewRetrieveWeatherByIDHandler(ctx, svc),
+				)
+			},
+		},
 		{
 			key: "airqualities",
-			setup: func(ctx context.Context) {
-				svc := airquality.NewAirQualityService(ctx, cbClient, contextBrokerTenant)
+			setup: func(ctx context.Context) error {
+				limits := airquality.DefaultLimitValues
+				if lv := env.GetVariableOrDefault(ctx, "AIRQUALITY_LIMIT_VALUES", ""); lv != "" {
+					var err error
+					limits, err = airquality.ParseLimitValues(lv)
+					if err != nil {
+						return fmt.Errorf("invalid air quality limit values: %w", err)
+					}
+				}
+
+				catalogue := airquality.DefaultCatalogue
+				if catalogueFile := env.GetVariableOrDefault(ctx, "AIRQUALITY_CATALOGUE_FILE", ""); catalogueFile != "" {
+					c, err := loadAirQualityCatalogue(catalogueFile)
+					if err != nil {
+						logger.Error("failed to load air quality catalogue, using the default catalogue", slog.String("err", err.Error()))
+						o.health.degraded("airqualities", fmt.Errorf("failed to load catalogue: %w", err))
+					} else {
+						catalogue = c
+					}
+				}
+
+				svc := airquality.NewAirQualityService(ctx, cbClient, contextBrokerTenant, catalogue, limits)
 				svc.Start(ctx)
 				services["airqualities"] = svc
+
+				return nil
 			},
 			register: func(r chi.Router) {
 				svc := services["airqualities"].(airquality.AirQualityService)
+
+				o.health.check("airqualities", func() (any, error) {
+					return airQualityHealth(svc.StationStatus())
+				})
+
 				r.Get(
 					"/api/airqualities",
 					handlers.NewRetrieveAirQualitiesHandler(ctx, svc),
 				)
+				r.Get(
+					"/api/airqualities/exceedances",
+					handlers.NewRetrieveAirQualityExceedancesHandler(ctx, svc),
+				)
 				r.Get(
 					"/api/airqualities/{id}",
 					handlers.NewRetrieveAirQualityByIDHandler(ctx, svc),
 				)
+				r.Get(
+					"/api/airqualities/{id}/exceedances",
+					handlers.NewRetrieveAirQualityExceedancesByIDHandler(ctx, svc),
+				)
 			},
 		},
 		{
 			key: "beaches",
-			setup: func(ctx context.Context) {
+			setup: func(ctx context.Context) error {
 				waterqualitySvc := waterquality.NewWaterQualityService(ctx, contextBrokerURL, contextBrokerTenant)
 				waterqualitySvc.Start(ctx)
 				services["waterqualities"] = waterqualitySvc
@@ -150,6 +257,8 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 				beachService := beaches.NewBeachService(ctx, contextBrokerURL, contextBrokerTenant, int(maxWQODistance), waterqualitySvc)
 				beachService.Start(ctx)
 				services["beaches"] = beachService
+
+				return nil
 			},
 			register: func(r chi.Router) {
 				wqsvc := services["waterqualities"].(waterquality.WaterQualityService)
@@ -169,16 +278,18 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 				)
 				r.Get(
 					"/api/beaches/{id}",
-					handlers.NewRetrieveBeachByIDHandler(ctx, beachsvc),
+					handlers.NewRetrieveBeachByIDHandler(ctx, beachsvc, forecasts()),
 				)
 			},
 		},
 		{
 			key: "cityworks",
-			setup: func(ctx context.Context) {
+			setup: func(ctx context.Context) error {
 				svc := citywork.NewCityworksService(ctx, contextBrokerURL, contextBrokerTenant)
 				svc.Start(ctx)
 				services["cityworks"] = svc
+
+				return nil
 			},
 			register: func(r chi.Router) {
 				svc := services["cityworks"].(citywork.CityworksService)
@@ -186,19 +297,28 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 					"/api/cityworks",
 					handlers.NewRetrieveCityworksHandler(ctx, svc),
 				)
+				r.Get(
+					"/api/cityworks.ics",
+					handlers.NewRetrieveCityworksCalendarHandler(ctx, svc),
+				)
 				r.Get(
 					"/api/cityworks/{id}",
 					handlers.NewRetrieveCityworksByIDHandler(ctx, svc),
 				)
+				r.Get(
+					"/api/feeds/cityworks.atom",
+					handlers.NewRetrieveCityworksFeedHandler(ctx, feedBase, svc),
+				)
 			},
 		},
 		{
 			key: "exercisetrails",
-			setup: func(ctx context.Context) {
+			setup: func(ctx context.Context) error {
 				svc := exercisetrails.NewExerciseTrailService(ctx, contextBrokerURL, contextBrokerTenant, organisationsRegistry)
 				svc.Start(ctx)
 				services["exercisetrails"] = svc
 
+				return nil
 			},
 			register: func(r chi.Router) {
 				svc := services["exercisetrails"].(exercisetrails.ExerciseTrailService)
@@ -209,35 +329,68 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 				)
 				r.Get(
 					"/api/exercisetrails/{id}",
-					handlers.NewRetrieveExerciseTrailByIDHandler(ctx, svc),
+					handlers.NewRetrieveExerciseTrailByIDHandler(ctx, svc, forecasts()),
+				)
+				r.Get(
+					"/api/feeds/exercisetrails.atom",
+					handlers.NewRetrieveExerciseTrailsFeedHandler(ctx, feedBase, svc),
 				)
 			},
 		},
 		{
 			key: "roadaccidents",
-			setup: func(ctx context.Context) {
+			setup: func(ctx context.Context) error {
 				svc := roadaccidents.NewRoadAccidentService(ctx, contextBrokerURL, contextBrokerTenant)
 				svc.Start(ctx)
 				services["roadaccidents"] = svc
+
+				// districts are optional and only needed to group accident statistics by district
+				if districtsFile := env.GetVariableOrDefault(ctx, "ROADACCIDENTS_DISTRICTS_FILE", ""); districtsFile != "" {
+					districts, err := loadDistricts(districtsFile)
+					if err != nil {
+						logger.Error("failed to load districts, grouping by district will not be available", slog.String("err", err.Error()))
+						o.health.degraded("roadaccidents", fmt.Errorf("failed to load districts: %w", err))
+					} else {
+						services["districts"] = districts
+					}
+				}
+
+				return nil
 			},
 			register: func(r chi.Router) {
 				svc := services["roadaccidents"].(roadaccidents.RoadAccidentService)
+				districts, _ := services["districts"].(*roadaccidents.Districts)
+
 				r.Get(
 					"/api/roadaccidents",
 					handlers.NewRetrieveRoadAccidentsHandler(ctx, svc),
 				)
+				r.Get(
+					"/api/roadaccidents/stats",
+					handlers.NewRetrieveRoadAccidentStatisticsHandler(ctx, svc, districts),
+				)
+				r.Get(
+					"/api/roadaccidents/hotspots",
+					handlers.NewRetrieveRoadAccidentHotspotsHandler(ctx, svc),
+				)
 				r.Get(
 					"/api/roadaccidents/{id}",
 					handlers.NewRetrieveRoadAccidentByIDHandler(ctx, svc),
 				)
+				r.Get(
+					"/api/feeds/roadaccidents.atom",
+					handlers.NewRetrieveRoadAccidentsFeedHandler(ctx, feedBase, svc),
+				)
 			},
 		},
 		{
 			key: "sportsfields",
-			setup: func(ctx context.Context) {
+			setup: func(ctx context.Context) error {
 				svc := sportsfields.NewSportsFieldService(ctx, contextBrokerURL, contextBrokerTenant, organisationsRegistry)
 				svc.Start(ctx)
 				services["sportsfields"] = svc
+
+				return nil
 			},
 			register: func(r chi.Router) {
 				svc := services["sportsfields"].(sportsfields.SportsFieldService)
@@ -250,14 +403,20 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 					"/api/sportsfields/{id}",
 					handlers.NewRetrieveSportsFieldByIDHandler(ctx, svc),
 				)
+				r.Get(
+					"/api/feeds/sportsfields.atom",
+					handlers.NewRetrieveSportsFieldsFeedHandler(ctx, feedBase, svc),
+				)
 			},
 		},
 		{
 			key: "sportsvenues",
-			setup: func(ctx context.Context) {
+			setup: func(ctx context.Context) error {
 				svc := sportsvenues.NewSportsVenueService(ctx, contextBrokerURL, contextBrokerTenant, organisationsRegistry)
 				svc.Start(ctx)
 				services["sportsvenues"] = svc
+
+				return nil
 			},
 			register: func(r chi.Router) {
 				svc := services["sportsvenues"].(sportsvenues.SportsVenueService)
@@ -272,41 +431,81 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 			},
 		},
 		{
-			key:   "stratsys",
-			setup: func(ctx context.Context) {},
+			key: "stratsys",
+			setup: func(ctx context.Context) error {
+				cacheTTL, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "STRATSYS_CACHE_TTL", "15m"))
+				if err != nil {
+					logger.Error("invalid stratsys cache ttl, using default", slog.String("err", err.Error()))
+					cacheTTL = 15 * time.Minute
+				}
+
+				client, err := stratsys.NewClient(
+					os.Getenv("STRATSYS_COMPANY_CODE"),
+					os.Getenv("STRATSYS_CLIENT_ID"),
+					os.Getenv("STRATSYS_SCOPE"),
+					os.Getenv("STRATSYS_LOGIN_URL"),
+					os.Getenv("STRATSYS_DEFAULT_URL"),
+					cacheTTL,
+				)
+				if err != nil {
+					return fmt.Errorf("failed to create stratsys client: %w", err)
+				}
+
+				services["stratsys"] = client
+
+				return nil
+			},
 			register: func(r chi.Router) {
-				stratsysCompanyCode := os.Getenv("STRATSYS_COMPANY_CODE")
-				stratsysClientId := os.Getenv("STRATSYS_CLIENT_ID")
-				stratsysScope := os.Getenv("STRATSYS_SCOPE")
-				stratsysLoginUrl := os.Getenv("STRATSYS_LOGIN_URL")
-				stratsysDefaultUrl := os.Getenv("STRATSYS_DEFAULT_URL")
+				client := services["stratsys"].(*stratsys.Client)
 
 				r.Get(
 					"/api/stratsys/publishedreports",
-					stratsys.NewRetrieveStratsysReportsHandler(ctx, stratsysCompanyCode, stratsysClientId, stratsysScope, stratsysLoginUrl, stratsysDefaultUrl),
+					stratsys.NewRetrieveStratsysReportsHandler(ctx, client),
 				)
 				r.Get(
 					"/api/stratsys/publishedreports/{id}",
-					stratsys.NewRetrieveStratsysReportsHandler(ctx, stratsysCompanyCode, stratsysClientId, stratsysScope, stratsysLoginUrl, stratsysDefaultUrl),
+					stratsys.NewRetrieveStratsysReportsHandler(ctx, client),
 				)
 			},
 		},
 		{
-			key:   "traffic",
-			setup: func(ctx context.Context) {},
+			key: "traffic",
+			setup: func(ctx context.Context) error {
+				window, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "TRAFFICFLOW_WINDOW", "168h"))
+				if err != nil {
+					return fmt.Errorf("invalid traffic flow window: %w", err)
+				}
+
+				if window <= 0 {
+					return fmt.Errorf("invalid traffic flow window %s, must be positive", window)
+				}
+
+				svc := trafficflow.NewTrafficFlowService(ctx, contextBrokerURL, contextBrokerTenant, window)
+				svc.Start(ctx)
+				services["traffic"] = svc
+
+				return nil
+			},
 			register: func(r chi.Router) {
+				svc := services["traffic"].(trafficflow.TrafficFlowService)
 				r.Get(
 					"/api/trafficflow",
-					handlers.NewRetrieveTrafficFlowsHandler(ctx, contextBrokerURL),
+					handlers.NewRetrieveTrafficFlowsHandler(ctx, svc),
+				)
+				r.Get(
+					"/api/trafficflow/segments",
+					handlers.NewRetrieveTrafficFlowSegmentsHandler(ctx, svc),
 				)
 			},
 		},
 		{
 			key: "waterqualities",
-			setup: func(ctx context.Context) {
+			setup: func(ctx context.Context) error {
 				svc := waterquality.NewWaterQualityService(ctx, contextBrokerURL, contextBrokerTenant)
 				svc.Start(ctx)
 				services["waterqualities"] = svc
+
+				return nil
 			},
 			register: func(r chi.Router) {
 				svc := services["waterqualities"].(waterquality.WaterQualityService)
@@ -321,34 +520,85 @@ func (o *opendataAPI) addDiwiseHandlers(ctx context.Context, r chi.Router, orgfi
 				)
 			},
 		},
-		{
-			key: "weather",
-			setup: func(ctx context.Context) {
-				svc := weather.NewWeatherService(ctx, contextBrokerURL, contextBrokerTenant)
-				services["weather"] = svc
-			},
-			register: func(r chi.Router) {
-				svc := services["weather"].(weather.WeatherService)
-				r.Get(
-					"/api/weather",
-					handlers.NewRetrieveWeatherHandler(ctx, svc),
-				)
-				r.Get(
-					"/api/weather/{id}",
-					handlers.NewRetrieveWeatherByIDHandler(ctx, svc),
-				)
-			},
-		},
 	}
 
+	// an integration that fails to set up is disabled and reported by the health
+	// endpoint, while all other integrations keep serving
 	for _, e := range entries {
 		if enabled["all"] || enabled[e.key] {
-			e.setup(ctx)
+			if err := e.setup(ctx); err != nil {
+				logger.Error("failed to set up service, it will be disabled", slog.String("service", e.key), slog.String("err", err.Error()))
+				o.health.disabled(e.key, err)
+				continue
+			}
+
 			e.register(o.router)
+			o.health.ok(e.key)
 		}
 	}
 }
 
+func loadDistricts(path string) (*roadaccidents.Districts, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return roadaccidents.NewDistrictsFromGeoJSON(file, "name")
+}
+
+// airQualityHealth reports the air qualities as degraded if the details of any station
+// could not be refreshed
+func airQualityHealth(stations []airquality.StationStatus) (any, error) {
+	failed := 0
+	for _, s := range stations {
+		if s.Status != airquality.StationStatusOK {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return stations, fmt.Errorf("the details of %d of %d stations could not be refreshed", failed, len(stations))
+	}
+
+	return stations, nil
+}
+
+func loadAirQualityCatalogue(path string) (airquality.Catalogue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return airquality.LoadCatalogue(file)
+}
+
+// parseCoordinates parses a point given as longitude,latitude
+func parseCoordinates(s string) (domain.Point, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return domain.Point{}, fmt.Errorf("expected longitude,latitude but got %q", s)
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return domain.Point{}, err
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return domain.Point{}, err
+	}
+
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return domain.Point{}, fmt.Errorf("coordinates %q are out of range", s)
+	}
+
+	return *domain.NewPoint(lat, lon), nil
+}
+
 func parseEnabledServices(s string) (map[string]bool, error) {
 	m := make(map[string]bool)
 	for _, part := range strings.Split(s, ",") {
@@ -362,9 +612,7 @@ func parseEnabledServices(s string) (map[string]bool, error) {
 }
 
 func (o *opendataAPI) addProbeHandlers(r chi.Router) {
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	r.Get("/health", o.health.newHealthHandler())
 }
 
 func (o *opendataAPI) newRetrieveDatasetsHandler(ctx context.Context, dcatResponse *bytes.Buffer) http.HandlerFunc {
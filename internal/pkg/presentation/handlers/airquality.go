@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/airquality"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
@@ -42,10 +44,21 @@ func NewRetrieveAirQualitiesHandler(ctx context.Context, aqsvc airquality.AirQua
 
 		aqos := aqsvc.GetAll(ctx)
 
+		// besides the known measurements, any property that is reported by some station
+		// can be selected
+		for _, f := range fields {
+			if _, ok := airQualityFieldMappers(nil)[f]; !ok && !isReportedByAnyStation(aqos, f) {
+				err = fmt.Errorf("unknown field: %s", f)
+				problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+		}
+
 		if acceptedContentType == geoJSONContentType {
 			locationMapper := func(aqo *domain.AirQuality) any { return aqo.Location }
 
-			fields := append([]string{"type", "location", "dateobserved"}, fields...)
+			fields := append([]string{"type", "location", "dateobserved", "index"}, fields...)
 			aqoGeoJSON, err := marshalAQOToJSON(
 				aqos,
 				newAQOGeoJSONMapper(
@@ -64,7 +77,17 @@ func NewRetrieveAirQualitiesHandler(ctx context.Context, aqsvc airquality.AirQua
 			w.Write([]byte(body))
 
 		} else {
-			aqosBytes, err := json.Marshal(aqos)
+			var aqosBytes []byte
+
+			// without any selected fields every measurement is included
+			if len(fields) == 0 {
+				aqosBytes, err = json.Marshal(aqos)
+			} else {
+				locationMapper := func(aqo *domain.AirQuality) any { return aqo.Location }
+
+				fields := append([]string{"id", "location", "dateobserved"}, fields...)
+				aqosBytes, err = marshalAQOToJSON(aqos, newAQOMapper(fields, locationMapper))
+			}
 			if err != nil {
 				problem := errors.NewProblemReport(http.StatusInternalServerError, "internalservererror", errors.Detail("failed to marshal air quality list to json"), errors.TraceID(traceID))
 				problem.WriteResponse(w)
@@ -87,7 +110,7 @@ func NewRetrieveAirQualityByIDHandler(ctx context.Context, aqsvc airquality.AirQ
 		ctx, span := tracer.Start(r.Context(), "retrieve-air-quality-by-id")
 		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-		traceID, _, _ := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+		traceID, ctx, _ := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
 
 		airQualityID, _ := url.QueryUnescape(chi.URLParam(r, "id"))
 		if airQualityID == "" {
@@ -96,24 +119,47 @@ func NewRetrieveAirQualityByIDHandler(ctx context.Context, aqsvc airquality.AirQ
 			return
 		}
 
-		aq := &domain.AirQualityDetails{}
-
-		from, to, err := getTimeParametersFromQuery(r)
-		if err != nil {
+		params := r.URL.Query()
+		aggr := timeseries.Resolution(params.Get("aggr"))
+		if aggr != "" && aggr != timeseries.Hour && aggr != timeseries.Day {
+			err = fmt.Errorf("unknown aggregation %q, must be one of hour or day", aggr)
+			problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+			problem.WriteResponse(w)
 			return
 		}
-		if from.IsZero() && to.IsZero() {
+
+		var aq *domain.AirQualityDetails
+
+		if !params.Has("from") && !params.Has("to") && aggr == "" {
 			aq, err = aqsvc.GetByID(ctx, airQualityID)
+		} else {
+			var from, to time.Time
+			from, to, err = getTimeSpanOrDefault(r.URL.Query(), "from", "to", 24*time.Hour)
 			if err != nil {
-				w.WriteHeader(http.StatusNotFound)
+				problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+				problem.WriteResponse(w)
 				return
 			}
-		} else {
-			aq, err = aqsvc.GetByIDWithTimespan(ctx, airQualityID, from, to)
-			if err != nil {
-				w.WriteHeader(http.StatusNotFound)
+
+			aq, err = aqsvc.GetByIDWithTimespan(ctx, airQualityID, from, to, aggr)
+		}
+
+		if err != nil {
+			if goerrors.Is(err, airquality.ErrNoSuchAirQuality) {
+				problem := errors.NewProblemReport(http.StatusNotFound, "notfound", errors.Detail(err.Error()), errors.TraceID(traceID))
+				problem.WriteResponse(w)
 				return
 			}
+
+			if goerrors.Is(err, airquality.ErrInvalidQuery) {
+				problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+
+			problem := errors.NewProblemReport(http.StatusInternalServerError, "internalservererror", errors.Detail("failed to retrieve air quality"), errors.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
 		}
 
 		bodyBytes, _ := json.Marshal(aq)
@@ -126,28 +172,142 @@ func NewRetrieveAirQualityByIDHandler(ctx context.Context, aqsvc airquality.AirQ
 	})
 }
 
+func NewRetrieveAirQualityExceedancesHandler(ctx context.Context, aqsvc airquality.AirQualityService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		ctx, span := tracer.Start(r.Context(), "retrieve-air-quality-exceedances")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, _ := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		from, to, err := getTimeSpanOrDefault(r.URL.Query(), "from", "to", 30*24*time.Hour)
+		if err != nil {
+			problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		exceedances, err := aqsvc.GetAllExceedances(ctx, from, to)
+		if err != nil {
+			if goerrors.Is(err, airquality.ErrInvalidQuery) {
+				problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+
+			problem := errors.NewProblemReport(http.StatusInternalServerError, "internalservererror", errors.Detail("failed to compute exceedances"), errors.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		bodyBytes, _ := json.Marshal(exceedances)
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Cache-Control", "max-age=600")
+		w.Write([]byte("{\"data\":" + string(bodyBytes) + "}"))
+	})
+}
+
+func NewRetrieveAirQualityExceedancesByIDHandler(ctx context.Context, aqsvc airquality.AirQualityService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		ctx, span := tracer.Start(r.Context(), "retrieve-air-quality-exceedances-by-id")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, _ := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		airQualityID, _ := url.QueryUnescape(chi.URLParam(r, "id"))
+		if airQualityID == "" {
+			problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail("no air quality id supplied in query"), errors.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		from, to, err := getTimeSpanOrDefault(r.URL.Query(), "from", "to", 30*24*time.Hour)
+		if err != nil {
+			problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		exceedances, err := aqsvc.GetExceedances(ctx, airQualityID, from, to)
+		if err != nil {
+			if goerrors.Is(err, airquality.ErrNoSuchAirQuality) {
+				problem := errors.NewProblemReport(http.StatusNotFound, "notfound", errors.Detail(err.Error()), errors.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+
+			if goerrors.Is(err, airquality.ErrInvalidQuery) {
+				problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+
+			problem := errors.NewProblemReport(http.StatusInternalServerError, "internalservererror", errors.Detail("failed to compute exceedances"), errors.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		bodyBytes, _ := json.Marshal(exceedances)
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Cache-Control", "max-age=600")
+		w.Write([]byte("{\"data\":" + string(bodyBytes) + "}"))
+	})
+}
+
+// getTimeParametersFromQuery parses the optional from and to parameters independently of each
+// other. A missing parameter is returned as a zero time, leaving that end of the time span open.
 func getTimeParametersFromQuery(r *http.Request) (from, to time.Time, err error) {
-	f := r.URL.Query().Get("from")
-	if f == "" {
-		return from, to, err
+	return getTimeSpanFromQuery(r.URL.Query(), "from", "to")
+}
+
+// getTimeSpanFromQuery parses the optional start and end of a time span from the named
+// parameters and makes sure that the start is not after the end.
+func getTimeSpanFromQuery(params url.Values, fromParam, toParam string) (from, to time.Time, err error) {
+	if params.Has(fromParam) {
+		from, err = time.Parse(time.RFC3339, params.Get(fromParam))
+		if err != nil {
+			return from, to, fmt.Errorf("could not parse a valid time from %q parameter: %s", fromParam, err.Error())
+		}
 	}
 
-	from, err = time.Parse(time.RFC3339, f)
-	if err != nil {
-		return from, to, fmt.Errorf("could not parse a valid time from \"from\" parameter: %s", err.Error())
+	if params.Has(toParam) {
+		to, err = time.Parse(time.RFC3339, params.Get(toParam))
+		if err != nil {
+			return from, to, fmt.Errorf("could not parse a valid time from %q parameter: %s", toParam, err.Error())
+		}
 	}
 
-	t := r.URL.Query().Get("to")
-	if t == "" {
-		return from, to, err
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		err = fmt.Errorf("%q must not be after %q", fromParam, toParam)
 	}
 
-	to, err = time.Parse(time.RFC3339, t)
+	return
+}
+
+// getTimeSpanOrDefault works like getTimeSpanFromQuery, but a missing end defaults to now and
+// a missing start to defaultSpan before the end.
+func getTimeSpanOrDefault(params url.Values, fromParam, toParam string, defaultSpan time.Duration) (from, to time.Time, err error) {
+	from, to, err = getTimeSpanFromQuery(params, fromParam, toParam)
 	if err != nil {
-		return from, to, fmt.Errorf("could not parse a valid time from \"to\" parameter: %s", err.Error())
+		return
+	}
+
+	if to.IsZero() {
+		to = time.Now().UTC()
 	}
 
-	return from, to, nil
+	if from.IsZero() {
+		from = to.Add(-defaultSpan)
+	}
+
+	if to.Before(from) {
+		err = fmt.Errorf("%q must not be after %q", fromParam, toParam)
+	}
+
+	return
 }
 
 type AirQualityMapperFunc func(*domain.AirQuality) ([]byte, error)
@@ -206,15 +366,47 @@ func marshalAQOToJSON(aqos []domain.AirQuality, mapper AirQualityMapperFunc) ([]
 	return buffer.Bytes(), nil
 }
 
+func airQualityFieldMappers(location func(*domain.AirQuality) any) map[string]func(*domain.AirQuality) (string, any) {
+	return map[string]func(*domain.AirQuality) (string, any){
+		"id":                  func(aq *domain.AirQuality) (string, any) { return "id", aq.ID },
+		"type":                func(aq *domain.AirQuality) (string, any) { return "type", "AirQualityObserved" },
+		"location":            func(aq *domain.AirQuality) (string, any) { return "location", location(aq) },
+		"dateobserved":        func(aq *domain.AirQuality) (string, any) { return "dateObserved", aq.DateObserved },
+		"atmosphericpressure": func(aq *domain.AirQuality) (string, any) { return "atmosphericPressure", aq.AtmosphericPressure },
+		"temperature":         func(aq *domain.AirQuality) (string, any) { return "temperature", aq.Temperature },
+		"relativehumidity":    func(aq *domain.AirQuality) (string, any) { return "relativeHumidity", aq.RelativeHumidity },
+		"particlecount":       func(aq *domain.AirQuality) (string, any) { return "particleCount", aq.ParticleCount },
+		"pm1":                 func(aq *domain.AirQuality) (string, any) { return "PM1", aq.PM1 },
+		"pm4":                 func(aq *domain.AirQuality) (string, any) { return "PM4", aq.PM4 },
+		"pm10":                func(aq *domain.AirQuality) (string, any) { return "PM10", aq.PM10 },
+		"pm25":                func(aq *domain.AirQuality) (string, any) { return "PM25", aq.PM25 },
+		"totalsuspendedparticulate": func(aq *domain.AirQuality) (string, any) {
+			return "totalSuspendedParticulate", aq.TotalSuspendedParticulate
+		},
+		"co2":           func(aq *domain.AirQuality) (string, any) { return "CO2", aq.CO2 },
+		"no":            func(aq *domain.AirQuality) (string, any) { return "NO", aq.NO },
+		"no2":           func(aq *domain.AirQuality) (string, any) { return "NO2", aq.NO2 },
+		"nox":           func(aq *domain.AirQuality) (string, any) { return "NOx", aq.NOx },
+		"o3":            func(aq *domain.AirQuality) (string, any) { return "O3", aq.O3 },
+		"index":         func(aq *domain.AirQuality) (string, any) { return "index", aq.Index },
+		"voltage":       func(aq *domain.AirQuality) (string, any) { return "voltage", aq.Voltage },
+		"winddirection": func(aq *domain.AirQuality) (string, any) { return "windDirection", aq.WindDirection },
+		"windspeed":     func(aq *domain.AirQuality) (string, any) { return "windSpeed", aq.WindSpeed },
+	}
+}
+
 func newAQOMapper(fields []string, location func(*domain.AirQuality) any) AirQualityMapperFunc {
-	mappers := map[string]func(*domain.AirQuality) (string, any){}
+	mappers := airQualityFieldMappers(location)
 
 	return func(aq *domain.AirQuality) ([]byte, error) {
 		result := map[string]any{}
 		for _, f := range fields {
 			mapper, ok := mappers[f]
 			if !ok {
-				return nil, fmt.Errorf("unknown field: %s", f)
+				if name, ok := otherMeasurementName(aq, f); ok {
+					result[name] = aq.Other[name]
+				}
+				continue
 			}
 			key, value := mapper(aq)
 			if propertyIsNotNil(value) {
@@ -225,3 +417,23 @@ func newAQOMapper(fields []string, location func(*domain.AirQuality) any) AirQua
 		return json.Marshal(&result)
 	}
 }
+
+// otherMeasurementName returns the name of the property in aq.Other that matches the
+// field, ignoring case
+func otherMeasurementName(aq *domain.AirQuality, field string) (string, bool) {
+	for name := range aq.Other {
+		if strings.EqualFold(name, field) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func isReportedByAnyStation(aqos []domain.AirQuality, field string) bool {
+	for i := range aqos {
+		if _, ok := otherMeasurementName(&aqos[i], field); ok {
+			return true
+		}
+	}
+	return false
+}
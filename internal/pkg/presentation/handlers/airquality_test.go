@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	services "github.com/diwise/api-opendata/internal/pkg/application/services/airquality"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 )
 
@@ -23,7 +24,58 @@ func TestRetrieveAirQuality(t *testing.T) {
 	is.Equal(len(svc.GetAllCalls()), 1)
 	responseBody := rw.Body.Bytes()
 
-	is.Equal(string(responseBody), `{"data":[{"id":"aq1","location":{"type":"Point","coordinates":[17.1,62.1]},"dateObserved":{"@type":"DateTime","@value":"2022-10-20T13:10:00Z"},"atmosphericPressure":12.6,"temperature":12.6,"relativeHumidity":12.6,"particleCount":12.6,"PM1":12.6,"PM4":12.6,"PM10":12.6,"PM25":12.6,"totalSuspendedParticulate":12.6,"CO2":12.6,"NO":12.6,"NO2":12.6,"NOx":12.6,"voltage":12.6,"windDirection":12.6,"windSpeed":12.6},{"id":"aq2","location":{"type":"Point","coordinates":[17.2,62.2]},"dateObserved":{"@type":"DateTime","@value":"2022-10-21T13:10:00Z"}},{"id":"aq3","location":{"type":"Point","coordinates":[17.3,62.3]},"dateObserved":{"@type":"DateTime","@value":"2022-10-22T13:10:00Z"}}]}`)
+	is.Equal(string(responseBody), `{"data":[{"id":"aq1","location":{"type":"Point","coordinates":[17.1,62.1]},"dateObserved":{"@type":"DateTime","@value":"2022-10-20T13:10:00Z"},"atmosphericPressure":12.6,"temperature":12.6,"relativeHumidity":12.6,"particleCount":12.6,"PM1":12.6,"PM4":12.6,"PM10":12.6,"PM25":12.6,"totalSuspendedParticulate":12.6,"CO2":12.6,"NO":12.6,"NO2":12.6,"NOx":12.6,"voltage":12.6,"windDirection":12.6,"windSpeed":12.6,"SO2":4.2},{"id":"aq2","location":{"type":"Point","coordinates":[17.2,62.2]},"dateObserved":{"@type":"DateTime","@value":"2022-10-21T13:10:00Z"}},{"id":"aq3","location":{"type":"Point","coordinates":[17.3,62.3]},"dateObserved":{"@type":"DateTime","@value":"2022-10-22T13:10:00Z"}}]}`)
+}
+
+func TestRetrieveAirQualityWithSelectedFields(t *testing.T) {
+	is, log, rw := setup(t)
+	svc := defaultAirQualityMock()
+	req, err := http.NewRequest("GET", "/airqualities?fields=pm10,no2", nil)
+	is.NoErr(err)
+
+	NewRetrieveAirQualitiesHandler(log, svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(rw.Body.String(), `{"data":[{"NO2":12.6,"PM10":12.6,"dateObserved":{"@type":"DateTime","@value":"2022-10-20T13:10:00Z"},"id":"aq1","location":{"type":"Point","coordinates":[17.1,62.1]}},`+
+		`{"dateObserved":{"@type":"DateTime","@value":"2022-10-21T13:10:00Z"},"id":"aq2","location":{"type":"Point","coordinates":[17.2,62.2]}},`+
+		`{"dateObserved":{"@type":"DateTime","@value":"2022-10-22T13:10:00Z"},"id":"aq3","location":{"type":"Point","coordinates":[17.3,62.3]}}]}`)
+}
+
+func TestRetrieveAirQualityAsGeoJSON(t *testing.T) {
+	is, log, rw := setup(t)
+	svc := defaultAirQualityMock()
+	req, err := http.NewRequest("GET", "/airqualities?fields=pm25,temperature", nil)
+	is.NoErr(err)
+	req.Header.Add("Accept", "application/geo+json")
+
+	NewRetrieveAirQualitiesHandler(log, svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(rw.Header().Get("Content-Type"), "application/geo+json")
+	is.True(strings.HasPrefix(rw.Body.String(), `{"type":"FeatureCollection", "features": [{"type":"Feature","id":"aq1","geometry":{"type":"Point","coordinates":[17.1,62.1]},"properties":{"PM25":12.6,"dateObserved":`))
+}
+
+func TestRetrieveAirQualityWithUnknownFieldIsBadRequest(t *testing.T) {
+	is, log, rw := setup(t)
+	svc := defaultAirQualityMock()
+	req, err := http.NewRequest("GET", "/airqualities?fields=ozone", nil)
+	is.NoErr(err)
+
+	NewRetrieveAirQualitiesHandler(log, svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusBadRequest)
+}
+
+func TestRetrieveAirQualityWithPropertyOutsideOfCatalogue(t *testing.T) {
+	is, log, rw := setup(t)
+	svc := defaultAirQualityMock()
+	req, err := http.NewRequest("GET", "/airqualities?fields=so2", nil)
+	is.NoErr(err)
+
+	NewRetrieveAirQualitiesHandler(log, svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.True(strings.Contains(rw.Body.String(), `"SO2":4.2,"dateObserved"`))
 }
 
 func TestRetrieveAirQualityByID(t *testing.T) {
@@ -50,6 +102,73 @@ func TestRetrieveAirQualityByIDParsesTimeParamsCorrectly(t *testing.T) {
 	is.Equal(len(svc.GetByIDWithTimespanCalls()), 1)
 }
 
+func TestRetrieveAirQualityByIDValidatesTheQuery(t *testing.T) {
+	is, r, ts := setupTest(t)
+	svc := defaultAirQualityMock()
+
+	r.Get("/{id}", NewRetrieveAirQualityByIDHandler(context.Background(), svc))
+
+	response, _ := newGetRequest(is, ts, "application/json", "/unknown", nil)
+	is.Equal(response.StatusCode, http.StatusNotFound)
+
+	response, _ = newGetRequest(is, ts, "application/json", "/unknown?from=2022-10-21T13:10:00Z&to=2022-10-22T13:10:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusNotFound)
+
+	response, _ = newGetRequest(is, ts, "application/json", "/aq1?from=2022-10-01T00:00:00Z&to=2022-12-01T00:00:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusBadRequest) // the time span should be limited
+
+	response, _ = newGetRequest(is, ts, "application/json", "/aq1?aggr=week", nil)
+	is.Equal(response.StatusCode, http.StatusBadRequest)
+
+	response, _ = newGetRequest(is, ts, "application/json", "/aq1?from=yesterday", nil)
+	is.Equal(response.StatusCode, http.StatusBadRequest)
+
+	response, _ = newGetRequest(is, ts, "application/json", "/aq1?aggr=day", nil)
+	is.Equal(response.StatusCode, http.StatusOK)
+
+	calls := svc.GetByIDWithTimespanCalls()
+	call := calls[len(calls)-1]
+	is.Equal(call.Resolution, timeseries.Day)
+	is.Equal(call.To.Sub(call.From), 24*time.Hour) // the time span should default to the last 24 hours
+}
+
+func TestRetrieveAirQualityExceedancesByID(t *testing.T) {
+	is, r, ts := setupTest(t)
+	svc := defaultAirQualityMock()
+
+	r.Get("/{id}/exceedances", NewRetrieveAirQualityExceedancesByIDHandler(context.Background(), svc))
+
+	response, _ := newGetRequest(is, ts, "application/json", "/aq1/exceedances?from=2025-01-01T00:00:00Z&to=2025-02-01T00:00:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusOK)
+	is.Equal(svc.GetExceedancesCalls()[0].From, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	response, _ = newGetRequest(is, ts, "application/json", "/unknown/exceedances", nil)
+	is.Equal(response.StatusCode, http.StatusNotFound)
+
+	response, _ = newGetRequest(is, ts, "application/json", "/aq1/exceedances?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusBadRequest)
+
+	response, _ = newGetRequest(is, ts, "application/json", "/aq1/exceedances?from=2025-01-01T00:00:00Z&to=2026-01-01T00:00:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusOK) // a calendar year should be allowed
+
+	response, _ = newGetRequest(is, ts, "application/json", "/aq1/exceedances?from=2025-01-01T00:00:00Z&to=2026-03-01T00:00:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusBadRequest) // the time span should be limited
+}
+
+func TestRetrieveAllAirQualityExceedances(t *testing.T) {
+	is, r, ts := setupTest(t)
+	svc := defaultAirQualityMock()
+
+	r.Get("/exceedances", NewRetrieveAirQualityExceedancesHandler(context.Background(), svc))
+
+	response, body := newGetRequest(is, ts, "application/json", "/exceedances?from=2025-01-01T00:00:00Z&to=2025-02-01T00:00:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusOK)
+	is.True(strings.Contains(body, `"error":"failed to retrieve the values of the station"`)) // failing stations should be reported per station
+
+	response, _ = newGetRequest(is, ts, "application/json", "/exceedances?from=2025-01-01T00:00:00Z&to=2026-03-01T00:00:00Z", nil)
+	is.Equal(response.StatusCode, http.StatusBadRequest) // the time span should be limited
+}
+
 const expectedAirQualityByIDOutput string = `{"data": {"id":"aq1","location":{"type":"Point","coordinates":[17.1,62.1]},"dateObserved":{"@type":"DateTime","@value":"2022-10-21T13:10:00Z"},"pollutants":[{"name":"Temperature","values":[{"value":12.6,"observedAt":"2022-10-20T13:10:00Z"}]}]}}`
 
 func defaultAirQualityMock() *services.AirQualityServiceMock {
@@ -62,17 +181,50 @@ func defaultAirQualityMock() *services.AirQualityServiceMock {
 			if ok {
 				return &aq, nil
 			} else {
-				return nil, fmt.Errorf("no such air quality")
+				return nil, services.ErrNoSuchAirQuality
 			}
 		},
-		GetByIDWithTimespanFunc: func(ctx context.Context, id string, from, to time.Time) (*domain.AirQualityDetails, error) {
-			return nil, nil
+		GetExceedancesFunc: func(ctx context.Context, id string, from, to time.Time) (*domain.AirQualityExceedances, error) {
+			if _, ok := aqDetails[id]; !ok {
+				return nil, services.ErrNoSuchAirQuality
+			}
+			if err := validateMockTimespan(from, to, services.MaxExceedanceTimespan); err != nil {
+				return nil, err
+			}
+			return &domain.AirQualityExceedances{ID: id, From: from, To: to}, nil
+		},
+		GetAllExceedancesFunc: func(ctx context.Context, from, to time.Time) ([]domain.AirQualityExceedances, error) {
+			if err := validateMockTimespan(from, to, services.MaxExceedanceTimespan); err != nil {
+				return nil, err
+			}
+			return []domain.AirQualityExceedances{
+				{ID: "aq1", From: from, To: to, LimitValues: []domain.LimitValueResult{}},
+				{ID: "aq2", From: from, To: to, LimitValues: []domain.LimitValueResult{}, Error: "failed to retrieve the values of the station"},
+			}, nil
+		},
+		GetByIDWithTimespanFunc: func(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.AirQualityDetails, error) {
+			aq, ok := aqDetails[id]
+			if !ok {
+				return nil, services.ErrNoSuchAirQuality
+			}
+			if err := validateMockTimespan(from, to, services.MaxTimespan); err != nil {
+				return nil, err
+			}
+			return &aq, nil
 		},
 	}
 
 	return mock
 }
 
+// validateMockTimespan rejects the same time spans as the air quality service does
+func validateMockTimespan(from, to time.Time, maxTimespan time.Duration) error {
+	if to.Before(from) || to.Sub(from) > maxTimespan {
+		return services.ErrInvalidQuery
+	}
+	return nil
+}
+
 var value float64 = 12.6
 
 var aqList = []domain.AirQuality{
@@ -96,6 +248,7 @@ var aqList = []domain.AirQuality{
 		Voltage:                   &value,
 		WindDirection:             &value,
 		WindSpeed:                 &value,
+		Other:                     map[string]float64{"SO2": 4.2},
 	},
 	{
 		ID:           "aq2",
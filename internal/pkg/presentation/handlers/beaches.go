@@ -12,6 +12,7 @@ import (
 	"log/slog"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/beaches"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/weather"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
@@ -26,7 +27,9 @@ const (
 	YearMonthDayISO8601 string = "2006-01-02"
 )
 
-func NewRetrieveBeachByIDHandler(ctx context.Context, beachService beaches.BeachService) http.HandlerFunc {
+// NewRetrieveBeachByIDHandler returns the details of a beach. If a weather service is
+// given, the nearest daily forecast is embedded in the response.
+func NewRetrieveBeachByIDHandler(ctx context.Context, beachService beaches.BeachService, forecasts weather.WeatherService) http.HandlerFunc {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -51,7 +54,15 @@ func NewRetrieveBeachByIDHandler(ctx context.Context, beachService beaches.Beach
 			return
 		}
 
-		beachJSON, err := json.Marshal(beach)
+		var forecast *domain.WeatherForecast
+		if lon, lat, ok := multiPolygonCentre(beach.Location); ok {
+			forecast = nearestDailyForecast(forecasts, lat, lon)
+		}
+
+		beachJSON, err := json.Marshal(struct {
+			*beaches.Beach
+			Forecast *domain.WeatherForecast `json:"forecast,omitempty"`
+		}{beach, forecast})
 
 		body := []byte("{\"data\":" + string(beachJSON) + "}")
 
@@ -72,7 +83,20 @@ func NewRetrieveBeachesHandler(ctx context.Context, beachService beaches.BeachSe
 
 		fields := urlValueAsSlice(r.URL.Query(), "fields")
 
-		allBeaches := beachService.GetAll(ctx)
+		lat, lon, maxDistance, nearPoint, err := getNearPointFromQuery(r.URL.Query())
+		if err != nil {
+			logger.Error("bad request", slog.String("err", err.Error()))
+			problem := errors.NewProblemReport(http.StatusBadRequest, "badrequest", errors.Detail(err.Error()), errors.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		var allBeaches []beaches.Beach
+		if nearPoint {
+			allBeaches = beachService.GetAllNearPoint(ctx, lat, lon, maxDistance)
+		} else {
+			allBeaches = beachService.GetAll(ctx)
+		}
 
 		const geoJSONContentType string = "application/geo+json"
 
@@ -243,3 +267,21 @@ func newBeachMapper(fields []string, location, wq func(*beaches.Beach) any) Beac
 	}
 
 }
+
+// multiPolygonCentre returns the mean longitude and latitude of the outer ring of the
+// first polygon
+func multiPolygonCentre(mp domain.MultiPolygon) (float64, float64, bool) {
+	if len(mp.Coordinates) == 0 || len(mp.Coordinates[0]) == 0 || len(mp.Coordinates[0][0]) == 0 {
+		return 0, 0, false
+	}
+
+	ring := mp.Coordinates[0][0]
+	var lon, lat float64
+
+	for _, p := range ring {
+		lon += p[0]
+		lat += p[1]
+	}
+
+	return lon / float64(len(ring)), lat / float64(len(ring)), true
+}
@@ -3,10 +3,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/beaches"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/matryer/is"
 )
 
@@ -28,7 +31,7 @@ func TestGetBeachesByID(t *testing.T) {
 	is, router, server := testSetup(t)
 	beachsvc := mockBeachSvc(is)
 
-	router.Get("/{id}", NewRetrieveBeachByIDHandler(context.Background(), beachsvc))
+	router.Get("/{id}", NewRetrieveBeachByIDHandler(context.Background(), beachsvc, nil))
 	resp, body := newGetRequest(is, server, "application/json", "/urn:ngsi-ld:Beach:se:sundsvall:anlaggning:283", nil)
 
 	is.Equal(resp.StatusCode, http.StatusOK)
@@ -38,6 +41,21 @@ func TestGetBeachesByID(t *testing.T) {
 	is.Equal(body, expectation)
 }
 
+func TestThatBeachDetailsEmbedTheNearestForecast(t *testing.T) {
+	is, router, server := testSetup(t)
+	beachsvc := mockBeachSvc(is)
+	weathersvc, _ := defaultWeatherServiceMock()
+
+	router.Get("/{id}", NewRetrieveBeachByIDHandler(context.Background(), beachsvc, weathersvc))
+	resp, body := newGetRequest(is, server, "application/json", "/urn:ngsi-ld:Beach:se:sundsvall:anlaggning:283", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(len(weathersvc.GetForecastsCalls()), 1)
+	is.Equal(weathersvc.GetForecastsCalls()[0].Resolution, timeseries.Day)
+	is.True(math.Abs(weathersvc.GetForecastsCalls()[0].Lat-62.435) < 0.001) // the forecast should be looked up near the beach
+	is.True(strings.HasSuffix(body, `"forecast":{"location":{"type":"Point","coordinates":[17.47,62.43]},"dateIssued":"2023-06-01T12:00:00Z","forecasts":[{"validFrom":"2023-06-01T22:00:00Z","validTo":"2023-06-02T22:00:00Z","temperature":24}]}}}`))
+}
+
 func TestGetBeaches(t *testing.T) {
 	is, router, ts := testSetup(t)
 	svc := mockBeachSvc(is)
@@ -51,6 +69,19 @@ func TestGetBeaches(t *testing.T) {
 	is.Equal(body, expectation)
 }
 
+func TestGetBeachesNearAPoint(t *testing.T) {
+	is, router, ts := testSetup(t)
+	svc := mockBeachSvc(is)
+
+	router.Get("/beaches", NewRetrieveBeachesHandler(context.Background(), svc))
+	resp, body := newGetRequest(is, ts, "application/json", "/beaches?coordinates=17.30,62.39&maxDistance=1000", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(len(svc.GetAllNearPointCalls()), 1)
+	is.Equal(svc.GetAllNearPointCalls()[0].MaxDistance, 1000)
+	is.Equal(body, `{"data":[]}`) // no beaches should be found far from the beach in the mock
+}
+
 func mockBeachSvc(is *is.I) *beaches.BeachServiceMock {
 	return &beaches.BeachServiceMock{
 		GetAllFunc: func(ctx context.Context) []beaches.Beach {
@@ -61,6 +92,9 @@ func mockBeachSvc(is *is.I) *beaches.BeachServiceMock {
 
 			return beaches
 		},
+		GetAllNearPointFunc: func(ctx context.Context, lat, lon float64, maxDistance int) []beaches.Beach {
+			return []beaches.Beach{}
+		},
 		GetByIDFunc: func(ctx context.Context, id string) (*beaches.Beach, error) {
 			beach := &beaches.Beach{}
 
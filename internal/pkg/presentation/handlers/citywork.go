@@ -1,29 +1,150 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"log/slog"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/citywork"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
 	"github.com/go-chi/chi/v5"
 )
 
+const calendarContentType string = "text/calendar"
+
 func NewRetrieveCityworksHandler(ctx context.Context, cityworkSvc citywork.CityworksService) http.HandlerFunc {
+	calendarHandler := NewRetrieveCityworksCalendarHandler(ctx, cityworkSvc)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		body := cityworkSvc.GetAll()
+		if len(r.Header["Accept"]) > 0 && strings.HasPrefix(r.Header["Accept"][0], calendarContentType) {
+			calendarHandler.ServeHTTP(w, r)
+			return
+		}
 
-		roadworksJSON := "{\"data\": " + string(body) + "}"
+		var err error
+		ctx, span := tracer.Start(r.Context(), "retrieve-cityworks")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-		w.Header().Add("Content-Type", "application/json")
-		w.Header().Add("Cache-Control", "max-age=3600")
-		w.Write([]byte(roadworksJSON))
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		from, to, err := getTimeParametersFromQuery(r)
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// the status of each citywork is evaluated at activeAt when given
+		statusAt := time.Now().UTC()
+
+		if activeAt := r.URL.Query().Get("activeAt"); activeAt != "" {
+			if !from.IsZero() || !to.IsZero() {
+				err = fmt.Errorf("activeAt can not be combined with from and to")
+				log.Error("bad request", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			from, err = time.Parse(time.RFC3339, activeAt)
+			if err != nil {
+				err = fmt.Errorf("could not parse a valid time from \"activeAt\" parameter: %s", err.Error())
+				log.Error("bad request", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			to = from
+			statusAt = from
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != domain.CityworksStatusOngoing && status != domain.CityworksStatusUpcoming && status != domain.CityworksStatusFinished {
+			err = fmt.Errorf("status must be one of ongoing, upcoming or finished")
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		sortOrder := r.URL.Query().Get("sort")
+		if sortOrder != "" && sortOrder != "startDate" && sortOrder != "-startDate" {
+			err = fmt.Errorf("cityworks can only be sorted by startDate or -startDate")
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fields := urlValueAsSlice(r.URL.Query(), "fields")
+
+		cityworks := cityworkSvc.GetAll(from, to)
+
+		if status != "" {
+			filtered := make([]domain.CityworksDetails, 0, len(cityworks))
+			for _, cw := range cityworks {
+				if cw.Status(statusAt) == status {
+					filtered = append(filtered, cw)
+				}
+			}
+			cityworks = filtered
+		}
+
+		if sortOrder != "" {
+			cityworks = sortCityworksByStartDate(cityworks, sortOrder == "-startDate")
+		}
+
+		const geoJSONContentType string = "application/geo+json"
+
+		acceptedContentType := "application/json"
+		if len(r.Header["Accept"]) > 0 {
+			acceptHeader := r.Header["Accept"][0]
+			if acceptHeader != "" && strings.HasPrefix(acceptHeader, geoJSONContentType) {
+				acceptedContentType = geoJSONContentType
+			}
+		}
+
+		if acceptedContentType == geoJSONContentType {
+			fields := append([]string{"type", "startdate", "enddate"}, fields...)
+			cityworksGeoJSON, err := marshalCityworksToJSON(
+				cityworks,
+				newCityworksGeoJSONMapper(newCityworksMapper(fields, statusAt)),
+			)
+			if err != nil {
+				log.Error("failed to marshal cityworks list to geo json", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			response := "{\"type\":\"FeatureCollection\", \"features\": " + string(cityworksGeoJSON) + "}"
+
+			w.Header().Add("Content-Type", acceptedContentType)
+			w.Header().Add("Cache-Control", "max-age=3600")
+			w.Write([]byte(response))
+		} else {
+			fields := append([]string{"id", "location", "startdate", "enddate"}, fields...)
+			cityworksJSON, err := marshalCityworksToJSON(cityworks, newCityworksMapper(fields, statusAt))
+			if err != nil {
+				log.Error("failed to marshal cityworks list to json", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			response := "{\"data\":" + string(cityworksJSON) + "}"
+
+			w.Header().Add("Content-Type", "application/json")
+			w.Header().Add("Cache-Control", "max-age=3600")
+			w.Write([]byte(response))
+		}
 	})
 }
 
@@ -43,17 +164,199 @@ func NewRetrieveCityworksByIDHandler(ctx context.Context, cityworkSvc citywork.C
 			return
 		}
 
-		body, err := cityworkSvc.GetByID(cityworkID)
-
+		cw, err := cityworkSvc.GetByID(cityworkID)
 		if err != nil {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
-		body = []byte("{\"data\": " + string(body) + "}")
+		responseBody, err := json.Marshal(cw)
+		if err != nil {
+			log.Error("failed to marshal cityworks to json", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		responseBody = []byte("{\"data\":" + string(responseBody) + "}")
 
 		w.Header().Add("Content-Type", "application/json")
 		w.Header().Add("Cache-Control", "max-age=600")
-		w.Write(body)
+		w.Write(responseBody)
+	})
+}
+
+func NewRetrieveCityworksCalendarHandler(ctx context.Context, cityworkSvc citywork.CityworksService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		ctx, span := tracer.Start(r.Context(), "retrieve-cityworks-calendar")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		bbox, err := urlValueAsBBox(r.URL.Query(), "bbox")
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var cityworks []domain.CityworksDetails
+
+		if bbox != nil {
+			cityworks = cityworkSvc.GetAllInBoundingBox(time.Time{}, time.Time{}, bbox.minLat, bbox.minLon, bbox.maxLat, bbox.maxLon)
+		} else {
+			cityworks = cityworkSvc.GetAll(time.Time{}, time.Time{})
+		}
+
+		w.Header().Add("Content-Type", calendarContentType+"; charset=utf-8")
+		w.Header().Add("Cache-Control", "max-age=3600")
+		w.Write(convertCityworksToICS(cityworks, time.Now()))
 	})
 }
+
+type CityworksMapperFunc func(*domain.CityworksDetails) ([]byte, error)
+
+func newCityworksGeoJSONMapper(baseMapper CityworksMapperFunc) CityworksMapperFunc {
+	return func(cw *domain.CityworksDetails) ([]byte, error) {
+		body, err := baseMapper(cw)
+		if err != nil {
+			return nil, err
+		}
+
+		var props any
+		json.Unmarshal(body, &props)
+
+		feature := struct {
+			Type       string `json:"type"`
+			ID         string `json:"id"`
+			Geometry   any    `json:"geometry"`
+			Properties any    `json:"properties"`
+		}{"Feature", cw.ID, cw.Location, props}
+
+		return json.Marshal(&feature)
+	}
+}
+
+func marshalCityworksToJSON(cityworks []domain.CityworksDetails, mapper CityworksMapperFunc) ([]byte, error) {
+	cityworksCount := len(cityworks)
+
+	if cityworksCount == 0 {
+		return []byte("[]"), nil
+	}
+
+	backingBuffer := make([]byte, 0, 1024*1024)
+	buffer := bytes.NewBuffer(backingBuffer)
+
+	cityworksBytes, err := mapper(&cityworks[0])
+	if err != nil {
+		return nil, err
+	}
+
+	buffer.Write([]byte("["))
+	buffer.Write(cityworksBytes)
+
+	for index := 1; index < cityworksCount; index++ {
+		cityworksBytes, err := mapper(&cityworks[index])
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write([]byte(","))
+		buffer.Write(cityworksBytes)
+	}
+
+	buffer.Write([]byte("]"))
+
+	return buffer.Bytes(), nil
+}
+
+// sortCityworksByStartDate returns a sorted copy of the cityworks so that the
+// slice held by the service is left untouched
+func sortCityworksByStartDate(cityworks []domain.CityworksDetails, descending bool) []domain.CityworksDetails {
+	sorted := append([]domain.CityworksDetails{}, cityworks...)
+
+	startDate := func(cw domain.CityworksDetails) time.Time {
+		t, _ := time.Parse(time.RFC3339, cw.StartDate)
+		return t
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if descending {
+			return startDate(sorted[i]).After(startDate(sorted[j]))
+		}
+		return startDate(sorted[i]).Before(startDate(sorted[j]))
+	})
+
+	return sorted
+}
+
+func newCityworksMapper(fields []string, now time.Time) CityworksMapperFunc {
+
+	omitempty := func(v string) any {
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	}
+
+	mappers := map[string]func(*domain.CityworksDetails) (string, any){
+		"id":           func(cw *domain.CityworksDetails) (string, any) { return "id", cw.ID },
+		"type":         func(cw *domain.CityworksDetails) (string, any) { return "type", "CityWork" },
+		"description":  func(cw *domain.CityworksDetails) (string, any) { return "description", cw.Description },
+		"location":     func(cw *domain.CityworksDetails) (string, any) { return "location", cw.Location },
+		"datemodified": func(cw *domain.CityworksDetails) (string, any) { return "dateModified", omitempty(cw.DateModified) },
+		"startdate":    func(cw *domain.CityworksDetails) (string, any) { return "startDate", cw.StartDate },
+		"enddate":      func(cw *domain.CityworksDetails) (string, any) { return "endDate", cw.EndDate },
+		"status":       func(cw *domain.CityworksDetails) (string, any) { return "status", omitempty(cw.Status(now)) },
+	}
+
+	return func(cw *domain.CityworksDetails) ([]byte, error) {
+		result := map[string]any{}
+		for _, f := range fields {
+			mapper, ok := mappers[f]
+			if !ok {
+				return nil, fmt.Errorf("unknown field: %s", f)
+			}
+			key, value := mapper(cw)
+			if propertyIsNotNil(value) {
+				result[key] = value
+			}
+		}
+
+		return json.Marshal(&result)
+	}
+}
+
+// boundingBox is a rectangular area expressed in WGS84 coordinates
+type boundingBox struct {
+	minLon, minLat, maxLon, maxLat float64
+}
+
+// urlValueAsBBox parses a bounding box in the form minLon,minLat,maxLon,maxLat
+// from the query. A nil bounding box is returned if the parameter is missing.
+func urlValueAsBBox(query url.Values, param string) (*boundingBox, error) {
+	values := urlValueAsSlice(query, param)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	if len(values) != 4 {
+		return nil, fmt.Errorf("%s must be specified as minLon,minLat,maxLon,maxLat", param)
+	}
+
+	coords := [4]float64{}
+	for idx := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(values[idx]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q in %s", values[idx], param)
+		}
+		coords[idx] = v
+	}
+
+	bbox := &boundingBox{minLon: coords[0], minLat: coords[1], maxLon: coords[2], maxLat: coords[3]}
+	if bbox.minLon > bbox.maxLon || bbox.minLat > bbox.maxLat {
+		return nil, fmt.Errorf("%s minimum coordinates must not exceed maximum coordinates", param)
+	}
+
+	return bbox, nil
+}
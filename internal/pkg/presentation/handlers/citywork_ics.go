@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+)
+
+const icsHeader string = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//diwise//api-opendata//SV\r\n" +
+	"CALSCALE:GREGORIAN\r\n" +
+	"METHOD:PUBLISH\r\n" +
+	"X-WR-CALNAME:Cityworks\r\n"
+
+const icsFooter string = "END:VCALENDAR\r\n"
+
+const icsDateTimeFormat string = "20060102T150405Z"
+
+// icsMaxLineLength is the maximum number of octets allowed on a single content
+// line before it has to be folded, as specified by RFC 5545 section 3.1
+const icsMaxLineLength int = 75
+
+func convertCityworksToICS(cityworks []domain.CityworksDetails, now time.Time) []byte {
+	ics := bytes.NewBufferString(icsHeader)
+
+	for _, cw := range cityworks {
+		startDate, err := time.Parse(time.RFC3339, cw.StartDate)
+		if err != nil {
+			// an event without a start date makes no sense in a calendar
+			continue
+		}
+
+		dtstamp := now
+		if cw.DateModified != "" {
+			if modified, err := time.Parse(time.RFC3339, cw.DateModified); err == nil {
+				dtstamp = modified
+			}
+		}
+
+		writeICSLine(ics, "BEGIN", "VEVENT")
+		writeICSLine(ics, "UID", cw.ID)
+		writeICSLine(ics, "DTSTAMP", dtstamp.UTC().Format(icsDateTimeFormat))
+		writeICSLine(ics, "DTSTART", startDate.UTC().Format(icsDateTimeFormat))
+
+		if endDate, err := time.Parse(time.RFC3339, cw.EndDate); err == nil && endDate.After(startDate) {
+			writeICSLine(ics, "DTEND", endDate.UTC().Format(icsDateTimeFormat))
+		}
+
+		writeICSLine(ics, "SUMMARY", escapeICSText(cityworksSummary(cw)))
+		writeICSLine(ics, "DESCRIPTION", escapeICSText(cw.Description))
+
+		if len(cw.Location.Coordinates) >= 2 {
+			lon, lat := cw.Location.Coordinates[0], cw.Location.Coordinates[1]
+			writeICSLine(ics, "LOCATION", escapeICSText(fmt.Sprintf("%0.6f, %0.6f", lat, lon)))
+			writeICSLine(ics, "GEO", fmt.Sprintf("%0.6f;%0.6f", lat, lon))
+		}
+
+		writeICSLine(ics, "END", "VEVENT")
+	}
+
+	ics.WriteString(icsFooter)
+
+	return ics.Bytes()
+}
+
+// cityworksSummary uses the first line of the description as a short summary
+// of the citywork, since the data model lacks a proper name property
+func cityworksSummary(cw domain.CityworksDetails) string {
+	return firstLineOrDefault(cw.Description, "Citywork")
+}
+
+func escapeICSText(text string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+		"\r", "",
+	).Replace(text)
+}
+
+func writeICSLine(buf *bytes.Buffer, name, value string) {
+	line := name + ":" + value
+	limit := icsMaxLineLength
+
+	for len(line) > limit {
+		// find a split point that does not break a multi byte utf-8 sequence
+		split := limit
+		for split > 0 && !utf8.RuneStart(line[split]) {
+			split--
+		}
+
+		buf.WriteString(line[:split])
+		buf.WriteString("\r\n ")
+		line = line[split:]
+
+		// continuation lines start with a space that counts towards the limit
+		limit = icsMaxLineLength - 1
+	}
+
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/citywork"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/matryer/is"
 )
 
@@ -17,12 +21,279 @@ func TestGetCitywork(t *testing.T) {
 	req, _ := http.NewRequest(http.MethodGet, "/api/cityworks", nil)
 	req.Header.Add("Accept", "application/json")
 
+	cityworkSvc := defaultCityworksMock()
+
+	NewRetrieveCityworksHandler(context.Background(), cityworkSvc).ServeHTTP(w, req)
+	is.Equal(w.Code, http.StatusOK)             // Request failed, status code not OK
+	is.Equal(len(cityworkSvc.GetAllCalls()), 1) // GetAll should have been called once
+	is.Equal(w.Body.String(), `{"data":[{"endDate":"2022-05-14T16:00:00Z","id":"urn:ngsi-ld:CityWork:citywork0","location":{"type":"Point","coordinates":[17,62]},"startDate":"2022-05-01T07:00:00Z"},{"endDate":"2022-06-02T16:00:00Z","id":"urn:ngsi-ld:CityWork:citywork1","location":{"type":"Point","coordinates":[17.1,62.1]},"startDate":"2022-06-01T07:00:00Z"}]}`)
+}
+
+func TestGetCityworksWithFieldsAndTimespan(t *testing.T) {
+	is, r, ts := setupTest(t)
+	cityworkSvc := defaultCityworksMock()
+
+	r.Get("/cityworks", NewRetrieveCityworksHandler(context.Background(), cityworkSvc))
+	response, responseBody := newGetRequest(is, ts, "application/json", "/cityworks?fields=description&from=2022-05-20T00:00:00Z&to=2022-07-01T00:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(len(cityworkSvc.GetAllCalls()), 1)
+	is.Equal(cityworkSvc.GetAllCalls()[0].From, time.Date(2022, 5, 20, 0, 0, 0, 0, time.UTC))
+	is.Equal(responseBody, `{"data":[{"description":"Asfaltering","endDate":"2022-06-02T16:00:00Z","id":"urn:ngsi-ld:CityWork:citywork1","location":{"type":"Point","coordinates":[17.1,62.1]},"startDate":"2022-06-01T07:00:00Z"}]}`)
+}
+
+func TestGetCityworksAsGeoJSON(t *testing.T) {
+	is, r, ts := setupTest(t)
+	cityworkSvc := defaultCityworksMock()
+
+	r.Get("/cityworks", NewRetrieveCityworksHandler(context.Background(), cityworkSvc))
+	response, responseBody := newGetRequest(is, ts, "application/geo+json", "/cityworks?from=2022-05-20T00:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(responseBody, `{"type":"FeatureCollection", "features": [{"type":"Feature","id":"urn:ngsi-ld:CityWork:citywork1","geometry":{"type":"Point","coordinates":[17.1,62.1]},"properties":{"endDate":"2022-06-02T16:00:00Z","startDate":"2022-06-01T07:00:00Z","type":"CityWork"}}]}`)
+}
+
+func TestGetCityworksActiveAt(t *testing.T) {
+	is, r, ts := setupTest(t)
+	cityworkSvc := defaultCityworksMock()
+
+	r.Get("/cityworks", NewRetrieveCityworksHandler(context.Background(), cityworkSvc))
+	response, responseBody := newGetRequest(is, ts, "application/json", "/cityworks?activeAt=2022-05-05T12:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(cityworkSvc.GetAllCalls()[0].From, cityworkSvc.GetAllCalls()[0].To)
+	is.Equal(strings.Count(responseBody, `"id"`), 1)
+	is.True(strings.Contains(responseBody, "urn:ngsi-ld:CityWork:citywork0"))
+}
+
+func TestGetCityworksByStatusSortedByStartDate(t *testing.T) {
+	is, r, ts := setupTest(t)
+
+	now := time.Now().UTC()
+	day := 24 * time.Hour
+
+	cityworks := []domain.CityworksDetails{
+		{ID: "finished", StartDate: now.Add(-10 * day).Format(time.RFC3339), EndDate: now.Add(-5 * day).Format(time.RFC3339)},
+		{ID: "upcoming-later", StartDate: now.Add(10 * day).Format(time.RFC3339), EndDate: now.Add(20 * day).Format(time.RFC3339)},
+		{ID: "ongoing", StartDate: now.Add(-1 * day).Format(time.RFC3339), EndDate: now.Add(1 * day).Format(time.RFC3339)},
+		{ID: "upcoming-soon", StartDate: now.Add(2 * day).Format(time.RFC3339), EndDate: now.Add(3 * day).Format(time.RFC3339)},
+	}
+
 	cityworkSvc := &citywork.CityworksServiceMock{
-		GetAllFunc: func() []byte {
-			return nil
+		GetAllFunc: func(from, to time.Time) []domain.CityworksDetails {
+			return cityworks
 		},
 	}
 
+	r.Get("/cityworks", NewRetrieveCityworksHandler(context.Background(), cityworkSvc))
+
+	response, responseBody := newGetRequest(is, ts, "application/json", "/cityworks?status=upcoming&sort=-startDate&fields=status", nil)
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(strings.Count(responseBody, `"status":"upcoming"`), 2)
+	is.True(strings.Index(responseBody, "upcoming-later") < strings.Index(responseBody, "upcoming-soon")) // should be sorted by descending start date
+
+	response, responseBody = newGetRequest(is, ts, "application/json", "/cityworks?sort=startDate", nil)
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.True(strings.Index(responseBody, `"finished"`) < strings.Index(responseBody, `"ongoing"`))
+	is.Equal(cityworks[1].ID, "upcoming-later") // sorting should not modify the data held by the service
+}
+
+func TestGetCityworksWithOnlyAnEndTime(t *testing.T) {
+	is, r, ts := setupTest(t)
+	cityworkSvc := defaultCityworksMock()
+
+	r.Get("/cityworks", NewRetrieveCityworksHandler(context.Background(), cityworkSvc))
+	response, _ := newGetRequest(is, ts, "application/json", "/cityworks?to=2022-05-05T12:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK)
+	is.True(cityworkSvc.GetAllCalls()[0].From.IsZero())
+	is.Equal(cityworkSvc.GetAllCalls()[0].To, time.Date(2022, 5, 5, 12, 0, 0, 0, time.UTC)) // to should be used without from
+}
+
+func TestGetCityworksStatusAtActiveAt(t *testing.T) {
+	is, r, ts := setupTest(t)
+
+	cityworkSvc := &citywork.CityworksServiceMock{
+		GetAllFunc: func(from, to time.Time) []domain.CityworksDetails {
+			return []domain.CityworksDetails{
+				{ID: "finished-today", StartDate: "2024-05-20T00:00:00Z", EndDate: "2024-06-10T00:00:00Z"},
+			}
+		},
+	}
+
+	r.Get("/cityworks", NewRetrieveCityworksHandler(context.Background(), cityworkSvc))
+
+	response, responseBody := newGetRequest(is, ts, "application/json", "/cityworks?activeAt=2024-06-01T00:00:00Z&status=ongoing&fields=status", nil)
+	is.Equal(response.StatusCode, http.StatusOK)
+	is.True(strings.Contains(responseBody, `"status":"ongoing"`)) // status should be evaluated at activeAt rather than now
+}
+
+func TestGetCityworksWithInvalidTimeWindow(t *testing.T) {
+	is, r, ts := setupTest(t)
+	cityworkSvc := defaultCityworksMock()
+
+	r.Get("/cityworks", NewRetrieveCityworksHandler(context.Background(), cityworkSvc))
+
+	for _, query := range []string{
+		"activeAt=today",
+		"activeAt=2022-05-05T12:00:00Z&from=2022-05-01T00:00:00Z",
+		"activeAt=2022-05-05T12:00:00Z&to=2022-05-01T00:00:00Z",
+		"from=2022-05-05T12:00:00Z&to=2022-05-01T00:00:00Z",
+		"status=cancelled",
+		"sort=endDate",
+	} {
+		response, _ := newGetRequest(is, ts, "application/json", "/cityworks?"+query, nil)
+		is.Equal(response.StatusCode, http.StatusBadRequest) // invalid time window should be rejected
+	}
+
+	is.Equal(len(cityworkSvc.GetAllCalls()), 0)
+}
+
+func TestGetCityworkByID(t *testing.T) {
+	is, r, ts := setupTest(t)
+	cityworkSvc := defaultCityworksMock()
+
+	r.Get("/{id}", NewRetrieveCityworksByIDHandler(context.Background(), cityworkSvc))
+	response, _ := newGetRequest(is, ts, "application/json", "/urn:ngsi-ld:CityWork:citywork0", nil)
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+
+	response, _ = newGetRequest(is, ts, "application/json", "/urn:ngsi-ld:CityWork:nosuchwork", nil)
+	is.Equal(response.StatusCode, http.StatusNotFound) // unknown ids should not be found
+}
+
+func TestGetCityworksAsCalendar(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/cityworks", nil)
+	req.Header.Add("Accept", "text/calendar")
+
+	cityworkSvc := defaultCityworksMock()
+
 	NewRetrieveCityworksHandler(context.Background(), cityworkSvc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)                                          // Request failed, status code not OK
+	is.Equal(w.Header().Get("Content-Type"), "text/calendar; charset=utf-8") // content type should be text/calendar
+	is.Equal(w.Body.String(), expectedCityworksCalendar)
+}
+
+func TestGetCityworksCalendarWithinBoundingBox(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/cityworks.ics?bbox=17.05,62.05,17.2,62.2", nil)
+
+	NewRetrieveCityworksCalendarHandler(context.Background(), defaultCityworksMock()).ServeHTTP(w, req)
+
 	is.Equal(w.Code, http.StatusOK) // Request failed, status code not OK
+	is.Equal(strings.Count(w.Body.String(), "BEGIN:VEVENT"), 1)
+	is.True(strings.Contains(w.Body.String(), "UID:urn:ngsi-ld:CityWork:citywork1\r\n"))
+}
+
+func TestGetCityworksCalendarWithInvalidBoundingBox(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/cityworks.ics?bbox=17.05,62.05,17.2", nil)
+
+	NewRetrieveCityworksCalendarHandler(context.Background(), defaultCityworksMock()).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadRequest) // an incomplete bbox should be rejected
 }
+
+func TestThatLongCalendarLinesAreFolded(t *testing.T) {
+	is := is.New(t)
+
+	description := strings.Repeat("Grävning pågår, ", 10)
+	ics := string(convertCityworksToICS([]domain.CityworksDetails{{
+		ID:          "urn:ngsi-ld:CityWork:long",
+		Description: description,
+		StartDate:   "2022-05-01T07:00:00Z",
+	}}, time.Now()))
+
+	for _, line := range strings.Split(ics, "\r\n") {
+		is.True(len(line) <= 75) // no content line may exceed 75 octets
+	}
+
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	is.True(strings.Contains(unfolded, "DESCRIPTION:"+strings.ReplaceAll(description, ",", "\\,")))
+}
+
+func defaultCityworksMock() *citywork.CityworksServiceMock {
+	cityworks := []domain.CityworksDetails{
+		{
+			ID:           "urn:ngsi-ld:CityWork:citywork0",
+			Location:     *domain.NewPoint(62.0, 17.0),
+			Description:  "Schaktarbete; ledningsbyte\nKörfält avstängt",
+			DateModified: "2022-04-20T08:00:00Z",
+			StartDate:    "2022-05-01T07:00:00Z",
+			EndDate:      "2022-05-14T16:00:00Z",
+		},
+		{
+			ID:           "urn:ngsi-ld:CityWork:citywork1",
+			Location:     *domain.NewPoint(62.1, 17.1),
+			Description:  "Asfaltering",
+			DateModified: "2022-04-21T08:00:00Z",
+			StartDate:    "2022-06-01T07:00:00Z",
+			EndDate:      "2022-06-02T16:00:00Z",
+		},
+	}
+
+	return &citywork.CityworksServiceMock{
+		GetAllFunc: func(from, to time.Time) []domain.CityworksDetails {
+			result := []domain.CityworksDetails{}
+			for _, cw := range cityworks {
+				if cw.Overlaps(from, to) {
+					result = append(result, cw)
+				}
+			}
+			return result
+		},
+		GetAllInBoundingBoxFunc: func(from, to time.Time, minLat, minLon, maxLat, maxLon float64) []domain.CityworksDetails {
+			result := []domain.CityworksDetails{}
+			for _, cw := range cityworks {
+				lon, lat := cw.Location.Coordinates[0], cw.Location.Coordinates[1]
+				if cw.Overlaps(from, to) && lat >= minLat && lat <= maxLat && lon >= minLon && lon <= maxLon {
+					result = append(result, cw)
+				}
+			}
+			return result
+		},
+		GetByIDFunc: func(id string) (*domain.CityworksDetails, error) {
+			for idx := range cityworks {
+				if cityworks[idx].ID == id {
+					return &cityworks[idx], nil
+				}
+			}
+			return nil, fmt.Errorf("no such cityworks")
+		},
+	}
+}
+
+const expectedCityworksCalendar string = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//diwise//api-opendata//SV\r\n" +
+	"CALSCALE:GREGORIAN\r\n" +
+	"METHOD:PUBLISH\r\n" +
+	"X-WR-CALNAME:Cityworks\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:urn:ngsi-ld:CityWork:citywork0\r\n" +
+	"DTSTAMP:20220420T080000Z\r\n" +
+	"DTSTART:20220501T070000Z\r\n" +
+	"DTEND:20220514T160000Z\r\n" +
+	"SUMMARY:Schaktarbete\\; ledningsbyte\r\n" +
+	"DESCRIPTION:Schaktarbete\\; ledningsbyte\\nKörfält avstängt\r\n" +
+	"LOCATION:62.000000\\, 17.000000\r\n" +
+	"GEO:62.000000;17.000000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:urn:ngsi-ld:CityWork:citywork1\r\n" +
+	"DTSTAMP:20220421T080000Z\r\n" +
+	"DTSTART:20220601T070000Z\r\n" +
+	"DTEND:20220602T160000Z\r\n" +
+	"SUMMARY:Asfaltering\r\n" +
+	"DESCRIPTION:Asfaltering\r\n" +
+	"LOCATION:62.100000\\, 17.100000\r\n" +
+	"GEO:62.100000;17.100000\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
@@ -12,6 +12,7 @@ import (
 	"log/slog"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/exercisetrails"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/weather"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
@@ -19,7 +20,10 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
-func NewRetrieveExerciseTrailByIDHandler(ctx context.Context, trailService exercisetrails.ExerciseTrailService) http.HandlerFunc {
+// NewRetrieveExerciseTrailByIDHandler returns the details of an exercise trail. If a
+// weather service is given, the daily forecast nearest to the start of the trail is
+// embedded in json responses.
+func NewRetrieveExerciseTrailByIDHandler(ctx context.Context, trailService exercisetrails.ExerciseTrailService, forecasts weather.WeatherService) http.HandlerFunc {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -61,7 +65,16 @@ func NewRetrieveExerciseTrailByIDHandler(ctx context.Context, trailService exerc
 		responseBody := []byte{}
 
 		if acceptedContentType == "application/json" {
-			responseBody, err = json.Marshal(trail)
+			var forecast *domain.WeatherForecast
+			if len(trail.Location.Coordinates) > 0 && len(trail.Location.Coordinates[0]) >= 2 {
+				start := trail.Location.Coordinates[0]
+				forecast = nearestDailyForecast(forecasts, start[1], start[0])
+			}
+
+			responseBody, err = json.Marshal(struct {
+				*domain.ExerciseTrail
+				Forecast *domain.WeatherForecast `json:"forecast,omitempty"`
+			}{trail, forecast})
 			if err != nil {
 				log.Error("failed to marshal trail to json", slog.String("err", err.Error()))
 				w.WriteHeader(http.StatusInternalServerError)
@@ -124,7 +137,19 @@ func NewRetrieveExerciseTrailsHandler(ctx context.Context, trailService exercise
 		categories := urlValueAsSlice(r.URL.Query(), "categories")
 		fields := urlValueAsSlice(r.URL.Query(), "fields")
 
-		trails := trailService.GetAll(categories)
+		lat, lon, maxDistance, nearPoint, err := getNearPointFromQuery(r.URL.Query())
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var trails []domain.ExerciseTrail
+		if nearPoint {
+			trails = trailService.GetAllNearPoint(lat, lon, maxDistance, categories)
+		} else {
+			trails = trailService.GetAll(categories)
+		}
 
 		const geoJSONContentType string = "application/geo+json"
 
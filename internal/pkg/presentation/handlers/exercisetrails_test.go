@@ -121,6 +121,37 @@ func TestGetExerciseTrailsWithCertainCategories(t *testing.T) {
 	is.Equal(len(svc.GetAllCalls()), 1) // Get should have been called once
 }
 
+func TestGetExerciseTrailsNearAPoint(t *testing.T) {
+	is, _, rw := setup(t)
+	svc := defaultTrailsMock()
+	req, err := http.NewRequest("GET", "?coordinates=[17.31,62.37]&maxDistance=2000&categories=bike-track", nil)
+	is.NoErr(err)
+
+	NewRetrieveExerciseTrailsHandler(context.Background(), svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(len(svc.GetAllCalls()), 0) // trails near a point should not be looked up among all trails
+	is.Equal(len(svc.GetAllNearPointCalls()), 1)
+
+	call := svc.GetAllNearPointCalls()[0]
+	is.Equal(call.Lat, 62.37)
+	is.Equal(call.Lon, 17.31)
+	is.Equal(call.MaxDistance, 2000)
+	is.Equal(call.RequiredCategories, []string{"bike-track"})
+}
+
+func TestGetExerciseTrailsWithInvalidMaxDistance(t *testing.T) {
+	is, _, rw := setup(t)
+	svc := defaultTrailsMock()
+	req, err := http.NewRequest("GET", "?coordinates=17.31,62.37&maxDistance=-1", nil)
+	is.NoErr(err)
+
+	NewRetrieveExerciseTrailsHandler(context.Background(), svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusBadRequest)
+	is.Equal(len(svc.GetAllNearPointCalls()), 0)
+}
+
 func TestGetExerciseTrailAsGeoJSON(t *testing.T) {
 	is, r, ts := setupTest(t)
 
@@ -131,7 +162,7 @@ func TestGetExerciseTrailAsGeoJSON(t *testing.T) {
 		return oldfunc(id)
 	}
 
-	r.Get("/{id}", NewRetrieveExerciseTrailByIDHandler(context.Background(), svc))
+	r.Get("/{id}", NewRetrieveExerciseTrailByIDHandler(context.Background(), svc, nil))
 	response, responseBody := newGetRequest(is, ts, "application/geo+json", "/expected-id", nil)
 
 	is.Equal(response.StatusCode, http.StatusOK) // response status should be 200 OK
@@ -169,7 +200,7 @@ func TestGetExerciseTrailAsGPX(t *testing.T) {
 		return oldfunc(id)
 	}
 
-	r.Get("/{id}", NewRetrieveExerciseTrailByIDHandler(context.Background(), svc))
+	r.Get("/{id}", NewRetrieveExerciseTrailByIDHandler(context.Background(), svc, nil))
 	response, responseBody := newGetRequest(is, ts, "application/gpx+xml", "/expected-id", nil)
 
 	is.Equal(response.StatusCode, http.StatusOK) // response status should be 200 OK
@@ -209,6 +240,9 @@ func defaultTrailsMock() *services.ExerciseTrailServiceMock {
 		GetAllFunc: func(c []string) []domain.ExerciseTrail {
 			return []domain.ExerciseTrail{trail0}
 		},
+		GetAllNearPointFunc: func(lat, lon float64, maxDistance int, c []string) []domain.ExerciseTrail {
+			return []domain.ExerciseTrail{trail0}
+		},
 		GetByIDFunc: func(id string) (*domain.ExerciseTrail, error) {
 			return &trail0, nil
 		},
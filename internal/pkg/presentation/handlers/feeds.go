@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/services/citywork"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/exercisetrails"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/roadaccidents"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/sportsfields"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+)
+
+const atomContentType string = "application/atom+xml"
+
+// maxFeedEntries limits the number of entries in a feed, as feed readers are
+// only interested in the most recent changes
+const maxFeedEntries int = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+}
+
+func NewRetrieveRoadAccidentsFeedHandler(ctx context.Context, feedBase FeedBase, roadAccidentSvc roadaccidents.RoadAccidentService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		_, span := tracer.Start(r.Context(), "retrieve-road-accidents-feed")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		accidents := append([]domain.RoadAccidentDetails{}, roadAccidentSvc.GetAll(time.Time{}, time.Time{})...)
+		sort.SliceStable(accidents, func(i, j int) bool {
+			return parseFeedTime(accidents[i].AccidentDate).After(parseFeedTime(accidents[j].AccidentDate))
+		})
+
+		base, derived := feedBaseURL(feedBase, r)
+		entries := make([]atomEntry, 0, len(accidents))
+
+		for _, ra := range accidents {
+			updated := ra.AccidentDate
+			if ra.DateModified != "" {
+				updated = ra.DateModified
+			}
+
+			entries = append(entries, atomEntry{
+				ID:        ra.ID,
+				Title:     firstLineOrDefault(ra.Description, "Road accident"),
+				Updated:   formatFeedTime(updated),
+				Published: formatFeedTime(ra.AccidentDate),
+				Links:     []atomLink{{Href: detailURL(base, "roadaccidents", ra.ID), Rel: "alternate", Type: "application/json"}},
+				Summary:   ra.Description,
+			})
+		}
+
+		err = writeAtomFeed(w, newAtomFeed(base, "roadaccidents", "Road accidents", entries), derived)
+	})
+}
+
+func NewRetrieveCityworksFeedHandler(ctx context.Context, feedBase FeedBase, cityworkSvc citywork.CityworksService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		_, span := tracer.Start(r.Context(), "retrieve-cityworks-feed")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		cityworks := append([]domain.CityworksDetails{}, cityworkSvc.GetAll(time.Time{}, time.Time{})...)
+		sort.SliceStable(cityworks, func(i, j int) bool {
+			return parseFeedTime(cityworks[i].DateModified).After(parseFeedTime(cityworks[j].DateModified))
+		})
+
+		base, derived := feedBaseURL(feedBase, r)
+		entries := make([]atomEntry, 0, len(cityworks))
+
+		for _, cw := range cityworks {
+			updated := cw.DateModified
+			if updated == "" {
+				updated = cw.StartDate
+			}
+
+			entries = append(entries, atomEntry{
+				ID:      cw.ID,
+				Title:   cityworksSummary(cw),
+				Updated: formatFeedTime(updated),
+				Links:   []atomLink{{Href: detailURL(base, "cityworks", cw.ID), Rel: "alternate", Type: "application/json"}},
+				Summary: cw.Description,
+			})
+		}
+
+		err = writeAtomFeed(w, newAtomFeed(base, "cityworks", "Cityworks", entries), derived)
+	})
+}
+
+func NewRetrieveExerciseTrailsFeedHandler(ctx context.Context, feedBase FeedBase, trailService exercisetrails.ExerciseTrailService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		_, span := tracer.Start(r.Context(), "retrieve-exercisetrails-feed")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		base, derived := feedBaseURL(feedBase, r)
+		entries := statusChangesToAtomEntries(base, "exercisetrails", trailService.GetStatusChanges())
+
+		err = writeAtomFeed(w, newAtomFeed(base, "exercisetrails", "Exercise trail status changes", entries), derived)
+	})
+}
+
+func NewRetrieveSportsFieldsFeedHandler(ctx context.Context, feedBase FeedBase, sportsFieldService sportsfields.SportsFieldService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		_, span := tracer.Start(r.Context(), "retrieve-sportsfields-feed")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		base, derived := feedBaseURL(feedBase, r)
+		entries := statusChangesToAtomEntries(base, "sportsfields", sportsFieldService.GetStatusChanges())
+
+		err = writeAtomFeed(w, newAtomFeed(base, "sportsfields", "Sports field status changes", entries), derived)
+	})
+}
+
+func statusChangesToAtomEntries(base, dataset string, changes []domain.StatusChange) []atomEntry {
+	entries := make([]atomEntry, 0, len(changes))
+
+	for _, sc := range changes {
+		changedAt := parseFeedTime(sc.DateChanged)
+
+		entries = append(entries, atomEntry{
+			// the same entity may change status many times, so the time of
+			// the change is needed to make the entry id unique
+			ID:      fmt.Sprintf("%s:status:%d", sc.ID, changedAt.Unix()),
+			Title:   fmt.Sprintf("%s: %s", sc.Name, sc.Status),
+			Updated: formatFeedTime(sc.DateChanged),
+			Links:   []atomLink{{Href: detailURL(base, dataset, sc.ID), Rel: "alternate", Type: "application/json"}},
+			Summary: fmt.Sprintf("Status changed from %s to %s", sc.PreviousStatus, sc.Status),
+		})
+	}
+
+	return entries
+}
+
+func newAtomFeed(base, dataset, title string, entries []atomEntry) atomFeed {
+	if len(entries) > maxFeedEntries {
+		entries = entries[:maxFeedEntries]
+	}
+
+	// the feed is as recent as its most recently updated entry
+	updated := time.Time{}
+	for _, e := range entries {
+		if t := parseFeedTime(e.Updated); t.After(updated) {
+			updated = t
+		}
+	}
+
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+
+	// updated is mandatory for entries, so fall back to the time of the feed
+	// for entries that lack a valid timestamp
+	for idx := range entries {
+		if entries[idx].Updated == "" {
+			entries[idx].Updated = updated.Format(time.RFC3339)
+		}
+	}
+
+	feedURL := fmt.Sprintf("%s/api/feeds/%s.atom", base, dataset)
+
+	return atomFeed{
+		ID:      feedURL,
+		Title:   title,
+		Updated: updated.Format(time.RFC3339),
+		Author:  atomAuthor{Name: "diwise"},
+		Links: []atomLink{
+			{Href: feedURL, Rel: "self", Type: atomContentType},
+			{Href: fmt.Sprintf("%s/api/%s", base, dataset), Rel: "alternate", Type: "application/json"},
+		},
+		Entries: entries,
+	}
+}
+
+// writeAtomFeed writes the feed to the response. A feed with links that are derived from
+// the request may differ between clients and is therefore not stored by shared caches.
+func writeAtomFeed(w http.ResponseWriter, feed atomFeed, derivedLinks bool) error {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return fmt.Errorf("failed to marshal atom feed: %w", err)
+	}
+
+	w.Header().Add("Content-Type", atomContentType+"; charset=utf-8")
+	if derivedLinks {
+		w.Header().Add("Cache-Control", "private, max-age=600")
+	} else {
+		w.Header().Add("Cache-Control", "max-age=600")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+
+	return nil
+}
+
+// FeedBase decides the base url of the absolute links in feeds
+type FeedBase struct {
+	// URL is the public base url of the api. When empty, the base url is derived from
+	// each incoming request.
+	URL string
+	// TrustForwardedHeaders lets X-Forwarded-Proto and X-Forwarded-Host decide a derived
+	// base url, and should only be set when the api runs behind a proxy that sets them
+	TrustForwardedHeaders bool
+}
+
+// feedBaseURL returns the configured public base url of the api, or one derived from
+// the incoming request if none has been configured, along with whether it was derived
+func feedBaseURL(feedBase FeedBase, r *http.Request) (string, bool) {
+	if feedBase.URL != "" {
+		return strings.TrimSuffix(feedBase.URL, "/"), false
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host := r.Host
+
+	if feedBase.TrustForwardedHeaders {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+
+		if fwdHost := r.Header.Get("X-Forwarded-Host"); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, host), true
+}
+
+func detailURL(base, dataset, id string) string {
+	return fmt.Sprintf("%s/api/%s/%s", base, dataset, url.PathEscape(id))
+}
+
+func firstLineOrDefault(text, defaultValue string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return defaultValue
+	}
+
+	return line
+}
+
+func parseFeedTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// formatFeedTime normalises a timestamp to UTC, as required for the date
+// constructs in an atom document
+func formatFeedTime(value string) string {
+	t := parseFeedTime(value)
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/diwise/api-opendata/internal/pkg/application/services/exercisetrails"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/roadaccidents"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
+	"github.com/matryer/is"
+)
+
+func TestRoadAccidentsFeedIsSortedNewestFirst(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/feeds/roadaccidents.atom", nil)
+
+	svc := &roadaccidents.RoadAccidentServiceMock{
+		GetAllFunc: func(from, to time.Time) []domain.RoadAccidentDetails {
+			return []domain.RoadAccidentDetails{
+				{ID: "urn:ngsi-ld:RoadAccident:ra0", Description: "Singelolycka", AccidentDate: "2022-05-01T07:00:00Z"},
+				{ID: "urn:ngsi-ld:RoadAccident:ra1", Description: "Viltolycka", AccidentDate: "2022-06-01T07:00:00Z"},
+			}
+		},
+	}
+
+	NewRetrieveRoadAccidentsFeedHandler(context.Background(), FeedBase{URL: "https://example.com/"}, svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK) // Request failed, status code not OK
+	is.Equal(w.Header().Get("Content-Type"), "application/atom+xml; charset=utf-8")
+	is.Equal(w.Header().Get("Cache-Control"), "max-age=600")
+
+	feed := atomFeed{}
+	is.NoErr(xml.Unmarshal(w.Body.Bytes(), &feed))
+
+	is.Equal(feed.ID, "https://example.com/api/feeds/roadaccidents.atom")
+	is.Equal(feed.Updated, "2022-06-01T07:00:00Z") // feed should be as recent as its newest entry
+	is.Equal(len(feed.Entries), 2)
+	is.Equal(feed.Entries[0].Title, "Viltolycka") // newest accident should be first
+	is.Equal(feed.Entries[0].Links[0].Href, "https://example.com/api/roadaccidents/urn:ngsi-ld:RoadAccident:ra1")
+}
+
+func TestCityworksFeedIsSortedByDateModified(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/feeds/cityworks.atom", nil)
+	req.Host = "opendata.local"
+
+	NewRetrieveCityworksFeedHandler(context.Background(), FeedBase{}, defaultCityworksMock()).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK) // Request failed, status code not OK
+
+	feed := atomFeed{}
+	is.NoErr(xml.Unmarshal(w.Body.Bytes(), &feed))
+
+	is.Equal(len(feed.Entries), 2)
+	is.Equal(feed.Entries[0].ID, "urn:ngsi-ld:CityWork:citywork1") // most recently modified should be first
+	is.Equal(feed.Entries[0].Updated, "2022-04-21T08:00:00Z")
+	is.Equal(feed.Entries[1].Title, "Schaktarbete; ledningsbyte")
+	is.Equal(feed.Entries[1].Links[0].Href, "http://opendata.local/api/cityworks/urn:ngsi-ld:CityWork:citywork0") // base url should be derived from the request
+	is.Equal(w.Header().Get("Cache-Control"), "private, max-age=600")                                             // feeds with derived links should not be stored by shared caches
+}
+
+func TestThatForwardedHeadersAreOnlyTrustedWhenEnabled(t *testing.T) {
+	is := is.New(t)
+
+	forwardedRequest := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "/api/feeds/cityworks.atom", nil)
+		req.Host = "opendata.local"
+		req.Header.Set("X-Forwarded-Host", "public.example.com")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	NewRetrieveCityworksFeedHandler(context.Background(), FeedBase{}, defaultCityworksMock()).ServeHTTP(w, forwardedRequest())
+
+	feed := atomFeed{}
+	is.NoErr(xml.Unmarshal(w.Body.Bytes(), &feed))
+	is.Equal(feed.ID, "http://opendata.local/api/feeds/cityworks.atom") // forwarded headers should be ignored by default
+
+	w = httptest.NewRecorder()
+	NewRetrieveCityworksFeedHandler(context.Background(), FeedBase{TrustForwardedHeaders: true}, defaultCityworksMock()).ServeHTTP(w, forwardedRequest())
+
+	feed = atomFeed{}
+	is.NoErr(xml.Unmarshal(w.Body.Bytes(), &feed))
+	is.Equal(feed.ID, "https://public.example.com/api/feeds/cityworks.atom")
+
+	w = httptest.NewRecorder()
+	NewRetrieveCityworksFeedHandler(context.Background(), FeedBase{URL: "https://opendata.example.com", TrustForwardedHeaders: true}, defaultCityworksMock()).ServeHTTP(w, forwardedRequest())
+
+	feed = atomFeed{}
+	is.NoErr(xml.Unmarshal(w.Body.Bytes(), &feed))
+	is.Equal(feed.ID, "https://opendata.example.com/api/feeds/cityworks.atom") // a configured base url should always be used
+}
+
+func TestExerciseTrailsFeedContainsStatusChanges(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/feeds/exercisetrails.atom", nil)
+
+	svc := &exercisetrails.ExerciseTrailServiceMock{
+		GetStatusChangesFunc: func() []domain.StatusChange {
+			return []domain.StatusChange{
+				{ID: "urn:ngsi-ld:ExerciseTrail:t0", Name: "Kallaspåret", Status: "open", PreviousStatus: "closed", DateChanged: "2022-11-02T10:00:00Z"},
+				{ID: "urn:ngsi-ld:ExerciseTrail:t0", Name: "Kallaspåret", Status: "closed", PreviousStatus: "open", DateChanged: "2022-11-01T10:00:00Z"},
+			}
+		},
+	}
+
+	NewRetrieveExerciseTrailsFeedHandler(context.Background(), FeedBase{URL: "https://example.com"}, svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK) // Request failed, status code not OK
+
+	feed := atomFeed{}
+	is.NoErr(xml.Unmarshal(w.Body.Bytes(), &feed))
+
+	is.Equal(len(feed.Entries), 2)
+	is.Equal(feed.Entries[0].Title, "Kallaspåret: open")
+	is.Equal(feed.Entries[0].Summary, "Status changed from closed to open")
+	is.True(feed.Entries[0].ID != feed.Entries[1].ID) // each status change should have a unique entry id
+}
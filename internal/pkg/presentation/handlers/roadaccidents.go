@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"log/slog"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/roadaccidents"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
@@ -31,33 +38,434 @@ func NewRetrieveRoadAccidentByIDHandler(ctx context.Context, roadAccidentSvc roa
 			return
 		}
 
-		body, err := roadAccidentSvc.GetByID(roadAccidentID)
-
+		roadAccident, err := roadAccidentSvc.GetByID(roadAccidentID)
 		if err != nil {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
-		body = []byte("{\"data\": " + string(body) + "}")
+		responseBody, err := json.Marshal(roadAccident)
+		if err != nil {
+			log.Error("failed to marshal road accident to json", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		responseBody = []byte("{\"data\":" + string(responseBody) + "}")
 
 		w.Header().Add("Content-Type", "application/json")
 		w.Header().Add("Cache-Control", "max-age=600")
-		w.Write(body)
+		w.Write(responseBody)
 	})
 }
 
 func NewRetrieveRoadAccidentsHandler(ctx context.Context, roadAccidentSvc roadaccidents.RoadAccidentService) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
-		_, span := tracer.Start(r.Context(), "retrieve-road-accidents")
+		ctx, span := tracer.Start(r.Context(), "retrieve-road-accidents")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		from, to, err := getTimeParametersFromQuery(r)
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fields := urlValueAsSlice(r.URL.Query(), "fields")
+
+		accidents := roadAccidentSvc.GetAll(from, to)
+
+		const geoJSONContentType string = "application/geo+json"
+
+		acceptedContentType := "application/json"
+		if len(r.Header["Accept"]) > 0 {
+			acceptHeader := r.Header["Accept"][0]
+			if acceptHeader != "" && strings.HasPrefix(acceptHeader, geoJSONContentType) {
+				acceptedContentType = geoJSONContentType
+			}
+		}
+
+		if acceptedContentType == geoJSONContentType {
+			fields := append([]string{"type", "accidentdate"}, fields...)
+			accidentsGeoJSON, err := marshalRoadAccidentsToJSON(
+				accidents,
+				newRoadAccidentsGeoJSONMapper(newRoadAccidentsMapper(fields)),
+			)
+			if err != nil {
+				log.Error("failed to marshal road accidents list to geo json", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			response := "{\"type\":\"FeatureCollection\", \"features\": " + string(accidentsGeoJSON) + "}"
+
+			w.Header().Add("Content-Type", acceptedContentType)
+			w.Header().Add("Cache-Control", "max-age=3600")
+			w.Write([]byte(response))
+		} else {
+			fields := append([]string{"id", "accidentdate", "location"}, fields...)
+			accidentsJSON, err := marshalRoadAccidentsToJSON(accidents, newRoadAccidentsMapper(fields))
+			if err != nil {
+				log.Error("failed to marshal road accidents list to json", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			response := "{\"data\":" + string(accidentsJSON) + "}"
+
+			w.Header().Add("Content-Type", "application/json")
+			w.Header().Add("Cache-Control", "max-age=3600")
+			w.Write([]byte(response))
+		}
+	})
+}
+
+func NewRetrieveRoadAccidentStatisticsHandler(ctx context.Context, roadAccidentSvc roadaccidents.RoadAccidentService, districts *roadaccidents.Districts) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		ctx, span := tracer.Start(r.Context(), "retrieve-road-accident-statistics")
 		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-		body := roadAccidentSvc.GetAll()
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
 
-		roadAccidentJSON := "{\"data\": " + string(body) + "}"
+		opts, bbox, err := getStatisticsOptionsFromQuery(r.URL.Query(), districts)
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		from, to, err := getTimeParametersFromQuery(r)
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var accidents []domain.RoadAccidentDetails
+
+		if bbox != nil {
+			accidents = roadAccidentSvc.GetAllInBoundingBox(from, to, bbox.minLat, bbox.minLon, bbox.maxLat, bbox.maxLon)
+		} else {
+			accidents = roadAccidentSvc.GetAll(from, to)
+		}
+
+		buckets, err := roadaccidents.ComputeStatistics(accidents, opts)
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		const csvContentType string = "text/csv"
+
+		if len(r.Header["Accept"]) > 0 && strings.HasPrefix(r.Header["Accept"][0], csvContentType) {
+			w.Header().Add("Content-Type", csvContentType)
+			w.Header().Add("Cache-Control", "max-age=3600")
+			err = writeRoadAccidentStatisticsAsCSV(w, buckets, opts)
+			return
+		}
+
+		responseBody, err := json.Marshal(buckets)
+		if err != nil {
+			log.Error("failed to marshal road accident statistics to json", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		responseBody = []byte("{\"data\":" + string(responseBody) + "}")
 
 		w.Header().Add("Content-Type", "application/json")
 		w.Header().Add("Cache-Control", "max-age=3600")
-		w.Write([]byte(roadAccidentJSON))
+		w.Write(responseBody)
+	})
+}
+
+func NewRetrieveRoadAccidentHotspotsHandler(ctx context.Context, roadAccidentSvc roadaccidents.RoadAccidentService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		ctx, span := tracer.Start(r.Context(), "retrieve-road-accident-hotspots")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		opts, err := getHotspotOptionsFromQuery(r.URL.Query())
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		from, to, err := getTimeParametersFromQuery(r)
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		hotspots, err := roadaccidents.FindHotspots(roadAccidentSvc.GetAll(from, to), opts)
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		responseBody, err := marshalHotspotsToGeoJSON(hotspots)
+		if err != nil {
+			log.Error("failed to marshal road accident hotspots to geo json", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/geo+json")
+		w.Header().Add("Cache-Control", "max-age=3600")
+		w.Write(responseBody)
 	})
 }
+
+type RoadAccidentsMapperFunc func(*domain.RoadAccidentDetails) ([]byte, error)
+
+func newRoadAccidentsGeoJSONMapper(baseMapper RoadAccidentsMapperFunc) RoadAccidentsMapperFunc {
+	return func(ra *domain.RoadAccidentDetails) ([]byte, error) {
+		body, err := baseMapper(ra)
+		if err != nil {
+			return nil, err
+		}
+
+		var props any
+		json.Unmarshal(body, &props)
+
+		feature := struct {
+			Type       string `json:"type"`
+			ID         string `json:"id"`
+			Geometry   any    `json:"geometry"`
+			Properties any    `json:"properties"`
+		}{"Feature", ra.ID, ra.Location, props}
+
+		return json.Marshal(&feature)
+	}
+}
+
+func marshalRoadAccidentsToJSON(accidents []domain.RoadAccidentDetails, mapper RoadAccidentsMapperFunc) ([]byte, error) {
+	accidentsCount := len(accidents)
+
+	if accidentsCount == 0 {
+		return []byte("[]"), nil
+	}
+
+	backingBuffer := make([]byte, 0, 1024*1024)
+	buffer := bytes.NewBuffer(backingBuffer)
+
+	accidentBytes, err := mapper(&accidents[0])
+	if err != nil {
+		return nil, err
+	}
+
+	buffer.Write([]byte("["))
+	buffer.Write(accidentBytes)
+
+	for index := 1; index < accidentsCount; index++ {
+		accidentBytes, err := mapper(&accidents[index])
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write([]byte(","))
+		buffer.Write(accidentBytes)
+	}
+
+	buffer.Write([]byte("]"))
+
+	return buffer.Bytes(), nil
+}
+
+func newRoadAccidentsMapper(fields []string) RoadAccidentsMapperFunc {
+
+	omitempty := func(v string) any {
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	}
+
+	mappers := map[string]func(*domain.RoadAccidentDetails) (string, any){
+		"id":           func(ra *domain.RoadAccidentDetails) (string, any) { return "id", ra.ID },
+		"type":         func(ra *domain.RoadAccidentDetails) (string, any) { return "type", "RoadAccident" },
+		"description":  func(ra *domain.RoadAccidentDetails) (string, any) { return "description", ra.Description },
+		"location":     func(ra *domain.RoadAccidentDetails) (string, any) { return "location", ra.Location },
+		"accidentdate": func(ra *domain.RoadAccidentDetails) (string, any) { return "accidentDate", ra.AccidentDate },
+		"datecreated":  func(ra *domain.RoadAccidentDetails) (string, any) { return "dateCreated", omitempty(ra.DateCreated) },
+		"datemodified": func(ra *domain.RoadAccidentDetails) (string, any) { return "dateModified", omitempty(ra.DateModified) },
+		"status":       func(ra *domain.RoadAccidentDetails) (string, any) { return "status", omitempty(ra.Status) },
+	}
+
+	return func(ra *domain.RoadAccidentDetails) ([]byte, error) {
+		result := map[string]any{}
+		for _, f := range fields {
+			mapper, ok := mappers[f]
+			if !ok {
+				return nil, fmt.Errorf("unknown field: %s", f)
+			}
+			key, value := mapper(ra)
+			if propertyIsNotNil(value) {
+				result[key] = value
+			}
+		}
+
+		return json.Marshal(&result)
+	}
+}
+
+func getStatisticsOptionsFromQuery(query url.Values, districts *roadaccidents.Districts) (roadaccidents.StatisticsOptions, *boundingBox, error) {
+	opts := roadaccidents.StatisticsOptions{Period: roadaccidents.PeriodMonth}
+
+	if period := query.Get("period"); period != "" {
+		opts.Period = period
+	}
+
+	for _, group := range urlValueAsSlice(query, "groupBy") {
+		switch group {
+		case "status":
+			opts.ByStatus = true
+		case "grid":
+			opts.GridSize = 0.01
+
+			if gridSize := query.Get("gridSize"); gridSize != "" {
+				size, err := strconv.ParseFloat(gridSize, 64)
+				if err != nil || size <= 0 {
+					return opts, nil, fmt.Errorf("gridSize must be a positive number of degrees")
+				}
+				opts.GridSize = size
+			}
+		case "district":
+			if districts == nil {
+				return opts, nil, fmt.Errorf("grouping by district is not available")
+			}
+			opts.Districts = districts
+		default:
+			return opts, nil, fmt.Errorf("unknown grouping %q", group)
+		}
+	}
+
+	bbox, err := urlValueAsBBox(query, "bbox")
+
+	return opts, bbox, err
+}
+
+func getHotspotOptionsFromQuery(query url.Values) (roadaccidents.HotspotOptions, error) {
+	opts := roadaccidents.HotspotOptions{Radius: 250, MinCount: 3}
+
+	if radius := query.Get("radius"); radius != "" {
+		r, err := strconv.ParseFloat(radius, 64)
+		if err != nil || r <= 0 || r > 5000 {
+			return opts, fmt.Errorf("radius must be a number of metres between 0 and 5000")
+		}
+		opts.Radius = r
+	}
+
+	if minCount := query.Get("minCount"); minCount != "" {
+		n, err := strconv.Atoi(minCount)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("minCount must be a positive integer")
+		}
+		opts.MinCount = n
+	}
+
+	return opts, nil
+}
+
+func marshalHotspotsToGeoJSON(hotspots []roadaccidents.Hotspot) ([]byte, error) {
+	type geometry struct {
+		Type        string `json:"type"`
+		Coordinates any    `json:"coordinates"`
+	}
+
+	type properties struct {
+		Count     int      `json:"count"`
+		Centroid  geometry `json:"centroid"`
+		Accidents []string `json:"accidents"`
+	}
+
+	type feature struct {
+		Type       string     `json:"type"`
+		ID         string     `json:"id"`
+		Geometry   geometry   `json:"geometry"`
+		Properties properties `json:"properties"`
+	}
+
+	features := make([]feature, 0, len(hotspots))
+
+	for idx, h := range hotspots {
+		centroid := geometry{Type: "Point", Coordinates: h.Centroid}
+
+		f := feature{
+			Type:     "Feature",
+			ID:       fmt.Sprintf("hotspot:%d", idx+1),
+			Geometry: centroid,
+			Properties: properties{
+				Count:     h.Count,
+				Centroid:  centroid,
+				Accidents: h.AccidentIDs,
+			},
+		}
+
+		if h.Hull != nil {
+			f.Geometry = geometry{Type: "Polygon", Coordinates: [][][]float64{h.Hull}}
+		}
+
+		features = append(features, f)
+	}
+
+	return json.Marshal(struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}{"FeatureCollection", features})
+}
+
+func writeRoadAccidentStatisticsAsCSV(w io.Writer, buckets []roadaccidents.StatisticsBucket, opts roadaccidents.StatisticsOptions) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = ';'
+	csvWriter.UseCRLF = true
+
+	header := []string{"period"}
+	if opts.ByStatus {
+		header = append(header, "status")
+	}
+	if opts.GridSize > 0 {
+		header = append(header, "cell_min_lon", "cell_min_lat", "cell_max_lon", "cell_max_lat")
+	} else if opts.Districts != nil {
+		header = append(header, "district")
+	}
+	header = append(header, "count")
+
+	csvWriter.Write(header)
+
+	for _, b := range buckets {
+		record := []string{b.Period}
+
+		if opts.ByStatus {
+			record = append(record, *b.Status)
+		}
+
+		if opts.GridSize > 0 {
+			for _, c := range b.Cell {
+				record = append(record, strconv.FormatFloat(c, 'f', -1, 64))
+			}
+		} else if opts.Districts != nil {
+			district := ""
+			if b.District != nil {
+				district = *b.District
+			}
+			record = append(record, district)
+		}
+
+		record = append(record, strconv.Itoa(b.Count))
+		csvWriter.Write(record)
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/roadaccidents"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/matryer/is"
 )
 
@@ -17,12 +20,168 @@ func TestGetRoadAccidents(t *testing.T) {
 	req, _ := http.NewRequest(http.MethodGet, "/api/roadaccidents", nil)
 	req.Header.Add("Accept", "application/json")
 
-	roadAccidentSvc := &roadaccidents.RoadAccidentServiceMock{
-		GetAllFunc: func() []byte { return nil },
-	}
+	roadAccidentSvc := defaultRoadAccidentsMock()
 
 	NewRetrieveRoadAccidentsHandler(context.Background(), roadAccidentSvc).ServeHTTP(w, req)
 
 	is.Equal(w.Code, http.StatusOK)                 // Request failed, status code not OK
 	is.Equal(len(roadAccidentSvc.GetAllCalls()), 1) // should have been called once
+	is.Equal(w.Body.String(), `{"data":[{"accidentDate":"2022-05-01T07:00:00Z","id":"urn:ngsi-ld:RoadAccident:ra0","location":{"type":"Point","coordinates":[17,62]}},{"accidentDate":"2022-06-01T07:00:00Z","id":"urn:ngsi-ld:RoadAccident:ra1","location":{"type":"Point","coordinates":[17.1,62.1]}}]}`)
+}
+
+func TestGetRoadAccidentsAsGeoJSONWithinTimespan(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/roadaccidents", NewRetrieveRoadAccidentsHandler(context.Background(), roadAccidentSvc))
+	response, responseBody := newGetRequest(is, ts, "application/geo+json", "/roadaccidents?fields=status&from=2022-05-20T00:00:00Z&to=2022-06-20T00:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(responseBody, `{"type":"FeatureCollection", "features": [{"type":"Feature","id":"urn:ngsi-ld:RoadAccident:ra1","geometry":{"type":"Point","coordinates":[17.1,62.1]},"properties":{"accidentDate":"2022-06-01T07:00:00Z","status":"solved","type":"RoadAccident"}}]}`)
+}
+
+func TestGetRoadAccidentsWithInvalidTimespan(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/roadaccidents", NewRetrieveRoadAccidentsHandler(context.Background(), roadAccidentSvc))
+	response, _ := newGetRequest(is, ts, "application/json", "/roadaccidents?from=yesterday", nil)
+
+	is.Equal(response.StatusCode, http.StatusBadRequest) // an invalid time should be rejected
+	is.Equal(len(roadAccidentSvc.GetAllCalls()), 0)
+}
+
+func TestGetRoadAccidentsUntilATime(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/roadaccidents", NewRetrieveRoadAccidentsHandler(context.Background(), roadAccidentSvc))
+	response, _ := newGetRequest(is, ts, "application/json", "/roadaccidents?to=2022-05-20T00:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK)
+	is.True(roadAccidentSvc.GetAllCalls()[0].From.IsZero()) // a lone to should leave the start open
+	is.Equal(roadAccidentSvc.GetAllCalls()[0].To, time.Date(2022, 5, 20, 0, 0, 0, 0, time.UTC))
+}
+
+func TestGetRoadAccidentsWithReversedTimespan(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/roadaccidents", NewRetrieveRoadAccidentsHandler(context.Background(), roadAccidentSvc))
+	response, _ := newGetRequest(is, ts, "application/json", "/roadaccidents?from=2022-06-20T00:00:00Z&to=2022-05-20T00:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusBadRequest) // from after to should be rejected
+	is.Equal(len(roadAccidentSvc.GetAllCalls()), 0)
+}
+
+func TestGetRoadAccidentByID(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/{id}", NewRetrieveRoadAccidentByIDHandler(context.Background(), roadAccidentSvc))
+	response, responseBody := newGetRequest(is, ts, "application/json", "/urn:ngsi-ld:RoadAccident:ra0", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(responseBody, `{"data":{"id":"urn:ngsi-ld:RoadAccident:ra0","description":"Singelolycka","location":{"type":"Point","coordinates":[17,62]},"accidentDate":"2022-05-01T07:00:00Z","dateCreated":"2022-05-01T08:00:00Z","status":"onGoing"}}`)
+}
+
+func defaultRoadAccidentsMock() *roadaccidents.RoadAccidentServiceMock {
+	accidents := []domain.RoadAccidentDetails{
+		{
+			ID:           "urn:ngsi-ld:RoadAccident:ra0",
+			Description:  "Singelolycka",
+			Location:     *domain.NewPoint(62.0, 17.0),
+			AccidentDate: "2022-05-01T07:00:00Z",
+			DateCreated:  "2022-05-01T08:00:00Z",
+			Status:       "onGoing",
+		},
+		{
+			ID:           "urn:ngsi-ld:RoadAccident:ra1",
+			Description:  "Viltolycka",
+			Location:     *domain.NewPoint(62.1, 17.1),
+			AccidentDate: "2022-06-01T07:00:00Z",
+			DateCreated:  "2022-06-01T08:00:00Z",
+			Status:       "solved",
+		},
+	}
+
+	return &roadaccidents.RoadAccidentServiceMock{
+		GetAllFunc: func(from, to time.Time) []domain.RoadAccidentDetails {
+			result := []domain.RoadAccidentDetails{}
+			for _, ra := range accidents {
+				if ra.OccurredWithin(from, to) {
+					result = append(result, ra)
+				}
+			}
+			return result
+		},
+		GetAllInBoundingBoxFunc: func(from, to time.Time, minLat, minLon, maxLat, maxLon float64) []domain.RoadAccidentDetails {
+			result := []domain.RoadAccidentDetails{}
+			for _, ra := range accidents {
+				lon, lat := ra.Location.Coordinates[0], ra.Location.Coordinates[1]
+				if ra.OccurredWithin(from, to) && lat >= minLat && lat <= maxLat && lon >= minLon && lon <= maxLon {
+					result = append(result, ra)
+				}
+			}
+			return result
+		},
+		GetByIDFunc: func(id string) (*domain.RoadAccidentDetails, error) {
+			for idx := range accidents {
+				if accidents[idx].ID == id {
+					return &accidents[idx], nil
+				}
+			}
+			return nil, fmt.Errorf("no such road accident")
+		},
+	}
+}
+
+func TestGetRoadAccidentStatistics(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/stats", NewRetrieveRoadAccidentStatisticsHandler(context.Background(), roadAccidentSvc, nil))
+	response, responseBody := newGetRequest(is, ts, "application/json", "/stats?period=month&groupBy=status", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(responseBody, `{"data":[{"period":"2022-05","status":"onGoing","count":1},{"period":"2022-06","status":"solved","count":1}]}`)
+}
+
+func TestGetRoadAccidentStatisticsAsCSV(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/stats", NewRetrieveRoadAccidentStatisticsHandler(context.Background(), roadAccidentSvc, nil))
+	response, responseBody := newGetRequest(is, ts, "text/csv", "/stats?period=year&groupBy=grid&gridSize=0.5&bbox=17.0,62.0,17.05,62.05", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(response.Header.Get("Content-Type"), "text/csv")
+	is.Equal(responseBody, "period;cell_min_lon;cell_min_lat;cell_max_lon;cell_max_lat;count\r\n2022;17;62;17.5;62.5;1\r\n")
+}
+
+func TestGetRoadAccidentStatisticsWithInvalidGrouping(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/stats", NewRetrieveRoadAccidentStatisticsHandler(context.Background(), roadAccidentSvc, nil))
+
+	for _, query := range []string{"groupBy=district", "groupBy=colour", "period=decade", "groupBy=grid&gridSize=-1"} {
+		response, _ := newGetRequest(is, ts, "application/json", "/stats?"+query, nil)
+		is.Equal(response.StatusCode, http.StatusBadRequest) // invalid statistics options should be rejected
+	}
+}
+
+func TestGetRoadAccidentHotspots(t *testing.T) {
+	is, r, ts := setupTest(t)
+	roadAccidentSvc := defaultRoadAccidentsMock()
+
+	r.Get("/hotspots", NewRetrieveRoadAccidentHotspotsHandler(context.Background(), roadAccidentSvc))
+	response, responseBody := newGetRequest(is, ts, "application/geo+json", "/hotspots?radius=5000&minCount=1&from=2022-05-20T00:00:00Z", nil)
+
+	is.Equal(response.StatusCode, http.StatusOK) // Request failed, status code not OK
+	is.Equal(response.Header.Get("Content-Type"), "application/geo+json")
+	is.Equal(responseBody, `{"type":"FeatureCollection","features":[{"type":"Feature","id":"hotspot:1","geometry":{"type":"Point","coordinates":[17.1,62.1]},"properties":{"count":1,"centroid":{"type":"Point","coordinates":[17.1,62.1]},"accidents":["urn:ngsi-ld:RoadAccident:ra1"]}}]}`)
+
+	response, _ = newGetRequest(is, ts, "application/geo+json", "/hotspots?minCount=0", nil)
+	is.Equal(response.StatusCode, http.StatusBadRequest) // an invalid minimum count should be rejected
 }
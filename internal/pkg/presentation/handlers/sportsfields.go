@@ -67,7 +67,19 @@ func NewRetrieveSportsFieldsHandler(ctx context.Context, sfsvc sportsfields.Spor
 		categories := urlValueAsSlice(r.URL.Query(), "categories")
 		fields := urlValueAsSlice(r.URL.Query(), "fields")
 
-		sportsfields := sfsvc.GetAll(categories)
+		lat, lon, maxDistance, nearPoint, err := getNearPointFromQuery(r.URL.Query())
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var sportsfields []domain.SportsField
+		if nearPoint {
+			sportsfields = sfsvc.GetAllNearPoint(lat, lon, maxDistance, categories)
+		} else {
+			sportsfields = sfsvc.GetAll(categories)
+		}
 
 		const geoJSONContentType string = "application/geo+json"
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	services "github.com/diwise/api-opendata/internal/pkg/application/services/sportsfields"
@@ -66,6 +67,21 @@ func TestGetSportsFieldsAsGeoJSON(t *testing.T) {
 	is.Equal(responseBody, sportsfieldGeoJSON)
 }
 
+func TestGetSportsFieldsNearAPoint(t *testing.T) {
+	is, _, rw := setup(t)
+	svc := defaultSportsFieldsMock()
+	req, err := http.NewRequest("GET", "?coordinates=17.43,62.42", nil)
+	is.NoErr(err)
+
+	NewRetrieveSportsFieldsHandler(context.Background(), svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(len(svc.GetAllNearPointCalls()), 1)
+	is.Equal(svc.GetAllNearPointCalls()[0].MaxDistance, 5000) // the distance should default to 5000 metres
+	is.True(strings.Contains(rw.Body.String(), `"id":"id0"`))
+	is.True(!strings.Contains(rw.Body.String(), `"id":"id1"`))
+}
+
 func defaultSportsFieldsMock() *services.SportsFieldServiceMock {
 	dlp := "2019-10-15T16:15:32Z"
 	sf0 := domain.SportsField{
@@ -113,6 +129,9 @@ func defaultSportsFieldsMock() *services.SportsFieldServiceMock {
 		GetAllFunc: func(c []string) []domain.SportsField {
 			return list
 		},
+		GetAllNearPointFunc: func(lat, lon float64, maxDistance int, c []string) []domain.SportsField {
+			return list[:1]
+		},
 		GetByIDFunc: func(id string) (*domain.SportsField, error) {
 			return &sf0, nil
 		},
@@ -68,7 +68,19 @@ func NewRetrieveSportsVenuesHandler(ctx context.Context, sfsvc sportsvenues.Spor
 		categories := urlValueAsSlice(r.URL.Query(), "categories")
 		fields := urlValueAsSlice(r.URL.Query(), "fields")
 
-		sportsvenues := sfsvc.GetAll(categories)
+		lat, lon, maxDistance, nearPoint, err := getNearPointFromQuery(r.URL.Query())
+		if err != nil {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var sportsvenues []domain.SportsVenue
+		if nearPoint {
+			sportsvenues = sfsvc.GetAllNearPoint(lat, lon, maxDistance, categories)
+		} else {
+			sportsvenues = sfsvc.GetAll(categories)
+		}
 
 		const geoJSONContentType string = "application/geo+json"
 
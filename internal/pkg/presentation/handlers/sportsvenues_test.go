@@ -54,6 +54,19 @@ func TestGetSportsVenuesAsGeoJSON(t *testing.T) {
 	is.Equal(responseBody, sportsvenueGeoJSON)
 }
 
+func TestGetSportsVenuesWithInvalidCoordinates(t *testing.T) {
+	is, _, rw := setup(t)
+	svc := defaultSportsVenuesMock()
+	req, err := http.NewRequest("GET", "?coordinates=17.43", nil)
+	is.NoErr(err)
+
+	NewRetrieveSportsVenuesHandler(context.Background(), svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusBadRequest)
+	is.Equal(len(svc.GetAllCalls()), 0)
+	is.Equal(len(svc.GetAllNearPointCalls()), 0)
+}
+
 func defaultSportsVenuesMock() *services.SportsVenueServiceMock {
 
 	sf0 := domain.SportsVenue{
@@ -99,6 +112,9 @@ func defaultSportsVenuesMock() *services.SportsVenueServiceMock {
 		GetAllFunc: func(c []string) []domain.SportsVenue {
 			return list
 		},
+		GetAllNearPointFunc: func(lat, lon float64, maxDistance int, c []string) []domain.SportsVenue {
+			return list[:1]
+		},
 		GetByIDFunc: func(id string) (*domain.SportsVenue, error) {
 			return &sf0, nil
 		},
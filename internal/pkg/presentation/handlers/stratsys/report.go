@@ -0,0 +1,234 @@
+package stratsys
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ReportSummary is the metadata of a published report, as listed by /api/stratsys/publishedreports
+type ReportSummary struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	PublishedAt string `json:"publishedAt,omitempty"`
+}
+
+// Report is a published report with its nodes flattened in document order. The tree
+// structure is kept through the parent id of each node.
+type Report struct {
+	ReportSummary
+	Nodes []ReportNode `json:"nodes"`
+}
+
+type ReportNode struct {
+	ID          string      `json:"id"`
+	ParentID    *string     `json:"parentId,omitempty"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Indicators  []Indicator `json:"indicators"`
+}
+
+type Indicator struct {
+	ID     string           `json:"id"`
+	Name   string           `json:"name"`
+	Unit   string           `json:"unit,omitempty"`
+	Values []IndicatorValue `json:"values"`
+}
+
+type IndicatorValue struct {
+	Period Period   `json:"period"`
+	Value  *float64 `json:"value"`
+	Target *float64 `json:"target,omitempty"`
+}
+
+type Period struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	StartDate string `json:"startDate,omitempty"`
+	EndDate   string `json:"endDate,omitempty"`
+}
+
+// parseReportSummaries parses the list of published reports returned by the v2 api
+func parseReportSummaries(body []byte) ([]ReportSummary, error) {
+	dtos := []reportDTO{}
+
+	if err := json.Unmarshal(body, &dtos); err != nil {
+		return nil, fmt.Errorf("failed to parse published reports: %w", err)
+	}
+
+	summaries := make([]ReportSummary, 0, len(dtos))
+	for _, dto := range dtos {
+		summaries = append(summaries, dto.summary())
+	}
+
+	return summaries, nil
+}
+
+// parseReport parses a single published report returned by the v2 api
+func parseReport(body []byte) (*Report, error) {
+	dto := reportDTO{}
+
+	if err := json.Unmarshal(body, &dto); err != nil {
+		return nil, fmt.Errorf("failed to parse published report: %w", err)
+	}
+
+	report := &Report{ReportSummary: dto.summary(), Nodes: []ReportNode{}}
+
+	var flatten func(nodes []nodeDTO, parentID *string)
+	flatten = func(nodes []nodeDTO, parentID *string) {
+		for _, n := range nodes {
+			node := ReportNode{
+				ID:          string(n.ID),
+				ParentID:    parentID,
+				Name:        n.Name,
+				Description: n.Description,
+				Indicators:  make([]Indicator, 0, len(n.Indicators)),
+			}
+
+			for _, i := range n.Indicators {
+				indicator := Indicator{ID: string(i.ID), Name: i.Name, Unit: i.Unit, Values: make([]IndicatorValue, 0, len(i.Values))}
+
+				for _, v := range i.Values {
+					indicator.Values = append(indicator.Values, IndicatorValue{
+						Period: Period{
+							ID:        string(v.Period.ID),
+							Name:      v.Period.Name,
+							StartDate: v.Period.StartDate,
+							EndDate:   v.Period.EndDate,
+						},
+						Value:  v.Value,
+						Target: v.Target,
+					})
+				}
+
+				node.Indicators = append(node.Indicators, indicator)
+			}
+
+			report.Nodes = append(report.Nodes, node)
+
+			id := node.ID
+			flatten(n.Nodes, &id)
+		}
+	}
+
+	flatten(dto.Nodes, nil)
+
+	return report, nil
+}
+
+func writeReportSummariesAsCSV(w io.Writer, summaries []ReportSummary) error {
+	csvWriter := newCSVWriter(w)
+	csvWriter.Write([]string{"id", "name", "description", "published_at"})
+
+	for _, s := range summaries {
+		csvWriter.Write([]string{s.ID, s.Name, s.Description, s.PublishedAt})
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// writeReportAsCSV writes one row per indicator value in the report
+func writeReportAsCSV(w io.Writer, report *Report) error {
+	csvWriter := newCSVWriter(w)
+	csvWriter.Write([]string{
+		"report_id", "node_id", "node_name", "indicator_id", "indicator_name", "unit",
+		"period", "period_start", "period_end", "value", "target",
+	})
+
+	for _, n := range report.Nodes {
+		for _, i := range n.Indicators {
+			for _, v := range i.Values {
+				csvWriter.Write([]string{
+					report.ID, n.ID, n.Name, i.ID, i.Name, i.Unit,
+					v.Period.Name, v.Period.StartDate, v.Period.EndDate,
+					formatOptionalFloat(v.Value), formatOptionalFloat(v.Target),
+				})
+			}
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func newCSVWriter(w io.Writer) *csv.Writer {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = ';'
+	csvWriter.UseCRLF = true
+	return csvWriter
+}
+
+func formatOptionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+type reportDTO struct {
+	ID          flexibleID `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	PublishedAt string     `json:"publishedAt"`
+	Nodes       []nodeDTO  `json:"nodes"`
+}
+
+func (dto reportDTO) summary() ReportSummary {
+	return ReportSummary{
+		ID:          string(dto.ID),
+		Name:        dto.Name,
+		Description: dto.Description,
+		PublishedAt: dto.PublishedAt,
+	}
+}
+
+type nodeDTO struct {
+	ID          flexibleID `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Indicators  []struct {
+		ID     flexibleID `json:"id"`
+		Name   string     `json:"name"`
+		Unit   string     `json:"unit"`
+		Values []struct {
+			Period struct {
+				ID        flexibleID `json:"id"`
+				Name      string     `json:"name"`
+				StartDate string     `json:"startDate"`
+				EndDate   string     `json:"endDate"`
+			} `json:"period"`
+			Value  *float64 `json:"value"`
+			Target *float64 `json:"target"`
+		} `json:"values"`
+	} `json:"indicators"`
+	Nodes []nodeDTO `json:"nodes"`
+}
+
+// flexibleID accepts ids that are returned as either numbers or strings
+type flexibleID string
+
+func (id *flexibleID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = flexibleID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+
+	*id = flexibleID(n.String())
+	return nil
+}
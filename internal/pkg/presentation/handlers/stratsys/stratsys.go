@@ -1,15 +1,16 @@
 package stratsys
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"log/slog"
 
@@ -23,15 +24,56 @@ import (
 
 var tracer = otel.Tracer("api-opendata/api/stratsys")
 
-func NewRetrieveStratsysReportsHandler(ctx context.Context, companyCode, clientID, scope, loginUrl, defaultUrl string) http.HandlerFunc {
-	logger := logging.GetFromContext(ctx)
+// Client retrieves published reports from Stratsys. Access tokens are reused until
+// shortly before they expire, and successful responses are cached for a configurable
+// time so that reports can still be served if Stratsys is unreachable.
+type Client struct {
+	companyCode string
+	clientID    string
+	scope       string
+	loginUrl    string
+	defaultUrl  string
+	cacheTTL    time.Duration
+
+	now func() time.Time
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	responses   map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	response  stratsysResponse
+	fetchedAt time.Time
+}
+
+// tokenExpiryMargin is how long before its expiry a cached token is replaced
+const tokenExpiryMargin time.Duration = 1 * time.Minute
 
+// maxStaleAge is how long after the cache ttl a response may still be served when
+// Stratsys is unavailable, after which it is evicted from the cache
+const maxStaleAge time.Duration = 24 * time.Hour
+
+func NewClient(companyCode, clientID, scope, loginUrl, defaultUrl string, cacheTTL time.Duration) (*Client, error) {
 	if companyCode == "" || clientID == "" || scope == "" || loginUrl == "" || defaultUrl == "" {
-		logger.Error("all STRATSYS environment variables need to be set")
-		os.Exit(1)
+		return nil, fmt.Errorf("all STRATSYS environment variables need to be set")
 	}
 
-	loginUrl = fmt.Sprintf("%s/%s/connect/token", loginUrl, companyCode)
+	return &Client{
+		companyCode: companyCode,
+		clientID:    clientID,
+		scope:       scope,
+		loginUrl:    fmt.Sprintf("%s/%s/connect/token", loginUrl, companyCode),
+		defaultUrl:  defaultUrl,
+		cacheTTL:    cacheTTL,
+		now:         time.Now,
+		responses:   map[string]cachedResponse{},
+	}, nil
+}
+
+func NewRetrieveStratsysReportsHandler(ctx context.Context, client *Client) http.HandlerFunc {
+	logger := logging.GetFromContext(ctx)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -41,48 +83,182 @@ func NewRetrieveStratsysReportsHandler(ctx context.Context, companyCode, clientI
 
 		_, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logger, ctx)
 
-		token, err := getTokenBearer(ctx, clientID, scope, loginUrl)
+		path := "/api/publishedreports/v2"
+
+		reportId := chi.URLParam(r, "id")
+		if reportId != "" {
+			path = path + "/" + url.PathEscape(reportId)
+		}
+
+		// only responses that can be parsed are cached, so that an unexpected response
+		// from Stratsys does not replace a report that can still be served
+		validate := func(body []byte) error {
+			_, err := parseReportSummaries(body)
+			return err
+		}
+
+		if reportId != "" {
+			validate = func(body []byte) error {
+				_, err := parseReport(body)
+				return err
+			}
+		}
+
+		response, stale, err := client.get(ctx, path, validate)
 		if err != nil {
-			log.Error("failed to retrieve token", slog.String("err", err.Error()))
-			w.WriteHeader(http.StatusUnauthorized)
+			log.Error("failed to get reports", slog.String("err", err.Error()))
+			w.WriteHeader(response.code)
 			return
 		}
 
-		reportId := chi.URLParam(r, "id")
+		var report *Report
+		var summaries []ReportSummary
 
 		if reportId != "" {
-			response, err := getReportById(ctx, reportId, defaultUrl, companyCode, token)
-			if err != nil {
-				log.Error("failed to get reports", slog.String("err", err.Error()))
-				w.WriteHeader(response.code)
-				return
-			}
-			if response.contentType != "" {
-				w.Header().Add("Content-Type", response.contentType)
-			}
-			w.Write(response.body)
+			report, err = parseReport(response.body)
 		} else {
-			response, err := getReports(ctx, defaultUrl, companyCode, token)
-			if err != nil {
-				log.Error("failed to get reports", slog.String("err", err.Error()))
-				w.WriteHeader(response.code)
-				return
+			summaries, err = parseReportSummaries(response.body)
+		}
+
+		if err != nil {
+			log.Error("unexpected response from stratsys", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body := &bytes.Buffer{}
+		contentType := "application/json"
+
+		if strings.HasPrefix(r.Header.Get("Accept"), "text/csv") {
+			contentType = "text/csv"
+
+			if report != nil {
+				err = writeReportAsCSV(body, report)
+			} else {
+				err = writeReportSummariesAsCSV(body, summaries)
 			}
-			if response.contentType != "" {
-				w.Header().Add("Content-Type", response.contentType)
+		} else {
+			var data any = summaries
+			if report != nil {
+				data = report
 			}
-			w.Write(response.body)
+
+			var responseBody []byte
+			responseBody, err = json.Marshal(struct {
+				Data any `json:"data"`
+			}{data})
+			body.Write(responseBody)
+		}
+
+		if err != nil {
+			log.Error("failed to write reports", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 
+		if stale {
+			w.Header().Add("Warning", `110 - "Response is Stale"`)
+		}
+
+		w.Header().Add("Content-Type", contentType)
+		w.Write(body.Bytes())
 	})
 }
 
-func getReportById(ctx context.Context, id, url, companyCode, token string) (stratsysResponse, error) {
-	return getReportOrReports(ctx, url+"/api/publishedreports/v2/"+id, companyCode, token)
+// get returns the response for path from the cache if it is younger than the cache ttl,
+// and otherwise requests it from Stratsys. Responses are only cached if their body passes
+// validate. If Stratsys can not be reached, fails or returns a body that does not pass
+// validate, a previously cached response that is no older than the cache ttl plus
+// maxStaleAge is returned instead and stale is set to true.
+func (c *Client) get(ctx context.Context, path string, validate func([]byte) error) (response stratsysResponse, stale bool, err error) {
+	c.mu.Lock()
+	c.evictExpiredResponses()
+	cached, found := c.responses[path]
+	c.mu.Unlock()
+
+	if found && c.now().Sub(cached.fetchedAt) < c.cacheTTL {
+		return cached.response, false, nil
+	}
+
+	token, err := c.getToken(ctx)
+	if err != nil {
+		if found {
+			return cached.response, true, nil
+		}
+		return stratsysResponse{code: http.StatusBadGateway}, false, fmt.Errorf("failed to retrieve token: %w", err)
+	}
+
+	response, err = getReportOrReports(ctx, c.defaultUrl+path, c.companyCode, token)
+	if err != nil {
+		if response.code == http.StatusUnauthorized {
+			c.invalidateToken(token)
+		}
+
+		// client errors such as a removed report are passed on, while the cached
+		// response is used when Stratsys is unavailable
+		if found && (response.code >= http.StatusInternalServerError || response.code == http.StatusUnauthorized) {
+			return cached.response, true, nil
+		}
+
+		return response, false, err
+	}
+
+	if err = validate(response.body); err != nil {
+		if found {
+			return cached.response, true, nil
+		}
+
+		return stratsysResponse{code: http.StatusBadGateway}, false, fmt.Errorf("unexpected response from stratsys: %w", err)
+	}
+
+	c.mu.Lock()
+	c.responses[path] = cachedResponse{response: response, fetchedAt: c.now()}
+	c.mu.Unlock()
+
+	return response, false, nil
 }
 
-func getReports(ctx context.Context, url, companyCode, token string) (stratsysResponse, error) {
-	return getReportOrReports(ctx, url+"/api/publishedreports/v2", companyCode, token)
+// evictExpiredResponses removes the cached responses that are too old to be served even
+// when Stratsys is unavailable. It must be called with the mutex held.
+func (c *Client) evictExpiredResponses() {
+	now := c.now()
+
+	for path, cached := range c.responses {
+		if now.Sub(cached.fetchedAt) >= c.cacheTTL+maxStaleAge {
+			delete(c.responses, path)
+		}
+	}
+}
+
+func (c *Client) getToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if c.token != "" && c.now().Before(c.tokenExpiry.Add(-tokenExpiryMargin)) {
+		defer c.mu.Unlock()
+		return c.token, nil
+	}
+	c.mu.Unlock()
+
+	token, err := getTokenBearer(ctx, c.clientID, c.scope, c.loginUrl)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token.AccessToken
+	c.tokenExpiry = c.now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return c.token, nil
+}
+
+func (c *Client) invalidateToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == token {
+		c.token = ""
+	}
 }
 
 func getReportOrReports(ctx context.Context, url, companyCode, token string) (stratsysResponse, error) {
@@ -110,7 +286,7 @@ func getReportOrReports(ctx context.Context, url, companyCode, token string) (st
 		return ssresp, fmt.Errorf("request failed, status code not ok: %d", resp.StatusCode)
 	}
 
-	ssresp.body, err = ioutil.ReadAll(resp.Body)
+	ssresp.body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		ssresp.code = http.StatusInternalServerError
 		return ssresp, fmt.Errorf("failed to read response body: %s", err.Error())
@@ -119,7 +295,7 @@ func getReportOrReports(ctx context.Context, url, companyCode, token string) (st
 	return ssresp, nil
 }
 
-func getTokenBearer(ctx context.Context, clientID, scope, authUrl string) (string, error) {
+func getTokenBearer(ctx context.Context, clientID, scope, authUrl string) (tokenResponse, error) {
 	var err error
 
 	httpClient := http.Client{
@@ -139,7 +315,7 @@ func getTokenBearer(ctx context.Context, clientID, scope, authUrl string) (strin
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, authUrl, body)
 	if err != nil {
 		err = fmt.Errorf("failed to create new token request: %w", err)
-		return "", err
+		return tokenResponse{}, err
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -147,19 +323,19 @@ func getTokenBearer(ctx context.Context, clientID, scope, authUrl string) (strin
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		err = fmt.Errorf("failed to get token: %w", err)
-		return "", err
+		return tokenResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("unexpected response from token request: %d != %d", resp.StatusCode, http.StatusOK)
-		return "", err
+		return tokenResponse{}, err
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		err = fmt.Errorf("failed to read response body: %w", err)
-		return "", err
+		return tokenResponse{}, err
 	}
 
 	token := tokenResponse{}
@@ -167,10 +343,10 @@ func getTokenBearer(ctx context.Context, clientID, scope, authUrl string) (strin
 	err = json.Unmarshal(bodyBytes, &token)
 	if err != nil {
 		err = fmt.Errorf("failed to unmarshal access token json: %w", err)
-		return "", err
+		return tokenResponse{}, err
 	}
 
-	return token.AccessToken, nil
+	return token, nil
 }
 
 type stratsysResponse struct {
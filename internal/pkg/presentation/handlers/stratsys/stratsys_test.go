@@ -5,8 +5,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/matryer/is"
 )
 
@@ -14,14 +17,14 @@ func TestThatWeGetATokenFromStratsysHandler(t *testing.T) {
 	is := is.New(t)
 	server := setupTokenMockService(http.StatusOK, accessTokenResp)
 
-	loginUrl := server.URL + "/token"
-	defaultUrl := server.URL
+	client, err := NewClient("companyCode", "clientId", "scope", server.URL+"/token", server.URL, time.Minute)
+	is.NoErr(err)
 
 	w := httptest.NewRecorder()
-	req, err := http.NewRequest(http.MethodPost, loginUrl, nil)
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/stratsys/publishedreports", nil)
 	is.NoErr(err)
 
-	NewRetrieveStratsysReportsHandler(context.Background(), "companyCode", "clientId", "scope", loginUrl, defaultUrl).ServeHTTP(w, req)
+	NewRetrieveStratsysReportsHandler(context.Background(), client).ServeHTTP(w, req)
 
 	is.Equal(w.Code, http.StatusOK)
 }
@@ -30,17 +33,288 @@ func TestThatWeCanRetrieveASingleReportFromStratsysHandler(t *testing.T) {
 	is := is.New(t)
 	server := setupTokenMockService(http.StatusOK, accessTokenResp)
 
-	loginUrl := server.URL + "/token"
-	defaultUrl := server.URL
+	client, err := NewClient("companyCode", "clientId", "scope", server.URL+"/token", server.URL, time.Minute)
+	is.NoErr(err)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/stratsys/1337", nil)
 	is.NoErr(err)
 
-	NewRetrieveStratsysReportsHandler(context.Background(), "companyCode", "clientId", "scope", loginUrl, defaultUrl).ServeHTTP(w, req)
+	NewRetrieveStratsysReportsHandler(context.Background(), client).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Header().Get("Content-Type"), "application/json")
+}
+
+func TestThatNewClientRequiresAllSettings(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewClient("companyCode", "", "scope", "http://login", "http://default", time.Minute)
+	is.True(err != nil) // a missing client id should be reported
+}
+
+func TestThatTokenIsReusedUntilShortlyBeforeExpiry(t *testing.T) {
+	is := is.New(t)
+	upstream := newStratsysUpstream()
+	defer upstream.Close()
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := NewClient("companyCode", "clientId", "scope", upstream.URL, upstream.URL, 0)
+	client.now = func() time.Time { return now }
+
+	_, _, err := client.get(context.Background(), "/api/publishedreports/v2", acceptAny)
+	is.NoErr(err)
+	_, _, err = client.get(context.Background(), "/api/publishedreports/v2", acceptAny)
+	is.NoErr(err)
+	is.Equal(upstream.tokenRequests.Load(), int32(1)) // the token should be reused
+	is.Equal(upstream.reportRequests.Load(), int32(2))
+
+	now = now.Add(3600*time.Second - tokenExpiryMargin)
+
+	_, _, err = client.get(context.Background(), "/api/publishedreports/v2", acceptAny)
+	is.NoErr(err)
+	is.Equal(upstream.tokenRequests.Load(), int32(2)) // a token that is about to expire should be replaced
+}
+
+func TestThatReportsAreCachedAndServedStaleWhenStratsysFails(t *testing.T) {
+	is := is.New(t)
+	upstream := newStratsysUpstream()
+	defer upstream.Close()
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := NewClient("companyCode", "clientId", "scope", upstream.URL, upstream.URL, 10*time.Minute)
+	client.now = func() time.Time { return now }
+
+	r := chi.NewRouter()
+	r.Get("/api/stratsys/publishedreports/{id}", NewRetrieveStratsysReportsHandler(context.Background(), client))
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports/1337", nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	is.Equal(get().Body.String(), `{"data":{"id":"1337","name":"Report 1337","nodes":[]}}`)
+	is.Equal(get().Code, http.StatusOK)
+	is.Equal(upstream.reportRequests.Load(), int32(1)) // the second request should be served from the cache
+
+	upstream.failing.Store(true)
+	now = now.Add(11 * time.Minute)
+
+	w := get()
+	is.Equal(w.Code, http.StatusOK) // a stale report should be served when stratsys fails
+	is.Equal(w.Body.String(), `{"data":{"id":"1337","name":"Report 1337","nodes":[]}}`)
+	is.True(w.Header().Get("Warning") != "")
+	is.Equal(upstream.reportRequests.Load(), int32(2))
+}
+
+func TestThatErrorsArePassedOnWhenNothingIsCached(t *testing.T) {
+	is := is.New(t)
+	upstream := newStratsysUpstream()
+	defer upstream.Close()
+	upstream.failing.Store(true)
+
+	client, _ := NewClient("companyCode", "clientId", "scope", upstream.URL, upstream.URL, 10*time.Minute)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports", nil)
+
+	NewRetrieveStratsysReportsHandler(context.Background(), client).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusServiceUnavailable)
+}
+
+func TestThatTokenFailuresAreReportedAsBadGateway(t *testing.T) {
+	is := is.New(t)
+	upstream := newStratsysUpstream()
+	defer upstream.Close()
+	upstream.tokenFailing.Store(true)
+
+	client, _ := NewClient("companyCode", "clientId", "scope", upstream.URL, upstream.URL, 10*time.Minute)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports", nil)
+
+	NewRetrieveStratsysReportsHandler(context.Background(), client).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadGateway) // a failing token request is an upstream error, not a client error
+}
+
+func TestThatExpiredResponsesAreEvicted(t *testing.T) {
+	is := is.New(t)
+	upstream := newStratsysUpstream()
+	defer upstream.Close()
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := NewClient("companyCode", "clientId", "scope", upstream.URL, upstream.URL, 10*time.Minute)
+	client.now = func() time.Time { return now }
+
+	_, _, err := client.get(context.Background(), "/api/publishedreports/v2/1", acceptAny)
+	is.NoErr(err)
+	is.Equal(len(client.responses), 1)
+
+	upstream.failing.Store(true)
+	now = now.Add(10*time.Minute + maxStaleAge)
+
+	_, _, err = client.get(context.Background(), "/api/publishedreports/v2/2", acceptAny)
+	is.True(err != nil)
+	is.Equal(len(client.responses), 0) // responses that are too old to be served stale should be evicted
+}
+
+func TestThatUnparsableReportsAreNotCached(t *testing.T) {
+	is := is.New(t)
+	upstream := newStratsysUpstream()
+	defer upstream.Close()
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := NewClient("companyCode", "clientId", "scope", upstream.URL, upstream.URL, 10*time.Minute)
+	client.now = func() time.Time { return now }
+
+	r := chi.NewRouter()
+	r.Get("/api/stratsys/publishedreports/{id}", NewRetrieveStratsysReportsHandler(context.Background(), client))
+
+	get := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports/"+id, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	is.Equal(get("1337").Code, http.StatusOK)
+
+	upstream.invalid.Store(true)
+
+	is.Equal(get("4711").Code, http.StatusBadGateway)
+	is.Equal(len(client.responses), 1) // an unparsable report should not be cached
+
+	now = now.Add(11 * time.Minute)
+
+	w := get("1337")
+	is.Equal(w.Code, http.StatusOK) // the cached report should be served instead of an unparsable one
+	is.True(w.Header().Get("Warning") != "")
+	is.Equal(w.Body.String(), `{"data":{"id":"1337","name":"Report 1337","nodes":[]}}`)
+}
+
+func TestThatReportIsReturnedAsTypedJSON(t *testing.T) {
+	is := is.New(t)
+	client := newClientWithCachedResponse("/api/publishedreports/v2/42", publishedReportResp)
+
+	r := chi.NewRouter()
+	r.Get("/api/stratsys/publishedreports/{id}", NewRetrieveStratsysReportsHandler(context.Background(), client))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports/42", nil)
+	r.ServeHTTP(w, req)
 
 	is.Equal(w.Code, http.StatusOK)
 	is.Equal(w.Header().Get("Content-Type"), "application/json")
+	is.Equal(w.Body.String(), `{"data":{"id":"42","name":"Miljöbokslut","publishedAt":"2022-03-01T08:00:00Z","nodes":[`+
+		`{"id":"n1","name":"Luft","indicators":[]},`+
+		`{"id":"n2","parentId":"n1","name":"Partiklar","indicators":[{"id":"101","name":"PM10","unit":"µg/m3","values":[`+
+		`{"period":{"id":"2021","name":"2021","startDate":"2021-01-01","endDate":"2021-12-31"},"value":14.5,"target":20},`+
+		`{"period":{"id":"2022","name":"2022","startDate":"2022-01-01","endDate":"2022-12-31"},"value":null}]}]}]}}`)
+}
+
+func TestThatReportCanBeReturnedAsCSV(t *testing.T) {
+	is := is.New(t)
+	client := newClientWithCachedResponse("/api/publishedreports/v2/42", publishedReportResp)
+
+	r := chi.NewRouter()
+	r.Get("/api/stratsys/publishedreports/{id}", NewRetrieveStratsysReportsHandler(context.Background(), client))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports/42", nil)
+	req.Header.Add("Accept", "text/csv")
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Header().Get("Content-Type"), "text/csv")
+	is.Equal(w.Body.String(), "report_id;node_id;node_name;indicator_id;indicator_name;unit;period;period_start;period_end;value;target\r\n"+
+		"42;n2;Partiklar;101;PM10;µg/m3;2021;2021-01-01;2021-12-31;14.5;20\r\n"+
+		"42;n2;Partiklar;101;PM10;µg/m3;2022;2022-01-01;2022-12-31;;\r\n")
+}
+
+func TestThatReportListCanBeReturnedAsCSV(t *testing.T) {
+	is := is.New(t)
+	client := newClientWithCachedResponse("/api/publishedreports/v2", `[{"id":42,"name":"Miljöbokslut","publishedAt":"2022-03-01T08:00:00Z"},{"id":"43","name":"Årsredovisning"}]`)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports", nil)
+	req.Header.Add("Accept", "text/csv")
+
+	NewRetrieveStratsysReportsHandler(context.Background(), client).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Body.String(), "id;name;description;published_at\r\n42;Miljöbokslut;;2022-03-01T08:00:00Z\r\n43;Årsredovisning;;\r\n")
+}
+
+func TestThatUnexpectedResponsesAreReportedAsBadGateway(t *testing.T) {
+	is := is.New(t)
+	client := newClientWithCachedResponse("/api/publishedreports/v2", `<html></html>`)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports", nil)
+
+	NewRetrieveStratsysReportsHandler(context.Background(), client).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadGateway)
+}
+
+func newClientWithCachedResponse(path, body string) *Client {
+	client, _ := NewClient("companyCode", "clientId", "scope", "http://login.invalid", "http://stratsys.invalid", time.Hour)
+	client.responses[path] = cachedResponse{
+		response:  stratsysResponse{code: http.StatusOK, contentType: "application/json", body: []byte(body)},
+		fetchedAt: time.Now(),
+	}
+	return client
+}
+
+type stratsysUpstream struct {
+	*httptest.Server
+	tokenRequests  atomic.Int32
+	reportRequests atomic.Int32
+	failing        atomic.Bool
+	tokenFailing   atomic.Bool
+	invalid        atomic.Bool
+}
+
+func acceptAny([]byte) error {
+	return nil
+}
+
+func newStratsysUpstream() *stratsysUpstream {
+	upstream := &stratsysUpstream{}
+	upstream.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/connect/token") {
+			upstream.tokenRequests.Add(1)
+			if upstream.tokenFailing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(accessTokenResp))
+			return
+		}
+
+		upstream.reportRequests.Add(1)
+
+		if upstream.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if upstream.invalid.Load() {
+			w.Header().Add("Content-Type", "text/html")
+			w.Write([]byte("<html>maintenance</html>"))
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		id := strings.TrimPrefix(r.URL.Path, "/api/publishedreports/v2/")
+		w.Write([]byte(`{"id":` + id + `,"name":"Report ` + id + `"}`))
+	}))
+	return upstream
 }
 
 func setupTokenMockService(responseCode int, responseBody string) *httptest.Server {
@@ -53,7 +327,7 @@ func setupTokenMockService(responseCode int, responseBody string) *httptest.Serv
 		} else {
 			w.Header().Add("Content-Type", "application/json")
 			w.WriteHeader(responseCode)
-			w.Write([]byte(nil))
+			w.Write([]byte("[]"))
 		}
 	}))
 }
@@ -62,3 +336,26 @@ const accessTokenResp string = `{"access_token":"ncjklhclabclksabclac",
 "scope":"am_application_scope default",
 "token_type":"Bearer",
 "expires_in":3600}`
+
+const publishedReportResp string = `{
+	"id": 42,
+	"name": "Miljöbokslut",
+	"publishedAt": "2022-03-01T08:00:00Z",
+	"nodes": [{
+		"id": "n1",
+		"name": "Luft",
+		"nodes": [{
+			"id": "n2",
+			"name": "Partiklar",
+			"indicators": [{
+				"id": 101,
+				"name": "PM10",
+				"unit": "µg/m3",
+				"values": [
+					{"period": {"id": 2021, "name": "2021", "startDate": "2021-01-01", "endDate": "2021-12-31"}, "value": 14.5, "target": 20},
+					{"period": {"id": 2022, "name": "2022", "startDate": "2022-01-01", "endDate": "2022-12-31"}, "value": null}
+				]
+			}]
+		}]
+	}]
+}`
@@ -4,131 +4,249 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"log/slog"
 
-	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	"github.com/diwise/api-opendata/internal/pkg/application/services/trafficflow"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-func NewRetrieveTrafficFlowsHandler(ctx context.Context, contextBroker string) http.HandlerFunc {
+func NewRetrieveTrafficFlowsHandler(ctx context.Context, trafficFlowSvc trafficflow.TrafficFlowService) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
 
 		ctx, span := tracer.Start(r.Context(), "retrieve-traffic-flows")
 		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-		_, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
 
-		tfosCsv := bytes.NewBufferString("date_observed;road_segment;L0_CNT;L0_AVG;L1_CNT;L1_AVG;L2_CNT;L2_AVG;L3_CNT;L3_AVG;R0_CNT;R0_AVG;R1_CNT;R1_AVG;R2_CNT;R2_AVG;R3_CNT;R3_AVG")
-
-		from := r.URL.Query().Get("from")
-		to := r.URL.Query().Get("to")
-
-		tfos, err := getTrafficFlowsFromContextBroker(ctx, contextBroker, from, to)
+		from, to, err := getTimeParametersFromQuery(r)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Error("failed to get traffic flow observations from context broker", slog.String("err", err.Error()), "contextBrokerUrl", contextBroker)
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		w.Header().Add("Content-Type", "text/csv")
+		aggr := r.URL.Query().Get("aggr")
+		if aggr != "" && !slices.Contains([]string{"15min", "hour", "day"}, aggr) {
+			err = fmt.Errorf("unknown aggregation %q, must be one of 15min, hour or day", aggr)
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		if len(tfos) == 0 {
-			w.Write(tfosCsv.Bytes())
+		observations, err := trafficFlowSvc.Query(ctx, from, to, urlValueAsSlice(r.URL.Query(), "segment"))
+		if errors.Is(err, trafficflow.ErrInvalidQuery) {
+			log.Error("bad request", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Error("failed to query traffic flows", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		sameDateIntensity := [8]int{}
-		sameDateAvgSpeed := [8]float64{}
+		if aggr != "" {
+			observations = aggregateTrafficFlows(observations, aggr)
+			sortTrafficFlows(observations)
+		}
 
-		currentDate := tfos[0].DateObserved.Value
+		const geoJSONContentType string = "application/geo+json"
+		const jsonContentType string = "application/json"
 
-		for _, tfo := range tfos {
+		acceptHeader := r.Header.Get("Accept")
 
-			tfoDateObserved := tfo.DateObserved.Value
+		if strings.HasPrefix(acceptHeader, geoJSONContentType) || strings.HasPrefix(acceptHeader, jsonContentType) {
+			var responseBody []byte
 
-			if strings.Compare(currentDate, tfoDateObserved) != 0 {
-				tfoInfo := fmt.Sprintf("\r\n%s;%s;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f",
-					currentDate, "urn:ngsi-ld:RoadSegment:19312:2860:35243",
-					sameDateIntensity[0], sameDateAvgSpeed[0], sameDateIntensity[1], sameDateAvgSpeed[1],
-					sameDateIntensity[2], sameDateAvgSpeed[2], sameDateIntensity[3], sameDateAvgSpeed[3],
-					sameDateIntensity[4], sameDateAvgSpeed[4], sameDateIntensity[5], sameDateAvgSpeed[5],
-					sameDateIntensity[6], sameDateAvgSpeed[6], sameDateIntensity[7], sameDateAvgSpeed[7],
-				)
+			if strings.HasPrefix(acceptHeader, geoJSONContentType) {
+				responseBody, err = marshalTrafficFlowsToGeoJSON(observations)
+			} else {
+				responseBody, err = json.Marshal(observations)
+				responseBody = []byte("{\"data\":" + string(responseBody) + "}")
+			}
 
-				sameDateIntensity = [8]int{}
-				sameDateAvgSpeed = [8]float64{}
+			if err != nil {
+				log.Error("failed to marshal traffic flows", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 
-				currentDate = tfoDateObserved
+			w.Header().Add("Content-Type", strings.Split(acceptHeader, ";")[0])
+			w.Write(responseBody)
+			return
+		}
 
-				tfosCsv.Write([]byte(tfoInfo))
-			}
+		tfosCsv := bytes.NewBufferString("date_observed;road_segment;L0_CNT;L0_AVG;L1_CNT;L1_AVG;L2_CNT;L2_AVG;L3_CNT;L3_AVG;R0_CNT;R0_AVG;R1_CNT;R1_AVG;R2_CNT;R2_AVG;R3_CNT;R3_AVG")
+
+		w.Header().Add("Content-Type", "text/csv")
 
-			tfoLaneId := int(tfo.LaneID.Value)
-			sameDateAvgSpeed[tfoLaneId] = tfo.AverageVehicleSpeed.Value
-			sameDateIntensity[tfoLaneId] = int(tfo.Intensity.Value)
+		for _, row := range groupTrafficFlowsBySegment(observations) {
+			tfoInfo := fmt.Sprintf("\r\n%s;%s;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f",
+				row.dateObserved, row.roadSegment,
+				row.intensity[0], row.avgSpeed[0], row.intensity[1], row.avgSpeed[1],
+				row.intensity[2], row.avgSpeed[2], row.intensity[3], row.avgSpeed[3],
+				row.intensity[4], row.avgSpeed[4], row.intensity[5], row.avgSpeed[5],
+				row.intensity[6], row.avgSpeed[6], row.intensity[7], row.avgSpeed[7],
+			)
 
+			tfosCsv.Write([]byte(tfoInfo))
 		}
 
-		tfoInfo := fmt.Sprintf("\r\n%s;%s;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f;%d;%.1f",
-			currentDate, "urn:ngsi-ld:RoadSegment:19312:2860:35243",
-			sameDateIntensity[0], sameDateAvgSpeed[0], sameDateIntensity[1], sameDateAvgSpeed[1],
-			sameDateIntensity[2], sameDateAvgSpeed[2], sameDateIntensity[3], sameDateAvgSpeed[3],
-			sameDateIntensity[4], sameDateAvgSpeed[4], sameDateIntensity[5], sameDateAvgSpeed[5],
-			sameDateIntensity[6], sameDateAvgSpeed[6], sameDateIntensity[7], sameDateAvgSpeed[7],
-		)
+		w.Write(tfosCsv.Bytes())
+	})
+}
+
+func NewRetrieveTrafficFlowSegmentsHandler(ctx context.Context, trafficFlowSvc trafficflow.TrafficFlowService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
 
-		tfosCsv.Write([]byte(tfoInfo))
+		ctx, span := tracer.Start(r.Context(), "retrieve-traffic-flow-segments")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-		w.Write(tfosCsv.Bytes())
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
 
+		responseBody, err := json.Marshal(trafficFlowSvc.GetRoadSegments())
+		if err != nil {
+			log.Error("failed to marshal road segments to json", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		responseBody = []byte("{\"data\":" + string(responseBody) + "}")
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Cache-Control", "max-age=60")
+		w.Write(responseBody)
 	})
 }
 
-func getTrafficFlowsFromContextBroker(ctx context.Context, host, from, to string) ([]*fiware.TrafficFlowObserved, error) {
-	var err error
-
-	httpClient := http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+// aggregateTrafficFlows sums the intensity and averages the speed of the observations
+// per road segment and lane within each 15 minute, hour or day long period, with days in
+// local time.
+// Observations without a valid observation date are skipped.
+func aggregateTrafficFlows(observations []domain.TrafficFlowObserved, aggr string) []domain.TrafficFlowObserved {
+	type aggregate struct {
+		observation domain.TrafficFlowObserved
+		speedSum    float64
+		count       int
 	}
 
-	url := fmt.Sprintf("%s/ngsi-ld/v1/entities?type=TrafficFlowObserved", host)
+	result := []*aggregate{}
+	index := map[string]*aggregate{}
+
+	for _, o := range observations {
+		dateObserved, err := time.Parse(time.RFC3339, o.DateObserved)
+		if err != nil {
+			continue
+		}
+
+		start := timeseries.BucketStart(dateObserved, timeseries.Resolution(aggr), timeseries.DefaultLocation).Format(time.RFC3339)
+		key := fmt.Sprintf("%s|%s|%d", start, o.RoadSegment, o.LaneID)
+
+		a, ok := index[key]
+		if !ok {
+			a = &aggregate{observation: o}
+			a.observation.DateObserved = start
+			a.observation.Intensity = 0
+			index[key] = a
+			result = append(result, a)
+		}
 
-	if from != "" && to != "" {
-		url = fmt.Sprintf("%s&timerel=between&timeAt=%s&endTimeAt=%s", url, from, to)
+		a.observation.Intensity += o.Intensity
+		a.speedSum += o.AverageVehicleSpeed
+		a.count++
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		err = fmt.Errorf("failed to create http request: %w", err)
-		return nil, err
+	aggregated := make([]domain.TrafficFlowObserved, 0, len(result))
+	for _, a := range result {
+		a.observation.AverageVehicleSpeed = math.Round(a.speedSum/float64(a.count)*10) / 10
+		aggregated = append(aggregated, a.observation)
 	}
 
-	response, err := httpClient.Do(req)
-	if err != nil {
-		err = fmt.Errorf("request failed: %w", err)
-		return nil, err
+	return aggregated
+}
+
+func sortTrafficFlows(observations []domain.TrafficFlowObserved) {
+	sort.SliceStable(observations, func(i, j int) bool {
+		a, b := observations[i], observations[j]
+		if a.DateObserved != b.DateObserved {
+			// aggregated periods are given in local time, so the offsets of the times
+			// may differ around the switches to and from daylight saving time
+			ta, errA := time.Parse(time.RFC3339, a.DateObserved)
+			tb, errB := time.Parse(time.RFC3339, b.DateObserved)
+			if errA != nil || errB != nil || ta.Equal(tb) {
+				return a.DateObserved < b.DateObserved
+			}
+			return ta.Before(tb)
+		}
+		if a.RoadSegment != b.RoadSegment {
+			return a.RoadSegment < b.RoadSegment
+		}
+		return a.LaneID < b.LaneID
+	})
+}
+
+func marshalTrafficFlowsToGeoJSON(observations []domain.TrafficFlowObserved) ([]byte, error) {
+	type feature struct {
+		Type       string                     `json:"type"`
+		Geometry   *domain.Point              `json:"geometry"`
+		Properties domain.TrafficFlowObserved `json:"properties"`
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusOK {
-		err = fmt.Errorf("request failed, status code not ok: %d", response.StatusCode)
-		return nil, err
+	features := make([]feature, 0, len(observations))
+
+	for _, o := range observations {
+		f := feature{Type: "Feature", Geometry: o.Location, Properties: o}
+		f.Properties.Location = nil
+		features = append(features, f)
 	}
 
-	tfos := []*fiware.TrafficFlowObserved{}
+	return json.Marshal(struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}{"FeatureCollection", features})
+}
+
+// maxLanes is the number of lane slots in the csv output, four lanes in each direction
+const maxLanes int = 8
+
+type trafficFlowRow struct {
+	dateObserved string
+	roadSegment  string
+	intensity    [maxLanes]int
+	avgSpeed     [maxLanes]float64
+}
+
+// groupTrafficFlowsBySegment folds sorted observations into one row per observation
+// date and road segment. Observations on lanes that do not fit in the csv are skipped.
+func groupTrafficFlowsBySegment(observations []domain.TrafficFlowObserved) []trafficFlowRow {
+	rows := []trafficFlowRow{}
+
+	for _, o := range observations {
+		if o.LaneID < 0 || o.LaneID >= maxLanes {
+			continue
+		}
+
+		if len(rows) == 0 || rows[len(rows)-1].dateObserved != o.DateObserved || rows[len(rows)-1].roadSegment != o.RoadSegment {
+			rows = append(rows, trafficFlowRow{dateObserved: o.DateObserved, roadSegment: o.RoadSegment})
+		}
 
-	err = json.NewDecoder(response.Body).Decode(&tfos)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		rows[len(rows)-1].intensity[o.LaneID] = o.Intensity
+		rows[len(rows)-1].avgSpeed[o.LaneID] = o.AverageVehicleSpeed
 	}
 
-	return tfos, err
+	return rows
 }
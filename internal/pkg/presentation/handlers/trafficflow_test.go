@@ -2,546 +2,291 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/diwise/api-opendata/internal/pkg/application/services/trafficflow"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/matryer/is"
 )
 
+const trafficFlowCsvHeader string = "date_observed;road_segment;L0_CNT;L0_AVG;L1_CNT;L1_AVG;L2_CNT;L2_AVG;L3_CNT;L3_AVG;R0_CNT;R0_AVG;R1_CNT;R1_AVG;R2_CNT;R2_AVG;R3_CNT;R3_AVG"
+
 func TestGetTrafficFlowsHandlesEmptyResult(t *testing.T) {
 	is := is.New(t)
-	ms := setupMockService(http.StatusOK, "[]")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow", nil)
 
-	NewRetrieveTrafficFlowsHandler(context.Background(), ms.URL).ServeHTTP(w, req)
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock()).ServeHTTP(w, req)
 
-	is.Equal(w.Code, http.StatusOK)                                                                                                                                         // return code must be 200, Status OK
-	is.Equal(w.Body.String(), "date_observed;road_segment;L0_CNT;L0_AVG;L1_CNT;L1_AVG;L2_CNT;L2_AVG;L3_CNT;L3_AVG;R0_CNT;R0_AVG;R1_CNT;R1_AVG;R2_CNT;R2_AVG;R3_CNT;R3_AVG") // body should only contain Csv Header
+	is.Equal(w.Code, http.StatusOK)                 // return code must be 200, Status OK
+	is.Equal(w.Body.String(), trafficFlowCsvHeader) // body should only contain Csv Header
 }
 
-func TestGetTrafficFlowsHandlesSingleObservation(t *testing.T) {
+func TestGetTrafficFlowsHandlesSameDateObservations(t *testing.T) {
 	is := is.New(t)
-	ms := setupMockService(http.StatusOK, `[{
-		"@context": [
-		  "https://schema.lab.fiware.org/ld/context",
-		  "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-		],
-		"id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-		"type": "TrafficFlowObserved",
-			"location": {
-				"type": "GeoProperty",
-				"value": {
-					"coordinates": [
-						17.0,
-						62.2
-					],
-				"type": "Point"
-				}
-			},
-			"dateObserved": {
-				"type": "Property",
-				"value": "2016-12-07T11:10:00Z"
-			},
-			"laneID": {
-				"type": "Property",
-				"value": 0
-			},
-			"averageVehicleSpeed": {
-				"type": "Property",
-				"value": 17.3
-			},
-			"intensity": {
-				"type": "Property",
-				"value": 8
-			},
-			"refRoadSegment": {
-				"type": "Relationship",
-				"object": ""
-			}
-	}]`)
+
+	observations := []domain.TrafficFlowObserved{}
+	for lane, values := range [][2]float64{{8, 17.3}, {11, 78.3}, {41, 39.5}, {14, 34.2}, {15, 68.5}, {18, 22.8}, {11, 20.5}, {15, 42.5}} {
+		observations = append(observations, newTrafficFlowObserved("2016-12-07T11:10:00Z", "", lane, int(values[0]), values[1]))
+	}
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow", nil)
 
-	NewRetrieveTrafficFlowsHandler(context.Background(), ms.URL).ServeHTTP(w, req)
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock(observations...)).ServeHTTP(w, req)
 
-	is.Equal(w.Code, http.StatusOK)                                                                                                                                                                                                                                                           // return code must be 200, Status OK
-	is.Equal(w.Body.String(), "date_observed;road_segment;L0_CNT;L0_AVG;L1_CNT;L1_AVG;L2_CNT;L2_AVG;L3_CNT;L3_AVG;R0_CNT;R0_AVG;R1_CNT;R1_AVG;R2_CNT;R2_AVG;R3_CNT;R3_AVG\r\n2016-12-07T11:10:00Z;urn:ngsi-ld:RoadSegment:19312:2860:35243;8;17.3;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0") // expected body to return values for intensity and average speed for only one observation
+	is.Equal(w.Code, http.StatusOK)                                                                                                            // return code must be 200, Status OK
+	is.Equal(w.Body.String(), trafficFlowCsvHeader+"\r\n2016-12-07T11:10:00Z;;8;17.3;11;78.3;41;39.5;14;34.2;15;68.5;18;22.8;11;20.5;15;42.5") // expected body to return values for intensity and average speed for eight same date observations
 }
 
-func TestGetTrafficFlowsHandlesSameDateObservations(t *testing.T) {
+func TestGetTrafficFlowsHandlesDifferentDateObservations(t *testing.T) {
 	is := is.New(t)
-	ms := setupMockService(http.StatusOK, trafficFlowJson)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow", nil)
 
-	NewRetrieveTrafficFlowsHandler(context.Background(), ms.URL).ServeHTTP(w, req)
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock(differentDateTfos()...)).ServeHTTP(w, req)
 
-	is.Equal(w.Code, http.StatusOK)                                                                                                                                                                                                                                                                         // return code must be 200, Status OK
-	is.Equal(w.Body.String(), "date_observed;road_segment;L0_CNT;L0_AVG;L1_CNT;L1_AVG;L2_CNT;L2_AVG;L3_CNT;L3_AVG;R0_CNT;R0_AVG;R1_CNT;R1_AVG;R2_CNT;R2_AVG;R3_CNT;R3_AVG\r\n2016-12-07T11:10:00Z;urn:ngsi-ld:RoadSegment:19312:2860:35243;8;17.3;11;78.3;41;39.5;14;34.2;15;68.5;18;22.8;11;20.5;15;42.5") // expected body to return values for intensity and average speed for eight same date observations
+	is.Equal(w.Code, http.StatusOK) // return code must be 200, Status OK
+	is.Equal(w.Body.String(), trafficFlowCsvHeader+
+		"\r\n2016-12-07T11:10:00Z;;8;17.3;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0"+
+		"\r\n2016-12-07T13:10:00Z;;0;0.0;0;0.0;0;0.0;3;25.4;0;0.0;0;0.0;0;0.0;0;0.0"+
+		"\r\n2016-12-07T18:10:00Z;;0;0.0;0;0.0;0;0.0;3;25.4;0;0.0;0;0.0;0;0.0;0;0.0") // expected body to return values for intensity and average speed for different date observations
 }
 
-func TestGetTrafficFlowsHandlesDifferentDateObservations(t *testing.T) {
+func TestGetTrafficFlowsWithinTimeSpan(t *testing.T) {
+	is := is.New(t)
+	svc := defaultTrafficFlowMock(differentDateTfos()...)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?from=2016-12-07T11:10:00Z&to=2016-12-07T13:10:00Z", nil)
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK) // Request failed, status code not OK
+	is.Equal(svc.QueryCalls()[0].From, time.Date(2016, 12, 7, 11, 10, 0, 0, time.UTC))
+	is.Equal(svc.QueryCalls()[0].To, time.Date(2016, 12, 7, 13, 10, 0, 0, time.UTC))
+	is.Equal(w.Body.String(), trafficFlowCsvHeader+
+		"\r\n2016-12-07T11:10:00Z;;8;17.3;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0"+
+		"\r\n2016-12-07T13:10:00Z;;0;0.0;0;0.0;0;0.0;3;25.4;0;0.0;0;0.0;0;0.0;0;0.0")
+}
+
+func TestGetTrafficFlowsWithInvalidTimeSpan(t *testing.T) {
+	is := is.New(t)
+	svc := defaultTrafficFlowMock()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?from=yesterday", nil)
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadRequest) // an invalid time should be rejected
+	is.Equal(len(svc.QueryCalls()), 0)
+}
+
+func TestGetTrafficFlowsGroupsObservationsByRoadSegment(t *testing.T) {
 	is := is.New(t)
-	ms := setupMockService(http.StatusOK, differentDateTfos)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow", nil)
 
-	NewRetrieveTrafficFlowsHandler(context.Background(), ms.URL).ServeHTTP(w, req)
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock(multipleSegmentsTfos()...)).ServeHTTP(w, req)
 
-	is.Equal(w.Code, http.StatusOK)                                                                                                                                                                                                                                                                                                                                                                                                                                                                                               // return code must be 200, Status OK
-	is.Equal(w.Body.String(), "date_observed;road_segment;L0_CNT;L0_AVG;L1_CNT;L1_AVG;L2_CNT;L2_AVG;L3_CNT;L3_AVG;R0_CNT;R0_AVG;R1_CNT;R1_AVG;R2_CNT;R2_AVG;R3_CNT;R3_AVG\r\n2016-12-07T11:10:00Z;urn:ngsi-ld:RoadSegment:19312:2860:35243;8;17.3;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0\r\n2016-12-07T13:10:00Z;urn:ngsi-ld:RoadSegment:19312:2860:35243;0;0.0;0;0.0;0;0.0;3;25.4;0;0.0;0;0.0;0;0.0;0;0.0\r\n2016-12-07T18:10:00Z;urn:ngsi-ld:RoadSegment:19312:2860:35243;0;0.0;0;0.0;0;0.0;3;25.4;0;0.0;0;0.0;0;0.0;0;0.0") // expected body to return values for intensity and average speed for two different date observations
+	is.Equal(w.Code, http.StatusOK) // return code must be 200, Status OK
+	is.Equal(w.Body.String(), trafficFlowCsvHeader+
+		"\r\n2016-12-07T11:10:00Z;urn:ngsi-ld:RoadSegment:1;8;17.3;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0;0;0.0"+
+		"\r\n2016-12-07T11:10:00Z;urn:ngsi-ld:RoadSegment:2;0;0.0;0;0.0;0;0.0;0;0.0;5;50.0;0;0.0;0;0.0;0;0.0") // observations on different segments should be on separate rows
 }
 
-func TestGetTrafficFlowsHandlesDateObservationsFromTimeSpan(t *testing.T) {
+func TestGetTrafficFlowsForASingleRoadSegment(t *testing.T) {
 	is := is.New(t)
+	svc := defaultTrafficFlowMock(multipleSegmentsTfos()...)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?segment=urn:ngsi-ld:RoadSegment:2", nil)
 
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		is.Equal(r.URL.RequestURI(), "/ngsi-ld/v1/entities?type=TrafficFlowObserved&timerel=between&timeAt=2016-12-07T11:10:00Z&endTimeAt=2016-12-07T13:10:00Z")
+	NewRetrieveTrafficFlowsHandler(context.Background(), svc).ServeHTTP(w, req)
 
-		w.Header().Add("Content-Type", "application/ld+json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("[]"))
-	}))
+	is.Equal(w.Code, http.StatusOK) // return code must be 200, Status OK
+	is.Equal(svc.QueryCalls()[0].Segments, []string{"urn:ngsi-ld:RoadSegment:2"})
+	is.Equal(w.Body.String(), trafficFlowCsvHeader+
+		"\r\n2016-12-07T11:10:00Z;urn:ngsi-ld:RoadSegment:2;0;0.0;0;0.0;0;0.0;0;0.0;5;50.0;0;0.0;0;0.0;0;0.0")
+}
+
+func TestGetTrafficFlowsAsJSON(t *testing.T) {
+	is := is.New(t)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/trafficflows?from=2016-12-07T11:10:00Z&to=2016-12-07T13:10:00Z", nil)
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?segment=urn:ngsi-ld:RoadSegment:1", nil)
+	req.Header.Add("Accept", "application/json")
 
-	NewRetrieveTrafficFlowsHandler(context.Background(), server.URL).ServeHTTP(w, req)
-	is.Equal(w.Code, http.StatusOK) // Request failed, status code not OK
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock(multipleSegmentsTfos()...)).ServeHTTP(w, req)
 
+	is.Equal(w.Code, http.StatusOK) // return code must be 200, Status OK
+	is.Equal(w.Header().Get("Content-Type"), "application/json")
+	is.Equal(w.Body.String(), `{"data":[{"dateObserved":"2016-12-07T11:10:00Z","roadSegment":"urn:ngsi-ld:RoadSegment:1","laneID":0,"intensity":8,"averageVehicleSpeed":17.3,"location":{"type":"Point","coordinates":[17,62.2]}}]}`)
 }
 
-func setupMockService(responseCode int, responseBody string) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Content-Type", "application/ld+json")
-		w.WriteHeader(responseCode)
-		w.Write([]byte(responseBody))
-	}))
+func TestGetTrafficFlowsAsGeoJSON(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?segment=urn:ngsi-ld:RoadSegment:2", nil)
+	req.Header.Add("Accept", "application/geo+json")
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock(multipleSegmentsTfos()...)).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK) // return code must be 200, Status OK
+	is.Equal(w.Header().Get("Content-Type"), "application/geo+json")
+	is.Equal(w.Body.String(), `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[17.1,62.3]},"properties":{"dateObserved":"2016-12-07T11:10:00Z","roadSegment":"urn:ngsi-ld:RoadSegment:2","laneID":4,"intensity":5,"averageVehicleSpeed":50}}]}`)
 }
 
-const differentDateTfos string = `[{
-	"@context": [
-	  "https://schema.lab.fiware.org/ld/context",
-	  "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-	],
-	"id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-	"type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 0
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 17.3
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 8
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-	"@context": [
-	  "https://schema.lab.fiware.org/ld/context",
-	  "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-	],
-	"id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-	"type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T13:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 3
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 25.4
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 3
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-	"@context": [
-	  "https://schema.lab.fiware.org/ld/context",
-	  "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-	],
-	"id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-	"type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T18:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 3
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 25.4
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 3
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-}]`
-
-const trafficFlowJson string = `[{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 0
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 17.3
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 8
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 1
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 78.3
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 11
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 2
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 39.5
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 41
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 3
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 34.2
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 14
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 4
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 68.5
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 15
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 5
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 22.8
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 18
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
-			}
-		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 6
+func TestGetTrafficFlowsAggregatedPerDay(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?aggr=day", nil)
+	req.Header.Add("Accept", "application/json")
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock(differentDateTfos()...)).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)                                                                                                                                                                                                                                                                                                                                                     // return code must be 200, Status OK
+	is.Equal(w.Body.String(), `{"data":[{"dateObserved":"2016-12-07T00:00:00+01:00","roadSegment":"","laneID":0,"intensity":8,"averageVehicleSpeed":17.3,"location":{"type":"Point","coordinates":[17,62.2]}},{"dateObserved":"2016-12-07T00:00:00+01:00","roadSegment":"","laneID":3,"intensity":6,"averageVehicleSpeed":25.4,"location":{"type":"Point","coordinates":[17,62.2]}}]}`) // intensity should be summed per lane and day
+}
+
+func TestThatTrafficFlowsAreAggregatedPerLocalDay(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?aggr=day", nil)
+	req.Header.Add("Accept", "application/json")
+
+	svc := defaultTrafficFlowMock(
+		newTrafficFlowObserved("2016-12-06T22:50:00Z", "", 0, 2, 10.0),
+		newTrafficFlowObserved("2016-12-06T23:10:00Z", "", 0, 3, 20.0),
+	)
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.True(strings.Contains(w.Body.String(), `"dateObserved":"2016-12-06T00:00:00+01:00","roadSegment":"","laneID":0,"intensity":2`)) // 23:50 local time belongs to the 6th
+	is.True(strings.Contains(w.Body.String(), `"dateObserved":"2016-12-07T00:00:00+01:00","roadSegment":"","laneID":0,"intensity":3`)) // 00:10 local time belongs to the 7th
+}
+
+func TestGetTrafficFlowsWithUnknownAggregation(t *testing.T) {
+	is := is.New(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?aggr=week", nil)
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), defaultTrafficFlowMock()).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadRequest) // an unknown aggregation should be rejected
+}
+
+func TestGetTrafficFlowsWhenTheBrokerFails(t *testing.T) {
+	is := is.New(t)
+
+	svc := &trafficflow.TrafficFlowServiceMock{
+		QueryFunc: func(ctx context.Context, from, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+			return nil, errors.New("request failed")
 		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 20.5
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?timeAt=2022-01-01T00:00:00Z", nil)
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusInternalServerError) // a failing query should not return an empty result
+}
+
+func TestGetTrafficFlowsWithTooLongTimeSpan(t *testing.T) {
+	is := is.New(t)
+
+	svc := &trafficflow.TrafficFlowServiceMock{
+		QueryFunc: func(ctx context.Context, from, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+			return nil, fmt.Errorf("%w: the time span is too long", trafficflow.ErrInvalidQuery)
 		},
-		"intensity": {
-			"type": "Property",
-			"value": 11
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow?timeAt=1970-01-01T00:00:00Z", nil)
+
+	NewRetrieveTrafficFlowsHandler(context.Background(), svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadRequest) // an invalid query should be rejected
+}
+
+func TestGetTrafficFlowSegments(t *testing.T) {
+	is := is.New(t)
+
+	svc := &trafficflow.TrafficFlowServiceMock{
+		GetRoadSegmentsFunc: func() []domain.RoadSegment {
+			return []domain.RoadSegment{{ID: "urn:ngsi-ld:RoadSegment:1", Location: *domain.NewPoint(62.2, 17.0), Lanes: []int{0, 1}}}
 		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
-},
-{
-    "@context": [
-      "https://schema.lab.fiware.org/ld/context",
-      "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
-    ],
-    "id": "urn:ngsi-ld:TrafficFlowObserved:sn-tcr-01:test",
-    "type": "TrafficFlowObserved",
-		"location": {
-			"type": "GeoProperty",
-			"value": {
-				"coordinates": [
-					17.0,
-					62.2
-				],
-			"type": "Point"
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/trafficflow/segments", nil)
+
+	NewRetrieveTrafficFlowSegmentsHandler(context.Background(), svc).ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK) // return code must be 200, Status OK
+	is.Equal(w.Body.String(), `{"data":[{"id":"urn:ngsi-ld:RoadSegment:1","location":{"type":"Point","coordinates":[17,62.2]},"lanes":[0,1]}]}`)
+}
+
+func defaultTrafficFlowMock(observations ...domain.TrafficFlowObserved) *trafficflow.TrafficFlowServiceMock {
+	return &trafficflow.TrafficFlowServiceMock{
+		QueryFunc: func(ctx context.Context, from, to time.Time, segments []string) ([]domain.TrafficFlowObserved, error) {
+			result := []domain.TrafficFlowObserved{}
+			for _, o := range observations {
+				dateObserved, _ := time.Parse(time.RFC3339, o.DateObserved)
+				if (!from.IsZero() && dateObserved.Before(from)) || (!to.IsZero() && dateObserved.After(to)) {
+					continue
+				}
+				if len(segments) == 0 || slices.Contains(segments, o.RoadSegment) {
+					result = append(result, o)
+				}
 			}
+			return result, nil
 		},
-		"dateObserved": {
-			"type": "Property",
-			"value": "2016-12-07T11:10:00Z"
-		},
-		"laneID": {
-			"type": "Property",
-			"value": 7
-		},
-		"averageVehicleSpeed": {
-			"type": "Property",
-			"value": 42.5
-		},
-		"intensity": {
-			"type": "Property",
-			"value": 15
-		},
-		"refRoadSegment": {
-			"type": "Relationship",
-			"object": ""
-		}
+	}
+}
+
+func newTrafficFlowObserved(dateObserved, roadSegment string, lane, intensity int, averageSpeed float64) domain.TrafficFlowObserved {
+	return domain.TrafficFlowObserved{
+		DateObserved:        dateObserved,
+		RoadSegment:         roadSegment,
+		LaneID:              lane,
+		Intensity:           intensity,
+		AverageVehicleSpeed: averageSpeed,
+		Location:            domain.NewPoint(62.2, 17.0),
+	}
+}
+
+func differentDateTfos() []domain.TrafficFlowObserved {
+	return []domain.TrafficFlowObserved{
+		newTrafficFlowObserved("2016-12-07T11:10:00Z", "", 0, 8, 17.3),
+		newTrafficFlowObserved("2016-12-07T13:10:00Z", "", 3, 3, 25.4),
+		newTrafficFlowObserved("2016-12-07T18:10:00Z", "", 3, 3, 25.4),
+	}
+}
+
+func multipleSegmentsTfos() []domain.TrafficFlowObserved {
+	second := newTrafficFlowObserved("2016-12-07T11:10:00Z", "urn:ngsi-ld:RoadSegment:2", 4, 5, 50.0)
+	second.Location = domain.NewPoint(62.3, 17.1)
+
+	return []domain.TrafficFlowObserved{
+		newTrafficFlowObserved("2016-12-07T11:10:00Z", "urn:ngsi-ld:RoadSegment:1", 0, 8, 17.3),
+		second,
+	}
 }
-]`
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -14,6 +15,7 @@ import (
 	"log/slog"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/waterquality"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
@@ -158,10 +160,34 @@ func NewRetrieveWaterQualityByIDHandler(ctx context.Context, svc waterquality.Wa
 			}
 		}
 
-		wqo, err := svc.GetByID(ctx, waterqualityID, from, to)
+		var resolution timeseries.Resolution
+
+		if aggr := values.Get("aggr"); aggr != "" {
+			resolution, err = timeseries.ParseResolution(aggr)
+			if err != nil || (resolution != timeseries.Hour && resolution != timeseries.Day) {
+				err = fmt.Errorf("aggr must be either hour or day")
+				log.Error("bad request", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		wqo, err := svc.GetByID(ctx, waterqualityID, from, to, resolution)
 		if err != nil {
-			log.Error("no water quality found", slog.String("err", err.Error()), "id", waterqualityID)
-			w.WriteHeader(http.StatusNotFound)
+			if errors.Is(err, waterquality.ErrInvalidQuery) {
+				log.Error("bad request", slog.String("err", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if errors.Is(err, waterquality.ErrWQNotFound) {
+				log.Error("no water quality found", slog.String("err", err.Error()), "id", waterqualityID)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			log.Error("failed to retrieve water quality", slog.String("err", err.Error()), "id", waterqualityID)
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
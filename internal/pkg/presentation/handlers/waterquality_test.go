@@ -3,12 +3,14 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/diwise/api-opendata/internal/pkg/application/services/waterquality"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/go-chi/chi/v5"
 	"github.com/matryer/is"
@@ -61,6 +63,46 @@ func TestGetWaterQualityByIDWithTimespan(t *testing.T) {
 	is.Equal(len(wqSvc.GetByIDCalls()), 1)   // GetByID should have been called exactly once
 }
 
+func TestGetWaterQualityByIDWithAggregation(t *testing.T) {
+	is, router, testServer := testSetup(t)
+	wqSvc := mockWaterQualitySvc(is)
+
+	router.Get("/{id}", NewRetrieveWaterQualityByIDHandler(context.Background(), wqSvc))
+	resp, _ := newGetRequest(is, testServer, "application/ld+json", "/urn:ngsi-ld:WaterQualityObserved:testID?aggr=day", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(wqSvc.GetByIDCalls()[0].Resolution, timeseries.Day)
+
+	resp, _ = newGetRequest(is, testServer, "application/ld+json", "/urn:ngsi-ld:WaterQualityObserved:testID?aggr=week", nil)
+	is.Equal(resp.StatusCode, http.StatusBadRequest) // only hourly and daily aggregation is supported
+	is.Equal(len(wqSvc.GetByIDCalls()), 1)
+}
+
+func TestGetWaterQualityByIDReturnsErrorsFromTheService(t *testing.T) {
+	is, router, testServer := testSetup(t)
+	wqSvc := mockWaterQualitySvc(is)
+
+	router.Get("/{id}", NewRetrieveWaterQualityByIDHandler(context.Background(), wqSvc))
+
+	wqSvc.GetByIDFunc = func(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error) {
+		return nil, fmt.Errorf("%w: too long", waterquality.ErrInvalidQuery)
+	}
+	resp, _ := newGetRequest(is, testServer, "application/ld+json", "/urn:ngsi-ld:WaterQualityObserved:testID?from=2020-01-01T00:00:00Z", nil)
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+
+	wqSvc.GetByIDFunc = func(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error) {
+		return nil, waterquality.ErrWQNotFound
+	}
+	resp, _ = newGetRequest(is, testServer, "application/ld+json", "/urn:ngsi-ld:WaterQualityObserved:unknown", nil)
+	is.Equal(resp.StatusCode, http.StatusNotFound)
+
+	wqSvc.GetByIDFunc = func(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error) {
+		return nil, fmt.Errorf("broker unavailable")
+	}
+	resp, _ = newGetRequest(is, testServer, "application/ld+json", "/urn:ngsi-ld:WaterQualityObserved:testID?from=2020-01-01T00:00:00Z", nil)
+	is.Equal(resp.StatusCode, http.StatusInternalServerError)
+}
+
 func testSetup(t *testing.T) (*is.I, *chi.Mux, *httptest.Server) {
 	is := is.New(t)
 	r := chi.NewRouter()
@@ -85,7 +127,7 @@ func mockWaterQualitySvc(is *is.I) *waterquality.WaterQualityServiceMock {
 
 			return []domain.WaterQuality{wq}
 		},
-		GetByIDFunc: func(ctx context.Context, id string, from, to time.Time) (*domain.WaterQualityTemporal, error) {
+		GetByIDFunc: func(ctx context.Context, id string, from, to time.Time, resolution timeseries.Resolution) (*domain.WaterQualityTemporal, error) {
 			wqt := &domain.WaterQualityTemporal{}
 			err := json.Unmarshal([]byte(waterqualityTemporalJson), wqt)
 			is.NoErr(err)
@@ -14,6 +14,8 @@ import (
 	"log/slog"
 
 	services "github.com/diwise/api-opendata/internal/pkg/application/services/weather"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
+	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
@@ -23,8 +25,11 @@ import (
 
 var ErrNoCoordsInQuery error = errors.New("no coordinates specified")
 var ErrInvalidCoordinates error = errors.New("invalid coordinates specified")
+var ErrInvalidMaxDistance error = errors.New("maxDistance must be a positive number of metres")
 
-func getPointFromURL(ctx context.Context, r *http.Request) (int64, float64, float64, error) {
+// getPointFromURL returns the max distance and the point given by the coordinates
+// parameter, or the default centre if no coordinates are specified
+func getPointFromURL(r *http.Request, defaultCentre domain.Point) (int64, float64, float64, error) {
 	var distance int64 = 5000
 	var lon, lat float64
 	var err error
@@ -36,51 +41,61 @@ func getPointFromURL(ctx context.Context, r *http.Request) (int64, float64, floa
 
 	coordinates := r.URL.Query().Get("coordinates")
 	if coordinates != "" {
-		coords := strings.Split(coordinates, ",")
-		if len(coords) != 2 {
-			return 0, 0, 0, ErrInvalidCoordinates
-		}
-		lon, err = strconv.ParseFloat(strings.Replace(coords[0], "[", "", 1), 64)
-		if err != nil {
-			return 0, 0, 0, ErrInvalidCoordinates
-		}
-		lat, err = strconv.ParseFloat(strings.Replace(coords[1], "]", "", 1), 64)
+		lat, lon, err = parseCoordinates(coordinates)
 		if err != nil {
-			return 0, 0, 0, ErrInvalidCoordinates
+			return 0, 0, 0, err
 		}
 	} else {
-		return distance, 62.390802, 17.306982, nil
+		return distance, defaultCentre.Coordinates[1], defaultCentre.Coordinates[0], nil
 	}
 
 	return distance, lat, lon, nil
 }
 
-func getTimeParamsFromURL(r *http.Request) (time.Time, time.Time, error) {
-	var err error
+// getNearPointFromQuery returns the point given by the optional coordinates parameter along
+// with the maxDistance in metres around it, which defaults to 5000. The returned bool is
+// false when no coordinates are specified.
+func getNearPointFromQuery(params url.Values) (lat, lon float64, maxDistance int, ok bool, err error) {
+	if !params.Has("coordinates") {
+		return 0, 0, 0, false, nil
+	}
 
-	startTime := time.Now().UTC().Add(-1 * 24 * time.Hour)
-	endTime := time.Now().UTC()
+	lat, lon, err = parseCoordinates(params.Get("coordinates"))
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
 
-	from := r.URL.Query().Get("timeAt")
-	if from != "" {
-		startTime, err = time.Parse(time.RFC3339, from)
-		if err != nil {
-			return time.Time{}, time.Time{}, err
+	maxDistance = 5000
+
+	if params.Has("maxDistance") {
+		maxDistance, err = strconv.Atoi(params.Get("maxDistance"))
+		if err != nil || maxDistance <= 0 {
+			return 0, 0, 0, false, ErrInvalidMaxDistance
 		}
 	}
 
-	to := r.URL.Query().Get("endTimeAt")
-	if to != "" {
-		endTime, err = time.Parse(time.RFC3339, to)
-		if err != nil {
-			return time.Time{}, time.Time{}, err
-		}
+	return lat, lon, maxDistance, true, nil
+}
+
+// parseCoordinates parses coordinates given as longitude,latitude, optionally within brackets
+func parseCoordinates(coordinates string) (lat, lon float64, err error) {
+	coords := strings.Split(coordinates, ",")
+	if len(coords) != 2 {
+		return 0, 0, ErrInvalidCoordinates
+	}
+	lon, err = strconv.ParseFloat(strings.Replace(coords[0], "[", "", 1), 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCoordinates
+	}
+	lat, err = strconv.ParseFloat(strings.Replace(coords[1], "]", "", 1), 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCoordinates
 	}
 
-	return startTime, endTime, nil
+	return lat, lon, nil
 }
 
-func NewRetrieveWeatherHandler(ctx context.Context, svc services.WeatherService) http.HandlerFunc {
+func NewRetrieveWeatherHandler(ctx context.Context, svc services.WeatherService, defaultCentre domain.Point) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
 
@@ -89,7 +104,7 @@ func NewRetrieveWeatherHandler(ctx context.Context, svc services.WeatherService)
 
 		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
 
-		dist, lat, lon, err := getPointFromURL(ctx, r)
+		dist, lat, lon, err := getPointFromURL(r, defaultCentre)
 		if err != nil {
 			err = fmt.Errorf("unable to get point (%w)", err)
 			log.Error("bad request", slog.String("err", err.Error()))
@@ -98,11 +113,44 @@ func NewRetrieveWeatherHandler(ctx context.Context, svc services.WeatherService)
 			return
 		}
 
+		query := svc.Query().NearPoint(dist, lat, lon)
+
+		// the history of each station is only included when a time span or an
+		// aggregation is requested
+		params := r.URL.Query()
+		if params.Has("timeAt") || params.Has("endTimeAt") || params.Has("aggr") {
+			from, to, err := getTimeSpanOrDefault(r.URL.Query(), "timeAt", "endTimeAt", 24*time.Hour)
+			if err != nil {
+				err = fmt.Errorf("unable to get time range (%w)", err)
+				log.Error("bad request", slog.String("err", err.Error()))
+				problem := errs.NewProblemReport(http.StatusBadRequest, "badrequest", errs.Detail(err.Error()), errs.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+
+			aggr := params.Get("aggr")
+			if aggr != "" {
+				if _, err = timeseries.ParseResolution(aggr); err != nil {
+					log.Error("bad request", slog.String("err", err.Error()))
+					problem := errs.NewProblemReport(http.StatusBadRequest, "badrequest", errs.Detail(err.Error()), errs.TraceID(traceID))
+					problem.WriteResponse(w)
+					return
+				}
+			}
+
+			query = query.BetweenTimes(from, to).Aggr(aggr)
+		}
+
 		timeout, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 
-		weather, err := svc.Query().NearPoint(dist, lat, lon).Get(timeout)
-		if err != nil {
+		weather, err := query.Get(timeout)
+		if errors.Is(err, services.ErrInvalidQuery) {
+			log.Error("bad request", slog.String("err", err.Error()))
+			problem := errs.NewProblemReport(http.StatusBadRequest, "badrequest", errs.Detail(err.Error()), errs.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		} else if err != nil {
 			err = fmt.Errorf("unable to get weather")
 			log.Error("internal error", slog.String("err", err.Error()))
 			problem := errs.NewProblemReport(http.StatusInternalServerError, "internalerror", errs.Detail(err.Error()), errs.TraceID(traceID))
@@ -143,7 +191,7 @@ func NewRetrieveWeatherByIDHandler(ctx context.Context, svc services.WeatherServ
 			return
 		}
 
-		from, to, err := getTimeParamsFromURL(r)
+		from, to, err := getTimeSpanOrDefault(r.URL.Query(), "timeAt", "endTimeAt", 24*time.Hour)
 		if err != nil {
 			err = fmt.Errorf("unable to get time range (%w)", err)
 			log.Error("bad request", slog.String("err", err.Error()))
@@ -153,12 +201,29 @@ func NewRetrieveWeatherByIDHandler(ctx context.Context, svc services.WeatherServ
 		}
 
 		resolution := r.URL.Query().Get("aggr")
+		if resolution != "" {
+			if _, err = timeseries.ParseResolution(resolution); err != nil {
+				log.Error("bad request", slog.String("err", err.Error()))
+				problem := errs.NewProblemReport(http.StatusBadRequest, "badrequest", errs.Detail(err.Error()), errs.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+		}
 
 		timeout, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 
 		weather, err := svc.Query().ID(woID).BetweenTimes(from, to).Aggr(resolution).GetByID(timeout)
-		if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			problem := errs.NewProblemReport(http.StatusNotFound, "notfound", errs.Detail("no such weather station"), errs.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		} else if errors.Is(err, services.ErrInvalidQuery) {
+			log.Error("bad request", slog.String("err", err.Error()))
+			problem := errs.NewProblemReport(http.StatusBadRequest, "badrequest", errs.Detail(err.Error()), errs.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		} else if err != nil {
 			err = fmt.Errorf("unable to get weather")
 			log.Error("internal error", slog.String("err", err.Error()))
 			problem := errs.NewProblemReport(http.StatusInternalServerError, "internalerror", errs.Detail(err.Error()), errs.TraceID(traceID))
@@ -180,3 +245,99 @@ func NewRetrieveWeatherByIDHandler(ctx context.Context, svc services.WeatherServ
 		w.Write([]byte("{\"data\": " + string(bytes) + "}"))
 	})
 }
+
+func NewRetrieveWeatherStationsHandler(ctx context.Context, svc services.WeatherService) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx, span := tracer.Start(r.Context(), "retrieve-weather-stations")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		_, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		stations := svc.GetStations()
+
+		bytes, err := json.Marshal(stations)
+		if err != nil {
+			err = fmt.Errorf("unable to marshal results to json (%w)", err)
+			log.Error("internal error", slog.String("err", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		// stations are refreshed every five minutes along with their latest temperature
+		w.Header().Add("Cache-Control", "max-age=300")
+		w.Write([]byte("{\"data\":" + string(bytes) + "}"))
+	})
+}
+
+// forecastMaxDistance is how far away, in metres, a forecast may be to be embedded as
+// the nearest forecast of e.g. a beach
+const forecastMaxDistance int64 = 10000
+
+func NewRetrieveWeatherForecastsHandler(ctx context.Context, svc services.WeatherService, defaultCentre domain.Point) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx, span := tracer.Start(r.Context(), "retrieve-weather-forecasts")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, _, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+		dist, lat, lon, err := getPointFromURL(r, defaultCentre)
+		if err != nil {
+			err = fmt.Errorf("unable to get point (%w)", err)
+			log.Error("bad request", slog.String("err", err.Error()))
+			problem := errs.NewProblemReport(http.StatusBadRequest, "badrequest", errs.Detail(err.Error()), errs.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		if r.URL.Query().Get("maxDistance") == "" {
+			dist = forecastMaxDistance
+		}
+
+		resolution := timeseries.Hour
+		if aggr := r.URL.Query().Get("aggr"); aggr != "" {
+			resolution, err = timeseries.ParseResolution(aggr)
+			if err != nil || (resolution != timeseries.Hour && resolution != timeseries.Day) {
+				err = fmt.Errorf("forecasts can only be aggregated by hour or day")
+				log.Error("bad request", slog.String("err", err.Error()))
+				problem := errs.NewProblemReport(http.StatusBadRequest, "badrequest", errs.Detail(err.Error()), errs.TraceID(traceID))
+				problem.WriteResponse(w)
+				return
+			}
+		}
+
+		forecasts := svc.GetForecasts(lat, lon, dist, resolution)
+
+		bytes, err := json.Marshal(forecasts)
+		if err != nil {
+			err = fmt.Errorf("unable to marshal results to json (%w)", err)
+			log.Error("internal error", slog.String("err", err.Error()))
+			problem := errs.NewProblemReport(http.StatusInternalServerError, "internalerror", errs.Detail(err.Error()), errs.TraceID(traceID))
+			problem.WriteResponse(w)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Cache-Control", "max-age=300")
+		w.Write([]byte("{\"data\":" + string(bytes) + "}"))
+	})
+}
+
+// nearestDailyForecast returns the daily forecast closest to the point, or nil if
+// forecasts are not available or none is close enough
+func nearestDailyForecast(svc services.WeatherService, lat, lon float64) *domain.WeatherForecast {
+	if svc == nil {
+		return nil
+	}
+
+	forecasts := svc.GetForecasts(lat, lon, forecastMaxDistance, timeseries.Day)
+	if len(forecasts) == 0 {
+		return nil
+	}
+
+	return &forecasts[0]
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	services "github.com/diwise/api-opendata/internal/pkg/application/services/weather"
+	"github.com/diwise/api-opendata/internal/pkg/application/timeseries"
 	"github.com/diwise/api-opendata/internal/pkg/domain"
 	"github.com/go-chi/chi/v5"
 	"github.com/matryer/is"
@@ -21,7 +22,7 @@ func TestInvokeWeatherHandler(t *testing.T) {
 	req, err := http.NewRequest("GET", "http://diwise.io/api/weather?coordinates=[0.0,0.0]", nil)
 	is.NoErr(err)
 
-	NewRetrieveWeatherHandler(context.Background(), svc).ServeHTTP(rw, req)
+	NewRetrieveWeatherHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
 
 	is.Equal(rw.Code, http.StatusOK)  // response status should be 200 OK
 	is.Equal(len(tsqm.GetCalls()), 1) // Get should have been called once
@@ -32,13 +33,61 @@ func TestThatCoordinatesAreExtractedFromGetParameters(t *testing.T) {
 	svc, tsqm := defaultWeatherServiceMock()
 	req, _ := http.NewRequest("GET", "http://diwise.io/api/weather?coordinates=[0.0,0.0]", nil)
 
-	NewRetrieveWeatherHandler(context.Background(), svc).ServeHTTP(rw, req)
+	NewRetrieveWeatherHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
 
 	is.Equal(len(tsqm.NearPointCalls()), 1) // NearPoint should have been called once
 	is.Equal(tsqm.NearPointCalls()[0].Lat, 0.0)
 	is.Equal(tsqm.NearPointCalls()[0].Lon, 0.0)
 }
 
+func TestThatListCanIncludeAggregatedHistory(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, tsqm := defaultWeatherServiceMock()
+	req, _ := http.NewRequest("GET", "/api/weather?coordinates=[17.3,62.4]&timeAt=2010-01-01T12:13:14Z&endTimeAt=2010-01-02T12:13:14Z&aggr=hour", nil)
+
+	NewRetrieveWeatherHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(len(tsqm.BetweenTimesCalls()), 1)
+	is.Equal(tsqm.BetweenTimesCalls()[0].From, time.Date(2010, 1, 1, 12, 13, 14, 0, time.UTC))
+	is.Equal(tsqm.AggrCalls()[0].Res, "hour")
+}
+
+func TestThatListWithUnknownAggregationFails(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, tsqm := defaultWeatherServiceMock()
+	req, _ := http.NewRequest("GET", "/api/weather?coordinates=[17.3,62.4]&aggr=fortnight", nil)
+
+	NewRetrieveWeatherHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusBadRequest) // an unknown aggregation should be rejected
+	is.Equal(len(tsqm.GetCalls()), 0)
+}
+
+func TestThatListWithInvalidTimeSpanFails(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, tsqm := defaultWeatherServiceMock()
+	tsqm.GetFunc = func(ctx context.Context) ([]domain.Weather, error) {
+		return nil, fmt.Errorf("%w: the time span is too long", services.ErrInvalidQuery)
+	}
+	req, _ := http.NewRequest("GET", "/api/weather?coordinates=[17.3,62.4]&timeAt=2010-01-01T00:00:00Z&endTimeAt=2011-01-01T00:00:00Z", nil)
+
+	NewRetrieveWeatherHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusBadRequest) // an invalid time span should be rejected
+}
+
+func TestThatListWithoutTimeSpanOnlyIncludesLatestValues(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, tsqm := defaultWeatherServiceMock()
+	req, _ := http.NewRequest("GET", "/api/weather?coordinates=[17.3,62.4]", nil)
+
+	NewRetrieveWeatherHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(len(tsqm.BetweenTimesCalls()), 0)
+}
+
 func TestThatTimeSpanIsExtractedFromGetParameters(t *testing.T) {
 	is, _, rw := setup(t)
 	svc, tsqm := defaultWeatherServiceMock()
@@ -84,6 +133,68 @@ func TestThatFailingGetGeneratesInternalServerError(t *testing.T) {
 	is.Equal(rw.Code, http.StatusInternalServerError) // response status should be 500 ISE
 }
 
+func TestThatDefaultCentreIsUsedWithoutCoordinates(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, tsqm := defaultWeatherServiceMock()
+	req, _ := http.NewRequest("GET", "http://diwise.io/api/weather", nil)
+
+	NewRetrieveWeatherHandler(context.Background(), svc, *domain.NewPoint(63.0, 18.0)).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(tsqm.NearPointCalls()[0].Lat, 63.0)
+	is.Equal(tsqm.NearPointCalls()[0].Lon, 18.0)
+}
+
+func TestThatUnknownWeatherStationReturnsNotFound(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, tsqm := defaultWeatherServiceMock()
+	tsqm.GetByIDFunc = func(ctx context.Context) (domain.Weather, error) { return domain.Weather{}, services.ErrNotFound }
+	req, _ := http.NewRequest("GET", "/{id}", nil)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "unknown")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	NewRetrieveWeatherByIDHandler(context.Background(), svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusNotFound)
+}
+
+func TestThatWeatherStationsAreListed(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, _ := defaultWeatherServiceMock()
+	req, _ := http.NewRequest("GET", "/api/weather/stations", nil)
+
+	NewRetrieveWeatherStationsHandler(context.Background(), svc).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(rw.Body.String(), `{"data":[{"id":"urn:ngsi-ld:WeatherObserved:1","location":{"type":"Point","coordinates":[17.3,62.39]},"dateObserved":"2023-11-10T15:04:49Z"}]}`)
+}
+
+func TestThatForecastsCanBeRetrievedPerDay(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, _ := defaultWeatherServiceMock()
+	req, _ := http.NewRequest("GET", "/api/weather/forecasts?coordinates=[17.47,62.43]&aggr=day", nil)
+
+	NewRetrieveWeatherForecastsHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusOK)
+	is.Equal(svc.GetForecastsCalls()[0].Resolution, timeseries.Day)
+	is.Equal(svc.GetForecastsCalls()[0].MaxDistance, int64(10000)) // forecasts should be searched for within 10 km by default
+	is.Equal(svc.GetForecastsCalls()[0].Lat, 62.43)
+	is.Equal(rw.Body.String(), `{"data":[{"location":{"type":"Point","coordinates":[17.47,62.43]},"dateIssued":"2023-06-01T12:00:00Z","forecasts":[{"validFrom":"2023-06-01T22:00:00Z","validTo":"2023-06-02T22:00:00Z","temperature":24}]}]}`)
+}
+
+func TestThatForecastsCanNotBeAggregatedByMonth(t *testing.T) {
+	is, _, rw := setup(t)
+	svc, _ := defaultWeatherServiceMock()
+	req, _ := http.NewRequest("GET", "/api/weather/forecasts?aggr=month", nil)
+
+	NewRetrieveWeatherForecastsHandler(context.Background(), svc, *domain.NewPoint(62.390802, 17.306982)).ServeHTTP(rw, req)
+
+	is.Equal(rw.Code, http.StatusBadRequest)
+}
+
 // #################################################
 
 func setup(t *testing.T) (*is.I, context.Context, *httptest.ResponseRecorder) {
@@ -119,5 +230,24 @@ func defaultWeatherServiceMock() (*services.WeatherServiceMock, *services.Weathe
 		QueryFunc: func() services.WeatherServiceQuery {
 			return tsqm
 		},
+		GetForecastsFunc: func(lat, lon float64, maxDistance int64, resolution timeseries.Resolution) []domain.WeatherForecast {
+			temperature := 24.0
+			return []domain.WeatherForecast{{
+				Location:   *domain.NewPoint(62.43, 17.47),
+				DateIssued: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+				Forecasts: []domain.WeatherForecastPeriod{{
+					ValidFrom:   time.Date(2023, 6, 1, 22, 0, 0, 0, time.UTC),
+					ValidTo:     time.Date(2023, 6, 2, 22, 0, 0, 0, time.UTC),
+					Temperature: &temperature,
+				}},
+			}}
+		},
+		GetStationsFunc: func() []domain.WeatherStation {
+			return []domain.WeatherStation{{
+				ID:           "urn:ngsi-ld:WeatherObserved:1",
+				Location:     *domain.NewPoint(62.39, 17.3),
+				DateObserved: time.Date(2023, 11, 10, 15, 4, 49, 0, time.UTC),
+			}}
+		},
 	}, tsqm
 }
@@ -0,0 +1,133 @@
+package presentation
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+const (
+	StatusOK       string = "ok"
+	StatusDegraded string = "degraded"
+	StatusDisabled string = "disabled"
+)
+
+// IntegrationStatus is the health of a single integration, as reported by /health
+type IntegrationStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Details is an optional, integration specific, breakdown of the status
+	Details any `json:"details,omitempty"`
+}
+
+// healthRegistry keeps track of the status of each integration that has been set up.
+// An integration is disabled if its configuration is invalid, and degraded if it runs
+// with reduced functionality.
+type healthRegistry struct {
+	mu           sync.Mutex
+	integrations map[string]IntegrationStatus
+	checks       map[string]func() (any, error)
+}
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{
+		integrations: map[string]IntegrationStatus{},
+		checks:       map[string]func() (any, error){},
+	}
+}
+
+// check registers a function that is called on every report to get the current details
+// of an integration. An error from the function marks an otherwise healthy integration
+// as degraded. The function must not block.
+func (h *healthRegistry) check(name string, fn func() (any, error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = fn
+}
+
+func (h *healthRegistry) ok(name string) {
+	h.set(name, StatusOK, nil)
+}
+
+func (h *healthRegistry) degraded(name string, err error) {
+	h.set(name, StatusDegraded, err)
+}
+
+func (h *healthRegistry) disabled(name string, err error) {
+	h.set(name, StatusDisabled, err)
+}
+
+func (h *healthRegistry) set(name, status string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// never let a later ok hide an earlier problem with the same integration
+	if current, ok := h.integrations[name]; ok && current.Status != StatusOK && status == StatusOK {
+		return
+	}
+
+	s := IntegrationStatus{Name: name, Status: status}
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	h.integrations[name] = s
+}
+
+// report returns the overall status along with the status of each integration, sorted by name
+func (h *healthRegistry) report() (string, []IntegrationStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := StatusOK
+	integrations := make([]IntegrationStatus, 0, len(h.integrations))
+
+	for name, s := range h.integrations {
+		if check, ok := h.checks[name]; ok {
+			details, err := check()
+			s.Details = details
+
+			if err != nil && s.Status == StatusOK {
+				s.Status = StatusDegraded
+				s.Error = err.Error()
+			}
+		}
+
+		if s.Status != StatusOK {
+			status = StatusDegraded
+		}
+		integrations = append(integrations, s)
+	}
+
+	sort.Slice(integrations, func(i, j int) bool { return integrations[i].Name < integrations[j].Name })
+
+	return status, integrations
+}
+
+// newHealthHandler responds with the status of all integrations. A degraded api still
+// serves the datasets that are healthy, so the response code is always 200.
+func (h *healthRegistry) newHealthHandler() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, integrations := h.report()
+
+		body, err := json.Marshal(struct {
+			Status       string              `json:"status"`
+			Integrations []IntegrationStatus `json:"integrations"`
+		}{
+			Status:       status,
+			Integrations: integrations,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	})
+}
@@ -0,0 +1,72 @@
+package presentation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+)
+
+func TestThatHealthIsDegradedWhenAnIntegrationFails(t *testing.T) {
+	is := is.New(t)
+
+	health := newHealthRegistry()
+	health.ok("weather")
+	health.degraded("roadaccidents", errors.New("failed to load districts"))
+	health.ok("roadaccidents")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	health.newHealthHandler().ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Body.String(), `{"status":"degraded","integrations":[`+
+		`{"name":"roadaccidents","status":"degraded","error":"failed to load districts"},`+
+		`{"name":"weather","status":"ok"}]}`)
+}
+
+func TestThatChecksCanDegradeAnIntegration(t *testing.T) {
+	is := is.New(t)
+
+	health := newHealthRegistry()
+	health.ok("airqualities")
+	health.check("airqualities", func() (any, error) {
+		return []string{"station1"}, errors.New("the details of 1 of 1 stations could not be refreshed")
+	})
+
+	status, integrations := health.report()
+
+	is.Equal(status, StatusDegraded)
+	is.Equal(integrations[0].Status, StatusDegraded)
+	is.Equal(integrations[0].Details, []string{"station1"})
+}
+
+func TestThatMisconfiguredStratsysIsDisabledInsteadOfExiting(t *testing.T) {
+	is := is.New(t)
+
+	t.Setenv("DIWISE_CONTEXT_BROKER_URL", "http://localhost:1026")
+	t.Setenv("ENABLED_SERVICES", "stratsys")
+	t.Setenv("STRATSYS_COMPANY_CODE", "")
+
+	r := chi.NewRouter()
+	newOpendataAPI(context.Background(), r, nil, nil, strings.NewReader("not;a;valid\norganisations file"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.True(strings.Contains(w.Body.String(), `{"name":"organisations","status":"degraded"`))
+	is.True(strings.Contains(w.Body.String(), `{"name":"stratsys","status":"disabled","error":"failed to create stratsys client:`))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/api/stratsys/publishedreports", nil)
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusNotFound) // the routes of a disabled integration should not be registered
+}